@@ -1,8 +0,0 @@
-package common
-
-var (
-	// info about this node
-	Password string
-	CP       string
-	SK       string
-)
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gridprotocol/computing-api/computing/config"
+	"github.com/gridprotocol/computing-api/computing/model"
+	"github.com/gridprotocol/computing-api/computing/server/httpserver"
+	"github.com/gridprotocol/computing-api/lib/passwd"
+	"github.com/urfave/cli/v2"
+)
+
+// env holding the admin token by default
+const adminTokenEnv = "COMPUTING_ADMIN_TOKEN"
+
+// flags to reach the admin api, the token is never given on the command line
+var adminFlags = append([]cli.Flag{
+	&cli.StringFlag{
+		Name:  "url",
+		Usage: "url of the admin api, http listener is used if admin listener is not set",
+		Value: "",
+	},
+	&cli.StringFlag{
+		Name:  "token-file",
+		Usage: "file holding the admin token in its first line",
+		Value: "",
+	},
+	&cli.StringFlag{
+		Name:  "token-env",
+		Usage: "env holding the admin token, sign with the provider wallet if neither the file nor the env is set",
+		Value: adminTokenEnv,
+	},
+}, passwordFlags()...)
+
+var AdminCmd = &cli.Command{
+	Name:  "admin",
+	Usage: "operate orders through the admin api of the gateway",
+	Flags: adminFlags,
+	Subcommands: []*cli.Command{
+		adminResetCmd,
+		adminSettleCmd,
+	},
+}
+
+// reset an order
+var adminResetCmd = &cli.Command{
+	Name:  "reset",
+	Usage: "reset an order to active with new probation and duration",
+	Flags: []cli.Flag{
+		&cli.Uint64Flag{
+			Name:     "id",
+			Usage:    "order id",
+			Required: true,
+		},
+		&cli.Uint64Flag{
+			Name:  "prob",
+			Usage: "probation in second",
+		},
+		&cli.Uint64Flag{
+			Name:  "dur",
+			Usage: "duration in second",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		return adminPost(ctx, "/reset", model.AdminOrderRequest{
+			ID:   ctx.Uint64("id"),
+			Prob: ctx.Uint64("prob"),
+			Dur:  ctx.Uint64("dur"),
+		})
+	},
+}
+
+// settle an order
+var adminSettleCmd = &cli.Command{
+	Name:  "settle",
+	Usage: "settle an order to retrieve the remuneration",
+	Flags: []cli.Flag{
+		&cli.Uint64Flag{
+			Name:     "id",
+			Usage:    "order id",
+			Required: true,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		return adminPost(ctx, "/settle", model.AdminOrderRequest{ID: ctx.Uint64("id")})
+	},
+}
+
+// post an admin request with the token or the signature of provider wallet
+func adminPost(ctx *cli.Context, route string, req model.AdminOrderRequest) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return printAdmin(ctx, "POST", route, "", body)
+}
+
+// send an admin request and print the response
+func printAdmin(ctx *cli.Context, method, route, query string, body []byte) error {
+	res, err := adminRequest(ctx, method, route, query, body, 5*time.Minute)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("admin request failed with status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// send a request to the admin api authorized by the token or the signature of provider wallet,
+// the body of the response is closed by the caller. No timeout if timeout is 0.
+func adminRequest(ctx *cli.Context, method, route, query string, body []byte, timeout time.Duration) (*http.Response, error) {
+	base := ctx.String("url")
+	if base == "" {
+		listen := config.GetConfig().Admin.Listen
+		if listen == "" {
+			listen = config.GetConfig().Http.Listen
+		}
+		base = "http://" + strings.Replace(listen, "0.0.0.0", "localhost", 1)
+	}
+	path := httpserver.AdminPrefix + route
+
+	url := strings.TrimRight(base, "/") + path
+	if query != "" {
+		url += "?" + query
+	}
+	hreq, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+
+	token, err := readAdminToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer passwd.Zero(token)
+
+	if len(token) > 0 {
+		hreq.Header.Set("Authorization", "Bearer "+string(token))
+	} else {
+		// sign with the provider wallet
+		sg, err := walletSigner(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ts, sig, err := httpserver.SignAdminRequest(method, path, query, body, sg)
+		if err != nil {
+			return nil, err
+		}
+		hreq.Header.Set(httpserver.AdminTsHeader, ts)
+		hreq.Header.Set(httpserver.AdminSigHeader, sig)
+	}
+
+	hc := &http.Client{Timeout: timeout}
+	return hc.Do(hreq)
+}
+
+// read the admin token by the flags, nil if neither the file nor the env is set,
+// it should be zeroed by passwd.Zero after use
+func readAdminToken(ctx *cli.Context) ([]byte, error) {
+	src := passwd.Source{
+		File: ctx.String("token-file"),
+		Env:  ctx.String("token-env"),
+	}
+	if src.File == "" && (src.Env == "" || os.Getenv(src.Env) == "") {
+		// not asked on the terminal
+		return nil, nil
+	}
+
+	token, err := src.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read admin token failed: %s", err.Error())
+	}
+	return token, nil
+}
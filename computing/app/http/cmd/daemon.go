@@ -13,17 +13,13 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/grid/contracts/eth"
-	"github.com/grid/contracts/eth/contracts"
-	com "github.com/gridprotocol/computing-api/common"
 	"github.com/gridprotocol/computing-api/common/version"
 	"github.com/gridprotocol/computing-api/computing/config"
 	"github.com/gridprotocol/computing-api/computing/gateway"
 	"github.com/gridprotocol/computing-api/computing/gateway/remote"
 	"github.com/gridprotocol/computing-api/computing/server/httpserver"
-	"github.com/gridprotocol/computing-api/keystore"
 	"github.com/gridprotocol/computing-api/lib/logc"
+	"github.com/gridprotocol/computing-api/lib/webhook"
 	"github.com/gridprotocol/computing-api/prover"
 	"github.com/mitchellh/go-homedir"
 	"github.com/urfave/cli/v2"
@@ -44,6 +40,7 @@ var DaemonCmd = &cli.Command{
 	Subcommands: []*cli.Command{
 		runCmd,
 		stopCmd,
+		dbCmd,
 	},
 }
 
@@ -51,7 +48,7 @@ var DaemonCmd = &cli.Command{
 var runCmd = &cli.Command{
 	Name:  "run",
 	Usage: "run server",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		&cli.BoolFlag{
 			Name:    "test",
 			Aliases: []string{"t"},
@@ -61,35 +58,21 @@ var runCmd = &cli.Command{
 		&cli.StringFlag{
 			Name:    "chain",
 			Aliases: []string{"c"},
-			Usage:   "chain to interactivate, local: use local test chain, sepo: use sepo test chain",
+			Usage:   "name of the chain in config to interactivate, e.g. local or sepo",
 			Value:   "local",
 		},
-		&cli.StringFlag{
-			Name:    "password",
-			Aliases: []string{"pw"},
-			Usage:   "password of current wallet",
-			Value:   "computing",
-		},
-	},
+	}, passwordFlags()...),
 	Action: func(ctx *cli.Context) error {
 		test := ctx.Bool("test")
 		chain := ctx.String("chain")
-		pw := ctx.String("pw")
 
-		// get wallet and sk from keystore
-		repo := keystore.Repo
-		wallet := config.GetConfig().Remote.Wallet
-		ki, err := repo.Get(wallet, pw)
+		// signer of the wallet, the key is held by it only
+		sg, err := walletSigner(ctx)
 		if err != nil {
-			fmt.Println("get key info from wallet failed: ", err.Error())
+			fmt.Println(err.Error())
 			return err
 		}
 
-		// save all info into common
-		com.Password = pw
-		com.CP = wallet
-		com.SK = ki.SK()
-
 		validator_url := config.GetConfig().Validator.Url
 
 		// check version
@@ -98,87 +81,74 @@ var runCmd = &cli.Command{
 		}
 		log.Println("Current Version:", version.CurrentVersion())
 
-		// new provder and start
+		// chain select for remote gw, its chain id is checked with the rpcs
+		ch, client, err := remote.SelectChain(ctx.Context, chain)
+		if err != nil {
+			log.Fatalf("select chain %s: %s\n", chain, err)
+		}
+		logger.Debugf("chain: %+v\n", ch)
+
+		// make a gw object
+		gw := gateway.NewComputingGateway(client, ch, sg, test)
+		// close db
+		defer gw.Close()
+
+		// new provder of the registered nodes and start
 		logger.Info("starting prover")
-		prover, err := prover.NewGRIDProver(chain, validator_url, ki.SK(), 1)
+		pv, err := prover.NewGRIDProver(chain, validator_url, sg)
 		if err != nil {
 			log.Fatalf("new light node prover: %s\n", err)
 		}
-		go prover.Start(context.Background())
-
-		// chain select for remote gw
-		var chain_endpoint string
-		switch chain {
-		case "local":
-			chain_endpoint = eth.Ganache
-
-			// load all addresses from json
-			logger.Debug("load addresses")
-			// loading contracts
-			l := contracts.Local{}
-			l.Load()
-			logger.Debugf("%+v\n", l)
-
-			if l.Market == "" || l.Access == "" || l.Credit == "" || l.Registry == "" {
-				logger.Debug("all contract addresses must exist in json file")
+		pv.SetNodeSource(func(ctx context.Context) ([]int64, error) {
+			ids, err := gw.Nodes(ctx)
+			if err != nil {
+				return nil, err
+			}
+			res := make([]int64, len(ids))
+			for i, id := range ids {
+				res[i] = int64(id)
 			}
-			// save address
-			remote.MarketAddr = common.HexToAddress(l.Market)
-			remote.AccessAddr = common.HexToAddress(l.Access)
-			remote.CreditAddr = common.HexToAddress(l.Credit)
-			remote.RegistryAddr = common.HexToAddress(l.Registry)
-
-		case "sepo":
-			chain_endpoint = eth.Sepolia
-
-			// load all addresses from json
-			logger.Debug("load addresses")
-			// loading contracts
-			s := contracts.Sepo{}
-			s.Load()
-			logger.Debugf("%+v\n", s)
-
-			if s.Market == "" || s.Access == "" || s.Credit == "" || s.Registry == "" {
-				logger.Debug("all contract addresses must exist in json file")
+			return res, nil
+		})
+		// the nodes without active orders are skipped
+		pv.SetOrderSource(func(ctx context.Context) (map[int64]int64, error) {
+			counts, err := gw.NodeOrders()
+			if err != nil {
+				return nil, err
 			}
-			// save address
-			remote.MarketAddr = common.HexToAddress(s.Market)
-			remote.AccessAddr = common.HexToAddress(s.Access)
-			remote.CreditAddr = common.HexToAddress(s.Credit)
-			remote.RegistryAddr = common.HexToAddress(s.Registry)
-
-		case "dev":
-			chain_endpoint = eth.DevChain
-
-			// load all addresses from json
-			logger.Debug("load addresses")
-			// loading contracts
-			d := contracts.Dev{}
-			d.Load()
-			logger.Debugf("%+v\n", d)
-
-			if d.Market == "" || d.Access == "" || d.Credit == "" || d.Registry == "" {
-				logger.Debug("all contract addresses must exist in json file")
+			res := make(map[int64]int64, len(counts))
+			for id, n := range counts {
+				res[int64(id)] = n
 			}
-			// save address
-			remote.MarketAddr = common.HexToAddress(d.Market)
-			remote.AccessAddr = common.HexToAddress(d.Access)
-			remote.CreditAddr = common.HexToAddress(d.Credit)
-			remote.RegistryAddr = common.HexToAddress(d.Registry)
-
-		default:
-			log.Fatal("unsupport chain")
+			return res, nil
+		})
+		pcfg := config.GetConfig().Prover
+		keep := time.Duration(pcfg.KeepDays) * 24 * time.Hour
+		pv.SetDB(gw.Database(), keep)
+		alertAfter := pcfg.AlertAfter
+		if alertAfter == 0 {
+			alertAfter = 3
 		}
+		pv.SetAlert(alertAfter, func(a prover.Alert) {
+			hook := config.GetConfig().Webhook
+			if hook.Url == "" {
+				return
+			}
+			if err := webhook.Send(hook.Url, hook.Secret, a); err != nil {
+				logger.Warn("webhook of prover alert is not delivered: ", err)
+			}
+		})
+		go pv.Start(ctx.Context)
 
-		// make a gw object
-		gw := gateway.NewComputingGateway(chain_endpoint, test)
-		// close db
-		defer gw.Close()
+		// follow the market logs, reorgs are rolled back and replayed
+		go gw.Watch(ctx.Context)
+		// reclaim the value log space
+		go gw.RunGC(ctx.Context)
 
 		logger.Debug("listen address: ", config.GetConfig().Http.Listen)
 
 		// make an httpserver with listen addr and gw object
-		svr := httpserver.NewServer(config.GetConfig().Http.Listen, gw)
+		svr := httpserver.NewServer(config.GetConfig().Http.Listen, gw, pv.RegisterRoutes)
 		// statr server
 		go func() {
 			if err := svr.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -186,6 +156,21 @@ var runCmd = &cli.Command{
 			}
 		}()
 
+		// operator api on a distinct listener
+		var adminSvr *http.Server
+		if addr := config.GetConfig().Admin.Listen; addr != "" {
+			logger.Debug("admin listen address: ", addr)
+			adminSvr, err = httpserver.NewAdminServer(addr, gw)
+			if err != nil {
+				log.Fatalf("fail to make admin server: %v", err)
+			}
+			go func() {
+				if err := adminSvr.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					log.Fatalf("fail to start serving admin api: %v", err)
+				}
+			}()
+		}
+
 		// todo: add order expire check for all users
 
 		// notify signal to chan
@@ -196,6 +181,9 @@ var runCmd = &cli.Command{
 		// quit signal received adn end app
 		log.Println("Shutting down gateway...")
 
+		// cancel the proofs in progress
+		pv.Stop()
+
 		// ctx
 		cctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
@@ -204,6 +192,11 @@ var runCmd = &cli.Command{
 		if err := svr.Shutdown(cctx); err != nil {
 			log.Fatal("Server forced to shutdown: ", err)
 		}
+		if adminSvr != nil {
+			if err := adminSvr.Shutdown(cctx); err != nil {
+				log.Fatal("Admin server forced to shutdown: ", err)
+			}
+		}
 
 		return nil
 	},
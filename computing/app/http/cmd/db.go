@@ -0,0 +1,320 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gridprotocol/computing-api/computing/config"
+	"github.com/gridprotocol/computing-api/computing/server/httpserver"
+	"github.com/gridprotocol/computing-api/lib/kv"
+	"github.com/urfave/cli/v2"
+)
+
+// maintain the db of the gateway, it's opened directly if the daemon is stopped,
+// or it's reached through the admin api of the running daemon
+var dbCmd = &cli.Command{
+	Name:  "db",
+	Usage: "backup, restore, gc and inspect the gateway db",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  "db",
+			Usage: "path of the db, Local.DBPath in config by default",
+			Value: "",
+		},
+	}, adminFlags...),
+	Subcommands: []*cli.Command{
+		dbBackupCmd,
+		dbRestoreCmd,
+		dbGCCmd,
+		dbInspectCmd,
+	},
+}
+
+var dbBackupCmd = &cli.Command{
+	Name:  "backup",
+	Usage: "back up the db in the badger streaming format, the running daemon keeps serving",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "out",
+			Usage: "backup file",
+			Value: "gateway-db-" + time.Now().Format("20060102-150405") + ".bak",
+		},
+		&cli.Uint64Flag{
+			Name:  "since",
+			Usage: "back up the versions after it only, the version printed by the last backup",
+			Value: 0,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		out := ctx.String("out")
+		since := ctx.Uint64("since")
+
+		// written to a temp file, a broken backup never takes the name
+		tmp := out + ".tmp"
+		f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp)
+		defer f.Close()
+
+		var version uint64
+		db, err := openDB(ctx)
+		switch {
+		case err == nil:
+			version, err = db.Backup(f, since)
+			db.Close()
+			if err != nil {
+				return fmt.Errorf("backup db failed: %s", err.Error())
+			}
+		case errors.Is(err, kv.ErrLocked):
+			version, err = onlineBackup(ctx, f, since)
+			if err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		if err := f.Sync(); err != nil {
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, out); err != nil {
+			return err
+		}
+
+		fmt.Printf("backup db to %s, version: %d, back up the later ones with --since %d\n", out, version, version)
+		return nil
+	},
+}
+
+// back up through the admin api of the running daemon
+func onlineBackup(ctx *cli.Context, w io.Writer, since uint64) (uint64, error) {
+	fmt.Println("db is used by the daemon, back up through its admin api")
+
+	res, err := adminRequest(ctx, "GET", "/db/backup", "since="+strconv.FormatUint(since, 10), nil, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(res.Body)
+		return 0, fmt.Errorf("backup failed with status %d: %s", res.StatusCode, data)
+	}
+
+	if _, err := io.Copy(w, res.Body); err != nil {
+		return 0, fmt.Errorf("receive backup failed: %s", err.Error())
+	}
+
+	// the trailer is read after the body
+	v := res.Trailer.Get(httpserver.BackupVersionTrailer)
+	if v == "" {
+		return 0, fmt.Errorf("backup is broken by the daemon, see its log")
+	}
+	return strconv.ParseUint(v, 10, 64)
+}
+
+var dbRestoreCmd = &cli.Command{
+	Name:  "restore",
+	Usage: "restore a backup into the db, the daemon must be stopped",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "in",
+			Usage:    "backup file",
+			Required: true,
+		},
+		&cli.BoolFlag{
+			Name:  "force",
+			Usage: "restore into a db with keys, the keys in backup overwrite the ones in db",
+			Value: false,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		f, err := os.Open(ctx.String("in"))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		db, err := openDB(ctx)
+		switch {
+		case errors.Is(err, kv.ErrNoDB):
+			db, err = kv.NewDatabase(dbPath(ctx))
+			if err != nil {
+				return err
+			}
+		case errors.Is(err, kv.ErrLocked):
+			return fmt.Errorf("db is used by the daemon, stop it before restore")
+		case err != nil:
+			return err
+		}
+		defer db.Close()
+
+		empty, err := db.Empty()
+		if err != nil {
+			return err
+		}
+		if !empty && !ctx.Bool("force") {
+			return fmt.Errorf("db %s is not empty, restore into it with --force", dbPath(ctx))
+		}
+
+		if err := db.Restore(f); err != nil {
+			return fmt.Errorf("restore db failed: %s", err.Error())
+		}
+
+		fmt.Printf("restored %s into db %s\n", ctx.String("in"), dbPath(ctx))
+		return nil
+	},
+}
+
+var dbGCCmd = &cli.Command{
+	Name:  "gc",
+	Usage: "reclaim the space of the value log",
+	Action: func(ctx *cli.Context) error {
+		db, err := openDB(ctx)
+		if errors.Is(err, kv.ErrLocked) {
+			return printAdmin(ctx, "POST", "/db/gc", "", nil)
+		}
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		ratio := config.GetConfig().Local.GCRatio
+		if ratio <= 0 || ratio >= 1 {
+			ratio = 0.5
+		}
+		n, err := db.GC(ratio)
+		if err != nil {
+			return fmt.Errorf("value log gc failed: %s", err.Error())
+		}
+
+		lsm, vlog := db.Size()
+		fmt.Printf("value log gc rewrote %d files, lsm size: %d, vlog size: %d\n", n, lsm, vlog)
+		return nil
+	},
+}
+
+var dbInspectCmd = &cli.Command{
+	Name:  "inspect",
+	Usage: "dump the keys with a prefix in readable form",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "prefix",
+			Usage: "prefix of keys, e.g. o/ for orders, watch/ for the log watchers",
+			Value: "",
+		},
+		&cli.StringFlag{
+			Name:  "after",
+			Usage: "hex of the key to read after, printed as next by the last page",
+			Value: "",
+		},
+		&cli.IntFlag{
+			Name:  "limit",
+			Usage: "keys in a page",
+			Value: 100,
+		},
+		&cli.BoolFlag{
+			Name:  "all",
+			Usage: "read all pages",
+			Value: false,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		after, err := hex.DecodeString(strings.TrimPrefix(ctx.String("after"), "0x"))
+		if err != nil {
+			return fmt.Errorf("invalid after: %s", err.Error())
+		}
+		prefix := []byte(ctx.String("prefix"))
+		limit := ctx.Int("limit")
+
+		var page func(prefix, after []byte, limit int) ([]kv.Entry, []byte, error)
+		db, err := openDB(ctx)
+		switch {
+		case err == nil:
+			defer db.Close()
+			page = db.Page
+		case errors.Is(err, kv.ErrLocked):
+			page = func(prefix, after []byte, limit int) ([]kv.Entry, []byte, error) {
+				return onlinePage(ctx, prefix, after, limit)
+			}
+		default:
+			return err
+		}
+
+		for {
+			entries, next, err := page(prefix, after, limit)
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				fmt.Printf("%s\t%s\n", kv.HumanKey(e.Key), kv.HumanValue(e.Value))
+			}
+			if next == nil {
+				return nil
+			}
+			if !ctx.Bool("all") {
+				fmt.Printf("next: --after %x\n", next)
+				return nil
+			}
+			after = next
+		}
+	},
+}
+
+// read a page through the admin api of the running daemon
+func onlinePage(ctx *cli.Context, prefix, after []byte, limit int) ([]kv.Entry, []byte, error) {
+	q := url.Values{}
+	q.Set("prefix", string(prefix))
+	q.Set("after", hex.EncodeToString(after))
+	q.Set("limit", strconv.Itoa(limit))
+
+	res, err := adminRequest(ctx, "GET", "/db/inspect", q.Encode(), nil, time.Minute)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("inspect failed with status %d: %s", res.StatusCode, data)
+	}
+
+	var p httpserver.DBPage
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, nil, err
+	}
+	next, err := hex.DecodeString(p.Next)
+	if err != nil || len(next) == 0 {
+		return p.Entries, nil, err
+	}
+	return p.Entries, next, nil
+}
+
+func dbPath(ctx *cli.Context) string {
+	if p := ctx.String("db"); p != "" {
+		return p
+	}
+	return config.GetConfig().Local.DBPath
+}
+
+// open the db if it's not used by the daemon
+func openDB(ctx *cli.Context) (*kv.Database, error) {
+	return kv.Open(dbPath(ctx))
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gridprotocol/computing-api/lib/passwd"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	// envs holding the password of wallet and the new one by default
+	passwordEnv    = "COMPUTING_PASSWORD"
+	newPasswordEnv = "COMPUTING_NEW_PASSWORD"
+)
+
+// flags to read the password of wallet, it's never given on the command line
+func passwordFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "password-file",
+			Usage: "file holding the password of wallet in its first line",
+			Value: "",
+		},
+		&cli.StringFlag{
+			Name:  "password-env",
+			Usage: "env holding the password of wallet, it's asked on the terminal if the env is not set",
+			Value: passwordEnv,
+		},
+	}
+}
+
+// flags to read the new password of wallet
+func newPasswordFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "new-password-file",
+			Usage: "file holding the new password of wallet in its first line",
+			Value: "",
+		},
+		&cli.StringFlag{
+			Name:  "new-password-env",
+			Usage: "env holding the new password of wallet, it's asked on the terminal if the env is not set",
+			Value: newPasswordEnv,
+		},
+	}
+}
+
+// read the password of wallet by the flags, it should be zeroed by passwd.Zero after use.
+// A new password is asked twice on the terminal and can't be empty.
+func readPassword(ctx *cli.Context, isNew bool) ([]byte, error) {
+	src := passwd.Source{
+		File:    ctx.String("password-file"),
+		Env:     ctx.String("password-env"),
+		Prompt:  "Password",
+		Confirm: isNew,
+	}
+	return readFrom(src, "--password-file", isNew)
+}
+
+// read the new password of wallet by the flags, it should be zeroed by passwd.Zero after use
+func readNewPassword(ctx *cli.Context) ([]byte, error) {
+	src := passwd.Source{
+		File:    ctx.String("new-password-file"),
+		Env:     ctx.String("new-password-env"),
+		Prompt:  "New password",
+		Confirm: true,
+	}
+	return readFrom(src, "--new-password-file", true)
+}
+
+func readFrom(src passwd.Source, fileFlag string, isNew bool) ([]byte, error) {
+	pw, err := src.Read()
+	if errors.Is(err, passwd.ErrNoPassword) {
+		return nil, fmt.Errorf("%s, set it by %s or the env %s", err.Error(), fileFlag, src.Env)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if isNew && len(pw) == 0 {
+		return nil, fmt.Errorf("the password of the wallet must be given")
+	}
+	return pw, nil
+}
@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/gridprotocol/computing-api/lib/auth"
+	"github.com/gridprotocol/computing-api/keystore/signer"
 	"github.com/gridprotocol/computing-api/lib/utils"
 	"github.com/urfave/cli/v2"
 )
@@ -13,37 +13,40 @@ import (
 var SignCmd = &cli.Command{
 	Name:  "sign",
 	Usage: "sign with a ts to get a cookie",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		&cli.StringFlag{
 			Name:  "sk",
-			Usage: "set the sk to sign",
+			Usage: "set the sk to sign, the signer of current wallet is used if it's empty",
 			Value: "",
 		},
-	},
+	}, passwordFlags()...),
 	Action: func(ctx *cli.Context) error {
-		sk := ctx.String("sk")
+		var sg signer.Signer
+		var err error
+		if sk := ctx.String("sk"); sk != "" {
+			sg, err = signer.HexToSigner(sk)
+		} else {
+			sg, err = walletSigner(ctx)
+		}
+		if err != nil {
+			return err
+		}
 
 		// get current timestamp
 		timestamp := time.Now().Unix()
 		ts := utils.Uint64ToString(uint64(timestamp))
 
-		// enclose ts and calc hash
-		hash := auth.Hash([]byte(auth.EncloseEth(ts)))
-
-		// sign with hash and sk
-		sig, err := auth.Sign(hash, sk)
+		// sign the ts as an eth message
+		sig, err := sg.SignText([]byte(ts))
 		if err != nil {
-			panic(err)
+			return err
 		}
 		// to string
 		strSig := hex.EncodeToString(sig)
 		fmt.Printf("ts: %s, sig: %s\n", ts, strSig)
 
-		// get address
-		address := hex.EncodeToString(auth.SigToAddress(hash, sig))
-
 		fmt.Println("cookie request:")
-		fmt.Printf("http://localhost:12346/greet/cookie?ts=%s&user=0x%s&sig=0x%s\n", ts, address, strSig)
+		fmt.Printf("http://localhost:12346/greet/cookie?ts=%s&user=%s&sig=0x%s\n", ts, sg.Address().Hex(), strSig)
 
 		return nil
 	},
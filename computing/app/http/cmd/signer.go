@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gridprotocol/computing-api/computing/config"
+	"github.com/gridprotocol/computing-api/keystore"
+	"github.com/gridprotocol/computing-api/keystore/signer"
+	"github.com/gridprotocol/computing-api/lib/passwd"
+	"github.com/urfave/cli/v2"
+)
+
+// the signer of the provider wallet, it's the external signer in config if set,
+// or the key in keystore decrypted by the password read by the flags
+func walletSigner(ctx *cli.Context) (signer.Signer, error) {
+	rc := config.GetConfig().Remote
+	if rc.Signer != "" {
+		if !common.IsHexAddress(rc.Wallet) {
+			return nil, fmt.Errorf("invalid wallet address %q for the external signer", rc.Wallet)
+		}
+		return signer.NewExternal(rc.Signer, common.HexToAddress(rc.Wallet), 0)
+	}
+
+	pw, err := readPassword(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer passwd.Zero(pw)
+
+	repo, err := keystore.OpenRepo()
+	if err != nil {
+		return nil, err
+	}
+	s, err := keystore.NewSigner(repo, rc.Wallet, pw)
+	if err != nil {
+		return nil, fmt.Errorf("get key info from wallet failed: %s", err.Error())
+	}
+	return s, nil
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gridprotocol/computing-api/prover/validator"
+	"github.com/urfave/cli/v2"
+)
+
+// a local validator for the prover in development
+var ValidatorCmd = &cli.Command{
+	Name:  "validator",
+	Usage: "run a local validator issuing challenges and verifying proofs for development",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "listen",
+			Usage: "listen address, Validator.Url in config should point to it",
+			Value: "localhost:8081",
+		},
+		&cli.IntFlag{
+			Name:  "prepare",
+			Usage: "prepare interval of a cycle in second",
+			Value: 10,
+		},
+		&cli.IntFlag{
+			Name:  "prove",
+			Usage: "prove interval of a cycle in second, proofs are accepted in it",
+			Value: 10,
+		},
+		&cli.IntFlag{
+			Name:  "wait",
+			Usage: "wait interval of a cycle in second",
+			Value: 100,
+		},
+		&cli.IntFlag{
+			Name:  "difficulty",
+			Usage: "leading zero bits of the proof hash",
+			Value: 10,
+		},
+		&cli.IntFlag{
+			Name:  "max-skew",
+			Usage: "proofs signed more than it in second before or after now are rejected",
+			Value: 30,
+		},
+		&cli.Int64Flag{
+			Name:  "orders",
+			Usage: "order count of every provider",
+			Value: 1,
+		},
+		&cli.StringSliceFlag{
+			Name:  "provider",
+			Usage: "order count of a provider in address=count, overrides --orders",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		v := validator.New(validator.Config{
+			PrepareInterval: time.Duration(ctx.Int("prepare")) * time.Second,
+			ProveInterval:   time.Duration(ctx.Int("prove")) * time.Second,
+			WaitInterval:    time.Duration(ctx.Int("wait")) * time.Second,
+			Difficulty:      ctx.Int("difficulty"),
+			DefaultOrders:   ctx.Int64("orders"),
+			MaxSkew:         time.Duration(ctx.Int("max-skew")) * time.Second,
+		})
+
+		for _, pc := range ctx.StringSlice("provider") {
+			addr, cnt, ok := strings.Cut(pc, "=")
+			if !ok {
+				return fmt.Errorf("invalid provider %s, it should be address=count", pc)
+			}
+			n, err := strconv.ParseInt(cnt, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid order count of provider %s: %s", addr, err.Error())
+			}
+			v.SetOrderCount(addr, n)
+		}
+
+		svr := v.NewServer(ctx.String("listen"))
+		go func() {
+			if err := svr.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("fail to serve validator: %v", err)
+			}
+		}()
+		log.Println("validator listening on", ctx.String("listen"))
+
+		sctx, stop := signal.NotifyContext(ctx.Context, syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		<-sctx.Done()
+
+		cctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return svr.Shutdown(cctx)
+	},
+}
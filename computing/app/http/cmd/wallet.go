@@ -3,9 +3,11 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/gridprotocol/computing-api/computing/config"
 	"github.com/gridprotocol/computing-api/keystore"
+	"github.com/gridprotocol/computing-api/lib/passwd"
 	"github.com/urfave/cli/v2"
 )
 
@@ -26,10 +28,12 @@ var WalletCmd = &cli.Command{
 	Subcommands: []*cli.Command{
 		initCmd,
 		importCmd,
+		exportCmd,
 		showCmd,
 		useCmd,
 		listCmd,
 		delCmd,
+		changePasswordCmd,
 	},
 }
 
@@ -37,20 +41,13 @@ var WalletCmd = &cli.Command{
 var initCmd = &cli.Command{
 	Name:  "init",
 	Usage: "create a new wallet",
-	Flags: []cli.Flag{
-		&cli.StringFlag{
-			Name:    "password",
-			Aliases: []string{"pw"},
-			Usage:   "set the key password",
-			Value:   "computing",
-		},
-	},
+	Flags: passwordFlags(),
 	Action: func(ctx *cli.Context) error {
-		pw := ctx.String("pw")
-
-		if pw == "" {
-			return fmt.Errorf("the password of the wallet must be given")
+		pw, err := readPassword(ctx, true)
+		if err != nil {
+			return err
 		}
+		defer passwd.Zero(pw)
 
 		logger.Debug("new keystore")
 		// keystore
@@ -79,11 +76,11 @@ var initCmd = &cli.Command{
 	},
 }
 
-// import a wallet with an sk
+// import a wallet with an sk or a keyfile
 var importCmd = &cli.Command{
 	Name:  "import",
-	Usage: "import a wallet with an sk",
-	Flags: []cli.Flag{
+	Usage: "import a wallet with an sk, or a web3 v3 keyfile of geth, metamask or foundry",
+	Flags: append([]cli.Flag{
 		&cli.StringFlag{
 			Name:    "secretkey",
 			Aliases: []string{"sk"},
@@ -91,22 +88,24 @@ var importCmd = &cli.Command{
 			Value:   "",
 		},
 		&cli.StringFlag{
-			Name:    "password",
-			Aliases: []string{"pw"},
-			Usage:   "set the key password",
-			Value:   "computing",
+			Name:  "keyfile",
+			Usage: "path of the keyfile encrypted by the password",
+			Value: "",
 		},
-	},
+	}, passwordFlags()...),
 	Action: func(ctx *cli.Context) error {
 		sk := ctx.String("sk")
-		pw := ctx.String("pw")
+		keyfile := ctx.String("keyfile")
 
-		if sk == "" {
-			return fmt.Errorf("a sk must be given")
+		if (sk == "") == (keyfile == "") {
+			return fmt.Errorf("either a sk or a keyfile must be given")
 		}
-		if pw == "" {
-			return fmt.Errorf("the password of the wallet must be given")
+		// the password of keyfile is kept, a new one is asked twice
+		pw, err := readPassword(ctx, keyfile == "")
+		if err != nil {
+			return err
 		}
+		defer passwd.Zero(pw)
 
 		// keystore
 		ks, err := keystore.NewKeyStore(RepoPath)
@@ -115,13 +114,28 @@ var importCmd = &cli.Command{
 		}
 
 		// key
-		ki, err := keystore.Import(sk)
-		if err != nil {
-			return err
+		var ki *keystore.KeyInfo
+		if keyfile != "" {
+			keyjson, err := os.ReadFile(keyfile)
+			if err != nil {
+				return err
+			}
+			ki, err = keystore.ImportKeyV3(keyjson, pw)
+			if err != nil {
+				return fmt.Errorf("decrypt keyfile failed: %s", err.Error())
+			}
+		} else {
+			ki, err = keystore.Import(sk)
+			if err != nil {
+				return err
+			}
 		}
 
 		// store key into keyjson
-		ks.Put(ki.Address(), pw, *ki)
+		if err := ks.Put(ki.Address(), pw, *ki); err != nil {
+			return err
+		}
+		fmt.Println("wallet imported: ", ki.Address())
 
 		// set address
 		config.GetConfig().Remote.Wallet = ki.Address()
@@ -132,6 +146,74 @@ var importCmd = &cli.Command{
 	},
 }
 
+// export a wallet into a standard web3 v3 keyfile
+var exportCmd = &cli.Command{
+	Name:  "export",
+	Usage: "export a wallet into a web3 v3 keyfile encrypted by the password, for geth, metamask or foundry",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:    "address",
+			Aliases: []string{"addr"},
+			Usage:   "wallet address, current wallet by default",
+			Value:   "",
+		},
+		&cli.StringFlag{
+			Name:  "out",
+			Usage: "path of the keyfile, it's not overwritten",
+			Value: "",
+		},
+	}, passwordFlags()...),
+	Action: func(ctx *cli.Context) error {
+		addr := ctx.String("address")
+		out := ctx.String("out")
+
+		if addr == "" {
+			addr = config.GetConfig().Remote.Wallet
+		}
+		if out == "" {
+			return fmt.Errorf("the path of the keyfile must be given")
+		}
+
+		pw, err := readPassword(ctx, false)
+		if err != nil {
+			return err
+		}
+		defer passwd.Zero(pw)
+
+		// keystore
+		ks, err := keystore.NewKeyStore(RepoPath)
+		if err != nil {
+			return err
+		}
+
+		// key
+		ki, err := ks.Get(addr, pw)
+		if err != nil {
+			return err
+		}
+
+		keyjson, err := keystore.ExportKeyV3(ki, pw, keystore.StandardScryptN, keystore.StandardScryptP)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(keyjson); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		fmt.Printf("wallet %s exported to %s\n", addr, out)
+
+		return nil
+	},
+}
+
 // select an address to use
 var useCmd = &cli.Command{
 	Name:  "use",
@@ -179,28 +261,27 @@ var useCmd = &cli.Command{
 var showCmd = &cli.Command{
 	Name:  "show",
 	Usage: "show the sk of an account",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		&cli.StringFlag{
 			Name:    "address",
 			Aliases: []string{"addr"},
 			Usage:   "address",
 			Value:   "",
 		},
-		&cli.StringFlag{
-			Name:    "password",
-			Aliases: []string{"pw"},
-			Usage:   "set the key password",
-			Value:   "computing",
-		},
-	},
+	}, passwordFlags()...),
 	Action: func(ctx *cli.Context) error {
 		addr := ctx.String("address")
-		pw := ctx.String("pw")
 
 		if addr == "" {
 			return fmt.Errorf("a sk must be given")
 		}
 
+		pw, err := readPassword(ctx, false)
+		if err != nil {
+			return err
+		}
+		defer passwd.Zero(pw)
+
 		// keystore
 		ks, err := keystore.NewKeyStore(RepoPath)
 		if err != nil {
@@ -214,6 +295,7 @@ var showCmd = &cli.Command{
 		}
 
 		fmt.Println("sk: ", ki.SK())
+		passwd.Zero(ki.SecretKey)
 
 		return nil
 	},
@@ -248,28 +330,27 @@ var listCmd = &cli.Command{
 var delCmd = &cli.Command{
 	Name:  "delete",
 	Usage: "delete a wallet",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		&cli.StringFlag{
 			Name:    "address",
 			Aliases: []string{"addr"},
 			Usage:   "address",
 			Value:   "",
 		},
-		&cli.StringFlag{
-			Name:    "password",
-			Aliases: []string{"pw"},
-			Usage:   "set the key password",
-			Value:   "computing",
-		},
-	},
+	}, passwordFlags()...),
 	Action: func(ctx *cli.Context) error {
 		addr := ctx.String("address")
-		pw := ctx.String("pw")
 
 		if addr == "" {
 			return fmt.Errorf("an wallet address must be given")
 		}
 
+		pw, err := readPassword(ctx, false)
+		if err != nil {
+			return err
+		}
+		defer passwd.Zero(pw)
+
 		// keystore
 		ks, err := keystore.NewKeyStore(RepoPath)
 		if err != nil {
@@ -285,3 +366,64 @@ var delCmd = &cli.Command{
 		return nil
 	},
 }
+
+// re-encrypt wallets with a new password
+var changePasswordCmd = &cli.Command{
+	Name:  "change-password",
+	Usage: "change the password of a wallet, or all wallets with the same password",
+	Flags: append(append([]cli.Flag{
+		&cli.StringFlag{
+			Name:    "address",
+			Aliases: []string{"addr"},
+			Usage:   "wallet address, current wallet by default",
+			Value:   "",
+		},
+		&cli.BoolFlag{
+			Name:  "all",
+			Usage: "change all wallets, none is changed if any can't be decrypted by the password",
+			Value: false,
+		},
+	}, passwordFlags()...), newPasswordFlags()...),
+	Action: func(ctx *cli.Context) error {
+		addr := ctx.String("address")
+		all := ctx.Bool("all")
+
+		if addr == "" {
+			addr = config.GetConfig().Remote.Wallet
+		}
+
+		// keystore
+		ks, err := keystore.NewKeyStore(RepoPath)
+		if err != nil {
+			return err
+		}
+
+		names := []string{addr}
+		if all {
+			names, err = ks.List()
+			if err != nil {
+				return err
+			}
+		}
+
+		pw, err := readPassword(ctx, false)
+		if err != nil {
+			return err
+		}
+		defer passwd.Zero(pw)
+
+		newPw, err := readNewPassword(ctx)
+		if err != nil {
+			return err
+		}
+		defer passwd.Zero(newPw)
+
+		err = ks.ChangePassword(pw, newPw, names...)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("password of %d wallet(s) changed\n", len(names))
+
+		return nil
+	},
+}
@@ -15,6 +15,8 @@ func main() {
 	local = append(local, cmd.VersionCmd)
 	local = append(local, cmd.WalletCmd)
 	local = append(local, cmd.SignCmd)
+	local = append(local, cmd.AdminCmd)
+	local = append(local, cmd.ValidatorCmd)
 
 	app := cli.App{
 		Commands: local,
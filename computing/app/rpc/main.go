@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 	"net"
 	"os"
@@ -10,29 +12,33 @@ import (
 	"github.com/gridprotocol/computing-api/common/version"
 	"github.com/gridprotocol/computing-api/computing/config"
 	"github.com/gridprotocol/computing-api/computing/gateway"
+	"github.com/gridprotocol/computing-api/computing/gateway/remote"
 	"github.com/gridprotocol/computing-api/computing/proto"
 	"github.com/gridprotocol/computing-api/computing/server/rpcserver"
 
 	"google.golang.org/grpc"
 )
 
-var gw *gateway.ComputingGateway
-
 var (
-	test = false // for local test, no k8s deployment required
+	test  = false // for local test, no k8s deployment required
+	chain = flag.String("chain", "local", "name of the chain in config to interactivate, e.g. local or sepo")
 )
 
-// make a geteway object with remote and local
-func init() {
+func main() {
+	// flags are parsed by it
 	if version.CheckVersion() {
-		os.Exit(0)
+		return
 	}
 
-	// gw
-	gw = gateway.NewComputingGateway("ep", test)
-}
+	// chain in config
+	ch, client, err := remote.SelectChain(context.Background(), *chain)
+	if err != nil {
+		log.Fatalf("select chain %s: %v", *chain, err)
+	}
+
+	// make a geteway object with remote and local, it sends no tx
+	gw := gateway.NewComputingGateway(client, ch, nil, test)
 
-func main() {
 	lis, err := net.Listen("tcp", config.GetConfig().Grpc.Listen)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
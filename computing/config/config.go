@@ -5,11 +5,16 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/BurntSushi/toml"
+	"github.com/ethereum/go-ethereum/common"
 )
 
-var conf *GatewayConfig
+var (
+	confMu sync.Mutex
+	conf   *GatewayConfig
+)
 
 type GatewayConfig struct {
 	Grpc      Grpc
@@ -17,16 +22,24 @@ type GatewayConfig struct {
 	Local     Local
 	Remote    Remote
 	Validator Validator
+	Prover    Prover
+	Admin     Admin
+	Gas       Gas
+	Webhook   Webhook
+	Chains    []Chain `toml:"Chain"`
 }
 
 type Local struct {
 	DBPath     string
-	SignExpire int // signature expire time in second, 60s is suggested
+	SignExpire int     // signature expire time in second, 60s is suggested
+	GCInterval int     // interval of the value log gc of db in minute, 10 by default, negative to disable
+	GCRatio    float64 // value log files with more stale data than it are rewritten by gc, 0.5 by default
 }
 
 type Remote struct {
 	KeyStore string
 	Wallet   string
+	Signer   string // url of an external signer like clef holding the key of Wallet, the key in KeyStore is used if it's empty
 }
 
 type Grpc struct {
@@ -42,13 +55,100 @@ type Validator struct {
 	Url string
 }
 
-// load config.toml
-func init() {
-	// parse config file
-	err := InitConfig()
-	if err != nil {
-		log.Fatalf("failed to init the config: %v", err)
+// proofs of the nodes to the validator
+type Prover struct {
+	AlertAfter int // alert after this many consecutive failed cycles, 3 by default, negative to disable
+	KeepDays   int // records of the cycles are kept in db for days, 7 by default
+}
+
+// gas policy of the txs sent by the gateway, zero for the default
+type Gas struct {
+	MarginPercent uint64 // gas limit is the estimated gas with this margin, 120 by default
+	MaxFeeGwei    uint64 // cap of the max fee per gas
+	MaxTipGwei    uint64 // cap of the priority fee per gas
+	ResubmitSec   int    // replace a pending tx with higher fees after it, 180 by default
+}
+
+// a chain the gateway works on, selected by name with daemon run --chain
+type Chain struct {
+	Name    string
+	Preset  string   // local, sepo or dev, the empty rpc and addresses are loaded from the preset of grid contracts
+	RPC     []string // rpc urls, requests go to the healthiest one and fail over to the others
+	ChainID uint64   // checked against the chain id reported by the rpcs at startup
+
+	// health of the rpcs, zero for the default
+	MaxBlockLag  uint64  // rpcs behind the highest block by more blocks are skipped, 5 by default
+	MaxErrorRate float64 // rpcs with a higher recent error rate are skipped, 0.5 by default
+	HealthSec    int     // interval of the health checks in second, 15 by default
+
+	Market   string
+	Access   string
+	Credit   string
+	Registry string
+
+	Confirmations uint64 // blocks on top of a tx or an order state for it to be final, 0 to trust the latest block
+	Gas           Gas    // gas policy on this chain, zero fields take the global [Gas]
+}
+
+// check the fields required for working on the chain
+func (c *Chain) Validate() error {
+	if len(c.RPC) == 0 {
+		return fmt.Errorf("no rpc url for chain %s", c.Name)
+	}
+	if c.ChainID == 0 {
+		return fmt.Errorf("chain id is required for chain %s", c.Name)
 	}
+
+	addrs := map[string]string{"market": c.Market, "access": c.Access, "credit": c.Credit, "registry": c.Registry}
+	for name, addr := range addrs {
+		if !common.IsHexAddress(addr) {
+			return fmt.Errorf("invalid %s address of chain %s: %q", name, c.Name, addr)
+		}
+	}
+
+	return nil
+}
+
+// gas policy on the chain, the zero fields take the global one
+func (c *Chain) GasPolicy(global Gas) Gas {
+	g := c.Gas
+	if g.MarginPercent == 0 {
+		g.MarginPercent = global.MarginPercent
+	}
+	if g.MaxFeeGwei == 0 {
+		g.MaxFeeGwei = global.MaxFeeGwei
+	}
+	if g.MaxTipGwei == 0 {
+		g.MaxTipGwei = global.MaxTipGwei
+	}
+	if g.ResubmitSec == 0 {
+		g.ResubmitSec = global.ResubmitSec
+	}
+	return g
+}
+
+// get the chain by name
+func (c *GatewayConfig) GetChain(name string) (*Chain, error) {
+	for i := range c.Chains {
+		if c.Chains[i].Name == name {
+			return &c.Chains[i], nil
+		}
+	}
+	return nil, fmt.Errorf("chain %s is not in config", name)
+}
+
+// notify the finished txs of the gateway, disabled if url is empty
+type Webhook struct {
+	Url    string // records of the finished txs and the prover alerts are posted to it
+	Secret string // body is signed with hmac-sha256 of it in header X-Webhook-Sig, if it is set
+}
+
+// operator api, reset and settle orders with the provider wallet
+type Admin struct {
+	Listen     string // serve the admin api on a distinct listener, empty to serve it on http listener with prefix /admin
+	Token      string // bearer token of the operator, empty to accept provider wallet signature only
+	SignExpire int    // expire of an admin request signature in second, 60s by default
+	AuditLog   string // file to append the audit trail of admin requests
 }
 
 // read and decode config file
@@ -67,10 +167,27 @@ func InitConfig() error {
 	return nil
 }
 
+// the config loaded from config.toml at first use, the process exits if it fails
 func GetConfig() *GatewayConfig {
+	confMu.Lock()
+	defer confMu.Unlock()
+
+	if conf == nil {
+		// parse config file
+		if err := InitConfig(); err != nil {
+			log.Fatalf("failed to init the config: %v", err)
+		}
+	}
 	return conf
 }
 
+// use c instead of config.toml, e.g. the config of tests
+func SetConfig(c *GatewayConfig) {
+	confMu.Lock()
+	defer confMu.Unlock()
+	conf = c
+}
+
 // 写回配置文件
 func WriteConf(conf *GatewayConfig) error {
 	// config path
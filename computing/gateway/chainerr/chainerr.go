@@ -0,0 +1,214 @@
+package chainerr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Code is the stable code of a chain failure in api responses
+type Code string
+
+const (
+	// reverted with a reason not known
+	CodeReverted Code = "CHAIN_REVERTED"
+	// failed by an assert, overflow, division by zero and so on in contract
+	CodePanic Code = "CHAIN_PANIC"
+
+	CodeOrderNotActive        Code = "ORDER_NOT_ACTIVE"
+	CodeOrderExpired          Code = "ORDER_EXPIRED"
+	CodeNotFound              Code = "NOT_FOUND"
+	CodeNotProvider           Code = "NOT_PROVIDER"
+	CodeNotUser               Code = "NOT_ORDER_USER"
+	CodeNotRegistered         Code = "NOT_REGISTERED"
+	CodeUnauthorized          Code = "UNAUTHORIZED"
+	CodeInsufficientBalance   Code = "INSUFFICIENT_BALANCE"
+	CodeInsufficientAllowance Code = "INSUFFICIENT_ALLOWANCE"
+	CodeInvalidArgument       Code = "INVALID_ARGUMENT"
+)
+
+// http status responsed for the code
+func (c Code) HTTPStatus() int {
+	switch c {
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeNotProvider, CodeNotUser, CodeNotRegistered, CodeUnauthorized:
+		return http.StatusForbidden
+	case CodeInsufficientBalance, CodeInsufficientAllowance:
+		return http.StatusPaymentRequired
+	case CodeOrderNotActive, CodeOrderExpired:
+		return http.StatusConflict
+	case CodeInvalidArgument:
+		return http.StatusBadRequest
+	case CodePanic:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
+
+// grpc code responsed for the code
+func (c Code) GRPCCode() codes.Code {
+	switch c {
+	case CodeNotFound:
+		return codes.NotFound
+	case CodeNotProvider, CodeNotUser, CodeNotRegistered, CodeUnauthorized:
+		return codes.PermissionDenied
+	case CodeInvalidArgument:
+		return codes.InvalidArgument
+	case CodePanic:
+		return codes.Internal
+	default:
+		return codes.FailedPrecondition
+	}
+}
+
+type Kind uint8
+
+const (
+	// reverted without data, or with data not decoded
+	KindUnknown Kind = iota
+	// Error(string) by require or revert
+	KindRevert
+	// custom error in the contract abi
+	KindCustom
+	// Panic(uint256)
+	KindPanic
+)
+
+// Error is a decoded revert of a contract call or tx
+type Error struct {
+	Code Code
+	Kind Kind
+	// name of the custom error, Error or Panic
+	Name string
+	// revert string, or the custom error with its args
+	Reason string
+	Args   []interface{}
+	// raw revert data
+	Data []byte
+
+	err error
+}
+
+func (e *Error) Error() string {
+	if e.Reason == "" {
+		return string(e.Code)
+	}
+	return "execution reverted: " + e.Reason
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// match the error of the same code, e.g. errors.Is(err, chainerr.ErrOrderNotActive)
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// the grpc status of the error, used by grpc when it's returned by a handler
+func (e *Error) GRPCStatus() *status.Status {
+	return status.New(e.Code.GRPCCode(), fmt.Sprintf("%s: %s", e.Code, e.Error()))
+}
+
+// errors to match a decoded error with errors.Is
+var (
+	ErrReverted              = &Error{Code: CodeReverted}
+	ErrPanic                 = &Error{Code: CodePanic}
+	ErrOrderNotActive        = &Error{Code: CodeOrderNotActive}
+	ErrOrderExpired          = &Error{Code: CodeOrderExpired}
+	ErrNotFound              = &Error{Code: CodeNotFound}
+	ErrNotProvider           = &Error{Code: CodeNotProvider}
+	ErrNotUser               = &Error{Code: CodeNotUser}
+	ErrNotRegistered         = &Error{Code: CodeNotRegistered}
+	ErrUnauthorized          = &Error{Code: CodeUnauthorized}
+	ErrInsufficientBalance   = &Error{Code: CodeInsufficientBalance}
+	ErrInsufficientAllowance = &Error{Code: CodeInsufficientAllowance}
+	ErrInvalidArgument       = &Error{Code: CodeInvalidArgument}
+)
+
+// turn err into a grpc status error with the code of the decoded error in its chain,
+// a timed out or cancelled call gets the code of its context, other errors are returned as is
+func GRPCError(err error) error {
+	ce, ok := As(err)
+	if !ok {
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			return status.Error(codes.DeadlineExceeded, err.Error())
+		case errors.Is(err, context.Canceled):
+			return status.Error(codes.Canceled, err.Error())
+		}
+		return err
+	}
+	return status.Error(ce.Code.GRPCCode(), fmt.Sprintf("%s: %s", ce.Code, err.Error()))
+}
+
+// get the decoded error in the chain of err
+func As(err error) (*Error, bool) {
+	var ce *Error
+	if errors.As(err, &ce) {
+		return ce, true
+	}
+	return nil, false
+}
+
+// keywords in the reason or the custom error name for the codes, with spaces,
+// punctuations, articles and cases ignored. The former ones are matched first.
+var reasonCodes = []struct {
+	key  string
+	code Code
+}{
+	{"allowance", CodeInsufficientAllowance},
+	{"insufficientbalance", CodeInsufficientBalance},
+	{"exceedsbalance", CodeInsufficientBalance},
+	{"notenoughbalance", CodeInsufficientBalance},
+	{"insufficientfund", CodeInsufficientBalance},
+	{"notprovider", CodeNotProvider},
+	{"onlyprovider", CodeNotProvider},
+	{"notuser", CodeNotUser},
+	{"onlyuser", CodeNotUser},
+	{"notregistered", CodeNotRegistered},
+	{"unregistered", CodeNotRegistered},
+	{"notowner", CodeUnauthorized},
+	{"onlyowner", CodeUnauthorized},
+	{"unauthorized", CodeUnauthorized},
+	{"notactiv", CodeOrderNotActive},
+	{"inactive", CodeOrderNotActive},
+	{"expired", CodeOrderExpired},
+	{"notexist", CodeNotFound},
+	{"nonexist", CodeNotFound},
+	{"notfound", CodeNotFound},
+	{"invalid", CodeInvalidArgument},
+}
+
+// words ignored in a reason, e.g. "is not the user" is "notuser"
+var fillers = map[string]bool{"a": true, "an": true, "the": true, "is": true, "are": true, "be": true}
+
+// map a revert reason or a custom error name to its code
+func Classify(reason string) Code {
+	words := strings.FieldsFunc(strings.ToLower(reason), func(r rune) bool {
+		return (r < 'a' || r > 'z') && (r < '0' || r > '9')
+	})
+	var sb strings.Builder
+	for _, w := range words {
+		if !fillers[w] {
+			sb.WriteString(w)
+		}
+	}
+	norm := sb.String()
+
+	for _, rc := range reasonCodes {
+		if strings.Contains(norm, rc.key) {
+			return rc.code
+		}
+	}
+
+	return CodeReverted
+}
@@ -0,0 +1,195 @@
+package chainerr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testABI = `[
+	{"type":"error","name":"OrderNotActive","inputs":[{"name":"id","type":"uint64"}]},
+	{"type":"error","name":"ERC20InsufficientBalance","inputs":[{"name":"sender","type":"address"},{"name":"balance","type":"uint256"},{"name":"needed","type":"uint256"}]},
+	{"type":"error","name":"Paused","inputs":[]}
+]`
+
+// error of a node carrying the revert data, as the rpc client returns
+type dataError struct {
+	msg  string
+	data interface{}
+}
+
+func (e *dataError) Error() string          { return e.msg }
+func (e *dataError) ErrorData() interface{} { return e.data }
+
+// revert data of Error(string) or Panic(uint256)
+func packError(t *testing.T, selector []byte, typ string, v interface{}) []byte {
+	data := common.CopyBytes(selector)
+	at, err := abi.NewType(typ, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, err := abi.Arguments{{Type: at}}.Pack(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(data, args...)
+}
+
+// revert data of a custom error in the abi
+func packCustom(t *testing.T, a abi.ABI, name string, args ...interface{}) []byte {
+	ae := a.Errors[name]
+	data, err := ae.Inputs.Pack(args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(common.CopyBytes(ae.ID[:4]), data...)
+}
+
+func newTestDecoder(t *testing.T) (*Decoder, abi.ABI) {
+	a, err := abi.JSON(strings.NewReader(testABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewDecoder(&a), a
+}
+
+func TestClassify(t *testing.T) {
+	cases := map[string]Code{
+		"order is not active":                CodeOrderNotActive,
+		"Market: order not activated":        CodeOrderNotActive,
+		"ERC20InsufficientBalance":           CodeInsufficientBalance,
+		"transfer amount exceeds balance":    CodeInsufficientBalance,
+		"ERC20InsufficientAllowance":         CodeInsufficientAllowance,
+		"only provider can settle":           CodeNotProvider,
+		"caller is not the user":             CodeNotUser,
+		"Market: provider is not registered": CodeNotRegistered,
+		"provider not registered":            CodeNotRegistered,
+		"OwnableUnauthorizedAccount":         CodeUnauthorized,
+		"order expired":                      CodeOrderExpired,
+		"node not exist":                     CodeNotFound,
+		"invalid duration":                   CodeInvalidArgument,
+		"something else":                     CodeReverted,
+	}
+	for reason, code := range cases {
+		if got := Classify(reason); got != code {
+			t.Errorf("%q: expected %s, got %s", reason, code, got)
+		}
+	}
+}
+
+func TestDecodeData(t *testing.T) {
+	d, a := newTestDecoder(t)
+
+	// Error(string)
+	e := d.DecodeData(packError(t, errorSelector, "string", "order is not active"))
+	if e.Kind != KindRevert || e.Reason != "order is not active" || e.Code != CodeOrderNotActive {
+		t.Fatalf("unexpected error: %+v", e)
+	}
+
+	// Panic(uint256)
+	e = d.DecodeData(packError(t, panicSelector, "uint256", big.NewInt(0x11)))
+	if e.Kind != KindPanic || e.Code != CodePanic || !strings.Contains(e.Reason, "overflow") {
+		t.Fatalf("unexpected error: %+v", e)
+	}
+
+	// custom errors
+	e = d.DecodeData(packCustom(t, a, "OrderNotActive", uint64(7)))
+	if e.Kind != KindCustom || e.Name != "OrderNotActive" || e.Code != CodeOrderNotActive || e.Reason != "OrderNotActive(7)" {
+		t.Fatalf("unexpected error: %+v", e)
+	}
+	if len(e.Args) != 1 || e.Args[0].(uint64) != 7 {
+		t.Fatalf("unexpected args: %v", e.Args)
+	}
+
+	e = d.DecodeData(packCustom(t, a, "ERC20InsufficientBalance", common.Address{1}, big.NewInt(1), big.NewInt(2)))
+	if e.Code != CodeInsufficientBalance || len(e.Args) != 3 {
+		t.Fatalf("unexpected error: %+v", e)
+	}
+
+	// no args, not known by name
+	e = d.DecodeData(packCustom(t, a, "Paused"))
+	if e.Kind != KindCustom || e.Reason != "Paused()" || e.Code != CodeReverted {
+		t.Fatalf("unexpected error: %+v", e)
+	}
+
+	// selector not in abis
+	e = d.DecodeData([]byte{1, 2, 3, 4, 5})
+	if e.Kind != KindUnknown || e.Code != CodeReverted || e.Reason != "0x0102030405" {
+		t.Fatalf("unexpected error: %+v", e)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	d, _ := newTestDecoder(t)
+
+	if d.Decode(nil) != nil {
+		t.Fatal("nil should be nil")
+	}
+
+	// not a revert
+	plain := errors.New("connection refused")
+	if d.Decode(plain) != plain {
+		t.Fatal("other errors should be returned as is")
+	}
+
+	// revert data in rpc error
+	raw := &dataError{
+		msg:  "execution reverted: only provider",
+		data: hexutil.Encode(packError(t, errorSelector, "string", "only provider")),
+	}
+	err := fmt.Errorf("estimate gas failed: %w", d.Decode(raw))
+	if !errors.Is(err, ErrNotProvider) || errors.Is(err, ErrNotUser) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !errors.Is(err, raw) {
+		t.Fatal("the node error should be wrapped")
+	}
+	ce, ok := As(err)
+	if !ok || ce.Code.HTTPStatus() != http.StatusForbidden {
+		t.Fatalf("unexpected error: %+v", ce)
+	}
+
+	// decoded once
+	if d.Decode(err) != err {
+		t.Fatal("decoded error should be returned as is")
+	}
+
+	// reason in message only
+	ce, ok = As(d.Decode(errors.New("execution reverted: order expired")))
+	if !ok || ce.Code != CodeOrderExpired || ce.Reason != "order expired" {
+		t.Fatalf("unexpected error: %+v", ce)
+	}
+	ce, ok = As(d.Decode(errors.New("execution reverted")))
+	if !ok || ce.Code != CodeReverted || ce.Kind != KindUnknown {
+		t.Fatalf("unexpected error: %+v", ce)
+	}
+
+	// grpc status
+	st, ok := status.FromError(GRPCError(err))
+	if !ok || st.Code() != codes.PermissionDenied || !strings.HasPrefix(st.Message(), string(CodeNotProvider)) {
+		t.Fatalf("unexpected grpc status: %v", st)
+	}
+}
+
+func TestGRPCErrorContext(t *testing.T) {
+	if c := status.Code(GRPCError(fmt.Errorf("call failed: %w", context.DeadlineExceeded))); c != codes.DeadlineExceeded {
+		t.Fatalf("unexpected code of a timeout: %s", c)
+	}
+	if c := status.Code(GRPCError(context.Canceled)); c != codes.Canceled {
+		t.Fatalf("unexpected code of a cancel: %s", c)
+	}
+	err := errors.New("other")
+	if GRPCError(err) != err {
+		t.Fatal("other errors should be returned as is")
+	}
+}
@@ -0,0 +1,191 @@
+package chainerr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/grid/contracts/go/credit"
+	"github.com/grid/contracts/go/market"
+	"github.com/grid/contracts/go/registry"
+	"github.com/gridprotocol/computing-api/lib/logc"
+)
+
+var logger = logc.Logger("chainerr")
+
+var (
+	errorSelector = crypto.Keccak256([]byte("Error(string)"))[:4]
+	panicSelector = crypto.Keccak256([]byte("Panic(uint256)"))[:4]
+)
+
+// message of node when a call is reverted
+const revertedMsg = "execution reverted"
+
+// Decoder decodes the revert data with the custom errors in abis
+type Decoder struct {
+	errs map[[4]byte]abi.Error
+}
+
+// make a decoder with the custom errors of abis, the former one wins for the same selector
+func NewDecoder(abis ...*abi.ABI) *Decoder {
+	d := &Decoder{errs: make(map[[4]byte]abi.Error)}
+	for _, a := range abis {
+		for _, e := range a.Errors {
+			var id [4]byte
+			copy(id[:], e.ID[:4])
+			if _, ok := d.errs[id]; !ok {
+				d.errs[id] = e
+			}
+		}
+	}
+	return d
+}
+
+var (
+	defaultOnce    sync.Once
+	defaultDecoder *Decoder
+)
+
+// decoder with the errors of the market, registry and credit contracts
+func Default() *Decoder {
+	defaultOnce.Do(func() {
+		var abis []*abi.ABI
+		for _, md := range []*bind.MetaData{market.MarketMetaData, registry.RegistryMetaData, credit.CreditMetaData} {
+			a, err := md.GetAbi()
+			if err != nil {
+				logger.Warn("get contract abi failed: ", err)
+				continue
+			}
+			abis = append(abis, a)
+		}
+		defaultDecoder = NewDecoder(abis...)
+	})
+	return defaultDecoder
+}
+
+// decode err with the default decoder
+func Decode(err error) error {
+	return Default().Decode(err)
+}
+
+// turn a reverted call or tx error into *Error wrapping it, other errors are returned as is
+func (d *Decoder) Decode(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := As(err); ok {
+		return err
+	}
+
+	if data := RevertData(err); len(data) > 0 {
+		e := d.DecodeData(data)
+		e.err = err
+		return e
+	}
+
+	// reverted without data, the reason may be in the message
+	msg := err.Error()
+	i := strings.Index(msg, revertedMsg)
+	if i < 0 {
+		return err
+	}
+	reason := strings.TrimPrefix(strings.TrimPrefix(msg[i+len(revertedMsg):], ":"), " ")
+	e := &Error{Code: CodeReverted, Kind: KindUnknown, err: err}
+	if reason != "" {
+		e.Kind = KindRevert
+		e.Name = "Error"
+		e.Reason = reason
+		e.Code = Classify(reason)
+	}
+	return e
+}
+
+// decode the revert data of a call or tx
+func (d *Decoder) DecodeData(data []byte) *Error {
+	e := &Error{Code: CodeReverted, Kind: KindUnknown, Data: data}
+	if len(data) < 4 {
+		e.Reason = hexutil.Encode(data)
+		return e
+	}
+
+	switch {
+	case bytes.Equal(data[:4], errorSelector):
+		reason, err := abi.UnpackRevert(data)
+		if err != nil {
+			break
+		}
+		e.Kind = KindRevert
+		e.Name = "Error"
+		e.Reason = reason
+		e.Code = Classify(reason)
+		return e
+	case bytes.Equal(data[:4], panicSelector):
+		reason, err := abi.UnpackRevert(data)
+		if err != nil {
+			break
+		}
+		e.Kind = KindPanic
+		e.Name = "Panic"
+		e.Reason = reason
+		e.Code = CodePanic
+		return e
+	default:
+		var id [4]byte
+		copy(id[:], data[:4])
+		ae, ok := d.errs[id]
+		if !ok {
+			break
+		}
+		v, err := ae.Unpack(data)
+		if err != nil {
+			break
+		}
+		args, _ := v.([]interface{})
+		e.Kind = KindCustom
+		e.Name = ae.Name
+		e.Args = args
+		e.Reason = formatCustom(ae, args)
+		e.Code = Classify(ae.Name)
+		return e
+	}
+
+	e.Reason = hexutil.Encode(data)
+	return e
+}
+
+// revert data carried by a call error, nil if there is none
+func RevertData(err error) []byte {
+	var de rpc.DataError
+	if !errors.As(err, &de) {
+		return nil
+	}
+
+	switch v := de.ErrorData().(type) {
+	case string:
+		data, err := hexutil.Decode(v)
+		if err != nil {
+			return nil
+		}
+		return data
+	case []byte:
+		return v
+	default:
+		return nil
+	}
+}
+
+// custom error in the form of Name(arg0, arg1)
+func formatCustom(ae abi.Error, args []interface{}) string {
+	strs := make([]string, len(args))
+	for i, a := range args {
+		strs[i] = fmt.Sprint(a)
+	}
+	return fmt.Sprintf("%s(%s)", ae.Name, strings.Join(strs, ", "))
+}
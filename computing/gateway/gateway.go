@@ -1,9 +1,14 @@
 package gateway
 
 import (
+	"context"
+	"time"
+
 	"github.com/gridprotocol/computing-api/computing/config"
 	"github.com/gridprotocol/computing-api/computing/gateway/local"
 	"github.com/gridprotocol/computing-api/computing/gateway/remote"
+	"github.com/gridprotocol/computing-api/computing/gateway/rpcpool"
+	"github.com/gridprotocol/computing-api/keystore/signer"
 	"github.com/gridprotocol/computing-api/lib/kv"
 	"github.com/gridprotocol/computing-api/lib/logc"
 )
@@ -19,7 +24,8 @@ type ComputingGateway struct {
 var logger = logc.Logger("gateway")
 
 // func NewComputingGateway(glp GatewayLocalProcessAPI, grp GatewayRemoteProcessAPI) *ComputingGateway {
-func NewComputingGateway(ep string, test bool) *ComputingGateway {
+// the txs of the provider are signed by sg, it can be nil if no tx is sent
+func NewComputingGateway(client *rpcpool.Pool, ch *config.Chain, sg signer.Signer, test bool) *ComputingGateway {
 	// new kv db for gw
 	db, err := kv.NewDatabase(config.GetConfig().Local.DBPath)
 	if err != nil {
@@ -28,7 +34,7 @@ func NewComputingGateway(ep string, test bool) *ComputingGateway {
 	}
 
 	// remote gw
-	grp := remote.NewGatewayRemoteProcess(ep, db)
+	grp := remote.NewGatewayRemoteProcess(client, ch, db, sg)
 
 	// local gw
 	var glp GatewayLocalProcessAPI
@@ -51,6 +57,31 @@ func StopTask() {
 	// delete: ingress + service + deployment + ReplicaSetsController + pods
 }
 
+// db of the gateway, for the maintenance of operators
+func (gw *ComputingGateway) Database() *kv.Database {
+	return gw.DB
+}
+
+// reclaim the value log space of db periodically until ctx is done
+func (gw *ComputingGateway) RunGC(ctx context.Context) {
+	cfg := config.GetConfig().Local
+	if cfg.GCInterval < 0 {
+		logger.Info("value log gc of db is disabled")
+		return
+	}
+
+	interval := time.Duration(cfg.GCInterval) * time.Minute
+	if interval == 0 {
+		interval = 10 * time.Minute
+	}
+	ratio := cfg.GCRatio
+	if ratio <= 0 || ratio >= 1 {
+		ratio = 0.5
+	}
+
+	gw.DB.RunGC(ctx, interval, ratio)
+}
+
 // close db for gw
 func (gw *ComputingGateway) Close() error {
 	return gw.DB.Close()
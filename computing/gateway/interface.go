@@ -1,7 +1,13 @@
 package gateway
 
 import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/grid/contracts/go/market"
+	"github.com/gridprotocol/computing-api/computing/gateway/txmgr"
 	"github.com/gridprotocol/computing-api/computing/model"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -19,11 +25,15 @@ type GatewayLocalProcessAPI interface {
 	AssessPower() model.Resources
 	//CalculateReward()
 	Authorize(user string, lease model.Lease) error
-	Deploy(deps []*appsv1.Deployment, svcs []*corev1.Service, user string) error
-	GetEntrance(user string) (string, error)
+	// deploy the app of an order and record it
+	Deploy(order *model.Order, deps []*appsv1.Deployment, svcs []*corev1.Service) error
+	// entrance of the order of user, the latest active order of user if id is 0
+	GetEntrance(id uint64, user string) (string, error)
+	// keep the status of an order read from chain
+	SetOrderStatus(id uint64, status uint8) error
 	// compute app after deployed
 	Compute(entrance string, input *model.ComputingInput, output *model.ComputingOutput) error
-	Terminate(user string) error
+	Terminate(id uint64) error
 	Close() error
 }
 
@@ -43,25 +53,39 @@ type GatewayRemoteProcessAPI interface {
 	//Activate(user string) error
 	//Deactivate(user string) error
 
-	// provider set the app name when deploy ok
-	SetApp(id uint64, app string) error
+	// provider set the app name when deploy ok, return the tx hash once it is sent
+	SetApp(id uint64, app string) (common.Hash, error)
 	//UserCancel(userAddr string, userSK string) error
-	// user renew an order
-	Extend(userSK string, id uint64, dur string) error
+	// build an unsigned tx for the user to renew an order
+	BuildExtend(user common.Address, id uint64, dur uint64) (*types.Transaction, *big.Int, error)
+	// verify and send the renew tx signed by the user, return the tx hash once it is sent
+	SendExtend(id uint64, rawTx []byte) (common.Hash, error)
+
+	// reset an order, return the tx hash once it is sent
+	Reset(id uint64, prob string, dur string) (common.Hash, error)
 
-	// reset an order
-	Reset(id uint64, prob string, dur string) error
+	// provider settle an order to retrieve remueration, return the tx hash once it is sent
+	Settle(id uint64) (common.Hash, error)
 
-	// provider settle an order to retrieve remueration
-	Settle(id uint64) error
+	// get the status of a tx sent by the gateway, with any hash of it
+	GetTx(hash common.Hash) (*txmgr.Record, error)
+	// wait until a tx sent by the gateway is finished
+	WaitTx(ctx context.Context, hash common.Hash) (*txmgr.Record, error)
 
 	// check the order's payee to be the provider itself
 	PayeeCheck(orderInfo market.IMarketOrder) (bool, error)
 	SetWatcher(contract string) error
+	// follow the market logs until ctx is done, reorgs are rolled back and replayed
+	Watch(ctx context.Context)
 
 	// get order with user and cp
 	GetOrder(id uint64) (*market.IMarketOrder, error)
 
 	// check order
 	OrderCheck(id uint64) (bool, error)
+
+	// ids of the nodes of the provider in the registry
+	Nodes(ctx context.Context) ([]uint64, error)
+	// active orders of each node, read from the market logs followed by Watch
+	NodeOrders() (map[uint64]int64, error)
 }
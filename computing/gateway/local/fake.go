@@ -38,14 +38,14 @@ func (filp *FakeImplementofLocalProcess) Authorize(user string, lease model.Leas
 	return nil
 }
 
-func (filp *FakeImplementofLocalProcess) Deploy(deps []*appsv1.Deployment, svcs []*corev1.Service, user string) error {
-	//key := prefixKey(user, entrancePrefix)
-	//filp.put(string(key), task)
+func (filp *FakeImplementofLocalProcess) Deploy(order *model.Order, deps []*appsv1.Deployment, svcs []*corev1.Service) error {
+	//key := orderKey(order.ID)
+	//filp.put(string(key), entrance)
 	return nil
 }
 
-func (filp *FakeImplementofLocalProcess) GetEntrance(user string) (string, error) {
-	key := prefixKey(user, entrancePrefix)
+func (filp *FakeImplementofLocalProcess) GetEntrance(id uint64, user string) (string, error) {
+	key := orderKey(id)
 	if ent, ok := filp.get(string(key)); !ok {
 		return "", fmt.Errorf("entrance is not found in test map")
 	} else {
@@ -53,11 +53,12 @@ func (filp *FakeImplementofLocalProcess) GetEntrance(user string) (string, error
 	}
 }
 
-func (filp *FakeImplementofLocalProcess) Terminate(user string) error {
-	key1 := prefixKey(user, entrancePrefix)
-	filp.delete(string(key1))
-	key2 := prefixKey(user, leasePrefix)
-	filp.delete(string(key2))
+func (filp *FakeImplementofLocalProcess) SetOrderStatus(id uint64, status uint8) error {
+	return nil
+}
+
+func (filp *FakeImplementofLocalProcess) Terminate(id uint64) error {
+	filp.delete(string(orderKey(id)))
 	return nil
 }
 
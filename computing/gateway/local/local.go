@@ -1,6 +1,7 @@
 package local
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/gridprotocol/computing-api/computing/config"
@@ -22,14 +23,18 @@ const (
 type GatewayLocalProcess struct {
 	signExpire int64
 
-	DB *kv.Database
+	DB     kv.Store
+	orders *OrderStore
 }
 
-func NewGatewayLocalProcess(db *kv.Database) *GatewayLocalProcess {
+func NewGatewayLocalProcess(db kv.Store) *GatewayLocalProcess {
 	glp := new(GatewayLocalProcess)
 
 	glp.signExpire = int64(config.GetConfig().Local.SignExpire)
 	glp.DB = db
+	// entrances in the old layout are migrated lazily, each is adopted by GetEntrance
+	// with the id of the order of its user, which is checked on chain by the caller
+	glp.orders = NewOrderStore(db)
 
 	return glp
 }
@@ -104,14 +109,15 @@ func (glp *GatewayLocalProcess) Authorize(user string, lease model.Lease) error
 // (flexiable, enable image change in the future, describe in the task file)
 // TODO: 1. consider the edge case: already deployed, but fail to put into database
 // TODO: 2. user -> lease -> resources -> yaml, which limits the resources a deployment uses
-func (glp *GatewayLocalProcess) Deploy(deps []*appsv1.Deployment, svcs []*corev1.Service, user string) error {
+// deploy the app of an order, the order is recorded with its entrance and deployed objects
+func (glp *GatewayLocalProcess) Deploy(order *model.Order, deps []*appsv1.Deployment, svcs []*corev1.Service) error {
 	// k8s deploy service
 
 	var ep *deploy.EndPoint
 	var err error
 
 	// deploy and create NodePort service
-	ep, err = deploy.Deploy(deps, svcs, user)
+	ep, err = deploy.Deploy(deps, svcs, order.User)
 
 	if err != nil {
 		logger.Error("fail to deploy: ", err)
@@ -122,8 +128,21 @@ func (glp *GatewayLocalProcess) Deploy(deps []*appsv1.Deployment, svcs []*corev1
 	entrance := fmt.Sprintf("http://localhost:%d", ep.NodePort)
 	fmt.Println("entrance:", entrance)
 
-	// record entrance
-	err = glp.DB.Put(prefixKey(user, entrancePrefix), []byte(entrance))
+	order.Entrance = entrance
+	order.Deployments = order.Deployments[:0]
+	for _, d := range deps {
+		order.Deployments = append(order.Deployments, d.Name)
+		if order.Namespace == "" {
+			order.Namespace = d.Namespace
+		}
+	}
+	order.Services = order.Services[:0]
+	for _, svc := range svcs {
+		order.Services = append(order.Services, svc.Name)
+	}
+
+	// record order
+	err = glp.orders.Put(order)
 	if err != nil {
 		// should delete deployment or pod
 		return err
@@ -131,26 +150,61 @@ func (glp *GatewayLocalProcess) Deploy(deps []*appsv1.Deployment, svcs []*corev1
 	return nil
 }
 
-func (glp *GatewayLocalProcess) GetEntrance(user string) (string, error) {
-	ent, err := glp.DB.Get(prefixKey(user, entrancePrefix))
+// entrance of the order of user, the latest active order of user if id is 0
+func (glp *GatewayLocalProcess) GetEntrance(id uint64, user string) (string, error) {
+	var (
+		o   *model.Order
+		err error
+	)
+	if id == 0 {
+		o, err = glp.orders.activeOf(user)
+	} else {
+		o, err = glp.orders.Get(id)
+	}
+
+	if errors.Is(err, ErrOrderNotFound) {
+		// deployed before the orders are kept by id
+		ent, ok, lerr := glp.orders.legacyEntrance(user)
+		if lerr != nil {
+			return "", lerr
+		}
+		if !ok {
+			return "", err
+		}
+		if id != 0 {
+			if aerr := glp.orders.adopt(id, user, ent); aerr != nil {
+				logger.Warn("adopt the old entrance of user ", user, " failed: ", aerr)
+			}
+		}
+		return ent, nil
+	}
 	if err != nil {
 		return "", err
 	}
-	return string(ent), nil
-}
 
-// delete outdated or canceled record
-// TODO: delete deployment and pod/service
-func (glp *GatewayLocalProcess) Terminate(user string) error {
-	keys := [][]byte{
-		prefixKey(user, entrancePrefix),
-		prefixKey(user, leasePrefix),
+	if !sameUser(o.User, user) {
+		return "", fmt.Errorf("order %d is not of user %s", o.ID, user)
 	}
-	err := glp.DB.MultiDelete(keys)
-	if err != nil {
-		return err
+	if o.Entrance == "" {
+		return "", fmt.Errorf("app of order %d is not deployed", o.ID)
 	}
-	return nil
+
+	return o.Entrance, nil
+}
+
+// keep the status of an order read from chain
+func (glp *GatewayLocalProcess) SetOrderStatus(id uint64, status uint8) error {
+	err := glp.orders.SetStatus(id, status)
+	if errors.Is(err, ErrOrderNotFound) {
+		return nil
+	}
+	return err
+}
+
+// delete outdated or canceled order
+// TODO: delete deployment and pod/service
+func (glp *GatewayLocalProcess) Terminate(id uint64) error {
+	return glp.orders.Delete(id)
 }
 
 func (glp *GatewayLocalProcess) Close() error {
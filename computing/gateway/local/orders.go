@@ -0,0 +1,316 @@
+package local
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gridprotocol/computing-api/computing/model"
+	"github.com/gridprotocol/computing-api/lib/kv"
+)
+
+var ErrOrderNotFound = errors.New("order is not found in local db")
+
+// key families of the order store
+const (
+	// order id -> order
+	orderPrefix = "o/"
+	// user/order id -> nil
+	userIndexPrefix = "ou/"
+	// status/order id -> nil
+	statusIndexPrefix = "os/"
+)
+
+// OrderStore keeps the orders served by the gateway in kv by id,
+// with the indexes by user and by status
+type OrderStore struct {
+	db kv.Store
+}
+
+func NewOrderStore(db kv.Store) *OrderStore {
+	return &OrderStore{db: db}
+}
+
+func orderKey(id uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte(orderPrefix), id)
+}
+
+// users are lower case in index, addresses in any case are the same user
+func userPrefix(user string) []byte {
+	return []byte(userIndexPrefix + strings.ToLower(user) + "/")
+}
+
+func userIndexKey(user string, id uint64) []byte {
+	return binary.BigEndian.AppendUint64(userPrefix(user), id)
+}
+
+func statusPrefix(status uint8) []byte {
+	return append([]byte(statusIndexPrefix), status, '/')
+}
+
+func statusIndexKey(status uint8, id uint64) []byte {
+	return binary.BigEndian.AppendUint64(statusPrefix(status), id)
+}
+
+// order id at the end of an index key
+func indexedID(key []byte) uint64 {
+	return binary.BigEndian.Uint64(key[len(key)-8:])
+}
+
+// get an order by id
+func (s *OrderStore) Get(id uint64) (*model.Order, error) {
+	has, err := s.db.Has(orderKey(id))
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, ErrOrderNotFound
+	}
+
+	val, err := s.db.Get(orderKey(id))
+	if err != nil {
+		return nil, err
+	}
+
+	o := new(model.Order)
+	if err := o.Decode(val); err != nil {
+		return nil, fmt.Errorf("decode order %d failed: %s", id, err.Error())
+	}
+	return o, nil
+}
+
+// save an order, the old indexes are read and replaced in one txn
+func (s *OrderStore) Put(o *model.Order) error {
+	return s.db.Txn(func(txn kv.Txn) error {
+		return putOrder(txn, o)
+	})
+}
+
+// write an order and its indexes in txn, the indexes of the saved one are deleted
+func putOrder(txn kv.Txn, o *model.Order) error {
+	old, err := txn.Get(orderKey(o.ID))
+	if err != nil && !errors.Is(err, kv.ErrNotFound) {
+		return err
+	}
+	if err == nil {
+		prev := new(model.Order)
+		if err := prev.Decode(old); err != nil {
+			return fmt.Errorf("decode order %d failed: %s", o.ID, err.Error())
+		}
+		if err := txn.Delete(userIndexKey(prev.User, prev.ID)); err != nil {
+			return err
+		}
+		if err := txn.Delete(statusIndexKey(prev.Status, prev.ID)); err != nil {
+			return err
+		}
+	}
+
+	o.Updated = time.Now().Unix()
+	val, err := o.Encode()
+	if err != nil {
+		return err
+	}
+
+	if err := txn.Put(orderKey(o.ID), val); err != nil {
+		return err
+	}
+	if err := txn.Put(userIndexKey(o.User, o.ID), nil); err != nil {
+		return err
+	}
+	return txn.Put(statusIndexKey(o.Status, o.ID), nil)
+}
+
+// change the status of an order
+func (s *OrderStore) SetStatus(id uint64, status uint8) error {
+	o, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if o.Status == status {
+		return nil
+	}
+	o.Status = status
+	return s.Put(o)
+}
+
+// delete an order and its indexes
+func (s *OrderStore) Delete(id uint64) error {
+	o, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	return s.db.MultiDelete([][]byte{orderKey(id), userIndexKey(o.User, id), statusIndexKey(o.Status, id)})
+}
+
+// iterate the orders in the order of id, stop when fn returns false
+func (s *OrderStore) Iterate(fn func(*model.Order) bool) error {
+	return s.db.Iterate([]byte(orderPrefix), func(key, value []byte) (bool, error) {
+		o := new(model.Order)
+		if err := o.Decode(value); err != nil {
+			return false, fmt.Errorf("decode order %x failed: %s", key, err.Error())
+		}
+		return fn(o), nil
+	})
+}
+
+// iterate the orders of a user in the order of id, stop when fn returns false
+func (s *OrderStore) IterateByUser(user string, fn func(*model.Order) bool) error {
+	return s.iterateIndex(userPrefix(user), fn)
+}
+
+// iterate the orders in a status in the order of id, stop when fn returns false
+func (s *OrderStore) IterateByStatus(status uint8, fn func(*model.Order) bool) error {
+	return s.iterateIndex(statusPrefix(status), fn)
+}
+
+// orders of a user
+func (s *OrderStore) ByUser(user string) ([]*model.Order, error) {
+	var res []*model.Order
+	err := s.IterateByUser(user, func(o *model.Order) bool {
+		res = append(res, o)
+		return true
+	})
+	return res, err
+}
+
+// orders in a status
+func (s *OrderStore) ByStatus(status uint8) ([]*model.Order, error) {
+	var res []*model.Order
+	err := s.IterateByStatus(status, func(o *model.Order) bool {
+		res = append(res, o)
+		return true
+	})
+	return res, err
+}
+
+func (s *OrderStore) iterateIndex(prefix []byte, fn func(*model.Order) bool) error {
+	// ids are collected first, the orders are read out of the index txn
+	var ids []uint64
+	err := s.db.Iterate(prefix, func(key, _ []byte) (bool, error) {
+		ids = append(ids, indexedID(key))
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		o, err := s.Get(id)
+		if err != nil {
+			if errors.Is(err, ErrOrderNotFound) {
+				// deleted after the index is read
+				continue
+			}
+			return err
+		}
+		if !fn(o) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// the latest active order of a user with an entrance
+func (s *OrderStore) activeOf(user string) (*model.Order, error) {
+	var found *model.Order
+	err := s.IterateByUser(user, func(o *model.Order) bool {
+		if o.Status == model.OrderActive && o.Entrance != "" {
+			found = o
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, ErrOrderNotFound
+	}
+	return found, nil
+}
+
+// move the entrances in the old layout, e<user> per user, to the orders of the ids resolved for the users.
+// The ones not resolved are kept, they are adopted by the order of the user read at first.
+// The l<user> leases are kept, they are the authorization of users.
+func (s *OrderStore) Migrate(resolve func(user string) (uint64, bool)) (int, error) {
+	if resolve == nil {
+		return 0, errors.New("no resolver of the orders of the old entrances")
+	}
+
+	type legacy struct {
+		user     string
+		entrance string
+	}
+
+	var olds []legacy
+	err := s.db.Iterate([]byte(entrancePrefix), func(key, value []byte) (bool, error) {
+		user := string(key[len(entrancePrefix):])
+		// keys of other families starting with the prefix
+		if !common.IsHexAddress(user) {
+			return true, nil
+		}
+		olds = append(olds, legacy{user: user, entrance: string(value)})
+		return true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, l := range olds {
+		id, ok := resolve(l.user)
+		if !ok {
+			logger.Info("order of the entrance of user ", l.user, " is not resolved, it's adopted at first read")
+			continue
+		}
+		if err := s.adopt(id, l.user, l.entrance); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+
+	logger.Info("migrated entrances: ", moved, ", kept: ", len(olds)-moved)
+	return moved, nil
+}
+
+// legacy entrance of a user in the old layout
+func (s *OrderStore) legacyEntrance(user string) (string, bool, error) {
+	key := prefixKey(user, entrancePrefix)
+	has, err := s.db.Has(key)
+	if err != nil || !has {
+		return "", false, err
+	}
+	val, err := s.db.Get(key)
+	if err != nil {
+		return "", false, err
+	}
+	return string(val), true, nil
+}
+
+// make the order of the legacy entrance of a user, and delete the legacy key
+func (s *OrderStore) adopt(id uint64, user, entrance string) error {
+	o, err := s.Get(id)
+	if err != nil {
+		if !errors.Is(err, ErrOrderNotFound) {
+			return err
+		}
+		o = &model.Order{ID: id, User: user, Status: model.OrderActive}
+	}
+	if o.Entrance == "" {
+		o.Entrance = entrance
+	}
+
+	return s.db.Txn(func(txn kv.Txn) error {
+		if err := putOrder(txn, o); err != nil {
+			return err
+		}
+		return txn.Delete(prefixKey(user, entrancePrefix))
+	})
+}
+
+// check an order is of the user, address in any case
+func sameUser(a, b string) bool {
+	return strings.EqualFold(a, b)
+}
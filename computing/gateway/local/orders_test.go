@@ -0,0 +1,192 @@
+package local
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gridprotocol/computing-api/computing/model"
+	"github.com/gridprotocol/computing-api/lib/kv"
+)
+
+const (
+	alice = "0x1111111111111111111111111111111111111111"
+	bob   = "0x2222222222222222222222222222222222222222"
+)
+
+func newDB(t *testing.T) kv.Store {
+	return kv.NewMemDatabase()
+}
+
+func ids(orders []*model.Order) []uint64 {
+	var res []uint64
+	for _, o := range orders {
+		res = append(res, o.ID)
+	}
+	return res
+}
+
+func equalIDs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestOrderStore(t *testing.T) {
+	s := NewOrderStore(newDB(t))
+
+	if _, err := s.Get(1); !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	// a user with two orders keeps both entrances
+	for _, o := range []*model.Order{
+		{ID: 1, User: alice, Entrance: "http://localhost:30001", Status: model.OrderActive},
+		{ID: 2, User: alice, Entrance: "http://localhost:30002", Status: model.OrderActive},
+		{ID: 300, User: bob, Entrance: "http://localhost:30003", Status: model.OrderUnactive},
+	} {
+		if err := s.Put(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	o, err := s.Get(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.User != alice || o.Entrance != "http://localhost:30002" || o.Updated == 0 {
+		t.Fatalf("unexpected order: %+v", o)
+	}
+
+	// user index in any case
+	orders, err := s.ByUser("0x1111111111111111111111111111111111111111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalIDs(ids(orders), []uint64{1, 2}) {
+		t.Fatalf("unexpected orders of alice: %v", ids(orders))
+	}
+
+	// status index follows the status
+	if err := s.SetStatus(300, model.OrderActive); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetStatus(1, model.OrderCompleted); err != nil {
+		t.Fatal(err)
+	}
+	active, err := s.ByStatus(model.OrderActive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalIDs(ids(active), []uint64{2, 300}) {
+		t.Fatalf("unexpected active orders: %v", ids(active))
+	}
+	unactive, err := s.ByStatus(model.OrderUnactive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unactive) != 0 {
+		t.Fatalf("stale status index: %v", ids(unactive))
+	}
+
+	// iteration stops
+	var seen []uint64
+	err = s.Iterate(func(o *model.Order) bool {
+		seen = append(seen, o.ID)
+		return len(seen) < 2
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalIDs(seen, []uint64{1, 2}) {
+		t.Fatalf("unexpected iteration: %v", seen)
+	}
+
+	// delete with indexes
+	if err := s.Delete(2); err != nil {
+		t.Fatal(err)
+	}
+	orders, _ = s.ByUser(alice)
+	active, _ = s.ByStatus(model.OrderActive)
+	if !equalIDs(ids(orders), []uint64{1}) || !equalIDs(ids(active), []uint64{300}) {
+		t.Fatalf("unexpected indexes after delete: %v, %v", ids(orders), ids(active))
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db := newDB(t)
+	glp := &GatewayLocalProcess{DB: db, orders: NewOrderStore(db)}
+
+	// the old layout
+	for user, ent := range map[string]string{alice: "http://localhost:30001", bob: "http://localhost:30002"} {
+		if err := db.Put(prefixKey(user, entrancePrefix), []byte(ent)); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Put(prefixKey(user, leasePrefix), []byte("{}")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// no migration without the resolver, the entrances are adopted at first read
+	if _, err := glp.orders.Migrate(nil); err == nil {
+		t.Fatal("expected error without resolver")
+	}
+
+	// alice is resolved, bob is kept
+	n, err := glp.orders.Migrate(func(user string) (uint64, bool) {
+		return 7, user == alice
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 migrated, got %d", n)
+	}
+
+	o, err := glp.orders.Get(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.User != alice || o.Entrance != "http://localhost:30001" || o.Status != model.OrderActive {
+		t.Fatalf("unexpected order: %+v", o)
+	}
+	if has, _ := db.Has(prefixKey(alice, entrancePrefix)); has {
+		t.Fatal("old entrance should be deleted")
+	}
+	if has, _ := db.Has(prefixKey(alice, leasePrefix)); !has {
+		t.Fatal("lease should be kept")
+	}
+
+	// latest active order of the user
+	ent, err := glp.GetEntrance(0, alice)
+	if err != nil || ent != "http://localhost:30001" {
+		t.Fatalf("unexpected entrance %s: %v", ent, err)
+	}
+	// not of the user
+	if _, err := glp.GetEntrance(7, bob); err == nil {
+		t.Fatal("expected error for the order of another user")
+	}
+
+	// bob is adopted by the order read at first
+	ent, err = glp.GetEntrance(9, bob)
+	if err != nil || ent != "http://localhost:30002" {
+		t.Fatalf("unexpected entrance %s: %v", ent, err)
+	}
+	o, err = glp.orders.Get(9)
+	if err != nil || o.User != bob {
+		t.Fatalf("order should be adopted: %+v, %v", o, err)
+	}
+	if has, _ := db.Has(prefixKey(bob, entrancePrefix)); has {
+		t.Fatal("old entrance should be deleted")
+	}
+
+	// nothing left
+	if _, err := glp.GetEntrance(10, "0x3333333333333333333333333333333333333333"); !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/grid/contracts/eth"
+	"github.com/grid/contracts/eth/contracts"
+	"github.com/gridprotocol/computing-api/computing/config"
+	"github.com/gridprotocol/computing-api/computing/gateway/rpcpool"
+)
+
+// fill the empty rpc and addresses of the chain from its preset of grid contracts
+func LoadPreset(ch *config.Chain) error {
+	var ep, mar, acc, cre, reg string
+	switch ch.Preset {
+	case "":
+		return nil
+	case "local":
+		l := contracts.Local{}
+		l.Load()
+		ep, mar, acc, cre, reg = eth.Ganache, l.Market, l.Access, l.Credit, l.Registry
+	case "sepo":
+		s := contracts.Sepo{}
+		s.Load()
+		ep, mar, acc, cre, reg = eth.Sepolia, s.Market, s.Access, s.Credit, s.Registry
+	case "dev":
+		d := contracts.Dev{}
+		d.Load()
+		ep, mar, acc, cre, reg = eth.DevChain, d.Market, d.Access, d.Credit, d.Registry
+	default:
+		return fmt.Errorf("unsupported preset %s of chain %s", ch.Preset, ch.Name)
+	}
+
+	if len(ch.RPC) == 0 {
+		ch.RPC = []string{ep}
+	}
+	fill := func(field *string, v string) {
+		if *field == "" {
+			*field = v
+		}
+	}
+	fill(&ch.Market, mar)
+	fill(&ch.Access, acc)
+	fill(&ch.Credit, cre)
+	fill(&ch.Registry, reg)
+
+	return nil
+}
+
+// dial the rpcs of the chain into a pool, the chain id reported by them is checked
+func DialChain(ctx context.Context, ch *config.Chain) (*rpcpool.Pool, error) {
+	cfg := rpcpool.Config{
+		MaxBlockLag:   ch.MaxBlockLag,
+		MaxErrorRate:  ch.MaxErrorRate,
+		CheckInterval: time.Duration(ch.HealthSec) * time.Second,
+	}
+
+	pool, err := rpcpool.Dial(ctx, ch.RPC, ch.ChainID, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("dial chain %s failed: %w", ch.Name, err)
+	}
+
+	return pool, nil
+}
+
+// load the chain of name in config, check it and dial its rpcs, they are checked until ctx is done
+func SelectChain(ctx context.Context, name string) (*config.Chain, *rpcpool.Pool, error) {
+	ch, err := config.GetConfig().GetChain(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := LoadPreset(ch); err != nil {
+		return nil, nil, err
+	}
+	if err := ch.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	pool, err := DialChain(ctx, ch)
+	if err != nil {
+		return nil, nil, err
+	}
+	go pool.Run(ctx)
+
+	return ch, pool, nil
+}
@@ -0,0 +1,167 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gridprotocol/computing-api/computing/config"
+)
+
+// the tests run with an empty config instead of config.toml
+func TestMain(m *testing.M) {
+	config.SetConfig(&config.GatewayConfig{})
+	os.Exit(m.Run())
+}
+
+// rpc answering eth_chainId with id and eth_blockNumber
+func stubRPC(t *testing.T, id uint64) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch req.Method {
+		case "eth_chainId":
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":"0x%x"}`, req.ID, id)
+		case "eth_blockNumber":
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":"0x64"}`, req.ID)
+		default:
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"error":{"code":-32601,"message":"method not found"}}`, req.ID)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testChain(rpcs ...string) *config.Chain {
+	return &config.Chain{
+		Name:     "test",
+		RPC:      rpcs,
+		ChainID:  1337,
+		Market:   "0x0000000000000000000000000000000000000001",
+		Access:   "0x0000000000000000000000000000000000000002",
+		Credit:   "0x0000000000000000000000000000000000000003",
+		Registry: "0x0000000000000000000000000000000000000004",
+	}
+}
+
+func TestDialChain(t *testing.T) {
+	ctx := context.Background()
+	good := stubRPC(t, 1337)
+
+	// a down rpc falls back to the next one
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	pool, err := DialChain(ctx, testChain(down.URL, good.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	if pool.Best() != good.URL {
+		t.Fatalf("expected %s, got %s", good.URL, pool.Best())
+	}
+
+	// a wrong chain id is an error
+	wrong := stubRPC(t, 11155111)
+	_, err = DialChain(ctx, testChain(wrong.URL, good.URL))
+	if err == nil || !strings.Contains(err.Error(), "chain id") {
+		t.Fatalf("expected chain id mismatch, got %v", err)
+	}
+
+	// none available
+	_, err = DialChain(ctx, testChain(down.URL))
+	if err == nil {
+		t.Fatal("expected error without an available rpc")
+	}
+}
+
+func TestChainConfig(t *testing.T) {
+	ch := testChain("http://localhost:8545")
+	if err := ch.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	bad := *ch
+	bad.Market = "market"
+	if err := bad.Validate(); err == nil {
+		t.Fatal("expected invalid market address")
+	}
+	bad = *ch
+	bad.ChainID = 0
+	if err := bad.Validate(); err == nil {
+		t.Fatal("expected missing chain id")
+	}
+
+	// chain gas policy over the global one
+	ch.Gas = config.Gas{MaxFeeGwei: 100}
+	g := ch.GasPolicy(config.Gas{MarginPercent: 120, MaxFeeGwei: 10, ResubmitSec: 180})
+	if g.MaxFeeGwei != 100 || g.MarginPercent != 120 || g.ResubmitSec != 180 {
+		t.Fatalf("unexpected gas policy: %+v", g)
+	}
+
+	// two gateways on distinct chains in a process
+	ch2 := testChain("http://localhost:8546")
+	ch2.ChainID = 5
+	ch2.Market = "0x0000000000000000000000000000000000000005"
+	g1 := NewGatewayRemoteProcess(nil, ch, nil, nil)
+	g2 := NewGatewayRemoteProcess(nil, ch2, nil, nil)
+	if g1.market == g2.market || g1.chainID == g2.chainID {
+		t.Fatalf("unexpected remote processes: %+v, %+v", g1, g2)
+	}
+}
+
+func TestLoadPreset(t *testing.T) {
+	ch := &config.Chain{Name: "local", Preset: "local", RPC: []string{"http://rpc"}, Market: "0x0000000000000000000000000000000000000009"}
+	if err := LoadPreset(ch); err != nil {
+		t.Fatal(err)
+	}
+	// the set fields are kept
+	if len(ch.RPC) != 1 || ch.RPC[0] != "http://rpc" || ch.Market != "0x0000000000000000000000000000000000000009" {
+		t.Fatalf("unexpected chain: %+v", ch)
+	}
+
+	if err := LoadPreset(&config.Chain{Preset: "mainnet"}); err == nil {
+		t.Fatal("expected unsupported preset")
+	}
+}
+
+func TestConfirmedOpts(t *testing.T) {
+	ctx := context.Background()
+	node := stubRPC(t, 1337)
+
+	ch := testChain(node.URL)
+	pool, err := DialChain(ctx, ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// latest block
+	opts, err := NewGatewayRemoteProcess(pool, ch, nil, nil).confirmedOpts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.BlockNumber != nil {
+		t.Fatalf("expected latest, got %s", opts.BlockNumber)
+	}
+
+	// pinned to head 100 - 3
+	ch.Confirmations = 3
+	opts, err = NewGatewayRemoteProcess(pool, ch, nil, nil).confirmedOpts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.BlockNumber == nil || opts.BlockNumber.Uint64() != 97 {
+		t.Fatalf("expected block 97, got %v", opts.BlockNumber)
+	}
+}
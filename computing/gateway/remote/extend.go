@@ -0,0 +1,160 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/grid/contracts/go/market"
+	"github.com/gridprotocol/computing-api/computing/gateway/chainerr"
+	"github.com/gridprotocol/computing-api/computing/gateway/txmgr"
+)
+
+// build an unsigned extend tx for the user to sign, the user key never leaves the client
+func (grp *GatewayRemoteProcess) BuildExtend(user common.Address, id uint64, dur uint64) (*types.Transaction, *big.Int, error) {
+	// the healthiest rpc of the chain
+	backend := grp.client
+	chainID := new(big.Int).SetUint64(grp.chainID)
+
+	data, err := packExtend(id, dur)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx := context.Background()
+
+	nonce, err := backend.PendingNonceAt(ctx, user)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get nonce of user failed: %s", err.Error())
+	}
+
+	gasPrice, err := backend.SuggestGasPrice(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("suggest gas price failed: %s", err.Error())
+	}
+
+	// estimate as the user, it fails if the tx will be reverted
+	gas, err := backend.EstimateGas(ctx, ethereum.CallMsg{From: user, To: &grp.market, Data: data})
+	if err != nil {
+		return nil, nil, fmt.Errorf("estimate gas for extend failed: %w", chainerr.Decode(err))
+	}
+
+	// the same margin as the txs sent by the gateway
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: gasPrice,
+		Gas:      txmgr.GasLimit(gas, grp.gas.MarginPercent),
+		To:       &grp.market,
+		Data:     data,
+	})
+
+	return tx, chainID, nil
+}
+
+// verify the extend tx signed by the user of the order and send it, return the tx hash without waiting
+func (grp *GatewayRemoteProcess) SendExtend(id uint64, rawTx []byte) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(rawTx); err != nil {
+		return common.Hash{}, fmt.Errorf("decode signed tx failed: %s", err.Error())
+	}
+
+	// the healthiest rpc of the chain
+	backend := grp.client
+	chainID := new(big.Int).SetUint64(grp.chainID)
+
+	sender, err := verifyExtend(tx, grp.market, chainID, id)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	// only the user of the order can extend it
+	marketIns, err := market.NewMarket(grp.market, backend)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("new contract instance failed: %s", err.Error())
+	}
+	opts, err := grp.confirmedOpts(context.Background())
+	if err != nil {
+		return common.Hash{}, err
+	}
+	orderInfo, err := marketIns.GetOrder(opts, id)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("getorder failed: %w", chainerr.Decode(err))
+	}
+	if orderInfo.User != sender {
+		return common.Hash{}, fmt.Errorf("tx signer %s is not the user of order %d", sender, id)
+	}
+
+	// tracked by the tx manager, the user can query it with the hash
+	txm, _, err := grp.getTxm()
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	logger.Debug("send extend tx of user:", sender)
+	rec, err := txm.SendSigned(context.Background(), "extend", tx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	return rec.ID, nil
+}
+
+// abi encode the extend call
+func packExtend(id uint64, dur uint64) ([]byte, error) {
+	mabi, err := market.MarketMetaData.GetAbi()
+	if err != nil {
+		return nil, fmt.Errorf("get market abi failed: %s", err.Error())
+	}
+
+	data, err := mabi.Pack("extend", id, dur)
+	if err != nil {
+		return nil, fmt.Errorf("pack extend call failed: %s", err.Error())
+	}
+
+	return data, nil
+}
+
+// check the signed tx calls extend of the order on the market contract, return the signer
+func verifyExtend(tx *types.Transaction, marketAddr common.Address, chainID *big.Int, id uint64) (common.Address, error) {
+	if tx.To() == nil || *tx.To() != marketAddr {
+		return common.Address{}, fmt.Errorf("tx is not sent to the market contract %s", marketAddr)
+	}
+
+	if tx.Value().Sign() != 0 {
+		return common.Address{}, fmt.Errorf("extend tx should not carry value")
+	}
+
+	// replay protected tx only
+	if !tx.Protected() || tx.ChainId().Cmp(chainID) != 0 {
+		return common.Address{}, fmt.Errorf("tx is not signed for chain %s", chainID)
+	}
+
+	mabi, err := market.MarketMetaData.GetAbi()
+	if err != nil {
+		return common.Address{}, fmt.Errorf("get market abi failed: %s", err.Error())
+	}
+
+	data := tx.Data()
+	if len(data) < 4 || !bytes.Equal(data[:4], mabi.Methods["extend"].ID) {
+		return common.Address{}, fmt.Errorf("tx does not call extend")
+	}
+
+	args, err := mabi.Methods["extend"].Inputs.Unpack(data[4:])
+	if err != nil || len(args) != 2 {
+		return common.Address{}, fmt.Errorf("invalid extend args in tx")
+	}
+	if oid, ok := args[0].(uint64); !ok || oid != id {
+		return common.Address{}, fmt.Errorf("tx extends order %v, not order %d", args[0], id)
+	}
+
+	sender, err := types.Sender(types.LatestSignerForChainID(chainID), tx)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("recover tx signer failed: %s", err.Error())
+	}
+
+	return sender, nil
+}
@@ -0,0 +1,129 @@
+package remote
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/grid/contracts/go/market"
+	"github.com/gridprotocol/computing-api/computing/gateway/watcher"
+	"github.com/gridprotocol/computing-api/lib/kv"
+)
+
+// logs of the market contract by block, built by the watcher and rolled back on reorgs.
+// The logs of the latest keep blocks are kept, and they are applied to the order status.
+type marketJournal struct {
+	db     kv.Store
+	keep   uint64
+	orders *orderStatus
+}
+
+func (j *marketJournal) HandleBlock(txn kv.Txn, n uint64, hash common.Hash, logs []types.Log) error {
+	if len(logs) > 0 {
+		data, err := json.Marshal(logs)
+		if err != nil {
+			return fmt.Errorf("encode logs failed: %s", err.Error())
+		}
+		if err := txn.Put(journalKey(n), data); err != nil {
+			return err
+		}
+	}
+
+	// a reorg deeper than keep blocks is never rolled back, as the hashes kept by the watcher
+	if n > j.keep {
+		if err := j.prune(txn, n-j.keep); err != nil {
+			return err
+		}
+	}
+
+	return j.orders.apply(txn, n, logs)
+}
+
+func (j *marketJournal) Rollback(txn kv.Txn, from, to uint64) error {
+	if err := j.orders.revert(txn, to); err != nil {
+		return err
+	}
+
+	for n := to + 1; n <= from; n++ {
+		if err := txn.Delete(journalKey(n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *marketJournal) Reset(txn kv.Txn, n uint64) error {
+	if err := j.orders.resync(txn, n); err != nil {
+		return err
+	}
+	// the logs are of the lost chain
+	return j.prune(txn, math.MaxUint64)
+}
+
+// market logs of a block, nil if it has none
+func (j *marketJournal) Logs(n uint64) ([]types.Log, error) {
+	has, err := j.db.Has(journalKey(n))
+	if err != nil || !has {
+		return nil, err
+	}
+
+	data, err := j.db.Get(journalKey(n))
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []types.Log
+	if err := json.Unmarshal(data, &logs); err != nil {
+		return nil, fmt.Errorf("decode logs failed: %s", err.Error())
+	}
+
+	return logs, nil
+}
+
+// drop the logs of the blocks up to n
+func (j *marketJournal) prune(txn kv.Txn, n uint64) error {
+	var keys [][]byte
+	err := txn.Iterate([]byte(journalPrefix), func(key, _ []byte) (bool, error) {
+		if binary.BigEndian.Uint64(key[len(journalPrefix):]) > n {
+			return false, nil
+		}
+		keys = append(keys, append([]byte{}, key...))
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := txn.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const journalPrefix = "journal/market/"
+
+func journalKey(n uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte(journalPrefix), n)
+}
+
+// follow the market logs into the journal and the order status until ctx is done
+func (grp *GatewayRemoteProcess) Watch(ctx context.Context) {
+	marketIns, err := market.NewMarket(grp.market, grp.client)
+	if err != nil {
+		logger.Error("new contract instance failed: ", err)
+		return
+	}
+
+	orders := &orderStatus{db: grp.db, contract: marketIns, provider: common.HexToAddress(grp.wallet)}
+	grp.orders.Store(orders)
+
+	cfg := watcher.DefaultConfig()
+	j := &marketJournal{db: grp.db, keep: cfg.KeepBlocks, orders: orders}
+	w := watcher.New("market", grp.client, grp.db, []common.Address{grp.market}, j, cfg)
+	w.Run(ctx)
+}
@@ -0,0 +1,185 @@
+package remote
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/grid/contracts/go/market"
+	"github.com/gridprotocol/computing-api/lib/kv"
+)
+
+var createTopic = common.HexToHash("0xc0")
+
+// an order changed at a block
+type orderChange struct {
+	block uint64
+	order market.IMarketOrder
+}
+
+// market with the changes of orders by block
+type fakeMarket struct {
+	changes map[uint64][]orderChange
+}
+
+func (fm *fakeMarket) set(id, block uint64, o market.IMarketOrder) {
+	fm.changes[id] = append(fm.changes[id], orderChange{block, o})
+}
+
+// drop the changes after block, they are reorged
+func (fm *fakeMarket) reorg(block uint64) {
+	for id, cs := range fm.changes {
+		kept := cs[:0]
+		for _, c := range cs {
+			if c.block <= block {
+				kept = append(kept, c)
+			}
+		}
+		fm.changes[id] = kept
+	}
+}
+
+func (fm *fakeMarket) GetOrder(opts *bind.CallOpts, id uint64) (market.IMarketOrder, error) {
+	var o market.IMarketOrder
+	for _, c := range fm.changes[id] {
+		if c.block <= opts.BlockNumber.Uint64() {
+			o = c.order
+		}
+	}
+	return o, nil
+}
+
+func (fm *fakeMarket) ParseCreateOrder(l types.Log) (*market.MarketCreateOrder, error) {
+	if len(l.Topics) != 2 || l.Topics[0] != createTopic {
+		return nil, errors.New("event signature mismatch")
+	}
+	return &market.MarketCreateOrder{Id: l.Topics[1].Big().Uint64(), Raw: l}, nil
+}
+
+func createLog(id uint64) types.Log {
+	return types.Log{Topics: []common.Hash{createTopic, common.BigToHash(new(big.Int).SetUint64(id))}}
+}
+
+func TestMarketJournal(t *testing.T) {
+	provider := common.HexToAddress("0x01")
+	fm := &fakeMarket{changes: make(map[uint64][]orderChange)}
+	db := kv.NewMemDatabase()
+	orders := &orderStatus{db: db, contract: fm, provider: provider}
+	j := &marketJournal{db: db, keep: 4, orders: orders}
+
+	status := func(id uint64) orderRecord {
+		t.Helper()
+		r, _, err := orders.get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	other := types.Log{Topics: []common.Hash{common.HexToHash("0xee")}}
+
+	// order 1 of the provider and order 2 of another are created, order 1 is activated then cancelled
+	fm.set(1, 10, market.IMarketOrder{Provider: provider, NodeId: 3, Status: orderUnactive})
+	fm.set(2, 10, market.IMarketOrder{Provider: common.HexToAddress("0x02"), Status: orderUnactive})
+	fm.set(1, 11, market.IMarketOrder{Provider: provider, NodeId: 3, Status: orderActive})
+	fm.set(1, 12, market.IMarketOrder{Provider: provider, NodeId: 3, Status: orderCancelled})
+
+	blocks := []struct {
+		n      uint64
+		logs   []types.Log
+		status uint8
+	}{
+		{10, []types.Log{createLog(1), createLog(2)}, orderUnactive},
+		{11, []types.Log{other}, orderActive},
+		{12, []types.Log{other}, orderCancelled},
+	}
+	for _, b := range blocks {
+		if err := j.HandleBlock(db, b.n, common.Hash{}, b.logs); err != nil {
+			t.Fatal(err)
+		}
+		if r := status(1); r.Status != b.status || r.NodeID != 3 || r.Block != b.n {
+			t.Fatalf("unexpected status of order at block %d: %+v", b.n, r)
+		}
+	}
+	if _, ok, _ := orders.get(2); ok {
+		t.Fatal("order of another provider is tracked")
+	}
+	if r := status(1); !r.final() || !orders.confirmed(r, 0) || orders.confirmed(r, 1) {
+		t.Fatalf("unexpected confirmation of %+v at %d", r, orders.head.Load())
+	}
+
+	// the cancellation is reorged
+	fm.reorg(11)
+	if err := j.Rollback(db, 12, 11); err != nil {
+		t.Fatal(err)
+	}
+	if r := status(1); r.Status != orderActive || r.Block != 11 {
+		t.Fatalf("unexpected status after rollback: %+v", r)
+	}
+	if counts, err := orders.nodeOrders(); err != nil || len(counts) != 1 || counts[3] != 1 {
+		t.Fatalf("unexpected active orders of nodes: %v %v", counts, err)
+	}
+	if logs, _ := j.Logs(12); logs != nil {
+		t.Fatal("logs of the rolled back block are kept")
+	}
+
+	// the creation is reorged
+	fm.reorg(9)
+	if err := j.Rollback(db, 11, 9); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := orders.get(1); ok {
+		t.Fatal("order created in a rolled back block is tracked")
+	}
+
+	// only the logs of the latest keep blocks are kept
+	for n := uint64(10); n <= 20; n++ {
+		if err := j.HandleBlock(db, n, common.Hash{}, []types.Log{other}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for n := uint64(10); n <= 20; n++ {
+		logs, err := j.Logs(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kept := n > 20-4; kept != (logs != nil) {
+			t.Fatalf("logs of block %d are kept: %v", n, logs != nil)
+		}
+	}
+}
+
+func TestMarketJournalReset(t *testing.T) {
+	provider := common.HexToAddress("0x01")
+	fm := &fakeMarket{changes: make(map[uint64][]orderChange)}
+	db := kv.NewMemDatabase()
+	orders := &orderStatus{db: db, contract: fm, provider: provider}
+	j := &marketJournal{db: db, keep: 4, orders: orders}
+
+	fm.set(1, 10, market.IMarketOrder{Provider: provider, NodeId: 3, Status: orderUnactive})
+	fm.set(1, 11, market.IMarketOrder{Provider: provider, NodeId: 3, Status: orderActive})
+	if err := j.HandleBlock(db, 10, common.Hash{}, []types.Log{createLog(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.HandleBlock(db, 11, common.Hash{}, []types.Log{createLog(9)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the chain after block 9 is lost, the order is created again at block 12 of the new chain
+	fm.reorg(9)
+	fm.set(1, 12, market.IMarketOrder{Provider: provider, NodeId: 3, Status: orderUnactive})
+	if err := j.Reset(db, 12); err != nil {
+		t.Fatal(err)
+	}
+	r, ok, err := orders.get(1)
+	if err != nil || !ok || r.Status != orderUnactive || r.Block != 12 || orders.head.Load() != 12 {
+		t.Fatalf("unexpected status after reset: %+v %v %v", r, ok, err)
+	}
+	for _, n := range []uint64{10, 11} {
+		if logs, _ := j.Logs(n); logs != nil {
+			t.Fatalf("logs of block %d of the lost chain are kept", n)
+		}
+	}
+}
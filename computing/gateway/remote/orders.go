@@ -0,0 +1,215 @@
+package remote
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/grid/contracts/go/market"
+	"github.com/gridprotocol/computing-api/lib/kv"
+)
+
+// status of an order in the market contract
+const (
+	orderNotExist  uint8 = 0
+	orderUnactive  uint8 = 1
+	orderActive    uint8 = 2
+	orderCancelled uint8 = 3
+	orderCompleted uint8 = 4
+)
+
+func orderStatusText(status uint8) string {
+	switch status {
+	case orderNotExist:
+		return "order not exist"
+	case orderUnactive:
+		return "order unactive"
+	case orderCancelled:
+		return "order cancelled"
+	case orderCompleted:
+		return "order completed"
+	}
+	return ""
+}
+
+// market methods read by the order status, implemented by the market binding
+type orderContract interface {
+	GetOrder(opts *bind.CallOpts, id uint64) (market.IMarketOrder, error)
+	ParseCreateOrder(log types.Log) (*market.MarketCreateOrder, error)
+}
+
+// status of an order of the provider read at block
+type orderRecord struct {
+	ID     uint64 `json:"id"`
+	NodeID uint64 `json:"nodeId"`
+	Status uint8  `json:"status"`
+	Block  uint64 `json:"block"`
+}
+
+// the order is cancelled or completed, its status never changes
+func (r orderRecord) final() bool {
+	return r.Status == orderCancelled || r.Status == orderCompleted
+}
+
+// status of the orders of provider, applied from the market logs replayed by the watcher.
+// The orders created in the watched blocks are tracked, the open ones are read again in
+// each block with market logs, and the ones read after a rolled back block are read again.
+type orderStatus struct {
+	db       kv.Store
+	contract orderContract
+	provider common.Address
+
+	// the last applied block
+	head atomic.Uint64
+}
+
+// apply the market logs of block n, the records are written in txn
+func (o *orderStatus) apply(txn kv.Txn, n uint64, logs []types.Log) error {
+	if len(logs) > 0 {
+		ids := make(map[uint64]struct{})
+		for _, l := range logs {
+			// the logs of other events are not parsed
+			ev, err := o.contract.ParseCreateOrder(l)
+			if err != nil || ev == nil {
+				continue
+			}
+			ids[ev.Id] = struct{}{}
+		}
+
+		open, err := records(txn, func(r orderRecord) bool { return !r.final() })
+		if err != nil {
+			return err
+		}
+		for _, r := range open {
+			ids[r.ID] = struct{}{}
+		}
+
+		if err := o.read(txn, ids, n); err != nil {
+			return err
+		}
+	}
+
+	o.head.Store(n)
+	return nil
+}
+
+// read the orders read after block to again at it, the blocks after it are rolled back
+func (o *orderStatus) revert(txn kv.Txn, to uint64) error {
+	changed, err := records(txn, func(r orderRecord) bool { return r.Block > to })
+	if err != nil {
+		return err
+	}
+
+	ids := make(map[uint64]struct{}, len(changed))
+	for _, r := range changed {
+		ids[r.ID] = struct{}{}
+	}
+	if err := o.read(txn, ids, to); err != nil {
+		return err
+	}
+
+	o.head.Store(to)
+	return nil
+}
+
+// read all the tracked orders again at block n, the chain they are read on is lost
+func (o *orderStatus) resync(txn kv.Txn, n uint64) error {
+	all, err := records(txn, func(orderRecord) bool { return true })
+	if err != nil {
+		return err
+	}
+
+	ids := make(map[uint64]struct{}, len(all))
+	for _, r := range all {
+		ids[r.ID] = struct{}{}
+	}
+	if err := o.read(txn, ids, n); err != nil {
+		return err
+	}
+
+	o.head.Store(n)
+	return nil
+}
+
+// read the orders at block n, the ones not of provider or not existing are dropped
+func (o *orderStatus) read(txn kv.Txn, ids map[uint64]struct{}, n uint64) error {
+	opts := &bind.CallOpts{Context: context.Background(), BlockNumber: new(big.Int).SetUint64(n)}
+	for id := range ids {
+		order, err := o.contract.GetOrder(opts, id)
+		if err != nil {
+			return fmt.Errorf("get order %d at block %d failed: %s", id, n, err.Error())
+		}
+
+		if order.Provider != o.provider || order.Status == orderNotExist {
+			if err := txn.Delete(orderKey(id)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		r := orderRecord{ID: id, NodeID: order.NodeId, Status: order.Status, Block: n}
+		if err := kv.PutAs(txn, kv.JSON, orderKey(id), r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the records matching fn, read in txn or in the db
+func records(txn kv.Txn, fn func(orderRecord) bool) ([]orderRecord, error) {
+	var res []orderRecord
+	err := txn.Iterate([]byte(orderPrefix), func(key, value []byte) (bool, error) {
+		var r orderRecord
+		if err := kv.JSON.Unmarshal(value, &r); err != nil {
+			return false, fmt.Errorf("decode order %q failed: %s", key, err.Error())
+		}
+		if fn(r) {
+			res = append(res, r)
+		}
+		return true, nil
+	})
+	return res, err
+}
+
+// the record of an order, false if it's not tracked
+func (o *orderStatus) get(id uint64) (orderRecord, bool, error) {
+	has, err := o.db.Has(orderKey(id))
+	if err != nil || !has {
+		return orderRecord{}, false, err
+	}
+	r, err := kv.GetAs[orderRecord](o.db, kv.JSON, orderKey(id))
+	if err != nil {
+		return orderRecord{}, false, err
+	}
+	return r, true, nil
+}
+
+// the active orders of each node
+func (o *orderStatus) nodeOrders() (map[uint64]int64, error) {
+	active, err := records(o.db, func(r orderRecord) bool { return r.Status == orderActive })
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[uint64]int64)
+	for _, r := range active {
+		res[r.NodeID]++
+	}
+	return res, nil
+}
+
+// the record is read at least confirmations blocks before the last applied block
+func (o *orderStatus) confirmed(r orderRecord, confirmations uint64) bool {
+	return r.Block+confirmations <= o.head.Load()
+}
+
+const orderPrefix = "order/status/"
+
+func orderKey(id uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte(orderPrefix), id)
+}
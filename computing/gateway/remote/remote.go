@@ -1,47 +1,172 @@
 package remote
 
 import (
+	"context"
 	"fmt"
 	"math/big"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/grid/contracts/eth"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/grid/contracts/go/market"
 	"github.com/grid/contracts/go/registry"
-	com "github.com/gridprotocol/computing-api/common"
 	"github.com/gridprotocol/computing-api/computing/config"
+	"github.com/gridprotocol/computing-api/computing/gateway/chainerr"
+	"github.com/gridprotocol/computing-api/computing/gateway/rpcpool"
+	"github.com/gridprotocol/computing-api/computing/gateway/txmgr"
 	"github.com/gridprotocol/computing-api/computing/model"
-	"github.com/gridprotocol/computing-api/keystore"
+	"github.com/gridprotocol/computing-api/keystore/signer"
 	"github.com/gridprotocol/computing-api/lib/kv"
 	"github.com/gridprotocol/computing-api/lib/logc"
 	"github.com/gridprotocol/computing-api/lib/utils"
 )
 
-var (
-	logger = logc.Logger("remote")
-
-	// market contract addr
-	MarketAddr common.Address
-	// access contract address
-	AccessAddr common.Address
-	// credit contract address
-	CreditAddr common.Address
-	// registry contract address
-	RegistryAddr common.Address
-)
+var logger = logc.Logger("remote")
 
 type GatewayRemoteProcess struct {
-	chain_endpoint string
-	wallet         string
+	client *rpcpool.Pool
+	wallet string
+	db     kv.Store
+
+	// contract addresses of the chain
+	market   common.Address
+	access   common.Address
+	credit   common.Address
+	registry common.Address
+
+	chainID       uint64
+	confirmations uint64
+	gas           config.Gas
+
+	// signer of the provider wallet, txs can't be sent without it
+	signer signer.Signer
+
+	// tx manager of the provider key, made at first use
+	mu       sync.Mutex
+	txm      *txmgr.Manager
+	provider common.Address
+
+	// status of the orders applied from the market logs, set by Watch
+	orders atomic.Pointer[orderStatus]
 }
 
-func NewGatewayRemoteProcess(ep string, db *kv.Database) *GatewayRemoteProcess {
+// make the remote process on a chain, client is the rpcs of the chain dialed by DialChain.
+// The txs of the provider are signed by sg, it can be nil for reading the chain only.
+func NewGatewayRemoteProcess(client *rpcpool.Pool, ch *config.Chain, db kv.Store, sg signer.Signer) *GatewayRemoteProcess {
 	return &GatewayRemoteProcess{
-		chain_endpoint: ep,
-		wallet:         config.GetConfig().Remote.Wallet,
+		client: client,
+		wallet: config.GetConfig().Remote.Wallet,
+		db:     db,
+		signer: sg,
+
+		market:   common.HexToAddress(ch.Market),
+		access:   common.HexToAddress(ch.Access),
+		credit:   common.HexToAddress(ch.Credit),
+		registry: common.HexToAddress(ch.Registry),
+
+		chainID:       ch.ChainID,
+		confirmations: ch.Confirmations,
+		gas:           ch.GasPolicy(config.GetConfig().Gas),
+	}
+}
+
+// get the tx manager with the provider key, pending txs in db are tracked again
+func (grp *GatewayRemoteProcess) getTxm() (*txmgr.Manager, common.Address, error) {
+	grp.mu.Lock()
+	defer grp.mu.Unlock()
+
+	if grp.txm != nil {
+		return grp.txm, grp.provider, nil
+	}
+	if grp.signer == nil {
+		return nil, common.Address{}, fmt.Errorf("no signer of the provider wallet")
+	}
+
+	gas := grp.gas
+	cfg := txmgr.Config{
+		GasMarginPercent: gas.MarginPercent,
+		ResubmitInterval: time.Duration(gas.ResubmitSec) * time.Second,
+		Confirmations:    grp.confirmations,
+	}
+	if gas.MaxFeeGwei > 0 {
+		cfg.MaxFeeCap = new(big.Int).Mul(new(big.Int).SetUint64(gas.MaxFeeGwei), big.NewInt(params.GWei))
+	}
+	if gas.MaxTipGwei > 0 {
+		cfg.MaxTipCap = new(big.Int).Mul(new(big.Int).SetUint64(gas.MaxTipGwei), big.NewInt(params.GWei))
+	}
+
+	txm, err := txmgr.NewManager(grp.client, grp.db, cfg)
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+
+	grp.provider = txm.AddSigner(grp.signer)
+	grp.txm = txm
+
+	if hook := config.GetConfig().Webhook; hook.Url != "" {
+		txm.OnFinal(txmgr.Webhook(hook.Url, hook.Secret))
+	}
+
+	// check and replace the pending txs in background
+	go txm.Run(context.Background())
+
+	return grp.txm, grp.provider, nil
+}
+
+// call opts pinned to the block with confirmations on top, the state read at it survives a reorg
+func (grp *GatewayRemoteProcess) confirmedOpts(ctx context.Context) (*bind.CallOpts, error) {
+	opts := &bind.CallOpts{Context: ctx}
+	if grp.confirmations == 0 {
+		return opts, nil
+	}
+
+	head, err := grp.client.BlockNumber(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get block number failed: %s", err.Error())
+	}
+	if head < grp.confirmations {
+		head = grp.confirmations
+	}
+	opts.BlockNumber = new(big.Int).SetUint64(head - grp.confirmations)
+
+	return opts, nil
+}
+
+// send a tx with the provider key, it is tracked by the tx manager until it's finished
+func (grp *GatewayRemoteProcess) transact(name string, build func(*bind.TransactOpts) (*types.Transaction, error)) (common.Hash, error) {
+	txm, provider, err := grp.getTxm()
+	if err != nil {
+		return common.Hash{}, err
 	}
+
+	rec, err := txm.Send(context.Background(), provider, name, build)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	return rec.ID, nil
+}
+
+// get the status of a tx sent by the gateway
+func (grp *GatewayRemoteProcess) GetTx(hash common.Hash) (*txmgr.Record, error) {
+	txm, _, err := grp.getTxm()
+	if err != nil {
+		return nil, err
+	}
+	return txm.Check(context.Background(), hash)
+}
+
+// wait until a tx sent by the gateway is mined, reverted or dropped
+func (grp *GatewayRemoteProcess) WaitTx(ctx context.Context, hash common.Hash) (*txmgr.Record, error) {
+	txm, _, err := grp.getTxm()
+	if err != nil {
+		return nil, err
+	}
+	return txm.Wait(ctx, hash)
 }
 
 func (grp *GatewayRemoteProcess) Register(ability model.Resources) error {
@@ -77,18 +202,17 @@ func (grp *GatewayRemoteProcess) StaticCheck(orderInfo market.IMarketOrder) (boo
 func (grp *GatewayRemoteProcess) fee(id uint64) (*big.Int, error) {
 	// get node resource
 
-	// connect to an eth node with ep
-	backend, chainID := eth.ConnETH(grp.chain_endpoint)
-	logger.Debug("chain id:", chainID)
+	// the healthiest rpc of the chain
+	backend := grp.client
 
 	// get contract instance
-	regIns, err := registry.NewRegistry(RegistryAddr, backend)
+	regIns, err := registry.NewRegistry(grp.registry, backend)
 	if err != nil {
 		return nil, fmt.Errorf("new contract instance failed: %s", err.Error())
 	}
 
 	// market
-	marIns, err := market.NewMarket(MarketAddr, backend)
+	marIns, err := market.NewMarket(grp.market, backend)
 	if err != nil {
 		return nil, fmt.Errorf("new contract instance failed: %s", err.Error())
 	}
@@ -125,234 +249,108 @@ func (grp *GatewayRemoteProcess) fee(id uint64) (*big.Int, error) {
 	return total, nil
 }
 
-// set the app name in contract
-func (grp *GatewayRemoteProcess) SetApp(id uint64, app string) error {
-	// connect to an eth node with ep
-	backend, chainID := eth.ConnETH(grp.chain_endpoint)
-	logger.Debug("chain id:", chainID)
-
-	// get contract instance
-	marketIns, err := market.NewMarket(MarketAddr, backend)
-	if err != nil {
-		return fmt.Errorf("new contract instance failed: %s", err.Error())
-	}
-
-	// get wallet
-	cp := config.GetConfig().Remote.Wallet
-	// get sk with password
-	repo := keystore.Repo
-	pw := com.Password
-	ki, err := repo.Get(cp, pw)
+// ids of the nodes of the provider in the registry, node id starts from 1
+func (grp *GatewayRemoteProcess) Nodes(ctx context.Context) ([]uint64, error) {
+	regIns, err := registry.NewRegistry(grp.registry, grp.client)
 	if err != nil {
-		return err
-	}
-	sk := ki.SK()
-
-	// make auth for sending transaction
-	authProvider, err := eth.MakeAuth(chainID, sk)
-	if err != nil {
-		return err
+		return nil, fmt.Errorf("new contract instance failed: %s", err.Error())
 	}
 
-	// gas
-	authProvider.GasLimit = 1000000
-	// 50 gwei
-	authProvider.GasPrice = new(big.Int).SetUint64(50000000000)
-
-	logger.Debug("provider set the app name for this order")
-	tx, err := marketIns.SetApp(authProvider, id, app)
+	cnt, err := regIns.GetNodeCount(&bind.CallOpts{Context: ctx}, common.HexToAddress(grp.wallet))
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("get node count failed: %s", err.Error())
 	}
 
-	logger.Debug("waiting for tx to be ok")
-	err = eth.CheckTx(grp.chain_endpoint, tx.Hash(), "")
-	if err != nil {
-		return err
+	ids := make([]uint64, 0, cnt)
+	for id := uint64(1); id <= cnt; id++ {
+		ids = append(ids, id)
 	}
+	return ids, nil
+}
 
-	receipt := eth.GetTransactionReceipt(grp.chain_endpoint, tx.Hash())
-	logger.Debug("set app name gas used:", receipt.GasUsed)
-
-	// get order
-	orderInfo, err := marketIns.GetOrder(&bind.CallOpts{}, id)
-	if err != nil {
-		return err
+// active orders of each node of the provider, read from the market logs followed by Watch
+func (grp *GatewayRemoteProcess) NodeOrders() (map[uint64]int64, error) {
+	orders := grp.orders.Load()
+	if orders == nil {
+		return nil, fmt.Errorf("market logs are not watched")
 	}
-	logger.Debug("app name:", orderInfo.AppName)
-
-	return nil
+	return orders.nodeOrders()
 }
 
-// user extend an order
-func (grp *GatewayRemoteProcess) Extend(userSK string, id uint64, dur string) error {
-
-	// connect to an eth node with ep
-	backend, chainID := eth.ConnETH(grp.chain_endpoint)
-	logger.Debug("chain id:", chainID)
-
-	logger.Debug("market address:", MarketAddr)
+// set the app name in contract
+func (grp *GatewayRemoteProcess) SetApp(id uint64, app string) (common.Hash, error) {
+	// the healthiest rpc of the chain
+	backend := grp.client
 
 	// get contract instance
-	marketIns, err := market.NewMarket(MarketAddr, backend)
-	if err != nil {
-		return fmt.Errorf("new contract instance failed: %s", err.Error())
-	}
-
-	// make auth for sending transaction
-	authUser, err := eth.MakeAuth(chainID, userSK)
-	if err != nil {
-		return err
-	}
-
-	// gas
-	authUser.GasLimit = 1000000
-	// 50 gwei
-	authUser.GasPrice = new(big.Int).SetUint64(50000000000)
-
-	_dur, err := utils.StringToUint64(dur)
-	if err != nil {
-		return err
-	}
-
-	logger.Debug("user extend an order")
-	tx, err := marketIns.Extend(authUser, id, _dur)
+	marketIns, err := market.NewMarket(grp.market, backend)
 	if err != nil {
-		return err
+		return common.Hash{}, fmt.Errorf("new contract instance failed: %s", err.Error())
 	}
 
-	logger.Debug("waiting for tx to be ok")
-	err = eth.CheckTx(grp.chain_endpoint, tx.Hash(), "")
-	if err != nil {
-		return err
-	}
-
-	receipt := eth.GetTransactionReceipt(grp.chain_endpoint, tx.Hash())
-	logger.Debug("extend order gas used:", receipt.GasUsed)
-
-	return nil
+	logger.Debug("provider set the app name for this order: ", app)
+	return grp.transact("set app", func(auth *bind.TransactOpts) (*types.Transaction, error) {
+		return marketIns.SetApp(auth, id, app)
+	})
 }
 
 // reset order
-func (grp *GatewayRemoteProcess) Reset(id uint64, prob string, dur string) error {
+func (grp *GatewayRemoteProcess) Reset(id uint64, prob string, dur string) (common.Hash, error) {
 
-	// connect to an eth node with ep
-	backend, chainID := eth.ConnETH(grp.chain_endpoint)
-	logger.Debug("chain id:", chainID)
+	// the healthiest rpc of the chain
+	backend := grp.client
 
-	logger.Debug("market address:", MarketAddr)
+	logger.Debug("market address:", grp.market)
 
 	// get contract instance
-	marketIns, err := market.NewMarket(MarketAddr, backend)
-	if err != nil {
-		return fmt.Errorf("new contract instance failed: %s", err.Error())
-	}
-
-	// make auth for sending transaction
-	authProvider, err := eth.MakeAuth(chainID, com.SK)
+	marketIns, err := market.NewMarket(grp.market, backend)
 	if err != nil {
-		return err
+		return common.Hash{}, fmt.Errorf("new contract instance failed: %s", err.Error())
 	}
 
-	// gas
-	authProvider.GasLimit = 1000000
-	// 50 gwei
-	authProvider.GasPrice = new(big.Int).SetUint64(50000000000)
-
 	// type transform
 	_prob, err := utils.StringToUint64(prob)
 	if err != nil {
-		return err
+		return common.Hash{}, err
 	}
 	_dur, err := utils.StringToUint64(dur)
 	if err != nil {
-		return err
+		return common.Hash{}, err
 	}
 
 	logger.Debug("reset an order")
-	tx, err := marketIns.Reset(authProvider, id, _prob, _dur)
-	if err != nil {
-		return err
-	}
-
-	logger.Debug("waiting for tx to be ok")
-	err = eth.CheckTx(grp.chain_endpoint, tx.Hash(), "")
-	if err != nil {
-		return err
-	}
-
-	receipt := eth.GetTransactionReceipt(grp.chain_endpoint, tx.Hash())
-	logger.Debug("gas used:", receipt.GasUsed)
-
-	// get order
-	orderInfo, err := marketIns.GetOrder(&bind.CallOpts{}, id)
-	if err != nil {
-		return err
-	}
-
-	logger.Debug("order info after reset:", orderInfo)
-
-	return nil
+	return grp.transact("reset", func(auth *bind.TransactOpts) (*types.Transaction, error) {
+		return marketIns.Reset(auth, id, _prob, _dur)
+	})
 }
 
 // provider settle
-func (grp *GatewayRemoteProcess) Settle(id uint64) error {
+func (grp *GatewayRemoteProcess) Settle(id uint64) (common.Hash, error) {
 
-	// connect to an eth node with ep
-	backend, chainID := eth.ConnETH(grp.chain_endpoint)
-	logger.Debug("chain id:", chainID)
+	// the healthiest rpc of the chain
+	backend := grp.client
 
 	logger.Debug("order id:", id)
 
-	logger.Debug("market address:", MarketAddr)
+	logger.Debug("market address:", grp.market)
 
 	// get contract instance
-	marketIns, err := market.NewMarket(MarketAddr, backend)
-	if err != nil {
-		return fmt.Errorf("new contract instance failed: %s", err.Error())
-	}
-
-	// make auth for sending transaction
-	authProvider, err := eth.MakeAuth(chainID, com.SK)
+	marketIns, err := market.NewMarket(grp.market, backend)
 	if err != nil {
-		return err
+		return common.Hash{}, fmt.Errorf("new contract instance failed: %s", err.Error())
 	}
 
-	// gas
-	authProvider.GasLimit = 1000000
-	// 50 gwei
-	authProvider.GasPrice = new(big.Int).SetUint64(50000000000)
-
 	// get order
 	orderInfo, err := marketIns.GetOrder(&bind.CallOpts{}, id)
 	if err != nil {
-		return err
+		return common.Hash{}, chainerr.Decode(err)
 	}
 	logger.Debug("order info before settle:", orderInfo)
 
 	logger.Debug("provider settle an order")
-	tx, err := marketIns.ProSettle(authProvider, id)
-	if err != nil {
-		return err
-	}
-
-	logger.Debug("waiting for tx to be ok")
-	err = eth.CheckTx(grp.chain_endpoint, tx.Hash(), "")
-	if err != nil {
-		return err
-	}
-
-	receipt := eth.GetTransactionReceipt(grp.chain_endpoint, tx.Hash())
-	logger.Debug("gas used:", receipt.GasUsed)
-
-	// get order
-	orderInfo, err = marketIns.GetOrder(&bind.CallOpts{}, id)
-	if err != nil {
-		return err
-	}
-	logger.Debug("order info after settle:", orderInfo)
-
-	return nil
+	return grp.transact("settle", func(auth *bind.TransactOpts) (*types.Transaction, error) {
+		return marketIns.ProSettle(auth, id)
+	})
 }
 
 // check the order expire
@@ -387,7 +385,7 @@ func (grp *GatewayRemoteProcess) ExpireCheck(orderInfo market.IMarketOrder) (boo
 
 // check the order's payee to be the provider itself
 func (grp *GatewayRemoteProcess) PayeeCheck(orderInfo market.IMarketOrder) (bool, error) {
-	// if orderInfo.Provider.String() != com.CP {
+	// if orderInfo.Provider != common.HexToAddress(grp.wallet) {
 	// 	return false, fmt.Errorf("the provider in order is invalid")
 	// }
 
@@ -410,22 +408,27 @@ func (grp *GatewayRemoteProcess) SetWatcher(contract string) error {
 
 // get an order with user and cp
 func (grp *GatewayRemoteProcess) GetOrder(id uint64) (*market.IMarketOrder, error) {
-	// connect to an eth node with ep
-	backend, chainID := eth.ConnETH(grp.chain_endpoint)
-	logger.Debug("chain id:", chainID)
+	// the healthiest rpc of the chain
+	backend := grp.client
 
-	logger.Debug("market:", MarketAddr)
+	logger.Debug("market:", grp.market)
 
 	// get market instance
-	marketIns, err := market.NewMarket(MarketAddr, backend)
+	marketIns, err := market.NewMarket(grp.market, backend)
+	if err != nil {
+		return nil, fmt.Errorf("new contract instance failed: %v, %s", err, grp.market)
+	}
+
+	// read the confirmed order, an activation may disappear in a reorg
+	opts, err := grp.confirmedOpts(context.Background())
 	if err != nil {
-		return nil, fmt.Errorf("new contract instance failed: %v, %s", err, MarketAddr)
+		return nil, err
 	}
 
 	// get order info
-	orderInfo, err := marketIns.GetOrder(&bind.CallOpts{}, id)
+	orderInfo, err := marketIns.GetOrder(opts, id)
 	if err != nil {
-		return nil, fmt.Errorf("getorder failed: %v, %s", err, MarketAddr)
+		return nil, fmt.Errorf("getorder failed: %w, %s", chainerr.Decode(err), grp.market)
 	}
 
 	return &orderInfo, nil
@@ -433,16 +436,20 @@ func (grp *GatewayRemoteProcess) GetOrder(id uint64) (*market.IMarketOrder, erro
 
 // process the order check
 func (grp *GatewayRemoteProcess) OrderCheck(id uint64) (bool, error) {
+	// a cancelled or completed order in the confirmed status is rejected without reading the chain
+	if orders := grp.orders.Load(); orders != nil {
+		if r, ok, err := orders.get(id); err == nil && ok && r.final() && orders.confirmed(r, grp.confirmations) {
+			return false, fmt.Errorf("only active order can get cookie: %s", orderStatusText(r.Status))
+		}
+	}
 
 	// get order info with params
 	orderInfo, err := grp.GetOrder(id)
 	if err != nil {
-		return false, fmt.Errorf("get order failed: %s", err.Error())
+		return false, fmt.Errorf("get order failed: %w", err)
 	}
 	logger.Debug("order info:", orderInfo)
 
-	// TODO: cache check
-
 	// static check
 	ok, err := grp.StaticCheck(*orderInfo)
 	if !ok {
@@ -460,19 +467,8 @@ func (grp *GatewayRemoteProcess) OrderCheck(id uint64) (bool, error) {
 	logger.Debug("payee check ok")
 
 	// check status must be activated
-	if orderInfo.Status != 2 {
-		var status string
-		switch orderInfo.Status {
-		case 0:
-			status = "order not exist"
-		case 1:
-			status = "order unactive"
-		case 3:
-			status = "order cancelled"
-		case 4:
-			status = "order completed"
-		}
-		return false, fmt.Errorf("only active order can get cookie: %s", status)
+	if orderInfo.Status != orderActive {
+		return false, fmt.Errorf("only active order can get cookie: %s", orderStatusText(orderInfo.Status))
 	}
 
 	// // check authorize
@@ -0,0 +1,361 @@
+package rpcpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gridprotocol/computing-api/lib/logc"
+)
+
+var logger = logc.Logger("rpcpool")
+
+// health policy of the endpoints, zero for the default
+type Config struct {
+	// endpoints behind the highest block by more than it are skipped
+	MaxBlockLag uint64
+	// endpoints with a higher error rate are skipped, in [0, 1]
+	MaxErrorRate float64
+	// interval of the health checks
+	CheckInterval time.Duration
+	// timeout of a health check
+	CheckTimeout time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxBlockLag:   5,
+		MaxErrorRate:  0.5,
+		CheckInterval: 15 * time.Second,
+		CheckTimeout:  5 * time.Second,
+	}
+}
+
+// fill the zero fields with the default
+func (c Config) withDefault() Config {
+	d := DefaultConfig()
+	if c.MaxBlockLag == 0 {
+		c.MaxBlockLag = d.MaxBlockLag
+	}
+	if c.MaxErrorRate == 0 {
+		c.MaxErrorRate = d.MaxErrorRate
+	}
+	if c.CheckInterval == 0 {
+		c.CheckInterval = d.CheckInterval
+	}
+	if c.CheckTimeout == 0 {
+		c.CheckTimeout = d.CheckTimeout
+	}
+	return c
+}
+
+// weight of the latest sample in the moving averages of latency and error rate
+const ewmaWeight = 0.2
+
+// an rpc endpoint and its health
+type endpoint struct {
+	url    string
+	client *ethclient.Client
+
+	mu      sync.Mutex
+	height  uint64
+	latency time.Duration
+	errRate float64
+	// the last health check failed
+	down bool
+	// the chain id is not the one of the pool, it's never used until it's fixed
+	wrongChain bool
+	checked    time.Time
+}
+
+// record a request to the endpoint
+func (e *endpoint) observe(latency time.Duration, failed bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency = time.Duration(ewmaWeight*float64(latency) + (1-ewmaWeight)*float64(e.latency))
+	}
+
+	sample := 0.0
+	if failed {
+		sample = 1
+	}
+	e.errRate = ewmaWeight*sample + (1-ewmaWeight)*e.errRate
+}
+
+// Health is a snapshot of the health of an endpoint
+type Health struct {
+	URL        string
+	Height     uint64
+	Latency    time.Duration
+	ErrorRate  float64
+	Down       bool
+	WrongChain bool
+	Healthy    bool
+	Checked    time.Time
+}
+
+// Pool routes the chain requests to the healthiest rpc endpoint of a chain,
+// and fails over to the others when the endpoint is down or rate limited.
+type Pool struct {
+	cfg     Config
+	chainID *big.Int
+	eps     []*endpoint
+}
+
+// dial the rpc urls of a chain, the chain id reported by each reachable one must be chainID.
+// Unreachable ones are kept and used when they are back, but one of them must be reachable.
+func Dial(ctx context.Context, urls []string, chainID uint64, cfg Config) (*Pool, error) {
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no rpc url")
+	}
+
+	p := &Pool{
+		cfg:     cfg.withDefault(),
+		chainID: new(big.Int).SetUint64(chainID),
+	}
+
+	var errs []error
+	for _, url := range urls {
+		client, err := ethclient.DialContext(ctx, url)
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("dial %s failed: %s", url, err.Error())
+		}
+		ep := &endpoint{url: url, client: client}
+		p.eps = append(p.eps, ep)
+
+		cctx, cancel := context.WithTimeout(ctx, p.cfg.CheckTimeout)
+		id, err := client.ChainID(cctx)
+		cancel()
+		if err != nil {
+			logger.Warn("rpc ", url, " is unavailable: ", err)
+			ep.down = true
+			errs = append(errs, fmt.Errorf("get chain id of %s failed: %s", url, err.Error()))
+			continue
+		}
+		if id.Cmp(p.chainID) != 0 {
+			// a wrong chain is a config error, never fall back from it silently
+			p.Close()
+			return nil, fmt.Errorf("chain id of rpc %s is %s, but %d is expected", url, id, chainID)
+		}
+	}
+
+	if len(errs) == len(urls) {
+		p.Close()
+		return nil, fmt.Errorf("no rpc is available: %v", errs)
+	}
+
+	p.Check(ctx)
+
+	return p, nil
+}
+
+// close the clients of all endpoints
+func (p *Pool) Close() {
+	for _, ep := range p.eps {
+		ep.client.Close()
+	}
+}
+
+// check the height and latency of all endpoints concurrently
+func (p *Pool) Check(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, ep := range p.eps {
+		wg.Add(1)
+		go func(ep *endpoint) {
+			defer wg.Done()
+
+			cctx, cancel := context.WithTimeout(ctx, p.cfg.CheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			height, err := ep.client.BlockNumber(cctx)
+			ep.observe(time.Since(start), err != nil)
+
+			// the rpc may be pointed to another chain while it's down
+			ep.mu.Lock()
+			recovering := ep.down
+			ep.mu.Unlock()
+			wrongChain := false
+			if err == nil && recovering {
+				err = p.checkChainID(cctx, ep)
+				wrongChain = errors.Is(err, errWrongChain)
+			}
+
+			ep.mu.Lock()
+			defer ep.mu.Unlock()
+			ep.checked = time.Now()
+			if err != nil {
+				if wrongChain && !ep.wrongChain {
+					logger.Error("rpc ", ep.url, " is out of rotation: ", err)
+				} else if !ep.down {
+					logger.Warn("rpc ", ep.url, " is down: ", err)
+				}
+				ep.down = true
+				ep.wrongChain = wrongChain
+				return
+			}
+			if ep.down {
+				logger.Info("rpc ", ep.url, " is back")
+			}
+			ep.down = false
+			ep.wrongChain = false
+			ep.height = height
+		}(ep)
+	}
+	wg.Wait()
+}
+
+// an endpoint reports a chain id other than the one of the pool
+var errWrongChain = errors.New("wrong chain id")
+
+// check the chain id of an endpoint is the one of the pool
+func (p *Pool) checkChainID(ctx context.Context, ep *endpoint) error {
+	id, err := ep.client.ChainID(ctx)
+	if err != nil {
+		return fmt.Errorf("get chain id failed: %s", err.Error())
+	}
+	if id.Cmp(p.chainID) != 0 {
+		return fmt.Errorf("%w: %s, but %s is expected", errWrongChain, id, p.chainID)
+	}
+	return nil
+}
+
+// check the endpoints periodically until ctx is done
+func (p *Pool) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.Check(ctx)
+		}
+	}
+}
+
+// health of the endpoints in the order of urls
+func (p *Pool) Status() []Health {
+	var top uint64
+	hs := make([]Health, len(p.eps))
+	for i, ep := range p.eps {
+		ep.mu.Lock()
+		hs[i] = Health{
+			URL:        ep.url,
+			Height:     ep.height,
+			Latency:    ep.latency,
+			ErrorRate:  ep.errRate,
+			Down:       ep.down,
+			WrongChain: ep.wrongChain,
+			Checked:    ep.checked,
+		}
+		ep.mu.Unlock()
+		if !hs[i].Down && hs[i].Height > top {
+			top = hs[i].Height
+		}
+	}
+
+	for i := range hs {
+		h := &hs[i]
+		h.Healthy = !h.Down && h.ErrorRate <= p.cfg.MaxErrorRate && top-h.Height <= p.cfg.MaxBlockLag
+	}
+
+	return hs
+}
+
+// endpoints to try in order, the healthy ones by latency and error rate,
+// then the others as the last resort. The ones on a wrong chain are never tried.
+func (p *Pool) ranked() []*endpoint {
+	hs := p.Status()
+	idx := make([]int, 0, len(hs))
+	for i, h := range hs {
+		if !h.WrongChain {
+			idx = append(idx, i)
+		}
+	}
+
+	score := func(h Health) float64 {
+		return float64(h.Latency) * (1 + 4*h.ErrorRate)
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		ha, hb := hs[idx[a]], hs[idx[b]]
+		if ha.Healthy != hb.Healthy {
+			return ha.Healthy
+		}
+		return score(ha) < score(hb)
+	})
+
+	eps := make([]*endpoint, len(idx))
+	for i, j := range idx {
+		eps[i] = p.eps[j]
+	}
+	return eps
+}
+
+// url of the endpoint the requests are routed to now, empty if none is on the chain
+func (p *Pool) Best() string {
+	eps := p.ranked()
+	if len(eps) == 0 {
+		return ""
+	}
+	return eps[0].url
+}
+
+// chain id checked at dial
+func (p *Pool) ChainID(ctx context.Context) (*big.Int, error) {
+	return new(big.Int).Set(p.chainID), nil
+}
+
+// run fn on the endpoints in the order of health until it is not failed by the endpoint
+func do[T any](p *Pool, ctx context.Context, fn func(*ethclient.Client) (T, error)) (T, error) {
+	var res T
+	err := fmt.Errorf("no rpc of chain %s", p.chainID)
+	for _, ep := range p.ranked() {
+		start := time.Now()
+		res, err = fn(ep.client)
+		failed := err != nil && endpointFailed(ctx, err)
+		ep.observe(time.Since(start), failed)
+		if !failed {
+			return res, err
+		}
+		logger.Debug("rpc ", ep.url, " failed, try the next one: ", err)
+	}
+
+	return res, fmt.Errorf("all rpcs failed: %w", err)
+}
+
+// json rpc error code of rate limit used by many providers
+const codeLimitExceeded = -32005
+
+// whether err is a failure of the endpoint to try another one with,
+// rather than an answer of the chain like a revert or a missing receipt
+func endpointFailed(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		// cancelled by the caller
+		return false
+	}
+	if errors.Is(err, ethereum.NotFound) {
+		return false
+	}
+
+	var re rpc.Error
+	if errors.As(err, &re) {
+		return re.ErrorCode() == codeLimitExceeded
+	}
+
+	// transport errors, http status errors and timeouts
+	return true
+}
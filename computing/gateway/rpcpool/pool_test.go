@@ -0,0 +1,272 @@
+package rpcpool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// stub json rpc node of a chain
+type stubNode struct {
+	*httptest.Server
+
+	chainID atomic.Uint64
+	height  atomic.Uint64
+	// respond with this http status if not zero
+	status atomic.Int64
+	delay  atomic.Int64
+	// requests served with result
+	served atomic.Int64
+}
+
+func newStubNode(t *testing.T, chainID, height uint64) *stubNode {
+	n := &stubNode{}
+	n.chainID.Store(chainID)
+	n.height.Store(height)
+	n.Server = httptest.NewServer(http.HandlerFunc(n.serve))
+	t.Cleanup(n.Close)
+	return n
+}
+
+func (n *stubNode) serve(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(time.Duration(n.delay.Load()))
+	if st := n.status.Load(); st != 0 {
+		http.Error(w, http.StatusText(int(st)), int(st))
+		return
+	}
+
+	var req struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var result interface{}
+	switch req.Method {
+	case "eth_chainId":
+		result = hexutil.Uint64(n.chainID.Load())
+	case "eth_blockNumber":
+		result = hexutil.Uint64(n.height.Load())
+	case "eth_call":
+		// reverted calls are answers of the chain, never failed over
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"error":{"code":3,"message":"execution reverted: nope","data":"0x"}}`, req.ID)
+		return
+	case "eth_getTransactionReceipt":
+		result = nil
+	default:
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"error":{"code":-32601,"message":"method not found"}}`, req.ID)
+		return
+	}
+
+	n.served.Add(1)
+	res, _ := json.Marshal(result)
+	fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":%s}`, req.ID, res)
+}
+
+func callMsg() ethereum.CallMsg {
+	to := common.Address{1}
+	return ethereum.CallMsg{To: &to}
+}
+
+func TestDial(t *testing.T) {
+	ctx := context.Background()
+	good := newStubNode(t, 1337, 100)
+
+	// a down rpc is kept, it is used when it is back
+	down := newStubNode(t, 1337, 100)
+	down.status.Store(http.StatusServiceUnavailable)
+	p, err := Dial(ctx, []string{down.URL, good.URL}, 1337, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if p.Best() != good.URL {
+		t.Fatalf("expected %s, got %s", good.URL, p.Best())
+	}
+
+	// a wrong chain id is an error
+	wrong := newStubNode(t, 11155111, 100)
+	if _, err := Dial(ctx, []string{wrong.URL, good.URL}, 1337, Config{}); err == nil || !strings.Contains(err.Error(), "chain id") {
+		t.Fatalf("expected chain id mismatch, got %v", err)
+	}
+
+	// none available
+	if _, err := Dial(ctx, []string{down.URL}, 1337, Config{}); err == nil {
+		t.Fatal("expected error without an available rpc")
+	}
+}
+
+func TestFailover(t *testing.T) {
+	ctx := context.Background()
+	a := newStubNode(t, 1337, 100)
+	b := newStubNode(t, 1337, 100)
+
+	p, err := Dial(ctx, []string{a.URL, b.URL}, 1337, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// rate limited by the best one, the other answers
+	best, other := a, b
+	if p.Best() == b.URL {
+		best, other = b, a
+	}
+	best.status.Store(http.StatusTooManyRequests)
+
+	before := other.served.Load()
+	for i := 0; i < 5; i++ {
+		h, err := p.BlockNumber(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h != 100 {
+			t.Fatalf("unexpected height %d", h)
+		}
+	}
+	if other.served.Load()-before != 5 {
+		t.Fatal("requests should be served by the other rpc")
+	}
+
+	// the failing one is ranked behind by its error rate
+	if p.Best() != other.URL {
+		t.Fatalf("expected %s, got %s", other.URL, p.Best())
+	}
+
+	// all down
+	other.status.Store(http.StatusBadGateway)
+	if _, err := p.BlockNumber(ctx); err == nil || !strings.Contains(err.Error(), "all rpcs failed") {
+		t.Fatalf("expected all failed, got %v", err)
+	}
+}
+
+func TestNoFailoverOnAnswers(t *testing.T) {
+	ctx := context.Background()
+	a := newStubNode(t, 1337, 100)
+	b := newStubNode(t, 1337, 100)
+
+	p, err := Dial(ctx, []string{a.URL, b.URL}, 1337, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// a revert is returned by the first rpc
+	_, err = p.CallContract(ctx, callMsg(), nil)
+	if err == nil || !strings.Contains(err.Error(), "execution reverted") {
+		t.Fatalf("expected revert, got %v", err)
+	}
+	for _, h := range p.Status() {
+		if h.ErrorRate != 0 {
+			t.Fatalf("revert should not count as an rpc error: %+v", h)
+		}
+	}
+
+	// a missing receipt as well
+	var r *types.Receipt
+	if r, err = p.TransactionReceipt(ctx, common.Hash{1}); err == nil || r != nil {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	ctx := context.Background()
+	fast := newStubNode(t, 1337, 100)
+	slow := newStubNode(t, 1337, 100)
+	slow.delay.Store(int64(30 * time.Millisecond))
+
+	p, err := Dial(ctx, []string{slow.URL, fast.URL}, 1337, Config{MaxBlockLag: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// lower latency first
+	if p.Best() != fast.URL {
+		t.Fatalf("expected the fast one %s, got %s", fast.URL, p.Best())
+	}
+
+	// lagging behind the highest block
+	slow.height.Store(120)
+	p.Check(ctx)
+	hs := p.Status()
+	if !hs[0].Healthy || hs[1].Healthy || hs[1].Height != 100 {
+		t.Fatalf("unexpected health: %+v", hs)
+	}
+	if p.Best() != slow.URL {
+		t.Fatalf("expected the synced one %s, got %s", slow.URL, p.Best())
+	}
+
+	// down in checks and back
+	slow.status.Store(http.StatusServiceUnavailable)
+	p.Check(ctx)
+	if hs := p.Status(); !hs[0].Down || hs[0].Healthy {
+		t.Fatalf("unexpected health: %+v", hs[0])
+	}
+	if p.Best() != fast.URL {
+		t.Fatalf("expected %s, got %s", fast.URL, p.Best())
+	}
+
+	slow.status.Store(0)
+	fast.height.Store(120)
+	p.Check(ctx)
+	if hs := p.Status(); hs[0].Down || !hs[1].Healthy {
+		t.Fatalf("unexpected health: %+v", hs)
+	}
+}
+
+// a rpc back on another chain is out of rotation until it's on the chain again
+func TestRecoverOnWrongChain(t *testing.T) {
+	ctx := context.Background()
+	good := newStubNode(t, 1337, 100)
+	moved := newStubNode(t, 1337, 100)
+	moved.status.Store(http.StatusServiceUnavailable)
+
+	p, err := Dial(ctx, []string{moved.URL, good.URL}, 1337, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	moved.chainID.Store(11155111)
+	moved.status.Store(0)
+	p.Check(ctx)
+	if hs := p.Status(); !hs[0].Down || !hs[0].WrongChain || hs[0].Healthy {
+		t.Fatalf("unexpected health: %+v", hs[0])
+	}
+
+	// never tried, even as the last resort
+	good.status.Store(http.StatusServiceUnavailable)
+	p.Check(ctx)
+	served := moved.served.Load()
+	if _, err := p.BlockNumber(ctx); err == nil {
+		t.Fatal("expected failure without a rpc on the chain")
+	}
+	if moved.served.Load() != served {
+		t.Fatal("the rpc on a wrong chain is used")
+	}
+
+	// back on the chain
+	moved.chainID.Store(1337)
+	p.Check(ctx)
+	if hs := p.Status(); hs[0].Down || hs[0].WrongChain || !hs[0].Healthy {
+		t.Fatalf("unexpected health: %+v", hs[0])
+	}
+	if p.Best() != moved.URL {
+		t.Fatalf("expected %s, got %s", moved.URL, p.Best())
+	}
+}
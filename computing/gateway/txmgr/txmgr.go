@@ -0,0 +1,934 @@
+package txmgr
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gridprotocol/computing-api/computing/gateway/chainerr"
+	"github.com/gridprotocol/computing-api/keystore/signer"
+	"github.com/gridprotocol/computing-api/lib/kv"
+	"github.com/gridprotocol/computing-api/lib/logc"
+)
+
+var logger = logc.Logger("txmgr")
+
+var (
+	ErrUnknownSigner = errors.New("no signer is added for the address")
+	ErrUnknownTx     = errors.New("tx is not managed")
+)
+
+const (
+	// key of the pending tx ids
+	pendingKey = "txm_pending"
+	// prefix of the tx records
+	recordPrefix = "txm_tx_"
+	// prefix of the record id of a replacement hash
+	aliasPrefix = "txm_id_"
+)
+
+// chain access used by the manager, both ethclient and simulated backend implement it
+type Backend interface {
+	bind.ContractBackend
+	bind.DeployBackend
+	ChainID(ctx context.Context) (*big.Int, error)
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+}
+
+// gas and fee policy of the manager
+type Config struct {
+	// gas limit is the estimated gas with this margin
+	GasMarginPercent uint64
+	// caps of the fee per gas, no cap if nil
+	MaxFeeCap *big.Int
+	MaxTipCap *big.Int
+	// replace the tx with higher fees if it is not mined after it
+	ResubmitInterval time.Duration
+	// percent of fee bump for a replacement, the node requires 10 at least
+	BumpPercent uint64
+	// interval of checking the pending txs
+	PollInterval time.Duration
+	// blocks on top of the block of a tx for it to be final, 0 to trust the latest block
+	Confirmations uint64
+}
+
+// fill the zero fields with the default
+func (c Config) withDefault() Config {
+	d := DefaultConfig()
+	if c.GasMarginPercent == 0 {
+		c.GasMarginPercent = d.GasMarginPercent
+	}
+	if c.ResubmitInterval == 0 {
+		c.ResubmitInterval = d.ResubmitInterval
+	}
+	if c.BumpPercent == 0 {
+		c.BumpPercent = d.BumpPercent
+	}
+	if c.PollInterval == 0 {
+		c.PollInterval = d.PollInterval
+	}
+	return c
+}
+
+func DefaultConfig() Config {
+	return Config{
+		GasMarginPercent: 120,
+		ResubmitInterval: 3 * time.Minute,
+		BumpPercent:      15,
+		PollInterval:     3 * time.Second,
+	}
+}
+
+// gas limit of the estimated gas with the margin percent, the default margin if it's 0
+func GasLimit(gas uint64, marginPercent uint64) uint64 {
+	if marginPercent == 0 {
+		marginPercent = DefaultConfig().GasMarginPercent
+	}
+	return gas * marginPercent / 100
+}
+
+type TxStatus uint8
+
+const (
+	StatusPending TxStatus = iota
+	// mined and succeeded
+	StatusMined
+	// mined and reverted
+	StatusFailed
+	// the nonce is used by another tx
+	StatusDropped
+)
+
+func (s TxStatus) String() string {
+	switch s {
+	case StatusPending:
+		return "pending"
+	case StatusMined:
+		return "mined"
+	case StatusFailed:
+		return "failed"
+	case StatusDropped:
+		return "dropped"
+	default:
+		return "unknown"
+	}
+}
+
+// status is in its name in json
+func (s TxStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// status is parsed from its name
+func (s *TxStatus) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	for v := StatusPending; v <= StatusDropped; v++ {
+		if v.String() == name {
+			*s = v
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown tx status %s", name)
+}
+
+// Record of a managed tx, id is the hash of its first submission,
+// all replacements with the same nonce share it.
+type Record struct {
+	ID     common.Hash    `json:"id"`
+	Name   string         `json:"name"`
+	From   common.Address `json:"from"`
+	Nonce  uint64         `json:"nonce"`
+	Hashes []common.Hash  `json:"hashes"`
+	// latest signed tx
+	Raw     hexutil.Bytes `json:"raw"`
+	Status  TxStatus      `json:"status"`
+	Sent    time.Time     `json:"sent"`
+	Updated time.Time     `json:"updated"`
+
+	// set when the tx is mined
+	Hash    common.Hash    `json:"hash,omitempty"`
+	Block   uint64         `json:"block,omitempty"`
+	GasUsed uint64         `json:"gasUsed,omitempty"`
+	Receipt *types.Receipt `json:"receipt,omitempty"`
+	// decoded revert reason of a failed tx, and its stable code
+	Reason string `json:"reason,omitempty"`
+	Code   string `json:"code,omitempty"`
+	Err    string `json:"err,omitempty"`
+}
+
+// check if the tx is mined or dropped
+func (r *Record) Final() bool {
+	return r.Status != StatusPending
+}
+
+// latest signed tx
+func (r *Record) Tx() (*types.Transaction, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(r.Raw); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// signer and nonce state of an address, sending is serialized by mu
+type account struct {
+	mu sync.Mutex
+	sg signer.Signer
+	// next nonce, valid if known
+	next  uint64
+	known bool
+}
+
+// Manager sends the txs of the gateway keys, tracks their nonces and pending txs,
+// and replaces the ones stuck in the pool.
+type Manager struct {
+	backend Backend
+	db      kv.Store
+	cfg     Config
+	chainID *big.Int
+
+	mu      sync.Mutex
+	signers map[common.Address]*account
+	// pending records by id, and id of all hashes sent
+	pending map[common.Hash]*Record
+	ids     map[common.Hash]common.Hash
+	// called with the record when a tx is finished
+	subs []func(*Record)
+
+	// for testing
+	now func() time.Time
+}
+
+// make a manager and load the pending txs from db, db can be nil for not persisting.
+// zero fields in cfg take the default.
+func NewManager(backend Backend, db kv.Store, cfg Config) (*Manager, error) {
+	chainID, err := backend.ChainID(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("get chain id failed: %s", err.Error())
+	}
+
+	m := &Manager{
+		backend: backend,
+		db:      db,
+		cfg:     cfg.withDefault(),
+		chainID: chainID,
+		signers: make(map[common.Address]*account),
+		pending: make(map[common.Hash]*Record),
+		ids:     make(map[common.Hash]common.Hash),
+		now:     time.Now,
+	}
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// chain id of the backend
+func (m *Manager) ChainID() *big.Int {
+	return new(big.Int).Set(m.chainID)
+}
+
+// add a key for sending txs, return its address
+func (m *Manager) AddKey(key *ecdsa.PrivateKey) common.Address {
+	return m.AddSigner(signer.NewKeySigner(key))
+}
+
+// add a signer for sending txs, return its address
+func (m *Manager) AddSigner(sg signer.Signer) common.Address {
+	addr := sg.Address()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.signers[addr]; ok {
+		s.sg = sg
+		return addr
+	}
+	m.signers[addr] = &account{sg: sg}
+
+	return addr
+}
+
+// call fn in a new goroutine when a tx is mined, reverted or dropped
+func (m *Manager) OnFinal(fn func(*Record)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subs = append(m.subs, fn)
+}
+
+// build a tx with the opts filled with nonce, fees and gas, sign and send it.
+// build is called twice, the first is a dry run (opts.NoSend) for estimating gas.
+func (m *Manager) Send(ctx context.Context, from common.Address, name string, build func(*bind.TransactOpts) (*types.Transaction, error)) (*Record, error) {
+	m.mu.Lock()
+	s, ok := m.signers[from]
+	m.mu.Unlock()
+	if !ok {
+		return nil, ErrUnknownSigner
+	}
+
+	// one tx at a time for a signer
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nonce, err := m.nextNonce(ctx, from, s)
+	if err != nil {
+		return nil, err
+	}
+
+	auth := &bind.TransactOpts{
+		From: from,
+		Signer: func(addr common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if addr != from {
+				return nil, bind.ErrNotAuthorized
+			}
+			return s.sg.SignTx(tx, m.chainID)
+		},
+		Context: ctx,
+	}
+	auth.Nonce = new(big.Int).SetUint64(nonce)
+	if err := m.setFees(ctx, auth); err != nil {
+		return nil, err
+	}
+
+	// dry run to estimate gas
+	auth.NoSend = true
+	tx, err := build(auth)
+	if err != nil {
+		return nil, fmt.Errorf("estimate gas for %s failed: %w", name, chainerr.Decode(err))
+	}
+
+	// sign with the gas margin, and send it after persisted
+	auth.GasLimit = GasLimit(tx.Gas(), m.cfg.GasMarginPercent)
+	tx, err = build(auth)
+	if err != nil {
+		return nil, fmt.Errorf("sign %s tx failed: %w", name, err)
+	}
+
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.now()
+	rec := &Record{
+		ID:      tx.Hash(),
+		Name:    name,
+		From:    from,
+		Nonce:   nonce,
+		Hashes:  []common.Hash{tx.Hash()},
+		Raw:     raw,
+		Status:  StatusPending,
+		Sent:    now,
+		Updated: now,
+	}
+	if err := m.track(rec); err != nil {
+		return nil, err
+	}
+
+	if err := m.backend.SendTransaction(ctx, tx); err != nil {
+		// nonce may be used outside, read it from chain next time
+		s.known = false
+		m.finish(rec.ID, func(r *Record) {
+			r.Status = StatusDropped
+			r.Err = err.Error()
+		})
+		return nil, fmt.Errorf("send %s tx failed: %w", name, err)
+	}
+	s.next = nonce + 1
+	s.known = true
+
+	logger.Debugf("%s tx sent, hash: %s, nonce: %d", name, tx.Hash(), nonce)
+
+	return rec.copy(), nil
+}
+
+// track and send a tx signed outside, e.g. by a user. It is never replaced for no key is held.
+func (m *Manager) SendSigned(ctx context.Context, name string, tx *types.Transaction) (*Record, error) {
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return nil, fmt.Errorf("recover tx signer failed: %s", err.Error())
+	}
+
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.now()
+	rec := &Record{
+		ID:      tx.Hash(),
+		Name:    name,
+		From:    from,
+		Nonce:   tx.Nonce(),
+		Hashes:  []common.Hash{tx.Hash()},
+		Raw:     raw,
+		Status:  StatusPending,
+		Sent:    now,
+		Updated: now,
+	}
+	if err := m.track(rec); err != nil {
+		return nil, err
+	}
+
+	if err := m.backend.SendTransaction(ctx, tx); err != nil {
+		m.finish(rec.ID, func(r *Record) {
+			r.Status = StatusDropped
+			r.Err = err.Error()
+		})
+		return nil, fmt.Errorf("send %s tx failed: %w", name, err)
+	}
+
+	logger.Debugf("%s tx sent, hash: %s, signer: %s", name, tx.Hash(), from)
+
+	return rec.copy(), nil
+}
+
+// the nonce for the next tx of a signer
+func (m *Manager) nextNonce(ctx context.Context, from common.Address, s *account) (uint64, error) {
+	nonce, err := m.backend.PendingNonceAt(ctx, from)
+	if err != nil {
+		return 0, fmt.Errorf("get nonce failed: %s", err.Error())
+	}
+
+	if s.known && s.next > nonce {
+		nonce = s.next
+	}
+
+	// txs persisted before restart may not be in the pool
+	m.mu.Lock()
+	for _, r := range m.pending {
+		if r.From == from && r.Nonce >= nonce {
+			nonce = r.Nonce + 1
+		}
+	}
+	m.mu.Unlock()
+
+	return nonce, nil
+}
+
+// fill the fees of a tx, dynamic fee if the chain supports it
+func (m *Manager) setFees(ctx context.Context, auth *bind.TransactOpts) error {
+	head, err := m.backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("get latest header failed: %s", err.Error())
+	}
+
+	if head.BaseFee == nil {
+		gasPrice, err := m.backend.SuggestGasPrice(ctx)
+		if err != nil {
+			return fmt.Errorf("suggest gas price failed: %s", err.Error())
+		}
+		auth.GasPrice = capFee(gasPrice, m.cfg.MaxFeeCap)
+		return nil
+	}
+
+	tip, err := m.backend.SuggestGasTipCap(ctx)
+	if err != nil {
+		return fmt.Errorf("suggest gas tip failed: %s", err.Error())
+	}
+	tip = capFee(tip, m.cfg.MaxTipCap)
+
+	// base fee may double in a few blocks
+	feeCap := new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), tip)
+	feeCap = capFee(feeCap, m.cfg.MaxFeeCap)
+	if tip.Cmp(feeCap) > 0 {
+		tip = new(big.Int).Set(feeCap)
+	}
+
+	auth.GasTipCap = tip
+	auth.GasFeeCap = feeCap
+
+	return nil
+}
+
+// wait until the tx is mined or dropped, id is any hash of the tx
+func (m *Manager) Wait(ctx context.Context, id common.Hash) (*Record, error) {
+	for {
+		rec, err := m.Check(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if rec.Final() {
+			return rec, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return rec, ctx.Err()
+		case <-time.After(m.cfg.PollInterval):
+		}
+	}
+}
+
+// get the record of a tx, id is any hash of the tx
+func (m *Manager) Get(id common.Hash) (*Record, error) {
+	m.mu.Lock()
+	if rid, ok := m.ids[id]; ok {
+		id = rid
+	}
+	rec, ok := m.pending[id]
+	if ok {
+		defer m.mu.Unlock()
+		return rec.copy(), nil
+	}
+	m.mu.Unlock()
+
+	// finished ones are in db only
+	if m.db == nil {
+		return nil, ErrUnknownTx
+	}
+	return m.getRecord(id)
+}
+
+// all pending txs
+func (m *Manager) Pending() []*Record {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := make([]*Record, 0, len(m.pending))
+	for _, r := range m.pending {
+		res = append(res, r.copy())
+	}
+	return res
+}
+
+// check the receipts of a pending tx, the stuck ones are replaced by Run only
+func (m *Manager) Check(ctx context.Context, id common.Hash) (*Record, error) {
+	return m.check(ctx, id, false)
+}
+
+// check a pending tx, and replace it if it's stuck and resubmit is set
+func (m *Manager) check(ctx context.Context, id common.Hash, resubmit bool) (*Record, error) {
+	rec, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Final() {
+		return rec, nil
+	}
+
+	// read the nonce before receipts, a used nonce without our receipt means dropped
+	used, err := m.backend.NonceAt(ctx, rec.From, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get nonce failed: %s", err.Error())
+	}
+
+	for _, h := range rec.Hashes {
+		receipt, err := m.backend.TransactionReceipt(ctx, h)
+		if err != nil {
+			if errors.Is(err, ethereum.NotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("get receipt failed: %s", err.Error())
+		}
+
+		// kept pending until it's deep enough to survive a reorg
+		if m.cfg.Confirmations > 0 {
+			head, err := m.backend.HeaderByNumber(ctx, nil)
+			if err != nil {
+				return nil, fmt.Errorf("get head failed: %s", err.Error())
+			}
+			depth := new(big.Int).Sub(head.Number, receipt.BlockNumber)
+			if depth.Sign() < 0 || depth.Uint64() < m.cfg.Confirmations {
+				return rec, nil
+			}
+		}
+
+		var reason *chainerr.Error
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			reason = m.revertReason(ctx, rec, receipt)
+		}
+
+		return m.finish(rec.ID, func(r *Record) {
+			r.Hash = h
+			r.Block = receipt.BlockNumber.Uint64()
+			r.GasUsed = receipt.GasUsed
+			r.Receipt = receipt
+			if receipt.Status == types.ReceiptStatusSuccessful {
+				r.Status = StatusMined
+			} else {
+				r.Status = StatusFailed
+				r.Reason = reason.Reason
+				r.Code = string(reason.Code)
+				r.Err = "tx reverted"
+				if reason.Reason != "" {
+					r.Err += ": " + reason.Reason
+				}
+			}
+		}), nil
+	}
+
+	if used > rec.Nonce {
+		return m.finish(rec.ID, func(r *Record) {
+			r.Status = StatusDropped
+			r.Err = fmt.Sprintf("nonce %d is used by another tx", r.Nonce)
+		}), nil
+	}
+
+	if !resubmit {
+		return rec, nil
+	}
+
+	m.mu.Lock()
+	_, own := m.signers[rec.From]
+	m.mu.Unlock()
+
+	if own && m.now().Sub(rec.Updated) >= m.cfg.ResubmitInterval {
+		if err := m.replace(ctx, rec); err != nil {
+			logger.Warn("replace stuck tx failed: ", err)
+		}
+	}
+
+	return m.Get(rec.ID)
+}
+
+// replay a reverted tx on the state before its block, and decode the revert data
+func (m *Manager) revertReason(ctx context.Context, rec *Record, receipt *types.Receipt) *chainerr.Error {
+	unknown := &chainerr.Error{Code: chainerr.CodeReverted}
+
+	tx, err := rec.Tx()
+	if err != nil {
+		return unknown
+	}
+
+	msg := ethereum.CallMsg{
+		From:  rec.From,
+		To:    tx.To(),
+		Gas:   tx.Gas(),
+		Value: tx.Value(),
+		Data:  tx.Data(),
+	}
+	parent := new(big.Int).Sub(receipt.BlockNumber, big.NewInt(1))
+
+	_, err = m.backend.CallContract(ctx, msg, parent)
+	if err == nil {
+		// reverted for the state changed by the txs before it in the block
+		return unknown
+	}
+
+	if ce, ok := chainerr.As(chainerr.Decode(err)); ok {
+		return ce
+	}
+	unknown.Reason = err.Error()
+	return unknown
+}
+
+// check all pending txs periodly and replace the stuck ones until ctx is done
+func (m *Manager) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(m.cfg.PollInterval):
+		}
+
+		for _, r := range m.Pending() {
+			if _, err := m.check(ctx, r.ID, true); err != nil {
+				logger.Debug("check pending tx failed: ", err)
+			}
+		}
+	}
+}
+
+// send the stuck tx again with bumped fees and the same nonce
+func (m *Manager) replace(ctx context.Context, rec *Record) error {
+	m.mu.Lock()
+	s, ok := m.signers[rec.From]
+	m.mu.Unlock()
+	if !ok {
+		return ErrUnknownSigner
+	}
+
+	// serialized with the sends of the account
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// re-read under the lock, it may be finished or replaced meanwhile
+	m.mu.Lock()
+	cur, ok := m.pending[rec.ID]
+	if ok {
+		rec = cur.copy()
+	}
+	m.mu.Unlock()
+	if !ok || m.now().Sub(rec.Updated) < m.cfg.ResubmitInterval {
+		return nil
+	}
+
+	old, err := rec.Tx()
+	if err != nil {
+		return err
+	}
+
+	// the new fees are the bumped old ones, or current suggestion if it's higher
+	auth := &bind.TransactOpts{}
+	if err := m.setFees(ctx, auth); err != nil {
+		return err
+	}
+
+	var inner types.TxData
+	switch old.Type() {
+	case types.LegacyTxType:
+		gasPrice := maxFee(m.bump(old.GasPrice()), auth.GasPrice)
+		if auth.GasPrice == nil {
+			gasPrice = maxFee(m.bump(old.GasPrice()), auth.GasFeeCap)
+		}
+		gasPrice = capFee(gasPrice, m.cfg.MaxFeeCap)
+		if gasPrice.Cmp(old.GasPrice()) <= 0 {
+			return fmt.Errorf("gas price reaches the cap")
+		}
+		inner = &types.LegacyTx{
+			Nonce:    old.Nonce(),
+			GasPrice: gasPrice,
+			Gas:      old.Gas(),
+			To:       old.To(),
+			Value:    old.Value(),
+			Data:     old.Data(),
+		}
+	default:
+		tip := capFee(maxFee(m.bump(old.GasTipCap()), auth.GasTipCap), m.cfg.MaxTipCap)
+		feeCap := capFee(maxFee(m.bump(old.GasFeeCap()), auth.GasFeeCap), m.cfg.MaxFeeCap)
+		if tip.Cmp(feeCap) > 0 {
+			tip = new(big.Int).Set(feeCap)
+		}
+		if feeCap.Cmp(old.GasFeeCap()) <= 0 || tip.Cmp(old.GasTipCap()) <= 0 {
+			return fmt.Errorf("fee reaches the cap")
+		}
+		inner = &types.DynamicFeeTx{
+			ChainID:   m.chainID,
+			Nonce:     old.Nonce(),
+			GasTipCap: tip,
+			GasFeeCap: feeCap,
+			Gas:       old.Gas(),
+			To:        old.To(),
+			Value:     old.Value(),
+			Data:      old.Data(),
+		}
+	}
+
+	tx, err := s.sg.SignTx(types.NewTx(inner), m.chainID)
+	if err != nil {
+		return err
+	}
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	// record it first, the receipt may come with its hash
+	m.mu.Lock()
+	r, ok := m.pending[rec.ID]
+	if !ok {
+		m.mu.Unlock()
+		return nil
+	}
+	r.Hashes = append(r.Hashes, tx.Hash())
+	r.Raw = raw
+	r.Updated = m.now()
+	m.ids[tx.Hash()] = r.ID
+	err = m.putRecord(r)
+	if err == nil && m.db != nil {
+		err = m.db.Put([]byte(aliasPrefix+tx.Hash().Hex()), r.ID.Bytes())
+	}
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	logger.Debugf("replace %s tx %s with %s", rec.Name, rec.ID, tx.Hash())
+
+	return m.backend.SendTransaction(ctx, tx)
+}
+
+func (m *Manager) bump(fee *big.Int) *big.Int {
+	v := new(big.Int).Mul(fee, new(big.Int).SetUint64(100+m.cfg.BumpPercent))
+	v.Div(v, big.NewInt(100))
+	// at least 1 wei more
+	if v.Cmp(fee) <= 0 {
+		v.Add(fee, big.NewInt(1))
+	}
+	return v
+}
+
+// add a pending record
+func (m *Manager) track(rec *Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pending[rec.ID] = rec
+	for _, h := range rec.Hashes {
+		m.ids[h] = rec.ID
+	}
+
+	if err := m.putRecord(rec); err != nil {
+		return err
+	}
+	return m.putPending()
+}
+
+// finish a pending record with update, return the result
+func (m *Manager) finish(id common.Hash, update func(r *Record)) *Record {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.pending[id]
+	if !ok {
+		// finished by others
+		if rec, err := m.getRecord(id); err == nil {
+			return rec
+		}
+		return nil
+	}
+
+	update(r)
+	r.Updated = m.now()
+	for _, fn := range m.subs {
+		go fn(r.copy())
+	}
+	delete(m.pending, id)
+	for _, h := range r.Hashes {
+		delete(m.ids, h)
+	}
+
+	if err := m.putRecord(r); err != nil {
+		logger.Error("persist tx record failed: ", err)
+	}
+	if err := m.putPending(); err != nil {
+		logger.Error("persist pending txs failed: ", err)
+	}
+
+	logger.Debugf("%s tx %s is %s", r.Name, r.ID, r.Status)
+
+	return r.copy()
+}
+
+// load the pending records from db
+func (m *Manager) load() error {
+	if m.db == nil {
+		return nil
+	}
+
+	has, err := m.db.Has([]byte(pendingKey))
+	if err != nil || !has {
+		return err
+	}
+
+	val, err := m.db.Get([]byte(pendingKey))
+	if err != nil {
+		return err
+	}
+	var ids []common.Hash
+	if err := json.Unmarshal(val, &ids); err != nil {
+		return fmt.Errorf("decode pending txs failed: %s", err.Error())
+	}
+
+	for _, id := range ids {
+		rec, err := m.getRecord(id)
+		if err != nil {
+			return err
+		}
+		if rec.Final() {
+			continue
+		}
+		m.pending[rec.ID] = rec
+		for _, h := range rec.Hashes {
+			m.ids[h] = rec.ID
+		}
+	}
+	logger.Debug("pending txs loaded: ", len(m.pending))
+
+	return nil
+}
+
+// persist a record, caller holds mu
+func (m *Manager) putRecord(r *Record) error {
+	if m.db == nil {
+		return nil
+	}
+	val, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return m.db.Put([]byte(recordPrefix+r.ID.Hex()), val)
+}
+
+// persist the ids of pending records, caller holds mu
+func (m *Manager) putPending() error {
+	if m.db == nil {
+		return nil
+	}
+	ids := make([]common.Hash, 0, len(m.pending))
+	for id := range m.pending {
+		ids = append(ids, id)
+	}
+	val, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	return m.db.Put([]byte(pendingKey), val)
+}
+
+func (m *Manager) getRecord(id common.Hash) (*Record, error) {
+	if m.db == nil {
+		return nil, ErrUnknownTx
+	}
+
+	key := []byte(recordPrefix + id.Hex())
+	has, err := m.db.Has(key)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		// a replacement hash
+		rid, err := m.db.Get([]byte(aliasPrefix + id.Hex()))
+		if err != nil {
+			return nil, ErrUnknownTx
+		}
+		key = []byte(recordPrefix + common.BytesToHash(rid).Hex())
+	}
+
+	val, err := m.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	rec := new(Record)
+	if err := json.Unmarshal(val, rec); err != nil {
+		return nil, fmt.Errorf("decode tx record failed: %s", err.Error())
+	}
+	return rec, nil
+}
+
+func (r *Record) copy() *Record {
+	c := *r
+	c.Hashes = append([]common.Hash{}, r.Hashes...)
+	c.Raw = append(hexutil.Bytes{}, r.Raw...)
+	return &c
+}
+
+// min of fee and cap, cap is ignored if nil
+func capFee(fee *big.Int, cap *big.Int) *big.Int {
+	if cap != nil && fee.Cmp(cap) > 0 {
+		return new(big.Int).Set(cap)
+	}
+	return fee
+}
+
+func maxFee(a, b *big.Int) *big.Int {
+	if b == nil || a.Cmp(b) >= 0 {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,464 @@
+package txmgr
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/gridprotocol/computing-api/computing/gateway/chainerr"
+	"github.com/gridprotocol/computing-api/lib/kv"
+)
+
+const (
+	// runtime: log the calldata, init: return the runtime
+	logCode = "600b600c600039600b6000f3" + "366000600037366000a000"
+	// runtime: revert
+	revertCode = "6005600c60003960056000f3" + "60006000fd"
+	// runtime: revert with the calldata
+	echoRevertCode = "600a600c600039600a6000f3" + "366000600037366000fd"
+)
+
+type testChain struct {
+	sim  *simulated.Backend
+	key  *ecdsa.PrivateKey
+	from common.Address
+	log  common.Address
+	rev  common.Address
+}
+
+func newTestChain(t *testing.T) *testChain {
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	sim := simulated.NewBackend(types.GenesisAlloc{
+		from: {Balance: new(big.Int).Mul(big.NewInt(1e18), big.NewInt(100))},
+	})
+	t.Cleanup(func() { sim.Close() })
+
+	tc := &testChain{sim: sim, key: key, from: from}
+	tc.log = tc.deploy(t, logCode)
+	tc.rev = tc.deploy(t, revertCode)
+	return tc
+}
+
+func (tc *testChain) deploy(t *testing.T, code string) common.Address {
+	auth, err := bind.NewKeyedTransactorWithChainID(tc.key, big.NewInt(1337))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, _, _, err := bind.DeployContract(auth, abi.ABI{}, common.FromHex(code), tc.sim.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc.sim.Commit()
+	return addr
+}
+
+// call the contract with raw data
+func (tc *testChain) call(to common.Address, data string) func(*bind.TransactOpts) (*types.Transaction, error) {
+	return func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		c := bind.NewBoundContract(to, abi.ABI{}, tc.sim.Client(), tc.sim.Client(), tc.sim.Client())
+		return c.RawTransact(opts, []byte(data))
+	}
+}
+
+func newDB(t *testing.T, dir string) *kv.Database {
+	db, err := kv.NewDatabase(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSendConcurrent(t *testing.T) {
+	tc := newTestChain(t)
+	m, err := NewManager(tc.sim.Client(), nil, Config{MaxFeeCap: big.NewInt(5e9)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.AddKey(tc.key)
+
+	// unknown signer
+	if _, err := m.Send(context.Background(), common.Address{1}, "test", tc.call(tc.log, "x")); err != ErrUnknownSigner {
+		t.Fatalf("expected unknown signer, got %v", err)
+	}
+
+	const n = 10
+	recs := make([]*Record, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec, err := m.Send(context.Background(), tc.from, "log", tc.call(tc.log, "hello"))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			recs[i] = rec
+		}(i)
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+	if len(m.Pending()) != n {
+		t.Fatalf("expected %d pending txs, got %d", n, len(m.Pending()))
+	}
+
+	tc.sim.Commit()
+
+	nonces := make(map[uint64]bool)
+	for _, r := range recs {
+		nonces[r.Nonce] = true
+
+		tx, err := r.Tx()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tx.GasFeeCap().Cmp(big.NewInt(5e9)) > 0 {
+			t.Fatalf("fee cap %s is over the max", tx.GasFeeCap())
+		}
+
+		res, err := m.Wait(context.Background(), r.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != StatusMined || res.Hash != r.ID {
+			t.Fatalf("unexpected record: %+v", res)
+		}
+		// gas limit is over the used with margin
+		if tx.Gas() <= res.GasUsed {
+			t.Fatalf("gas limit %d should be over gas used %d", tx.Gas(), res.GasUsed)
+		}
+	}
+	if len(nonces) != n {
+		t.Fatalf("expected %d distinct nonces, got %d", n, len(nonces))
+	}
+	if len(m.Pending()) != 0 {
+		t.Fatal("expected no pending tx")
+	}
+
+	// reverted in estimation
+	if _, err := m.Send(context.Background(), tc.from, "revert", tc.call(tc.rev, "x")); !errors.Is(err, chainerr.ErrReverted) {
+		t.Fatalf("expected estimation reverted, got %v", err)
+	}
+}
+
+func TestPersistPending(t *testing.T) {
+	tc := newTestChain(t)
+	dir := t.TempDir()
+
+	db := newDB(t, dir)
+	m, err := NewManager(tc.sim.Client(), db, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.AddKey(tc.key)
+
+	rec, err := m.Send(context.Background(), tc.from, "log", tc.call(tc.log, "persist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// restart
+	db = newDB(t, dir)
+	defer db.Close()
+	m, err = NewManager(tc.sim.Client(), db, Config{PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.AddKey(tc.key)
+
+	pending := m.Pending()
+	if len(pending) != 1 || pending[0].ID != rec.ID || pending[0].Name != "log" {
+		t.Fatalf("unexpected pending txs: %+v", pending)
+	}
+
+	// next nonce after the persisted one
+	rec2, err := m.Send(context.Background(), tc.from, "log", tc.call(tc.log, "next"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec2.Nonce != rec.Nonce+1 {
+		t.Fatalf("expected nonce %d, got %d", rec.Nonce+1, rec2.Nonce)
+	}
+
+	tc.sim.Commit()
+	res, err := m.Wait(context.Background(), rec.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusMined {
+		t.Fatalf("expected mined, got %s", res.Status)
+	}
+
+	// finished record is kept
+	got, err := m.Get(rec.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != StatusMined || got.Block == 0 {
+		t.Fatalf("unexpected record: %+v", got)
+	}
+}
+
+func TestReplaceStuck(t *testing.T) {
+	tc := newTestChain(t)
+	db := newDB(t, t.TempDir())
+	defer db.Close()
+
+	now := time.Now()
+	m, err := NewManager(tc.sim.Client(), db, Config{ResubmitInterval: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.now = func() time.Time { return now }
+	m.AddKey(tc.key)
+
+	rec, err := m.Send(context.Background(), tc.from, "log", tc.call(tc.log, "stuck"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// not stuck yet
+	got, err := m.Check(context.Background(), rec.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Hashes) != 1 {
+		t.Fatal("tx should not be replaced before resubmit interval")
+	}
+
+	now = now.Add(2 * time.Minute)
+
+	// a plain check never broadcasts
+	got, err = m.Check(context.Background(), rec.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Hashes) != 1 {
+		t.Fatal("tx should only be replaced by the loop of manager")
+	}
+
+	// concurrent checks of the loop replace it once
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.check(context.Background(), rec.ID, true); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	got, err = m.Get(rec.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Hashes) != 2 {
+		t.Fatalf("expected one replacement, got %+v", got)
+	}
+
+	old, _ := rec.Tx()
+	replaced, _ := got.Tx()
+	if replaced.Nonce() != old.Nonce() || replaced.GasTipCap().Cmp(old.GasTipCap()) <= 0 || replaced.GasFeeCap().Cmp(old.GasFeeCap()) <= 0 {
+		t.Fatal("replacement should have the same nonce and higher fees")
+	}
+
+	tc.sim.Commit()
+
+	// found with the replacement hash too
+	res, err := m.Wait(context.Background(), got.Hashes[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusMined || res.Hash != got.Hashes[1] || res.ID != rec.ID {
+		t.Fatalf("unexpected record: %+v", res)
+	}
+	res, err = m.Get(got.Hashes[1])
+	if err != nil || res.ID != rec.ID {
+		t.Fatalf("replacement hash should be resolved, got %+v, %v", res, err)
+	}
+}
+
+func TestSendSignedRevert(t *testing.T) {
+	tc := newTestChain(t)
+	echo := tc.deploy(t, echoRevertCode)
+
+	m, err := NewManager(tc.sim.Client(), nil, Config{PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	finals := make(chan *Record, 1)
+	m.OnFinal(func(r *Record) { finals <- r })
+
+	// signed outside with a fixed gas, Error("nope") is the revert data
+	data, err := abi.Arguments{{Type: mustType(t, "string")}}.Pack("nope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(crypto.Keccak256([]byte("Error(string)"))[:4], data...)
+
+	ctx := context.Background()
+	nonce, _ := tc.sim.Client().PendingNonceAt(ctx, tc.from)
+	tx, err := types.SignNewTx(tc.key, types.LatestSignerForChainID(big.NewInt(1337)), &types.DynamicFeeTx{
+		ChainID:   big.NewInt(1337),
+		Nonce:     nonce,
+		GasTipCap: big.NewInt(1e9),
+		GasFeeCap: big.NewInt(1e10),
+		Gas:       100000,
+		To:        &echo,
+		Data:      data,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := m.SendSigned(ctx, "echo", tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.From != tc.from || rec.ID != tx.Hash() {
+		t.Fatalf("unexpected record: %+v", rec)
+	}
+
+	tc.sim.Commit()
+
+	res, err := m.Wait(ctx, rec.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusFailed || res.Reason != "nope" || res.Code != "CHAIN_REVERTED" || res.Receipt == nil || res.GasUsed == 0 {
+		t.Fatalf("unexpected record: %+v", res)
+	}
+
+	select {
+	case r := <-finals:
+		if r.ID != rec.ID || r.Status != StatusFailed {
+			t.Fatalf("unexpected final record: %+v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("final callback is not called")
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	tc := newTestChain(t)
+
+	got := make(chan *Record, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write(body)
+		if r.Header.Get(WebhookSigHeader) != hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		rec := new(Record)
+		if err := json.Unmarshal(body, rec); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		got <- rec
+	}))
+	defer srv.Close()
+
+	m, err := NewManager(tc.sim.Client(), nil, Config{PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.AddKey(tc.key)
+	m.OnFinal(Webhook(srv.URL, "secret"))
+
+	rec, err := m.Send(context.Background(), tc.from, "log", tc.call(tc.log, "hook"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc.sim.Commit()
+	if _, err := m.Wait(context.Background(), rec.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case r := <-got:
+		if r.ID != rec.ID || r.Status != StatusMined || r.Receipt == nil {
+			t.Fatalf("unexpected webhook record: %+v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook is not posted")
+	}
+}
+
+func mustType(t *testing.T, name string) abi.Type {
+	typ, err := abi.NewType(name, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return typ
+}
+
+func TestConfirmations(t *testing.T) {
+	tc := newTestChain(t)
+	m, err := NewManager(tc.sim.Client(), nil, Config{Confirmations: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.AddKey(tc.key)
+
+	rec, err := m.Send(context.Background(), tc.from, "log", tc.call(tc.log, "hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// mined, but not deep enough
+	for i := 0; i < 2; i++ {
+		tc.sim.Commit()
+		res, err := m.Check(context.Background(), rec.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != StatusPending {
+			t.Fatalf("expected pending with %d blocks on top, got %s", i, res.Status)
+		}
+	}
+
+	tc.sim.Commit()
+	res, err := m.Check(context.Background(), rec.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusMined {
+		t.Fatalf("expected mined, got %s", res.Status)
+	}
+}
+
+func TestGasLimit(t *testing.T) {
+	if g := GasLimit(100000, 0); g != 120000 {
+		t.Fatalf("expected the default margin, got %d", g)
+	}
+	if g := GasLimit(100000, 150); g != 150000 {
+		t.Fatalf("expected the margin of config, got %d", g)
+	}
+}
@@ -0,0 +1,18 @@
+package txmgr
+
+import (
+	"github.com/gridprotocol/computing-api/lib/webhook"
+)
+
+// header of the hmac-sha256 of the body in hex, set if the secret is given
+const WebhookSigHeader = webhook.SigHeader
+
+// make a callback for OnFinal, it posts the record in json to url,
+// and retries a few times if the receiver is not ok
+func Webhook(url string, secret string) func(*Record) {
+	return func(r *Record) {
+		if err := webhook.Send(url, secret, r); err != nil {
+			logger.Warnf("webhook of %s tx %s is not delivered: %s", r.Name, r.ID, err)
+		}
+	}
+}
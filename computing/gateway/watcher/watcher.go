@@ -0,0 +1,351 @@
+package watcher
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gridprotocol/computing-api/lib/kv"
+	"github.com/gridprotocol/computing-api/lib/logc"
+)
+
+var logger = logc.Logger("watcher")
+
+// ErrDeepReorg is found when no common block is within the kept hashes, the state is resynced
+var ErrDeepReorg = errors.New("reorg is deeper than the kept blocks")
+
+// Handler keeps the state built from the logs. The state is written in txn, it's committed
+// with the cursor and the kept hashes of the watcher.
+type Handler interface {
+	// logs of a block in the order of index, a block is handled once unless it's rolled back
+	HandleBlock(txn kv.Txn, number uint64, hash common.Hash, logs []types.Log) error
+	// drop the state of the blocks in (to, from], they are replayed on the new chain
+	Rollback(txn kv.Txn, from, to uint64) error
+	// the handled chain is lost in a reorg deeper than the kept blocks, drop the state
+	// of the blocks and rebuild it at block n of the new chain, the blocks after it are replayed
+	Reset(txn kv.Txn, n uint64) error
+}
+
+// chain access of the watcher
+type Backend interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
+}
+
+type Config struct {
+	// first block to watch if there is no cursor, the head is used if it's 0
+	StartBlock uint64
+	// hashes of the latest blocks are kept to find the common block of a reorg
+	KeepBlocks uint64
+	// blocks handled in a poll at most
+	MaxBlocks uint64
+	// interval of polling the new blocks
+	PollInterval time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		KeepBlocks:   128,
+		MaxBlocks:    500,
+		PollInterval: 5 * time.Second,
+	}
+}
+
+// fill the zero fields with the default
+func (c Config) withDefault() Config {
+	d := DefaultConfig()
+	if c.KeepBlocks == 0 {
+		c.KeepBlocks = d.KeepBlocks
+	}
+	if c.MaxBlocks == 0 {
+		c.MaxBlocks = d.MaxBlocks
+	}
+	if c.PollInterval == 0 {
+		c.PollInterval = d.PollInterval
+	}
+	return c
+}
+
+// Watcher follows the logs of contracts block by block. The hash of each handled block
+// is kept in db, so a reorg is found by a changed hash, then the state is rolled back to
+// the common block and the blocks of the new chain are replayed.
+type Watcher struct {
+	name    string
+	backend Backend
+	db      kv.Store
+	addrs   []common.Address
+	handler Handler
+	cfg     Config
+}
+
+// make a watcher of the logs of addrs, name separates the cursors of watchers in db
+func New(name string, backend Backend, db kv.Store, addrs []common.Address, h Handler, cfg Config) *Watcher {
+	return &Watcher{
+		name:    name,
+		backend: backend,
+		db:      db,
+		addrs:   addrs,
+		handler: h,
+		cfg:     cfg.withDefault(),
+	}
+}
+
+// poll until ctx is done
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.Poll(ctx); err != nil {
+			logger.Warn("watch ", w.name, " failed: ", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// handle the new blocks up to the head, a reorg is rolled back first
+func (w *Watcher) Poll(ctx context.Context) error {
+	head, err := w.backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("get head failed: %s", err.Error())
+	}
+
+	cursor, ok, err := w.Cursor()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		start := w.cfg.StartBlock
+		if start == 0 {
+			start = head.Number.Uint64()
+		}
+		// handled blocks are after the cursor
+		if start > 0 {
+			cursor = start - 1
+		}
+		return w.handleFrom(ctx, cursor, head.Number.Uint64())
+	}
+
+	base, err := w.checkReorg(ctx, cursor)
+	if errors.Is(err, ErrDeepReorg) {
+		logger.Error("resync ", w.name, " for ", err)
+		base, err = w.resync(ctx, cursor)
+	}
+	if err != nil {
+		return err
+	}
+
+	return w.handleFrom(ctx, base, head.Number.Uint64())
+}
+
+// find the common block of the handled chain and the canonical one, roll back to it if they differ
+func (w *Watcher) checkReorg(ctx context.Context, cursor uint64) (uint64, error) {
+	for n := cursor; ; n-- {
+		kept, ok, err := w.hash(n)
+		if err != nil {
+			return 0, err
+		}
+		if !ok || cursor-n >= w.cfg.KeepBlocks {
+			return 0, fmt.Errorf("%w: block %d of %s", ErrDeepReorg, n, w.name)
+		}
+
+		hdr, err := w.backend.HeaderByNumber(ctx, new(big.Int).SetUint64(n))
+		if err != nil && !errors.Is(err, ethereum.NotFound) {
+			return 0, fmt.Errorf("get header %d failed: %s", n, err.Error())
+		}
+		if hdr != nil && hdr.Hash() == kept {
+			if n == cursor {
+				return cursor, nil
+			}
+			return n, w.rollback(cursor, n)
+		}
+
+		if n == 0 {
+			return 0, fmt.Errorf("%w: block 0 of %s", ErrDeepReorg, w.name)
+		}
+	}
+}
+
+// roll back the state and the kept hashes of blocks in (to, from]
+func (w *Watcher) rollback(from, to uint64) error {
+	logger.Warn("reorg of ", w.name, " found, roll back from block ", from, " to ", to)
+
+	return w.db.Txn(func(txn kv.Txn) error {
+		if err := w.handler.Rollback(txn, from, to); err != nil {
+			return fmt.Errorf("roll back to block %d failed: %s", to, err.Error())
+		}
+
+		for n := to + 1; n <= from; n++ {
+			if err := txn.Delete(w.hashKey(n)); err != nil {
+				return err
+			}
+		}
+
+		return w.setCursor(txn, to)
+	})
+}
+
+// rebuild the state at the block below the kept hashes, the hashes of the lost chain are dropped
+func (w *Watcher) resync(ctx context.Context, cursor uint64) (uint64, error) {
+	var base uint64
+	if cursor > w.cfg.KeepBlocks {
+		base = cursor - w.cfg.KeepBlocks
+	}
+
+	hdr, err := w.backend.HeaderByNumber(ctx, new(big.Int).SetUint64(base))
+	if err != nil {
+		return 0, fmt.Errorf("get header %d failed: %s", base, err.Error())
+	}
+
+	err = w.db.Txn(func(txn kv.Txn) error {
+		if err := w.handler.Reset(txn, base); err != nil {
+			return fmt.Errorf("reset to block %d failed: %s", base, err.Error())
+		}
+
+		var keys [][]byte
+		err := txn.Iterate(w.hashPrefix(), func(key, _ []byte) (bool, error) {
+			keys = append(keys, append([]byte{}, key...))
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		if err := w.setHash(txn, base, hdr.Hash()); err != nil {
+			return err
+		}
+		return w.setCursor(txn, base)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return base, nil
+}
+
+// handle the blocks in (cursor, head], stop at a block not on the handled chain
+func (w *Watcher) handleFrom(ctx context.Context, cursor, head uint64) error {
+	end := head
+	if end > cursor+w.cfg.MaxBlocks {
+		end = cursor + w.cfg.MaxBlocks
+	}
+
+	parent, hasParent, err := w.hash(cursor)
+	if err != nil {
+		return err
+	}
+
+	for n := cursor + 1; n <= end; n++ {
+		hdr, err := w.backend.HeaderByNumber(ctx, new(big.Int).SetUint64(n))
+		if err != nil {
+			return fmt.Errorf("get header %d failed: %s", n, err.Error())
+		}
+		// reorged after the check, it's rolled back in the next poll
+		if hasParent && hdr.ParentHash != parent {
+			logger.Debug("block ", n, " of ", w.name, " is not on the handled chain")
+			return nil
+		}
+
+		hash := hdr.Hash()
+		// logs of the block hash, never mixed with the logs of another chain
+		logs, err := w.backend.FilterLogs(ctx, ethereum.FilterQuery{BlockHash: &hash, Addresses: w.addrs})
+		if err != nil {
+			return fmt.Errorf("filter logs of block %d failed: %s", n, err.Error())
+		}
+
+		// the state, the hash and the cursor of a block are committed together
+		err = w.db.Txn(func(txn kv.Txn) error {
+			if err := w.handler.HandleBlock(txn, n, hash, logs); err != nil {
+				return fmt.Errorf("handle block %d failed: %s", n, err.Error())
+			}
+			if err := w.setHash(txn, n, hash); err != nil {
+				return err
+			}
+			if n > w.cfg.KeepBlocks {
+				if err := txn.Delete(w.hashKey(n - w.cfg.KeepBlocks)); err != nil {
+					return err
+				}
+			}
+			return w.setCursor(txn, n)
+		})
+		if err != nil {
+			return err
+		}
+
+		parent, hasParent = hash, true
+	}
+
+	return nil
+}
+
+// the last handled block
+func (w *Watcher) Cursor() (uint64, bool, error) {
+	val, ok, err := w.get(w.cursorKey())
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	if len(val) != 8 {
+		return 0, false, fmt.Errorf("invalid cursor of %s", w.name)
+	}
+	return binary.BigEndian.Uint64(val), true, nil
+}
+
+func (w *Watcher) setCursor(txn kv.Txn, n uint64) error {
+	return txn.Put(w.cursorKey(), binary.BigEndian.AppendUint64(nil, n))
+}
+
+// hash of a handled block
+func (w *Watcher) hash(n uint64) (common.Hash, bool, error) {
+	val, ok, err := w.get(w.hashKey(n))
+	if err != nil || !ok {
+		return common.Hash{}, false, err
+	}
+	if len(val) != common.HashLength {
+		return common.Hash{}, false, fmt.Errorf("invalid hash of block %d of %s", n, w.name)
+	}
+	return common.BytesToHash(val), true, nil
+}
+
+func (w *Watcher) setHash(txn kv.Txn, n uint64, h common.Hash) error {
+	return txn.Put(w.hashKey(n), h.Bytes())
+}
+
+// value of key, false if it's not in db
+func (w *Watcher) get(key []byte) ([]byte, bool, error) {
+	has, err := w.db.Has(key)
+	if err != nil || !has {
+		return nil, false, err
+	}
+	val, err := w.db.Get(key)
+	if err != nil {
+		return nil, false, err
+	}
+	return val, true, nil
+}
+
+func (w *Watcher) cursorKey() []byte {
+	return []byte("watch/" + w.name + "/cursor")
+}
+
+func (w *Watcher) hashPrefix() []byte {
+	return []byte("watch/" + w.name + "/hash/")
+}
+
+func (w *Watcher) hashKey(n uint64) []byte {
+	return binary.BigEndian.AppendUint64(w.hashPrefix(), n)
+}
@@ -0,0 +1,281 @@
+package watcher
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/gridprotocol/computing-api/lib/kv"
+)
+
+// runtime: log the calldata, init: return the runtime
+const logCode = "600b600c600039600b6000f3" + "366000600037366000a000"
+
+// state of the logs by block
+type testHandler struct {
+	blocks    map[uint64][]string
+	rollbacks [][2]uint64
+	resets    []uint64
+	// handling the block fails after its state is written
+	failAt uint64
+}
+
+func stateKey(n uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte("test/state/"), n)
+}
+
+func (h *testHandler) HandleBlock(txn kv.Txn, n uint64, hash common.Hash, logs []types.Log) error {
+	if err := txn.Put(stateKey(n), hash.Bytes()); err != nil {
+		return err
+	}
+	if n == h.failAt {
+		return errors.New("handler failed")
+	}
+	for _, l := range logs {
+		if l.BlockHash != hash {
+			return errors.New("log of another block")
+		}
+		h.blocks[n] = append(h.blocks[n], string(l.Data))
+	}
+	return nil
+}
+
+func (h *testHandler) Rollback(txn kv.Txn, from, to uint64) error {
+	for n := to + 1; n <= from; n++ {
+		delete(h.blocks, n)
+	}
+	h.rollbacks = append(h.rollbacks, [2]uint64{from, to})
+	return nil
+}
+
+func (h *testHandler) Reset(txn kv.Txn, n uint64) error {
+	for b := range h.blocks {
+		if b > n {
+			delete(h.blocks, b)
+		}
+	}
+	h.resets = append(h.resets, n)
+	return nil
+}
+
+func (h *testHandler) all() []string {
+	var res []string
+	for n := uint64(0); n < 100; n++ {
+		res = append(res, h.blocks[n]...)
+	}
+	return res
+}
+
+type testChain struct {
+	sim *simulated.Backend
+	key *ecdsa.PrivateKey
+	log common.Address
+}
+
+func newTestChain(t *testing.T) *testChain {
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	sim := simulated.NewBackend(types.GenesisAlloc{
+		from: {Balance: new(big.Int).Mul(big.NewInt(1e18), big.NewInt(100))},
+	})
+	t.Cleanup(func() { sim.Close() })
+
+	auth, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(1337))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, _, _, err := bind.DeployContract(auth, abi.ABI{}, common.FromHex(logCode), sim.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.Commit()
+
+	return &testChain{sim: sim, key: key, log: addr}
+}
+
+// log data in a new block
+func (tc *testChain) emit(t *testing.T, data string) common.Hash {
+	auth, err := bind.NewKeyedTransactorWithChainID(tc.key, big.NewInt(1337))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := bind.NewBoundContract(tc.log, abi.ABI{}, tc.sim.Client(), tc.sim.Client(), tc.sim.Client())
+	if _, err := c.RawTransact(auth, []byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	return tc.sim.Commit()
+}
+
+func newDB(t *testing.T) kv.Store {
+	return kv.NewMemDatabase()
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReorg(t *testing.T) {
+	ctx := context.Background()
+	tc := newTestChain(t)
+	db := newDB(t)
+
+	h := &testHandler{blocks: make(map[uint64][]string)}
+	w := New("test", tc.sim.Client(), db, []common.Address{tc.log}, h, Config{StartBlock: 1})
+
+	// block 2, 3, 4
+	fork := tc.emit(t, "a")
+	tc.emit(t, "b")
+	tc.emit(t, "c")
+
+	if err := w.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.all(); !equal(got, []string{"a", "b", "c"}) {
+		t.Fatalf("unexpected logs: %v", got)
+	}
+	if cursor, _, _ := w.Cursor(); cursor != 4 {
+		t.Fatalf("unexpected cursor %d", cursor)
+	}
+
+	// nothing new
+	if err := w.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.rollbacks) != 0 {
+		t.Fatal("rolled back without reorg")
+	}
+
+	// replace block 3 and 4 with a longer chain
+	if err := tc.sim.Fork(fork); err != nil {
+		t.Fatal(err)
+	}
+	tc.emit(t, "x")
+	tc.emit(t, "y")
+	tc.emit(t, "z")
+
+	if err := w.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.rollbacks) != 1 || h.rollbacks[0] != [2]uint64{4, 2} {
+		t.Fatalf("unexpected rollbacks: %v", h.rollbacks)
+	}
+	if got := h.all(); !equal(got, []string{"a", "x", "y", "z"}) {
+		t.Fatalf("unexpected logs: %v", got)
+	}
+
+	// the cursor and hashes are persisted, a new watcher continues from them
+	w2 := New("test", tc.sim.Client(), db, []common.Address{tc.log}, h, Config{})
+	tc.emit(t, "w")
+	if err := w2.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.all(); !equal(got, []string{"a", "x", "y", "z", "w"}) {
+		t.Fatalf("unexpected logs: %v", got)
+	}
+}
+
+func TestDeepReorg(t *testing.T) {
+	ctx := context.Background()
+	tc := newTestChain(t)
+
+	h := &testHandler{blocks: make(map[uint64][]string)}
+	w := New("test", tc.sim.Client(), newDB(t), []common.Address{tc.log}, h, Config{StartBlock: 1, KeepBlocks: 2})
+
+	fork := tc.emit(t, "a")
+	tc.emit(t, "b")
+	tc.emit(t, "c")
+	tc.emit(t, "d")
+	if err := w.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tc.sim.Fork(fork); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []string{"x", "y", "z", "v"} {
+		tc.emit(t, d)
+	}
+
+	// resynced at the block below the kept hashes, and the new chain is replayed after it
+	if err := w.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.resets) != 1 || h.resets[0] != 3 || len(h.rollbacks) != 0 {
+		t.Fatalf("unexpected resets %v, rollbacks %v", h.resets, h.rollbacks)
+	}
+	if got := h.all(); !equal(got, []string{"a", "b", "y", "z", "v"}) {
+		t.Fatalf("unexpected logs: %v", got)
+	}
+	if cursor, _, _ := w.Cursor(); cursor != 6 {
+		t.Fatalf("unexpected cursor %d", cursor)
+	}
+
+	// and it keeps going on the new chain
+	tc.emit(t, "w")
+	if err := w.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.all(); !equal(got, []string{"a", "b", "y", "z", "v", "w"}) || len(h.resets) != 1 {
+		t.Fatalf("unexpected logs: %v, resets %v", got, h.resets)
+	}
+}
+
+func TestHandleAtomic(t *testing.T) {
+	ctx := context.Background()
+	tc := newTestChain(t)
+	db := newDB(t)
+
+	h := &testHandler{blocks: make(map[uint64][]string), failAt: 3}
+	w := New("test", tc.sim.Client(), db, []common.Address{tc.log}, h, Config{StartBlock: 1})
+
+	// block 2, 3
+	tc.emit(t, "a")
+	tc.emit(t, "b")
+
+	if err := w.Poll(ctx); err == nil {
+		t.Fatal("expected the error of handler")
+	}
+
+	// block 2 is committed, nothing of block 3 is
+	if cursor, _, _ := w.Cursor(); cursor != 2 {
+		t.Fatalf("unexpected cursor %d", cursor)
+	}
+	if _, ok, _ := w.hash(3); ok {
+		t.Fatal("hash of the failed block is kept")
+	}
+	if has, _ := db.Has(stateKey(2)); !has {
+		t.Fatal("state of block 2 is not committed")
+	}
+	if has, _ := db.Has(stateKey(3)); has {
+		t.Fatal("state of the failed block is committed")
+	}
+
+	// handled again when it's fixed
+	h.failAt = 0
+	if err := w.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.all(); !equal(got, []string{"a", "b"}) {
+		t.Fatalf("unexpected logs: %v", got)
+	}
+	if has, _ := db.Has(stateKey(3)); !has {
+		t.Fatal("state of block 3 is not committed")
+	}
+}
@@ -30,9 +30,68 @@ func (l *Lease) Decode(dat []byte) error {
 	return json.Unmarshal(dat, l)
 }
 
+// order status on chain
+const (
+	OrderNotExist uint8 = iota
+	OrderUnactive
+	OrderActive
+	OrderCancelled
+	OrderCompleted
+)
+
+// an order served by the gateway, kept in local db by id
+type Order struct {
+	ID        uint64 `json:"id"`
+	User      string `json:"user"`
+	AppName   string `json:"appName"`
+	Namespace string `json:"namespace"`
+	Entrance  string `json:"entrance"`
+	Status    uint8  `json:"status"`
+	// unix time in second
+	ActivateTime int64 `json:"activateTime"`
+	ExpireTime   int64 `json:"expireTime"`
+	// names of the deployments and services of the app
+	Deployments []string `json:"deployments"`
+	Services    []string `json:"services"`
+	Updated     int64    `json:"updated"`
+}
+
+func (o Order) Encode() ([]byte, error) {
+	return json.Marshal(o)
+}
+
+func (o *Order) Decode(dat []byte) error {
+	return json.Unmarshal(dat, o)
+}
+
 type Resources struct {
 	Cpu     string
 	Gpu     string
 	Mem     string
 	Storage string
 }
+
+// an unsigned tx for the user to sign on client side, tx is the rlp encoded tx in hex
+type UnsignedTx struct {
+	Msg      string `json:"msg"`
+	Tx       string `json:"tx"`
+	ChainID  string `json:"chainId"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Nonce    uint64 `json:"nonce"`
+	Gas      uint64 `json:"gas"`
+	GasPrice string `json:"gasPrice"`
+	Data     string `json:"data"`
+}
+
+// a tx signed by the user, rlp encoded in hex
+type SignedTx struct {
+	Tx string `json:"tx" binding:"required"`
+}
+
+// order operated by the provider through the admin api, prob and dur are in second
+type AdminOrderRequest struct {
+	ID   uint64 `json:"id" binding:"required"`
+	Prob uint64 `json:"prob"`
+	Dur  uint64 `json:"dur"`
+}
@@ -0,0 +1,358 @@
+package httpserver
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"github.com/gridprotocol/computing-api/computing/config"
+	"github.com/gridprotocol/computing-api/computing/gateway"
+	"github.com/gridprotocol/computing-api/computing/model"
+	"github.com/gridprotocol/computing-api/keystore/signer"
+	"github.com/gridprotocol/computing-api/lib/auth"
+	"github.com/gridprotocol/computing-api/lib/utils"
+)
+
+const (
+	// path prefix of the admin api
+	AdminPrefix = "/admin"
+
+	// headers of a request signed by the provider wallet
+	AdminTsHeader  = "X-Admin-Ts"
+	AdminSigHeader = "X-Admin-Sig"
+
+	// key of the authorized operator in gin context
+	adminActorKey = "admin_actor"
+	// body longer than it is truncated in the audit trail
+	maxAuditBody = 4096
+	// body longer than it is rejected, it's read before the auth
+	maxAdminBody = 1 << 20
+)
+
+// the message signed by the provider wallet for an admin request, the query is signed in its canonical form
+func AdminMessage(method, path, query string, body []byte, ts string) string {
+	return fmt.Sprintf("%s\n%s\n%s\n%s\n%s", method, path, canonicalQuery(query), hex.EncodeToString(auth.Hash(body)), ts)
+}
+
+// the query with sorted keys, the raw one if it can't be parsed
+func canonicalQuery(query string) string {
+	v, err := url.ParseQuery(query)
+	if err != nil {
+		return query
+	}
+	return v.Encode()
+}
+
+// sign an admin request by the signer of provider wallet, return the ts and sig headers
+func SignAdminRequest(method, path, query string, body []byte, sg signer.Signer) (string, string, error) {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	sig, err := sg.SignText([]byte(AdminMessage(method, path, query, body, ts)))
+	if err != nil {
+		return "", "", err
+	}
+	return ts, "0x" + hex.EncodeToString(sig), nil
+}
+
+// authorize the operator with the admin token or a signature of the provider wallet
+type adminAuth struct {
+	token string
+	// zero if no wallet is set, then no signature is accepted
+	wallet common.Address
+	expire time.Duration
+
+	mu sync.Mutex
+	// signed messages within expire, for rejecting replays
+	used map[string]time.Time
+}
+
+func newAdminAuth(token string, wallet string, expire time.Duration) *adminAuth {
+	if expire <= 0 {
+		expire = time.Minute
+	}
+	aa := &adminAuth{
+		token:  token,
+		expire: expire,
+		used:   make(map[string]time.Time),
+	}
+	if common.IsHexAddress(wallet) {
+		aa.wallet = common.HexToAddress(wallet)
+	}
+	return aa
+}
+
+// middleware rejecting the requests not from the operator
+func (aa *adminAuth) handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actor, err := aa.check(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"msg": "[Fail] unauthorized: " + err.Error()})
+			return
+		}
+		c.Set(adminActorKey, actor)
+		c.Next()
+	}
+}
+
+// check the credential of a request, return the operator
+func (aa *adminAuth) check(c *gin.Context) (string, error) {
+	// admin token
+	if h := c.GetHeader("Authorization"); h != "" {
+		token, ok := strings.CutPrefix(h, "Bearer ")
+		if !ok || aa.token == "" {
+			return "", fmt.Errorf("token is not accepted")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(aa.token)) != 1 {
+			return "", fmt.Errorf("invalid token")
+		}
+		return "token", nil
+	}
+
+	// signature of provider wallet
+	ts := c.GetHeader(AdminTsHeader)
+	sigStr := c.GetHeader(AdminSigHeader)
+	if ts == "" || sigStr == "" {
+		return "", fmt.Errorf("missing token or signature")
+	}
+	if aa.wallet == (common.Address{}) {
+		return "", fmt.Errorf("signature is not accepted")
+	}
+
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid timestamp")
+	}
+	signed := time.Unix(sec, 0)
+	if d := time.Since(signed); d > aa.expire || d < -aa.expire {
+		return "", fmt.Errorf("signature expired")
+	}
+
+	sig, err := auth.HexDecode(sigStr)
+	if err != nil || len(sig) != 65 {
+		return "", fmt.Errorf("invalid signature")
+	}
+
+	// the body is read for the signature, and put back for the handler
+	body, err := readAdminBody(c)
+	if err != nil {
+		return "", fmt.Errorf("read body failed: %s", err.Error())
+	}
+
+	msg := AdminMessage(c.Request.Method, c.Request.URL.Path, c.Request.URL.RawQuery, body, ts)
+	hash := auth.Hash([]byte(auth.EncloseEth(msg)))
+	// a failed recovery is nil, never take it as the zero address
+	recovered := auth.SigToAddress(hash, sig)
+	if len(recovered) != common.AddressLength {
+		return "", fmt.Errorf("invalid signature")
+	}
+	signer := common.BytesToAddress(recovered)
+	if signer != aa.wallet {
+		return "", fmt.Errorf("signer %s is not the provider wallet", signer)
+	}
+
+	// the same request can't be sent twice, whatever the encoding of the signature
+	if err := aa.use(hex.EncodeToString(hash), signed); err != nil {
+		return "", err
+	}
+
+	return signer.Hex(), nil
+}
+
+// read the body of an admin request up to maxAdminBody, and put it back for the next reader
+func readAdminBody(c *gin.Context) ([]byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxAdminBody))
+	if err != nil {
+		return nil, err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// record a signed message, reject it if used
+func (aa *adminAuth) use(msgHash string, signed time.Time) error {
+	aa.mu.Lock()
+	defer aa.mu.Unlock()
+
+	// forget the expired ones
+	now := time.Now()
+	for k, t := range aa.used {
+		if now.Sub(t) > aa.expire {
+			delete(aa.used, k)
+		}
+	}
+
+	if _, ok := aa.used[msgHash]; ok {
+		return fmt.Errorf("signature is used")
+	}
+	aa.used[msgHash] = signed
+
+	return nil
+}
+
+// a record in the audit trail
+type auditEntry struct {
+	Time   string `json:"time"`
+	Remote string `json:"remote"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Actor  string `json:"actor"`
+	Body   string `json:"body"`
+	Status int    `json:"status"`
+}
+
+// append a json line for each admin request, authorized or not
+type auditor struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// open the audit file in append mode, the audit trail goes to log if path is empty
+func newAuditor(path string) (*auditor, error) {
+	if path == "" {
+		return &auditor{}, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log failed: %s", err.Error())
+	}
+
+	return &auditor{w: f}, nil
+}
+
+func (au *auditor) handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// keep the body for the record, a large one is rejected before the auth
+		body, err := readAdminBody(c)
+		if err != nil {
+			status := http.StatusBadRequest
+			var mbe *http.MaxBytesError
+			if errors.As(err, &mbe) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			c.AbortWithStatusJSON(status, gin.H{"msg": "[Fail] read body failed: " + err.Error()})
+		} else {
+			c.Next()
+		}
+
+		if len(body) > maxAuditBody {
+			body = body[:maxAuditBody]
+		}
+
+		au.record(auditEntry{
+			Time:   time.Now().Format(time.RFC3339),
+			Remote: c.ClientIP(),
+			Method: c.Request.Method,
+			Path:   c.Request.URL.Path,
+			Actor:  c.GetString(adminActorKey),
+			Body:   string(body),
+			Status: c.Writer.Status(),
+		})
+	}
+}
+
+func (au *auditor) record(e auditEntry) {
+	data, _ := json.Marshal(e)
+	logger.Info("admin audit: ", string(data))
+
+	au.mu.Lock()
+	defer au.mu.Unlock()
+	if au.w == nil {
+		return
+	}
+	if _, err := au.w.Write(append(data, '\n')); err != nil {
+		logger.Error("write audit log failed: ", err)
+	}
+}
+
+// register the admin routes with their auth and audit
+func registerAdminRoutes(gw gateway.ComputingGatewayAPI, r gin.IRouter) error {
+	cfg := config.GetConfig()
+
+	au, err := newAuditor(cfg.Admin.AuditLog)
+	if err != nil {
+		return err
+	}
+	aa := newAdminAuth(cfg.Admin.Token, cfg.Remote.Wallet, time.Duration(cfg.Admin.SignExpire)*time.Second)
+
+	hc := &handlerCore{gw: gw}
+
+	g := r.Group(AdminPrefix, au.handler(), aa.handler())
+	g.POST("/reset", hc.handlerReset)
+	g.POST("/settle", hc.handlerSettle)
+
+	if h, ok := gw.(dbHolder); ok && h.Database() != nil {
+		registerAdminDBRoutes(h.Database(), g)
+	}
+
+	return nil
+}
+
+// make a server only serving the admin api, listen on a distinct address from the users
+func NewAdminServer(addr string, gw gateway.ComputingGatewayAPI) (*http.Server, error) {
+	logger.Info("Starting admin server")
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(gin.Recovery())
+
+	if err := registerAdminRoutes(gw, r); err != nil {
+		return nil, err
+	}
+
+	return &http.Server{
+		Addr:    addr,
+		Handler: r,
+	}, nil
+}
+
+// reset an order by the provider
+func (hc *handlerCore) handlerReset(c *gin.Context) {
+	var req model.AdminOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] invalid request body: " + err.Error()})
+		return
+	}
+
+	logger.Debug("reseting order: ", req.ID)
+
+	// reset order
+	hash, err := hc.gw.Reset(req.ID, utils.Uint64ToString(req.Prob), utils.Uint64ToString(req.Dur))
+	if err != nil {
+		chainFail(c, http.StatusInternalServerError, "[Fail] Failed to reset: ", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"msg": "[ACK] reset tx sent, query it with /tx/" + hash.Hex(), "hash": hash.Hex()})
+}
+
+// settle an order by the provider to retrieve the remuneration
+func (hc *handlerCore) handlerSettle(c *gin.Context) {
+	var req model.AdminOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] invalid request body: " + err.Error()})
+		return
+	}
+
+	logger.Debug("settling order: ", req.ID)
+
+	hash, err := hc.gw.Settle(req.ID)
+	if err != nil {
+		chainFail(c, http.StatusInternalServerError, "[Fail] Failed to settle: ", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"msg": "[ACK] settle tx sent, query it with /tx/" + hash.Hex(), "hash": hash.Hex()})
+}
@@ -0,0 +1,121 @@
+package httpserver
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gridprotocol/computing-api/computing/config"
+	"github.com/gridprotocol/computing-api/lib/kv"
+)
+
+const (
+	// trailer of a backup response, the version to back up from next time.
+	// It's missing if the backup is broken in the stream.
+	BackupVersionTrailer = "X-Backup-Version"
+
+	// entries of an inspect page
+	defaultInspectLimit = 100
+	maxInspectLimit     = 1000
+)
+
+// the gateways with a badger db serve its maintenance in the admin api
+type dbHolder interface {
+	Database() *kv.Database
+}
+
+// a page of the db entries
+type DBPage struct {
+	Entries []kv.Entry `json:"entries"`
+	// hex of the key to read the next page after, empty on the last page
+	Next string `json:"next"`
+}
+
+// maintenance of the gateway db while it's serving
+func registerAdminDBRoutes(db *kv.Database, g gin.IRouter) {
+	dh := &dbHandler{db: db}
+	g.GET("/db/backup", dh.handlerBackup)
+	g.POST("/db/gc", dh.handlerGC)
+	g.GET("/db/inspect", dh.handlerInspect)
+}
+
+type dbHandler struct {
+	db *kv.Database
+}
+
+// stream a backup of the versions after since
+func (dh *dbHandler) handlerBackup(c *gin.Context) {
+	since, err := strconv.ParseUint(c.DefaultQuery("since", "0"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] invalid since: " + err.Error()})
+		return
+	}
+
+	logger.Info("backing up db since version ", since)
+
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Trailer", BackupVersionTrailer)
+	c.Status(http.StatusOK)
+
+	version, err := dh.db.Backup(c.Writer, since)
+	if err != nil {
+		// the status is sent, the missing trailer tells the failure
+		logger.Error("backup db failed: ", err)
+		return
+	}
+	c.Writer.Header().Set(BackupVersionTrailer, strconv.FormatUint(version, 10))
+}
+
+// run value log gc once
+func (dh *dbHandler) handlerGC(c *gin.Context) {
+	ratio := config.GetConfig().Local.GCRatio
+	if ratio <= 0 || ratio >= 1 {
+		ratio = 0.5
+	}
+
+	n, err := dh.db.GC(ratio)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"msg": "[Fail] value log gc failed: " + err.Error()})
+		return
+	}
+
+	lsm, vlog := dh.db.Size()
+	c.JSON(http.StatusOK, gin.H{
+		"msg":       "[ACK] value log gc rewrote " + strconv.Itoa(n) + " files",
+		"rewritten": n,
+		"lsm":       lsm,
+		"vlog":      vlog,
+	})
+}
+
+// read a page of the entries with prefix
+func (dh *dbHandler) handlerInspect(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultInspectLimit)))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] invalid limit"})
+		return
+	}
+	if limit > maxInspectLimit {
+		limit = maxInspectLimit
+	}
+
+	after, err := hex.DecodeString(strings.TrimPrefix(c.Query("after"), "0x"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] invalid after: " + err.Error()})
+		return
+	}
+
+	entries, next, err := dh.db.Page([]byte(c.Query("prefix")), after, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"msg": "[Fail] read db failed: " + err.Error()})
+		return
+	}
+
+	page := DBPage{Entries: entries}
+	if next != nil {
+		page.Next = hex.EncodeToString(next)
+	}
+	c.JSON(http.StatusOK, page)
+}
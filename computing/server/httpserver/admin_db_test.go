@@ -0,0 +1,104 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gridprotocol/computing-api/lib/kv"
+)
+
+func newDBServer(t *testing.T) (*kv.Database, *httptest.Server) {
+	db, err := kv.NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	g := r.Group(AdminPrefix, newAdminAuth("secret", "", time.Minute).handler())
+	registerAdminDBRoutes(db, g)
+
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return db, srv
+}
+
+func adminGet(t *testing.T, url string) *http.Response {
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+func TestAdminBackup(t *testing.T) {
+	db, srv := newDBServer(t)
+	db.MultiPut([][]byte{[]byte("a"), []byte("b")}, [][]byte{[]byte("1"), []byte("2")})
+
+	res := adminGet(t, srv.URL+AdminPrefix+"/db/backup")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", res.StatusCode)
+	}
+
+	// the backup is restored into a new db
+	dst, err := kv.NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	if err := dst.Restore(res.Body); err != nil {
+		t.Fatal(err)
+	}
+	if res.Trailer.Get(BackupVersionTrailer) == "" {
+		t.Fatal("version trailer is missing")
+	}
+	if v, err := dst.Get([]byte("b")); err != nil || string(v) != "2" {
+		t.Fatalf("unexpected restored value %s %v", v, err)
+	}
+}
+
+func TestAdminInspect(t *testing.T) {
+	db, srv := newDBServer(t)
+	for i := 0; i < 5; i++ {
+		db.Put([]byte(fmt.Sprintf("p/%d", i)), []byte("v"))
+	}
+	db.Put([]byte("q/0"), []byte("v"))
+
+	var keys []string
+	next := ""
+	for {
+		res := adminGet(t, srv.URL+AdminPrefix+"/db/inspect?prefix=p/&limit=2&after="+next)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status %d", res.StatusCode)
+		}
+		data, _ := io.ReadAll(res.Body)
+		var page DBPage
+		if err := json.Unmarshal(data, &page); err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range page.Entries {
+			keys = append(keys, string(e.Key))
+		}
+		if page.Next == "" {
+			break
+		}
+		next = page.Next
+	}
+	if fmt.Sprint(keys) != "[p/0 p/1 p/2 p/3 p/4]" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	if res := adminGet(t, srv.URL+AdminPrefix+"/db/inspect?after=zz"); res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected bad request, got %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,208 @@
+package httpserver
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	"github.com/gridprotocol/computing-api/keystore/signer"
+	"github.com/gridprotocol/computing-api/lib/auth"
+)
+
+func newAdminRouter(aa *adminAuth, au *auditor) *gin.Engine {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	g := r.Group(AdminPrefix, au.handler(), aa.handler())
+	g.POST("/settle", func(c *gin.Context) {
+		// body is kept for the handler
+		var req struct {
+			ID uint64 `json:"id"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || req.ID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] bad body"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"msg": "[ACK] order settle ok"})
+	})
+	g.GET("/db/inspect", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"msg": "[ACK] inspect ok"})
+	})
+	return r
+}
+
+func adminRequest(body string, header map[string]string) *http.Request {
+	req := httptest.NewRequest("POST", AdminPrefix+"/settle", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	return req
+}
+
+func TestAdminAuth(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	sk := hex.EncodeToString(crypto.FromECDSA(key))
+	wallet := crypto.PubkeyToAddress(key.PublicKey).Hex()
+
+	var trail bytes.Buffer
+	r := newAdminRouter(newAdminAuth("secret", wallet, time.Minute), &auditor{w: &trail})
+
+	body := `{"id":1}`
+	signed := func(body string, sg signer.Signer) map[string]string {
+		ts, sig, err := SignAdminRequest("POST", AdminPrefix+"/settle", "", []byte(body), sg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return map[string]string{AdminTsHeader: ts, AdminSigHeader: sig}
+	}
+
+	other, _ := crypto.GenerateKey()
+
+	replay := signed(body, signer.NewKeySigner(key))
+
+	// expired signature
+	oldTs := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	oldHash := auth.Hash([]byte(auth.EncloseEth(AdminMessage("POST", AdminPrefix+"/settle", "", []byte(body), oldTs))))
+	oldSig, _ := auth.Sign(oldHash, sk)
+
+	cases := []struct {
+		name   string
+		body   string
+		header map[string]string
+		status int
+	}{
+		{"no credential", body, nil, http.StatusUnauthorized},
+		{"bad token", body, map[string]string{"Authorization": "Bearer wrong"}, http.StatusUnauthorized},
+		{"token", body, map[string]string{"Authorization": "Bearer secret"}, http.StatusOK},
+		{"wallet", body, replay, http.StatusOK},
+		{"replay", body, replay, http.StatusUnauthorized},
+		{"other wallet", body, signed(body, signer.NewKeySigner(other)), http.StatusUnauthorized},
+		{"body changed", `{"id":2}`, signed(body, signer.NewKeySigner(key)), http.StatusUnauthorized},
+		{"expired", body, map[string]string{AdminTsHeader: oldTs, AdminSigHeader: "0x" + hex.EncodeToString(oldSig)}, http.StatusUnauthorized},
+		{"unrecoverable", body, unrecoverable(), http.StatusUnauthorized},
+	}
+
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, adminRequest(tc.body, tc.header))
+		if w.Code != tc.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", tc.name, tc.status, w.Code, w.Body.String())
+		}
+	}
+
+	// every request is in the audit trail
+	lines := strings.Split(strings.TrimSpace(trail.String()), "\n")
+	if len(lines) != len(cases) {
+		t.Fatalf("expected %d audit records, got %d", len(cases), len(lines))
+	}
+	var e auditEntry
+	if err := json.Unmarshal([]byte(lines[3]), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Actor != wallet || e.Status != http.StatusOK || e.Body != body || e.Path != AdminPrefix+"/settle" {
+		t.Fatalf("unexpected audit record: %+v", e)
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Actor != "" || e.Status != http.StatusUnauthorized {
+		t.Fatalf("unexpected audit record: %+v", e)
+	}
+}
+
+// a signature no address can be recovered from
+func unrecoverable() map[string]string {
+	return map[string]string{
+		AdminTsHeader:  strconv.FormatInt(time.Now().Unix(), 10),
+		AdminSigHeader: "0x" + hex.EncodeToString(make([]byte, 65)),
+	}
+}
+
+func TestAdminQuery(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	wallet := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	r := newAdminRouter(newAdminAuth("", wallet, time.Minute), &auditor{})
+
+	// the query is signed in any order of its keys
+	path := AdminPrefix + "/db/inspect"
+	ts, sig, err := SignAdminRequest("GET", path, "prefix=p/&limit=2", nil, signer.NewKeySigner(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		query  string
+		status int
+	}{
+		{"limit=200&prefix=p/", http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+		{"limit=2&prefix=p%2F", http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", path+"?"+tc.query, nil)
+		req.Header.Set(AdminTsHeader, ts)
+		req.Header.Set(AdminSigHeader, sig)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.status {
+			t.Fatalf("query %q: expected status %d, got %d: %s", tc.query, tc.status, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestAdminBodyLimit(t *testing.T) {
+	var trail bytes.Buffer
+	r := newAdminRouter(newAdminAuth("secret", "", time.Minute), &auditor{w: &trail})
+
+	// a large body is rejected before the auth
+	body := `{"id":1,"pad":"` + strings.Repeat("a", maxAdminBody) + `"}`
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, adminRequest(body, map[string]string{"Authorization": "Bearer secret"}))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected too large, got %d", w.Code)
+	}
+
+	var e auditEntry
+	if err := json.Unmarshal(trail.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Actor != "" || e.Status != http.StatusRequestEntityTooLarge || len(e.Body) > maxAuditBody {
+		t.Fatalf("unexpected audit record: %+v", e)
+	}
+}
+
+func TestAdminNoWallet(t *testing.T) {
+	r := newAdminRouter(newAdminAuth("secret", "", time.Minute), &auditor{})
+
+	// no signature is accepted without the wallet, even one recovering nothing
+	key, _ := crypto.GenerateKey()
+	ts, sig, err := SignAdminRequest("POST", AdminPrefix+"/settle", "", []byte(`{"id":1}`), signer.NewKeySigner(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, header := range []map[string]string{unrecoverable(), {AdminTsHeader: ts, AdminSigHeader: sig}} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, adminRequest(`{"id":1}`, header))
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("expected unauthorized, got %d", w.Code)
+		}
+	}
+}
+
+func TestAdminTokenDisabled(t *testing.T) {
+	r := newAdminRouter(newAdminAuth("", "0x0000000000000000000000000000000000000001", time.Minute), &auditor{})
+
+	// empty token never matches
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, adminRequest(`{"id":1}`, map[string]string{"Authorization": "Bearer "}))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected unauthorized, got %d", w.Code)
+	}
+}
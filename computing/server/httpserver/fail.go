@@ -0,0 +1,21 @@
+package httpserver
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gridprotocol/computing-api/computing/gateway/chainerr"
+)
+
+// respond a failure with msg and err. A decoded chain error responses the http status
+// and the stable code of it, others response status.
+func chainFail(c *gin.Context, status int, msg string, err error) {
+	if ce, ok := chainerr.As(err); ok {
+		codeFail(c, ce.Code, msg+err.Error())
+		return
+	}
+	c.JSON(status, gin.H{"msg": msg + err.Error()})
+}
+
+// respond a failure with the code and its http status
+func codeFail(c *gin.Context, code chainerr.Code, msg string) {
+	c.JSON(code.HTTPStatus(), gin.H{"msg": msg, "code": code})
+}
@@ -3,24 +3,35 @@ package httpserver
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/grid/contracts/go/market"
 	"github.com/gridprotocol/computing-api/computing/config"
 	"github.com/gridprotocol/computing-api/computing/deploy"
 	"github.com/gridprotocol/computing-api/computing/docker"
+	"github.com/gridprotocol/computing-api/computing/gateway/chainerr"
+	"github.com/gridprotocol/computing-api/computing/gateway/txmgr"
 	"github.com/gridprotocol/computing-api/computing/model"
 	"github.com/gridprotocol/computing-api/lib/utils"
 
 	"github.com/gin-gonic/gin"
 
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// the deployment is cleaned if the set app tx is not mined in it
+const setAppTimeout = 30 * time.Minute
+
 /*
 func (hc *handlerCore) handlerConfirm(c *gin.Context) {
 	user := c.Query("user")
@@ -142,6 +153,12 @@ func (hc *handlerCore) handlerDeployUrl(c *gin.Context) {
 		return
 	}
 
+	// the app is recorded with its order
+	oid64, orderInfo, ok := hc.deployOrder(c, addr)
+	if !ok {
+		return
+	}
+
 	// parse url into deps and svcs
 	deps, svcs, err := deploy.ParseYamlUrl(url)
 	if err != nil {
@@ -150,7 +167,7 @@ func (hc *handlerCore) handlerDeployUrl(c *gin.Context) {
 	}
 
 	logger.Debug("deploying app")
-	err = hc.gw.Deploy(deps, svcs, addr)
+	err = hc.gw.Deploy(orderRecord(oid64, addr, orderInfo), deps, svcs)
 	if err != nil {
 		deploy.Clean(deps)
 
@@ -164,9 +181,6 @@ func (hc *handlerCore) handlerDeployUrl(c *gin.Context) {
 
 // deploy app by app id
 func (hc *handlerCore) handlerDeployID(c *gin.Context) {
-	oid := c.Query("oid")
-	oid64, _ := utils.StringToUint64(oid)
-
 	yamlID := c.Query("id")
 	if len(yamlID) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] missing yaml id in request"})
@@ -189,6 +203,13 @@ func (hc *handlerCore) handlerDeployID(c *gin.Context) {
 
 	logger.Info("cookie check passed, addr:", user)
 
+	// get order info with params
+	oid64, orderInfo, ok := hc.deployOrder(c, user)
+	if !ok {
+		return
+	}
+	logger.Debug("node id:", orderInfo.NodeId)
+
 	// if no remote yaml is provided either, response error
 	if len(yamlID) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] the request missing yaml id"})
@@ -216,19 +237,13 @@ func (hc *handlerCore) handlerDeployID(c *gin.Context) {
 	cp := config.GetConfig().Remote.Wallet
 	logger.Info("cp addr:", cp)
 
-	// get order info with params
-	orderInfo, err := hc.gw.GetOrder(oid64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] get order info from contract failed: " + err.Error()})
-		return
-	}
-	logger.Debug("node id:", orderInfo.NodeId)
-
 	// set node id for the first deploy
 	deps[0].Spec.Template.Spec.NodeSelector["id"] = utils.Uint64ToString(orderInfo.NodeId)
 
 	// deploy deps
-	err = hc.gw.Deploy(deps, svcs, user)
+	order := orderRecord(oid64, user, orderInfo)
+	order.AppName = deps[0].Name
+	err = hc.gw.Deploy(order, deps, svcs)
 	if err != nil {
 		deploy.Clean(deps)
 
@@ -239,16 +254,69 @@ func (hc *handlerCore) handlerDeployID(c *gin.Context) {
 
 	logger.Debug("app name:", deps[0].Name)
 	// set the app name in order
-	err = hc.gw.SetApp(oid64, deps[0].Name)
+	hash, err := hc.gw.SetApp(oid64, deps[0].Name)
 	if err != nil {
 		deploy.Clean(deps)
 
-		msg := fmt.Sprintf("[Fail] Failed to set app: %s", err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"msg": msg})
+		chainFail(c, http.StatusInternalServerError, "[Fail] Failed to set app: ", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"msg": "[ACK] deploy ok"})
+	// the app is removed if the tx fails on chain
+	go hc.cleanOnFail(hash, deps)
+
+	c.JSON(http.StatusOK, gin.H{"msg": "[ACK] deploy ok, app name is being set in tx", "hash": hash.Hex()})
+}
+
+// the order in query to deploy for, only its user can deploy for it
+func (hc *handlerCore) deployOrder(c *gin.Context, user string) (uint64, *market.IMarketOrder, bool) {
+	oid64, err := utils.StringToUint64(c.Query("oid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] missing or invalid order id in request"})
+		return 0, nil, false
+	}
+
+	orderInfo, err := hc.gw.GetOrder(oid64)
+	if err != nil {
+		chainFail(c, http.StatusBadRequest, "[Fail] get order info from contract failed: ", err)
+		return 0, nil, false
+	}
+	if orderInfo.User != common.HexToAddress(user) {
+		codeFail(c, chainerr.CodeNotUser, "[Fail] only the user of the order can deploy for it")
+		return 0, nil, false
+	}
+	return oid64, orderInfo, true
+}
+
+// local record of an order read from chain
+func orderRecord(id uint64, user string, info *market.IMarketOrder) *model.Order {
+	o := &model.Order{
+		ID:      id,
+		User:    user,
+		AppName: info.AppName,
+		Status:  info.Status,
+	}
+	if info.ActivateTime != nil && info.Probation != nil && info.Duration != nil {
+		o.ActivateTime = info.ActivateTime.Int64()
+		o.ExpireTime = o.ActivateTime + info.Probation.Int64() + info.Duration.Int64()
+	}
+	return o
+}
+
+// wait for the set app tx and clean the deployment if it is not mined
+func (hc *handlerCore) cleanOnFail(hash common.Hash, deps []*appsv1.Deployment) {
+	ctx, cancel := context.WithTimeout(context.Background(), setAppTimeout)
+	defer cancel()
+
+	rec, err := hc.gw.WaitTx(ctx, hash)
+	if err != nil {
+		logger.Warnf("wait for set app tx %s failed: %s", hash, err)
+		return
+	}
+	if rec.Status != txmgr.StatusMined {
+		logger.Warnf("set app tx %s is %s, clean the deployment: %s", hash, rec.Status, rec.Err)
+		deploy.Clean(deps)
+	}
 }
 
 // clean deploy
@@ -278,7 +346,7 @@ func (hc *handlerCore) handlerClean(c *gin.Context) {
 	// get order info with params
 	orderInfo, err := hc.gw.GetOrder(oid64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] get order info from contract failed: " + err.Error()})
+		chainFail(c, http.StatusBadRequest, "[Fail] get order info from contract failed: ", err)
 		return
 	}
 	logger.Debug("order info:", orderInfo)
@@ -316,7 +384,7 @@ func (hc *handlerCore) handlerShow(c *gin.Context) {
 	// get order info with params
 	orderInfo, err := hc.gw.GetOrder(oid64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] get order info from contract failed: " + err.Error()})
+		chainFail(c, http.StatusBadRequest, "[Fail] get order info from contract failed: ", err)
 		return
 	}
 	logger.Debug("order info:", orderInfo)
@@ -359,98 +427,149 @@ func (hc *handlerCore) handlerShow(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"deployment": deployName, "available": avail, "progressing": progress})
 }
 
+// build an unsigned extend tx for the user, the user signs it and posts it back
 func (hc *handlerCore) handlerExtend(c *gin.Context) {
 	// order id
 	oid := c.Query("oid")
-	oid64, _ := utils.StringToUint64(oid)
+	oid64, err := utils.StringToUint64(oid)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] invalid order id: " + oid})
+		return
+	}
 
 	user := c.Query("user")
-	// get cp address from config file
-	//cp := config.GetConfig().Remote.Wallet
+	if !common.IsHexAddress(user) {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] invalid user address: " + user})
+		return
+	}
 
-	sk := c.Query("sk")
 	dur := c.Query("dur")
+	dur64, err := utils.StringToUint64(dur)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] invalid duration: " + dur})
+		return
+	}
 
 	logger.Debug("user:", user)
-	logger.Debug("sk:", sk)
 
 	// get order info with params
 	orderInfo, err := hc.gw.GetOrder(oid64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] get order info from contract failed: " + err.Error()})
+		chainFail(c, http.StatusBadRequest, "[Fail] get order info from contract failed: ", err)
 		return
 	}
 	logger.Debug("order info:", orderInfo)
 
 	// check order status
 	if orderInfo.Status != 2 {
-		c.JSON(http.StatusInternalServerError, gin.H{"msg": "[Error] only activated order can be renewed"})
+		codeFail(c, chainerr.CodeOrderNotActive, "[Error] only activated order can be renewed")
 		return
 	}
 
-	logger.Debug("renewing order")
+	if orderInfo.User != common.HexToAddress(user) {
+		codeFail(c, chainerr.CodeNotUser, "[Fail] only the user of the order can renew it")
+		return
+	}
 
-	// renew order
-	err = hc.gw.Extend(sk, oid64, dur)
+	tx, chainID, err := hc.gw.BuildExtend(common.HexToAddress(user), oid64, dur64)
 	if err != nil {
-		msg := fmt.Sprintf("[Fail] Failed to renew: %s", err.Error())
+		chainFail(c, http.StatusInternalServerError, "[Fail] Failed to build renew tx: ", err)
+		return
+	}
+
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		msg := fmt.Sprintf("[Fail] Failed to encode renew tx: %s", err.Error())
 		c.JSON(http.StatusInternalServerError, gin.H{"msg": msg})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"msg": "[ACK] order renewed"})
+	c.JSON(http.StatusOK, model.UnsignedTx{
+		Msg:      "[ACK] sign the tx and post it to /greet/extend",
+		Tx:       hexutil.Encode(raw),
+		ChainID:  chainID.String(),
+		From:     common.HexToAddress(user).Hex(),
+		To:       tx.To().Hex(),
+		Nonce:    tx.Nonce(),
+		Gas:      tx.Gas(),
+		GasPrice: tx.GasPrice().String(),
+		Data:     hexutil.Encode(tx.Data()),
+	})
 }
 
-func (hc *handlerCore) handlerReset(c *gin.Context) {
+// verify the extend tx signed by the user and send it
+func (hc *handlerCore) handlerExtendSend(c *gin.Context) {
 	// order id
 	oid := c.Query("oid")
-	id64, _ := utils.StringToUint64(oid)
+	oid64, err := utils.StringToUint64(oid)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] invalid order id: " + oid})
+		return
+	}
 
-	// user addr
-	user := c.Query("user")
-	// get cp address from config file
-	cp := config.GetConfig().Remote.Wallet
+	var req model.SignedTx
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] invalid request body: " + err.Error()})
+		return
+	}
 
-	prob := c.Query("prob")
-	dur := c.Query("dur")
+	raw, err := hexutil.Decode(req.Tx)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] invalid signed tx: " + err.Error()})
+		return
+	}
 
-	logger.Debug("user:", user)
-	logger.Debug("cp:", cp)
+	// get order info with params
+	orderInfo, err := hc.gw.GetOrder(oid64)
+	if err != nil {
+		chainFail(c, http.StatusBadRequest, "[Fail] get order info from contract failed: ", err)
+		return
+	}
 
-	logger.Debug("reseting order")
+	// check order status
+	if orderInfo.Status != 2 {
+		codeFail(c, chainerr.CodeOrderNotActive, "[Error] only activated order can be renewed")
+		return
+	}
+
+	logger.Debug("renewing order")
 
-	// reset order
-	err := hc.gw.Reset(id64, prob, dur)
+	// send the renew tx
+	hash, err := hc.gw.SendExtend(oid64, raw)
 	if err != nil {
-		msg := fmt.Sprintf("[Fail] Failed to reset: %s", err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"msg": msg})
+		chainFail(c, http.StatusInternalServerError, "[Fail] Failed to renew: ", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"msg": "[ACK] order reset to status 2 (active)"})
+	c.JSON(http.StatusOK, gin.H{"msg": "[ACK] renew tx sent, query it with /tx/" + hash.Hex(), "hash": hash.Hex()})
 }
 
-func (hc *handlerCore) handlerSettle(c *gin.Context) {
-	// order id
-	oid := c.Query("oid")
-	oid64, _ := utils.StringToUint64(oid)
-
-	// user addr
-	user := c.Query("user")
-
-	logger.Debug("user:", user)
+// status of a tx sent by the gateway, the record fields are inlined
+type txResult struct {
+	Msg string `json:"msg"`
+	*txmgr.Record
+}
 
-	logger.Debug("settling order")
+// get the status of a tx sent by the gateway
+func (hc *handlerCore) handlerTx(c *gin.Context) {
+	h := c.Param("hash")
+	b, err := hexutil.Decode(h)
+	if err != nil || len(b) != common.HashLength {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] invalid tx hash: " + h})
+		return
+	}
 
-	// cancel order
-	err := hc.gw.Settle(oid64)
+	rec, err := hc.gw.GetTx(common.BytesToHash(b))
 	if err != nil {
-		msg := fmt.Sprintf("[Fail] Failed to settle: %s", err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"msg": msg})
+		if errors.Is(err, txmgr.ErrUnknownTx) {
+			c.JSON(http.StatusNotFound, gin.H{"msg": "[Fail] tx is not sent by the gateway: " + h})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"msg": "[Fail] get tx status failed: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"msg": "[ACK] order settle ok"})
+	c.JSON(http.StatusOK, txResult{Msg: "[ACK] tx is " + rec.Status.String(), Record: rec})
 }
 
 // for all other requests, forward them to a proxy, and return the response from the proxy to the client
@@ -484,11 +603,16 @@ func (hc *handlerCore) handlerCompute(c *gin.Context) {
 	// get order info with params
 	orderInfo, err := hc.gw.GetOrder(id64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] get order info from contract failed: " + err.Error()})
+		chainFail(c, http.StatusBadRequest, "[Fail] get order info from contract failed: ", err)
 		return
 	}
 	logger.Debug("order info:", orderInfo)
 
+	// keep the local status of the order
+	if err := hc.gw.SetOrderStatus(id64, orderInfo.Status); err != nil {
+		logger.Warn("set local order status failed: ", err)
+	}
+
 	// check status must be activated
 	if orderInfo.Status != 2 {
 		var status string
@@ -515,8 +639,14 @@ func (hc *handlerCore) handlerCompute(c *gin.Context) {
 	}
 	logger.Debug("expire check ok")
 
-	// query entrance url(service endpoint) stored in DB with address
-	ent, err := hc.gw.GetEntrance(user)
+	// only the user of the order can use its app
+	if orderInfo.User != common.HexToAddress(user) {
+		codeFail(c, chainerr.CodeNotUser, "[Fail] only the user of the order can use its app")
+		return
+	}
+
+	// query entrance url(service endpoint) stored in DB with order id
+	ent, err := hc.gw.GetEntrance(id64, user)
 	if err != nil {
 		logger.Error("No Entrance: ", err)
 		msg := fmt.Sprintf("[Fail] have not deployed before or something went wrong: %s", err.Error())
@@ -5,6 +5,7 @@ import (
 	"net/http/httputil"
 	"sync"
 
+	"github.com/gridprotocol/computing-api/computing/config"
 	"github.com/gridprotocol/computing-api/computing/gateway"
 	"github.com/gridprotocol/computing-api/lib/logc"
 
@@ -19,8 +20,8 @@ type handlerCore struct {
 	cm  *cookieManager
 }
 
-// make a new server with a router registered all routes
-func NewServer(addr string, gw gateway.ComputingGatewayAPI) *http.Server {
+// make a new server with a router registered all routes, and the extra ones such as the prover status
+func NewServer(addr string, gw gateway.ComputingGatewayAPI, extra ...func(gin.IRouter)) *http.Server {
 	logger.Info("Starting server")
 
 	// gin mode
@@ -31,6 +32,9 @@ func NewServer(addr string, gw gateway.ComputingGatewayAPI) *http.Server {
 
 	// register all routes for the new router
 	registerAllRoutes(gw, r)
+	for _, register := range extra {
+		register(r)
+	}
 
 	// new server object with router
 	server := &http.Server{
@@ -68,13 +72,20 @@ func registerAllRoutes(gw gateway.ComputingGatewayAPI, r *gin.Engine) {
 	r.GET("/greet/deployurl", hc.handlerDeployUrl)
 	r.GET("/greet/deployid", hc.handlerDeployID)
 	r.GET("/greet/extend", hc.handlerExtend)
-	r.GET("/greet/reset", hc.handlerReset)
-	r.GET("/greet/settle", hc.handlerSettle)
+	r.POST("/greet/extend", hc.handlerExtendSend)
+	r.GET("/tx/:hash", hc.handlerTx)
 	r.GET("/greet/clean", hc.handlerClean)
 	r.GET("/greet/show", hc.handlerShow)
 	r.GET("/greet/modellist", hc.handlerModelList)
 
 	r.Any("/", hc.handlerCompute)
+
+	// operator routes, served on the admin listener if it is set
+	if config.GetConfig().Admin.Listen == "" {
+		if err := registerAdminRoutes(gw, r); err != nil {
+			logger.Error("admin api is disabled: ", err)
+		}
+	}
 }
 
 // for the cross domain access
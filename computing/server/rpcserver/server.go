@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/grid/contracts/go/market"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/gridprotocol/computing-api/computing/gateway"
+	"github.com/gridprotocol/computing-api/computing/gateway/chainerr"
 	"github.com/gridprotocol/computing-api/computing/model"
 	"github.com/gridprotocol/computing-api/computing/proto"
 	"github.com/gridprotocol/computing-api/lib/logc"
+	"github.com/gridprotocol/computing-api/lib/utils"
 )
 
 var logger = logc.Logger("server")
@@ -39,17 +41,33 @@ func (es *EntranceService) Greet(ctx context.Context, gfc *proto.GreetFromClient
 
 		return nil, nil
 	case 1: // apply for authority
-		var user string
-
 		logger.Debug("Greet - apply for authority")
 		// if !es.gw.StaticCheck(gfc.GetInput()) {
 		// 	return &proto.GreetFromServer{Result: "[Fail] the contract is not acceptable"}, nil
 		// }
 
+		user := gfc.GetOpts()["address"]
+		if !common.IsHexAddress(user) {
+			return &proto.GreetFromServer{Result: "[Fail] user's address is required"}, nil
+		}
+		oid, err := utils.StringToUint64(gfc.GetOpts()["oid"])
+		if err != nil {
+			return &proto.GreetFromServer{Result: "[Fail] missing or invalid order id"}, nil
+		}
+
+		// reverts and timeouts of the chain calls get their codes
+		orderInfo, err := es.gw.GetOrder(oid)
+		if err != nil {
+			return &proto.GreetFromServer{Result: "[Fail] get order info from contract failed"}, chainerr.GRPCError(err)
+		}
+		if orderInfo.User != common.HexToAddress(user) {
+			return &proto.GreetFromServer{Result: "[Fail] only the user of the order can be authorized"}, chainerr.GRPCError(chainerr.ErrNotUser)
+		}
+
 		// check payee (send activate tx if necessary)
-		ok, err := es.gw.PayeeCheck(market.IMarketOrder{})
+		ok, err := es.gw.PayeeCheck(*orderInfo)
 		if !ok {
-			return &proto.GreetFromServer{Result: "[Fail] Authorize failed"}, err
+			return &proto.GreetFromServer{Result: "[Fail] Authorize failed"}, chainerr.GRPCError(err)
 		}
 
 		// authorize and record in database and set a contract watcher
@@ -99,8 +117,8 @@ func (es *EntranceService) Process(ctx context.Context, gfc *proto.Request) (*pr
 		return &proto.Response{Response: nil}, fmt.Errorf("[Fail] Failed to verify your account %s", addr)
 	}
 
-	// acquire entrance from recording
-	entrance, err := es.gw.GetEntrance(addr)
+	// acquire entrance from recording, the latest active order of the user
+	entrance, err := es.gw.GetEntrance(0, addr)
 	if err != nil {
 		logger.Error("No Entrance: ", err)
 		return &proto.Response{Response: nil}, err
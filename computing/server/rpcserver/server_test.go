@@ -0,0 +1,89 @@
+package rpcserver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/grid/contracts/go/market"
+	"github.com/gridprotocol/computing-api/computing/gateway"
+	"github.com/gridprotocol/computing-api/computing/gateway/chainerr"
+	"github.com/gridprotocol/computing-api/computing/model"
+	"github.com/gridprotocol/computing-api/computing/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testUser = "0xd46e8dd67c5d32be8058bb8eb970870f07244567"
+
+// gateway with the chain calls of authorizing faked
+type fakeGateway struct {
+	gateway.ComputingGatewayAPI
+
+	order    *market.IMarketOrder
+	orderErr error
+	payeeErr error
+	authed   string
+}
+
+func (f *fakeGateway) GetOrder(id uint64) (*market.IMarketOrder, error) {
+	if f.orderErr != nil {
+		return nil, f.orderErr
+	}
+	return f.order, nil
+}
+
+func (f *fakeGateway) PayeeCheck(orderInfo market.IMarketOrder) (bool, error) {
+	if f.payeeErr != nil {
+		return false, f.payeeErr
+	}
+	return true, nil
+}
+
+func (f *fakeGateway) Authorize(user string, lease model.Lease) error {
+	f.authed = user
+	return nil
+}
+
+func (f *fakeGateway) SetWatcher(contract string) error {
+	return nil
+}
+
+func TestGreetAuthorizeCodes(t *testing.T) {
+	order := &market.IMarketOrder{User: common.HexToAddress(testUser)}
+	opts := map[string]string{"address": testUser, "oid": "1"}
+
+	cases := []struct {
+		name string
+		gw   *fakeGateway
+		code codes.Code
+	}{
+		{"ok", &fakeGateway{order: order}, codes.OK},
+		{"order not found", &fakeGateway{orderErr: fmt.Errorf("get order failed: %w", chainerr.ErrNotFound)}, codes.NotFound},
+		{"order timeout", &fakeGateway{orderErr: fmt.Errorf("get order failed: %w", context.DeadlineExceeded)}, codes.DeadlineExceeded},
+		{"other user", &fakeGateway{order: &market.IMarketOrder{User: common.HexToAddress("0x01")}}, codes.PermissionDenied},
+		{"activate reverted", &fakeGateway{order: order, payeeErr: fmt.Errorf("send activate tx failed: %w", chainerr.ErrOrderNotActive)}, codes.FailedPrecondition},
+	}
+
+	for _, c := range cases {
+		es := InitEntranceService(c.gw)
+		res, err := es.Greet(context.Background(), &proto.GreetFromClient{MsgType: 1, Opts: opts})
+		if got := status.Code(err); got != c.code {
+			t.Fatalf("%s: expect code %s, got %s (%v)", c.name, c.code, got, err)
+		}
+		if c.code == codes.OK && (res.GetResult() != "[ACK] authorized ok" || c.gw.authed != testUser) {
+			t.Fatalf("%s: unexpected result %q, authorized %q", c.name, res.GetResult(), c.gw.authed)
+		}
+		if c.code != codes.OK && c.gw.authed != "" {
+			t.Fatalf("%s: authorized on a failed check", c.name)
+		}
+	}
+
+	// a bad order id fails before any chain call
+	es := InitEntranceService(&fakeGateway{orderErr: context.DeadlineExceeded})
+	res, err := es.Greet(context.Background(), &proto.GreetFromClient{MsgType: 1, Opts: map[string]string{"address": testUser}})
+	if err != nil || res.GetResult() != "[Fail] missing or invalid order id" {
+		t.Fatalf("unexpected result %q, err %v", res.GetResult(), err)
+	}
+}
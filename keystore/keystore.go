@@ -6,29 +6,29 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"golang.org/x/xerrors"
 
 	"github.com/gridprotocol/computing-api/computing/config"
+	"github.com/gridprotocol/computing-api/lib/passwd"
 )
 
 // var _ KeyStore = (*keyStore)(nil)
-var Repo KeyStore
 
 type keyStore struct {
 	path string
+	// scrypt parameters of the keys written
+	scryptN int
+	scryptP int
 }
 
-// load repo from config
-func init() {
+// open the repo set in config
+func OpenRepo() (KeyStore, error) {
 	repoPath := config.GetConfig().Remote.KeyStore
-	repo, err := NewKeyStore(repoPath)
-	if err != nil {
-		panic(err)
+	if repoPath == "" {
+		return nil, xerrors.New("no keystore is set in config")
 	}
-
-	Repo = repo
+	return NewKeyStore(repoPath)
 }
 
 // create a repo to store keyfile
@@ -42,23 +42,26 @@ func NewKeyStore(path string) (KeyStore, error) {
 	// create a file for test password
 
 	return &keyStore{
-		path,
+		path:    path,
+		scryptN: StandardScryptN,
+		scryptP: StandardScryptP,
 	}, nil
 }
 
 // StorePrivateKey encrypt the privatekey by password and then store it in keystore
-func (k keyStore) Put(name, auth string, info KeyInfo) error {
+func (k keyStore) Put(name string, auth []byte, info KeyInfo) error {
 	sData, err := json.Marshal(info)
 	if err != nil {
 		return err
 	}
+	defer passwd.Zero(sData)
 
 	key := &Key{
 		Address:     name,
 		SecretValue: sData,
 	}
 
-	keyjson, err := encryptKey(key, auth, StandardScryptN, StandardScryptP)
+	keyjson, err := encryptKey(key, auth, k.scryptN, k.scryptP)
 	if err != nil {
 		return err
 	}
@@ -73,7 +76,7 @@ func (k keyStore) Put(name, auth string, info KeyInfo) error {
 	return writeKeyFile(path, keyjson)
 }
 
-func (k *keyStore) Get(name, auth string) (KeyInfo, error) {
+func (k *keyStore) Get(name string, auth []byte) (KeyInfo, error) {
 	var res KeyInfo
 
 	path := joinPath(k.path, name)
@@ -89,11 +92,12 @@ func (k *keyStore) Get(name, auth string) (KeyInfo, error) {
 		return res, err
 	}
 	// Make sure we're really operating on the requested key (no swap attacks)
-	if strings.Compare(key.Address, name) != 0 {
+	if !sameAddress(key, name) {
 		return res, xerrors.Errorf("key content mismatch: have peer %x, want %x", key.Address, name)
 	}
+	defer passwd.Zero(key.SecretValue)
 
-	err = json.Unmarshal(key.SecretValue, &res)
+	res, err = keyInfoOf(key)
 	if err != nil {
 		return res, xerrors.Errorf("decoding key '%s': %w", name, err)
 	}
@@ -135,7 +139,7 @@ func (k *keyStore) Exist(name string) (bool, error) {
 	return false, nil
 }
 
-func (k *keyStore) Delete(name, auth string) error {
+func (k *keyStore) Delete(name string, auth []byte) error {
 	_, err := k.Get(name, auth)
 	if err != nil {
 		return err
@@ -151,6 +155,66 @@ func (k *keyStore) Delete(name, auth string) error {
 	return nil
 }
 
+// ChangePassword re-encrypts the keys of names with newAuth. All the keys are decrypted by oldAuth
+// before any file is replaced, and each file is replaced atomically.
+func (k *keyStore) ChangePassword(oldAuth, newAuth []byte, names ...string) error {
+	type pending struct {
+		name string
+		path string
+		tmp  string
+	}
+	var files []pending
+	// remove the temporary files not moved into place
+	defer func() {
+		for _, f := range files {
+			os.Remove(f.tmp)
+		}
+	}()
+
+	for _, name := range names {
+		path := joinPath(k.path, name)
+		keyjson, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		key, err := decryptKey(keyjson, oldAuth)
+		if err != nil {
+			return xerrors.Errorf("decrypting key '%s': %w", name, err)
+		}
+		if !sameAddress(key, name) {
+			passwd.Zero(key.SecretValue)
+			return xerrors.Errorf("key content mismatch: have peer %x, want %x", key.Address, name)
+		}
+
+		// keep the format of the file
+		if key.Standard {
+			keyjson, err = encryptKeyStandard(key.Address, key.SecretValue, newAuth, k.scryptN, k.scryptP)
+		} else {
+			keyjson, err = encryptKey(key, newAuth, k.scryptN, k.scryptP)
+		}
+		passwd.Zero(key.SecretValue)
+		if err != nil {
+			return err
+		}
+
+		tmp, err := writeTemporaryKeyFile(path, keyjson)
+		if err != nil {
+			return err
+		}
+		files = append(files, pending{name, path, tmp})
+	}
+
+	for len(files) > 0 {
+		f := files[0]
+		if err := os.Rename(f.tmp, f.path); err != nil {
+			return xerrors.Errorf("replacing key '%s', the keys before it are changed: %w", f.name, err)
+		}
+		files = files[1:]
+	}
+
+	return nil
+}
+
 func (k *keyStore) Close() error {
 	return nil
 }
@@ -181,6 +245,12 @@ func writeTemporaryKeyFile(file string, content []byte) (string, error) {
 		os.Remove(f.Name())
 		return "", err
 	}
+	// on disk before it's renamed
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
 	f.Close()
 	return f.Name(), nil
 }
@@ -199,10 +269,11 @@ func LoadKeyFile(password, path string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	key, err := decryptKey(keyjson, password)
+	key, err := decryptKey(keyjson, []byte(password))
 	if err != nil {
 		return "", err
 	}
+	defer passwd.Zero(key.SecretValue)
 
 	sk := key.SecretValue
 	var res KeyInfo
@@ -0,0 +1,73 @@
+package keystore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	gethks "github.com/ethereum/go-ethereum/accounts/keystore"
+)
+
+func TestChangePassword(t *testing.T) {
+	dir := t.TempDir()
+	ks := &keyStore{path: dir, scryptN: gethks.LightScryptN, scryptP: gethks.LightScryptP}
+	old, pw := []byte("old"), []byte("new")
+
+	legacy, _ := NewKey()
+	if err := ks.Put(legacy.Address(), old, *legacy); err != nil {
+		t.Fatal(err)
+	}
+	standard, _ := NewKey()
+	keyjson, err := ExportKeyV3(*standard, old, gethks.LightScryptN, gethks.LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, standard.Address()), keyjson, 0600); err != nil {
+		t.Fatal(err)
+	}
+	other, _ := NewKey()
+	if err := ks.Put(other.Address(), []byte("other"), *other); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is changed if any key can't be decrypted
+	if err := ks.ChangePassword(old, pw, legacy.Address(), standard.Address(), other.Address()); err == nil {
+		t.Fatal("changed with a wrong password")
+	}
+	for _, ki := range []*KeyInfo{legacy, standard} {
+		if _, err := ks.Get(ki.Address(), old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if names, _ := ks.List(); len(names) != 3 {
+		t.Fatalf("temporary files are left: %v", names)
+	}
+
+	if err := ks.ChangePassword(old, pw, legacy.Address(), standard.Address()); err != nil {
+		t.Fatal(err)
+	}
+	for _, ki := range []*KeyInfo{legacy, standard} {
+		got, err := ks.Get(ki.Address(), pw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.SK() != ki.SK() {
+			t.Fatalf("unexpected key %s of %s", got.SK(), ki.Address())
+		}
+		if _, err := ks.Get(ki.Address(), old); err == nil {
+			t.Fatal("decrypted with the old password")
+		}
+	}
+	if names, _ := ks.List(); len(names) != 3 {
+		t.Fatalf("temporary files are left: %v", names)
+	}
+
+	// the standard file is still readable by geth
+	keyjson, err = os.ReadFile(filepath.Join(dir, standard.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gethks.DecryptKey(keyjson, string(pw)); err != nil {
+		t.Fatal(err)
+	}
+}
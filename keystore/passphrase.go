@@ -5,17 +5,25 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	cr "crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io"
+	"math"
 
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gridprotocol/computing-api/lib/passwd"
 	"github.com/zeebo/blake3"
+	"golang.org/x/crypto/pbkdf2"
 	"golang.org/x/crypto/scrypt"
 	"golang.org/x/xerrors"
 )
 
 const (
 	keyHeaderKDF = "scrypt"
+	// kdf of the web3 secret storage files written by some wallets, only hmac-sha256 is supported as its prf
+	kdfPBKDF2 = "pbkdf2"
 	// StandardScryptN is the N parameter of Scrypt encryption algorithm, using 256MB
 	// memory and taking approximately 1s CPU time on a modern processor.
 	StandardScryptN = 1 << 18
@@ -30,6 +38,9 @@ const (
 type Key struct {
 	Address     string
 	SecretValue []byte
+	// the key is read from a standard web3 secret storage file, its SecretValue is a raw secp256k1 key
+	// instead of a json KeyInfo
+	Standard bool
 }
 
 type cipherparamsJSON struct {
@@ -48,31 +59,72 @@ type cryptoJSON struct {
 type encryptedKeyJSONV3 struct {
 	Address string     `json:"address"`
 	Crypto  cryptoJSON `json:"crypto"`
-	Version int        `json:"version"`
+	// uuid of the key, required by geth in the standard files
+	ID      string `json:"id,omitempty"`
+	Version int    `json:"version"`
+}
+
+// the mac of the files in keystore
+func blake3MAC(derivedKey, cipherText []byte) []byte {
+	d := blake3.New()
+	d.Write(derivedKey[16:32])
+	d.Write(cipherText)
+	return d.Sum(nil)
+}
+
+// the mac of the standard web3 secret storage files
+func keccakMAC(derivedKey, cipherText []byte) []byte {
+	return crypto.Keccak256(derivedKey[16:32], cipherText)
 }
 
 // encryptKey encrypts a key using the specified scrypt parameters into a json
 // blob that can be decrypted later on.
-func encryptKey(key *Key, password string, scryptN, scryptP int) ([]byte, error) {
-	passwordArray := []byte(password)
-	salt := getEntropyCSPRNG(32)                                                               //生成一个随即的32B的salt
-	derivedKey, err := scrypt.Key(passwordArray, salt, scryptN, scryptR, scryptP, scryptDKLen) //使用scrypt算法对输入的password加密，生成一个32位的derivedKey
+func encryptKey(key *Key, password []byte, scryptN, scryptP int) ([]byte, error) {
+	cryptoStruct, err := encryptSecret(key.SecretValue, password, scryptN, scryptP, blake3MAC)
 	if err != nil {
 		return nil, err
 	}
-	encryptKey := derivedKey[:16]
+	encryptedKeyJSONV3 := encryptedKeyJSONV3{
+		Address: key.Address,
+		Crypto:  cryptoStruct,
+		Version: version,
+	}
+	return json.Marshal(encryptedKeyJSONV3)
+}
 
-	iv := getEntropyCSPRNG(aes.BlockSize)                         // 16,aes-128-ctr加密算法需要的初始化向量
-	cipherText, err := aesCTRXOR(encryptKey, key.SecretValue, iv) //对privatekey进行aes加密，生成一个32byte的cipherText
+// encryptKeyStandard encrypts a raw secp256k1 key of address into a standard web3 secret storage v3 json,
+// the address is in hex without 0x like geth
+func encryptKeyStandard(address string, sk []byte, password []byte, scryptN, scryptP int) ([]byte, error) {
+	cryptoStruct, err := encryptSecret(sk, password, scryptN, scryptP, keccakMAC)
 	if err != nil {
 		return nil, err
 	}
+	encryptedKeyJSONV3 := encryptedKeyJSONV3{
+		Address: address,
+		Crypto:  cryptoStruct,
+		ID:      newUUID(),
+		Version: version,
+	}
+	return json.Marshal(encryptedKeyJSONV3)
+}
 
-	//将derivedKey的后16byte与cipherText进行Keccak256哈希，生成32byte的mac，mac用于验证解密时password的正确性
-	d := blake3.New()
-	d.Write(derivedKey[16:32])
-	d.Write(cipherText)
-	mac := d.Sum(nil)
+func encryptSecret(secret []byte, password []byte, scryptN, scryptP int, macFn func(derivedKey, cipherText []byte) []byte) (cryptoJSON, error) {
+	salt := getEntropyCSPRNG(32)                                                          //生成一个随即的32B的salt
+	derivedKey, err := scrypt.Key(password, salt, scryptN, scryptR, scryptP, scryptDKLen) //使用scrypt算法对输入的password加密，生成一个32位的derivedKey
+	if err != nil {
+		return cryptoJSON{}, err
+	}
+	defer passwd.Zero(derivedKey)
+	encryptKey := derivedKey[:16]
+
+	iv := getEntropyCSPRNG(aes.BlockSize)                // 16,aes-128-ctr加密算法需要的初始化向量
+	cipherText, err := aesCTRXOR(encryptKey, secret, iv) //对privatekey进行aes加密，生成一个32byte的cipherText
+	if err != nil {
+		return cryptoJSON{}, err
+	}
+
+	//将derivedKey的后16byte与cipherText进行哈希，生成32byte的mac，mac用于验证解密时password的正确性
+	mac := macFn(derivedKey, cipherText)
 
 	scryptParamsJSON := make(map[string]interface{}, 5)
 	scryptParamsJSON["n"] = scryptN
@@ -85,20 +137,22 @@ func encryptKey(key *Key, password string, scryptN, scryptP int) ([]byte, error)
 		IV: hex.EncodeToString(iv),
 	}
 
-	cryptoStruct := cryptoJSON{
+	return cryptoJSON{
 		Cipher:       "aes-128-ctr",
 		CipherText:   hex.EncodeToString(cipherText),
 		CipherParams: cipherParamsJSON,
 		KDF:          keyHeaderKDF,
 		KDFParams:    scryptParamsJSON,
 		MAC:          hex.EncodeToString(mac),
-	}
-	encryptedKeyJSONV3 := encryptedKeyJSONV3{
-		key.Address,
-		cryptoStruct,
-		version,
-	}
-	return json.Marshal(encryptedKeyJSONV3)
+	}, nil
+}
+
+// a random uuid of version 4
+func newUUID() string {
+	u := getEntropyCSPRNG(16)
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
 }
 
 func getEntropyCSPRNG(n int) []byte {
@@ -122,7 +176,7 @@ func aesCTRXOR(key, inText, iv []byte) ([]byte, error) {
 	return outText, err
 }
 
-func decryptKey(keyjson []byte, auth string) (*Key, error) {
+func decryptKey(keyjson []byte, auth []byte) (*Key, error) {
 	k := new(encryptedKeyJSONV3)
 	err := json.Unmarshal(keyjson, k)
 	if err != nil {
@@ -130,7 +184,7 @@ func decryptKey(keyjson []byte, auth string) (*Key, error) {
 	}
 
 	// Handle any decryption errors and return the key
-	keyBytes, err := decryptKeyV3(k, auth)
+	keyBytes, standard, err := decryptKeyV3(k, auth)
 	if err != nil {
 		return nil, err
 	}
@@ -138,76 +192,123 @@ func decryptKey(keyjson []byte, auth string) (*Key, error) {
 	return &Key{
 		Address:     k.Address,
 		SecretValue: keyBytes,
+		Standard:    standard,
 	}, nil
 }
 
-func decryptKeyV3(keyProtected *encryptedKeyJSONV3, password string) (keyBytes []byte, err error) {
+// decrypt a file in keystore with the blake3 mac, or a standard one with the keccak mac
+func decryptKeyV3(keyProtected *encryptedKeyJSONV3, password []byte) (keyBytes []byte, standard bool, err error) {
 	if keyProtected.Version != version {
-		return nil, xerrors.Errorf("version not supported: %v", keyProtected.Version)
+		return nil, false, xerrors.Errorf("version not supported: %v", keyProtected.Version)
 	}
 
 	if keyProtected.Crypto.Cipher != "aes-128-ctr" {
-		return nil, xerrors.Errorf("cipher not supported: %v", keyProtected.Crypto.Cipher)
+		return nil, false, xerrors.Errorf("cipher not supported: %v", keyProtected.Crypto.Cipher)
 	}
 
 	mac, err := hex.DecodeString(keyProtected.Crypto.MAC)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	iv, err := hex.DecodeString(keyProtected.Crypto.CipherParams.IV)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, false, xerrors.Errorf("invalid iv length: %d", len(iv))
 	}
 
 	cipherText, err := hex.DecodeString(keyProtected.Crypto.CipherText)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	derivedKey, err := getKDFKey(keyProtected.Crypto, password)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
+	defer passwd.Zero(derivedKey)
 
-	d := blake3.New()
-	d.Write(derivedKey[16:32])
-	d.Write(cipherText)
-	calculatedMAC := d.Sum(nil)
-	if !bytes.Equal(calculatedMAC, mac) {
-		return nil, xerrors.New("could not decrypt key with given passphrase")
+	if len(derivedKey) < 32 {
+		return nil, false, xerrors.Errorf("derived key is too short: %d", len(derivedKey))
+	}
+	switch {
+	case bytes.Equal(blake3MAC(derivedKey, cipherText), mac):
+	case bytes.Equal(keccakMAC(derivedKey, cipherText), mac):
+		standard = true
+	default:
+		return nil, false, xerrors.New("could not decrypt key with given passphrase")
 	}
 
 	plainText, err := aesCTRXOR(derivedKey[:16], cipherText, iv)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	return plainText, err
+	return plainText, standard, err
 }
 
-func getKDFKey(cryptoJSON cryptoJSON, password string) ([]byte, error) {
-	passwordArray := []byte(password)
-	salt, err := hex.DecodeString(cryptoJSON.KDFParams["salt"].(string))
+func getKDFKey(cryptoJSON cryptoJSON, passwordArray []byte) ([]byte, error) {
+	params := cryptoJSON.KDFParams
+	saltHex, ok := params["salt"].(string)
+	if !ok {
+		return nil, xerrors.New("missing or invalid kdf param salt")
+	}
+	salt, err := hex.DecodeString(saltHex)
+	if err != nil {
+		return nil, err
+	}
+	dkLen, err := ensureInt(params, "dklen")
 	if err != nil {
 		return nil, err
 	}
-	dkLen := ensureInt(cryptoJSON.KDFParams["dklen"])
 
 	if cryptoJSON.KDF == keyHeaderKDF {
-		n := ensureInt(cryptoJSON.KDFParams["n"])
-		r := ensureInt(cryptoJSON.KDFParams["r"])
-		p := ensureInt(cryptoJSON.KDFParams["p"])
+		n, err := ensureInt(params, "n")
+		if err != nil {
+			return nil, err
+		}
+		r, err := ensureInt(params, "r")
+		if err != nil {
+			return nil, err
+		}
+		p, err := ensureInt(params, "p")
+		if err != nil {
+			return nil, err
+		}
 		return scrypt.Key(passwordArray, salt, n, r, p, dkLen)
 
+	} else if cryptoJSON.KDF == kdfPBKDF2 {
+		c, err := ensureInt(params, "c")
+		if err != nil {
+			return nil, err
+		}
+		prf, ok := params["prf"].(string)
+		if !ok {
+			return nil, xerrors.New("missing or invalid kdf param prf")
+		}
+		if prf != "hmac-sha256" {
+			return nil, xerrors.Errorf("unsupported PBKDF2 PRF: %s", prf)
+		}
+		return pbkdf2.Key(passwordArray, salt, c, dkLen, sha256.New), nil
 	}
 	return nil, xerrors.Errorf("unsupported KDF: %s", cryptoJSON.KDF)
 }
 
-func ensureInt(x interface{}) int {
-	res, ok := x.(int)
-	if !ok {
-		res = int(x.(float64))
+// a positive integer param of the kdf, it's a float64 when decoded from json
+func ensureInt(params map[string]interface{}, name string) (int, error) {
+	switch x := params[name].(type) {
+	case int:
+		if x > 0 {
+			return x, nil
+		}
+	case float64:
+		if x > 0 && x <= math.MaxInt32 && x == math.Trunc(x) {
+			return int(x), nil
+		}
+	case nil:
+		return 0, xerrors.Errorf("missing kdf param %s", name)
 	}
-	return res
+	return 0, xerrors.Errorf("invalid kdf param %s: %v", name, params[name])
 }
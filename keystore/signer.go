@@ -0,0 +1,37 @@
+package keystore
+
+import (
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/xerrors"
+
+	"github.com/gridprotocol/computing-api/keystore/signer"
+	"github.com/gridprotocol/computing-api/lib/passwd"
+)
+
+// make a signer of the key stored under name, the key is decrypted with auth and held by the signer only
+func NewSigner(ks KeyStore, name string, auth []byte) (signer.Signer, error) {
+	ki, err := ks.Get(name, auth)
+	if err != nil {
+		return nil, err
+	}
+	if ki.Type != Secp256k1 {
+		passwd.Zero(ki.SecretKey)
+		return nil, xerrors.Errorf("key '%s' of type %d can't sign", name, ki.Type)
+	}
+
+	key, err := crypto.ToECDSA(ki.SecretKey)
+	passwd.Zero(ki.SecretKey)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding key '%s': %w", name, err)
+	}
+	s := signer.NewKeySigner(key)
+
+	// the key of a wallet is stored under its address
+	if strings.HasPrefix(name, "0x") && !strings.EqualFold(s.Address().Hex(), name) {
+		return nil, xerrors.Errorf("key content mismatch: have address %s, want %s", s.Address(), name)
+	}
+
+	return s, nil
+}
@@ -0,0 +1,144 @@
+package signer
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// a signing waits for the approval on the external signer, it's failed after the timeout
+const DefaultExternalTimeout = 2 * time.Minute
+
+// a signer over the json-rpc api of clef, or any signer compatible with
+// account_signTransaction and account_signData
+type External struct {
+	client  *rpc.Client
+	addr    common.Address
+	timeout time.Duration
+}
+
+var _ Signer = (*External)(nil)
+
+// args of account_signTransaction
+type txArgs struct {
+	From                 common.MixedcaseAddress  `json:"from"`
+	To                   *common.MixedcaseAddress `json:"to"`
+	Gas                  hexutil.Uint64           `json:"gas"`
+	GasPrice             *hexutil.Big             `json:"gasPrice,omitempty"`
+	MaxFeePerGas         *hexutil.Big             `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *hexutil.Big             `json:"maxPriorityFeePerGas,omitempty"`
+	Value                hexutil.Big              `json:"value"`
+	Nonce                hexutil.Uint64           `json:"nonce"`
+	Input                *hexutil.Bytes           `json:"input,omitempty"`
+	ChainID              *hexutil.Big             `json:"chainId,omitempty"`
+}
+
+// result of account_signTransaction
+type signTxResult struct {
+	Raw hexutil.Bytes `json:"raw"`
+}
+
+// dial the external signer at url to sign with the key of addr, timeout 0 means the default
+func NewExternal(url string, addr common.Address, timeout time.Duration) (*External, error) {
+	client, err := rpc.Dial(url)
+	if err != nil {
+		return nil, fmt.Errorf("dial external signer failed: %s", err.Error())
+	}
+	if timeout <= 0 {
+		timeout = DefaultExternalTimeout
+	}
+	return &External{
+		client:  client,
+		addr:    addr,
+		timeout: timeout,
+	}, nil
+}
+
+func (e *External) Address() common.Address {
+	return e.addr
+}
+
+func (e *External) SignText(data []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	var sig hexutil.Bytes
+	err := e.client.CallContext(ctx, &sig, "account_signData", "text/plain", common.NewMixedcaseAddress(e.addr), hexutil.Bytes(data))
+	if err != nil {
+		return nil, fmt.Errorf("external sign failed: %s", err.Error())
+	}
+	if len(sig) != crypto.SignatureLength {
+		return nil, fmt.Errorf("external sign failed: invalid signature length %d", len(sig))
+	}
+	// clef replies V in 27 or 28
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	if !VerifyText(e.addr, data, sig) {
+		return nil, ErrWrongSigner
+	}
+
+	return sig, nil
+}
+
+func (e *External) SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	input := hexutil.Bytes(tx.Data())
+	args := txArgs{
+		From:    common.NewMixedcaseAddress(e.addr),
+		Gas:     hexutil.Uint64(tx.Gas()),
+		Value:   hexutil.Big(*tx.Value()),
+		Nonce:   hexutil.Uint64(tx.Nonce()),
+		Input:   &input,
+		ChainID: (*hexutil.Big)(chainID),
+	}
+	if to := tx.To(); to != nil {
+		mto := common.NewMixedcaseAddress(*to)
+		args.To = &mto
+	}
+	switch tx.Type() {
+	case types.LegacyTxType:
+		args.GasPrice = (*hexutil.Big)(tx.GasPrice())
+	case types.DynamicFeeTxType:
+		args.MaxFeePerGas = (*hexutil.Big)(tx.GasFeeCap())
+		args.MaxPriorityFeePerGas = (*hexutil.Big)(tx.GasTipCap())
+	default:
+		return nil, fmt.Errorf("external sign failed: unsupported tx type %d", tx.Type())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	var res signTxResult
+	if err := e.client.CallContext(ctx, &res, "account_signTransaction", args); err != nil {
+		return nil, fmt.Errorf("external sign failed: %s", err.Error())
+	}
+
+	signed := new(types.Transaction)
+	if err := signed.UnmarshalBinary(res.Raw); err != nil {
+		return nil, fmt.Errorf("decode signed tx failed: %s", err.Error())
+	}
+	// the signer may change the tx on approval, but not the sender
+	from, err := types.Sender(types.LatestSignerForChainID(chainID), signed)
+	if err != nil {
+		return nil, fmt.Errorf("recover signed tx failed: %s", err.Error())
+	}
+	if from != e.addr {
+		return nil, ErrWrongSigner
+	}
+	if signed.Nonce() != tx.Nonce() {
+		return nil, fmt.Errorf("external sign failed: nonce is changed from %d to %d", tx.Nonce(), signed.Nonce())
+	}
+
+	return signed, nil
+}
+
+func (e *External) Close() {
+	e.client.Close()
+}
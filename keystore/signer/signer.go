@@ -0,0 +1,78 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var ErrWrongSigner = errors.New("signed by another address")
+
+// Signer signs with a key of an address, the key may be held in memory or by an external signer
+type Signer interface {
+	// address of the key
+	Address() common.Address
+	// sign data as an ethereum text message, the hash is accounts.TextHash(data).
+	// The signature is in [R || S || V] with V in 0 or 1 like crypto.Sign.
+	SignText(data []byte) ([]byte, error)
+	// sign a tx for the chain
+	SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+}
+
+// a signer of a key in memory
+type keySigner struct {
+	key  *ecdsa.PrivateKey
+	addr common.Address
+}
+
+var _ Signer = (*keySigner)(nil)
+
+// make a signer of the key in memory
+func NewKeySigner(key *ecdsa.PrivateKey) Signer {
+	return &keySigner{
+		key:  key,
+		addr: crypto.PubkeyToAddress(key.PublicKey),
+	}
+}
+
+// make a signer of the sk in hex, used by the tests and the tools
+func HexToSigner(sk string) (Signer, error) {
+	key, err := crypto.HexToECDSA(sk)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeySigner(key), nil
+}
+
+func (s *keySigner) Address() common.Address {
+	return s.addr
+}
+
+func (s *keySigner) SignText(data []byte) ([]byte, error) {
+	return crypto.Sign(accounts.TextHash(data), s.key)
+}
+
+func (s *keySigner) SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), s.key)
+}
+
+// check the signature of the text is made by addr, V can be in 0, 1 or 27, 28
+func VerifyText(addr common.Address, data, sig []byte) bool {
+	if len(sig) != crypto.SignatureLength {
+		return false
+	}
+	sig = append([]byte(nil), sig...)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	pub, err := crypto.SigToPub(accounts.TextHash(data), sig)
+	if err != nil {
+		return false
+	}
+	return crypto.PubkeyToAddress(*pub) == addr
+}
@@ -0,0 +1,168 @@
+package signer
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const sk = "b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291"
+
+// a clef-like account api backed by a key in memory
+type fakeClef struct {
+	s Signer
+	// reply the signatures of another key
+	wrong Signer
+}
+
+func (f *fakeClef) signer() Signer {
+	if f.wrong != nil {
+		return f.wrong
+	}
+	return f.s
+}
+
+func (f *fakeClef) SignTransaction(ctx context.Context, args txArgs, methodSelector *string) (*signTxResult, error) {
+	if args.From.Address() != f.s.Address() {
+		return nil, errors.New("unknown account")
+	}
+	var inner types.TxData
+	if args.GasPrice != nil {
+		inner = &types.LegacyTx{
+			Nonce:    uint64(args.Nonce),
+			GasPrice: args.GasPrice.ToInt(),
+			Gas:      uint64(args.Gas),
+			To:       toAddress(args.To),
+			Value:    args.Value.ToInt(),
+			Data:     *args.Input,
+		}
+	} else {
+		inner = &types.DynamicFeeTx{
+			ChainID:   args.ChainID.ToInt(),
+			Nonce:     uint64(args.Nonce),
+			GasTipCap: args.MaxPriorityFeePerGas.ToInt(),
+			GasFeeCap: args.MaxFeePerGas.ToInt(),
+			Gas:       uint64(args.Gas),
+			To:        toAddress(args.To),
+			Value:     args.Value.ToInt(),
+			Data:      *args.Input,
+		}
+	}
+	tx, err := f.signer().SignTx(types.NewTx(inner), args.ChainID.ToInt())
+	if err != nil {
+		return nil, err
+	}
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &signTxResult{Raw: raw}, nil
+}
+
+func (f *fakeClef) SignData(contentType string, addr common.MixedcaseAddress, data hexutil.Bytes) (hexutil.Bytes, error) {
+	if contentType != "text/plain" || addr.Address() != f.s.Address() {
+		return nil, errors.New("unsupported request")
+	}
+	sig, err := f.signer().SignText(data)
+	if err != nil {
+		return nil, err
+	}
+	sig[crypto.RecoveryIDOffset] += 27
+	return sig, nil
+}
+
+func toAddress(a *common.MixedcaseAddress) *common.Address {
+	if a == nil {
+		return nil
+	}
+	addr := a.Address()
+	return &addr
+}
+
+func newFakeClef(t *testing.T, f *fakeClef) *External {
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("account", f); err != nil {
+		t.Fatal(err)
+	}
+	hs := httptest.NewServer(srv)
+	t.Cleanup(func() {
+		hs.Close()
+		srv.Stop()
+	})
+
+	e, err := NewExternal(hs.URL, f.s.Address(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.Close)
+	return e
+}
+
+// the key signer and the external one make the same signatures
+func TestSigners(t *testing.T) {
+	ks, err := HexToSigner(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext := newFakeClef(t, &fakeClef{s: ks})
+	if ext.Address() != ks.Address() {
+		t.Fatalf("unexpected address %s", ext.Address())
+	}
+
+	chainID := big.NewInt(1337)
+	to := common.HexToAddress("0x01")
+	txs := []*types.Transaction{
+		types.NewTx(&types.DynamicFeeTx{ChainID: chainID, Nonce: 3, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(10), Gas: 21000, To: &to, Value: big.NewInt(5), Data: []byte{1, 2}}),
+		types.NewTx(&types.LegacyTx{Nonce: 4, GasPrice: big.NewInt(7), Gas: 21000, To: &to, Value: big.NewInt(0)}),
+	}
+
+	for _, s := range []Signer{ks, ext} {
+		msg := []byte("hello")
+		sig, err := s.SignText(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sig[crypto.RecoveryIDOffset] > 1 || !VerifyText(ks.Address(), msg, sig) {
+			t.Fatalf("invalid signature %x", sig)
+		}
+		if VerifyText(ks.Address(), []byte("hello!"), sig) {
+			t.Fatal("signature of another text is verified")
+		}
+
+		for _, tx := range txs {
+			signed, err := s.SignTx(tx, chainID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			from, err := types.Sender(types.LatestSignerForChainID(chainID), signed)
+			if err != nil || from != ks.Address() || signed.Nonce() != tx.Nonce() || signed.Type() != tx.Type() {
+				t.Fatalf("unexpected signed tx from %s, error %v", from, err)
+			}
+		}
+	}
+}
+
+// the signatures by another key are rejected
+func TestExternalWrongKey(t *testing.T) {
+	ks, _ := HexToSigner(sk)
+	key, _ := crypto.GenerateKey()
+	ext := newFakeClef(t, &fakeClef{s: ks, wrong: NewKeySigner(key)})
+
+	if _, err := ext.SignText([]byte("hello")); !errors.Is(err, ErrWrongSigner) {
+		t.Fatalf("expected wrong signer, got %v", err)
+	}
+	to := common.HexToAddress("0x01")
+	tx := types.NewTx(&types.LegacyTx{Nonce: 1, GasPrice: big.NewInt(1), Gas: 21000, To: &to, Value: big.NewInt(0)})
+	if _, err := ext.SignTx(tx, big.NewInt(1337)); !errors.Is(err, ErrWrongSigner) {
+		t.Fatalf("expected wrong signer, got %v", err)
+	}
+}
@@ -18,11 +18,13 @@ type KeyStore interface {
 	// List lists all the keys stored in the KeyStore
 	List() ([]string, error)
 	// Get gets a key out of keystore use its name and password
-	Get(string, string) (KeyInfo, error)
+	Get(string, []byte) (KeyInfo, error)
 	// Put saves a key info under given name and password
-	Put(string, string, KeyInfo) error
+	Put(string, []byte, KeyInfo) error
 	// Delete removes a key from keystores
-	Delete(string, string) error
+	Delete(string, []byte) error
+	// ChangePassword re-encrypts the keys of names from the old password to the new one
+	ChangePassword(oldAuth, newAuth []byte, names ...string) error
 	// check if a name exist in the keystore
 	Exist(name string) (bool, error)
 
@@ -0,0 +1,70 @@
+package keystore
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gridprotocol/computing-api/lib/passwd"
+	"golang.org/x/xerrors"
+)
+
+// ImportKeyV3 decrypts a standard web3 secret storage v3 file, e.g. of geth, metamask or foundry.
+// A file of this keystore is accepted too.
+func ImportKeyV3(keyjson []byte, password []byte) (*KeyInfo, error) {
+	key, err := decryptKey(keyjson, password)
+	if err != nil {
+		return nil, err
+	}
+
+	defer passwd.Zero(key.SecretValue)
+
+	ki, err := keyInfoOf(key)
+	if err != nil {
+		return nil, err
+	}
+	// the address is optional in the standard files
+	if key.Address != "" && !sameAddress(key, ki.Address()) {
+		return nil, xerrors.Errorf("key content mismatch: have address %s, want %s", ki.Address(), key.Address)
+	}
+
+	return &ki, nil
+}
+
+// ExportKeyV3 encrypts a secp256k1 key into a standard web3 secret storage v3 file with the scrypt parameters,
+// StandardScryptN and StandardScryptP are used by geth
+func ExportKeyV3(ki KeyInfo, password []byte, scryptN, scryptP int) ([]byte, error) {
+	if ki.Type != Secp256k1 {
+		return nil, xerrors.Errorf("key of type %d can't be exported", ki.Type)
+	}
+	address := strings.ToLower(strings.TrimPrefix(ki.Address(), "0x"))
+	return encryptKeyStandard(address, ki.SecretKey, password, scryptN, scryptP)
+}
+
+// the key info in the decrypted key
+func keyInfoOf(key *Key) (KeyInfo, error) {
+	var res KeyInfo
+	if !key.Standard {
+		err := json.Unmarshal(key.SecretValue, &res)
+		return res, err
+	}
+
+	// the keys shorter than 32 bytes are written by some old wallets
+	if len(key.SecretValue) > 32 {
+		return res, xerrors.Errorf("invalid key length: %d", len(key.SecretValue))
+	}
+	res.Type = Secp256k1
+	res.SecretKey = make([]byte, 32)
+	copy(res.SecretKey[32-len(key.SecretValue):], key.SecretValue)
+	return res, nil
+}
+
+// check the key is stored under name. The address in a standard file is in hex without 0x,
+// and maybe in lower case.
+func sameAddress(key *Key, name string) bool {
+	if !key.Standard {
+		return key.Address == name
+	}
+	return common.IsHexAddress(key.Address) && common.IsHexAddress(name) &&
+		common.HexToAddress(key.Address) == common.HexToAddress(name)
+}
@@ -0,0 +1,181 @@
+package keystore
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gethks "github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// test vectors of geth in accounts/keystore/testdata/v3_test_vector.json
+var vectors = []struct {
+	name     string
+	json     string
+	password string
+	priv     string
+}{
+	{
+		"wikipage_test_vector_scrypt",
+		`{"crypto":{"cipher":"aes-128-ctr","cipherparams":{"iv":"83dbcc02d8ccb40e466191a123791e0e"},"ciphertext":"d172bf743a674da9cdad04534d56926ef8358534d458fffccd4e6ad2fbde479c","kdf":"scrypt","kdfparams":{"dklen":32,"n":262144,"r":1,"p":8,"salt":"ab0c7876052600dd703518d6fc3fe8984592145b591fc8fb5c6d43190334ba19"},"mac":"2103ac29920d71da29f15d75b4a16dbe95cfd7ff8faea1056c33131d846e3097"},"id":"3198bc9c-6672-5ab3-d995-4942343ae5b6","version":3}`,
+		"testpassword",
+		"7a28b5ba57c53603b0b07b56bba752f7784bf506fa95edc395f5cf6c7514fe9d",
+	},
+	{
+		"wikipage_test_vector_pbkdf2",
+		`{"crypto":{"cipher":"aes-128-ctr","cipherparams":{"iv":"6087dab2f9fdbbfaddc31a909735c1e6"},"ciphertext":"5318b4d5bcd28de64ee5559e671353e16f075ecae9f99c7a79a38af5f869aa46","kdf":"pbkdf2","kdfparams":{"c":262144,"dklen":32,"prf":"hmac-sha256","salt":"ae3cd4e7013836a3df6bd7241b12db061dbe2c6785853cce422d148a624ce0bd"},"mac":"517ead924a9d0dc3124507e3393d175ce3ff7c1e96529c6c555ce9e51205e9b2"},"id":"3198bc9c-6672-5ab3-d995-4942343ae5b6","version":3}`,
+		"testpassword",
+		"7a28b5ba57c53603b0b07b56bba752f7784bf506fa95edc395f5cf6c7514fe9d",
+	},
+	{
+		"31_byte_key",
+		`{"crypto":{"cipher":"aes-128-ctr","cipherparams":{"iv":"e0c41130a323adc1446fc82f724bca2f"},"ciphertext":"9517cd5bdbe69076f9bf5057248c6c050141e970efa36ce53692d5d59a3984","kdf":"scrypt","kdfparams":{"dklen":32,"n":2,"r":8,"p":1,"salt":"711f816911c92d649fb4c84b047915679933555030b3552c1212609b38208c63"},"mac":"d5e116151c6aa71470e67a7d42c9620c75c4d23229847dcc127794f0732b0db5"},"id":"fecfc4ce-e956-48fd-953b-30f8b52ed66c","version":3}`,
+		"foo",
+		"00fa7b3db73dc7dfdf8c5fbdb796d741e4488628c41fc4febd9160a866ba0f35",
+	},
+}
+
+func TestImportKeyV3(t *testing.T) {
+	for _, v := range vectors {
+		ki, err := ImportKeyV3([]byte(v.json), []byte(v.password))
+		if err != nil {
+			t.Fatalf("%s: %s", v.name, err)
+		}
+		if ki.Type != Secp256k1 || ki.SK() != v.priv {
+			t.Fatalf("%s: unexpected key %s", v.name, ki.SK())
+		}
+
+		if _, err := ImportKeyV3([]byte(v.json), []byte(v.password+"x")); err == nil {
+			t.Fatalf("%s: decrypted with a wrong password", v.name)
+		}
+	}
+}
+
+// malformed kdf params and iv are rejected without panic
+func TestImportKeyV3Malformed(t *testing.T) {
+	var base map[string]interface{}
+	if err := json.Unmarshal([]byte(vectors[1].json), &base); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]func(c map[string]interface{}){
+		"no salt":     func(c map[string]interface{}) { delete(kdfParams(c), "salt") },
+		"salt number": func(c map[string]interface{}) { kdfParams(c)["salt"] = 1 },
+		"no dklen":    func(c map[string]interface{}) { delete(kdfParams(c), "dklen") },
+		"dklen text":  func(c map[string]interface{}) { kdfParams(c)["dklen"] = "32" },
+		"c negative":  func(c map[string]interface{}) { kdfParams(c)["c"] = -1 },
+		"c fraction":  func(c map[string]interface{}) { kdfParams(c)["c"] = 1.5 },
+		"no prf":      func(c map[string]interface{}) { delete(kdfParams(c), "prf") },
+		"no params":   func(c map[string]interface{}) { delete(c, "kdfparams") },
+		"short iv":    func(c map[string]interface{}) { c["cipherparams"] = map[string]interface{}{"iv": "00"} },
+	}
+	for name, change := range cases {
+		var v map[string]interface{}
+		b, _ := json.Marshal(base)
+		json.Unmarshal(b, &v)
+		change(v["crypto"].(map[string]interface{}))
+
+		keyjson, _ := json.Marshal(v)
+		if _, err := ImportKeyV3(keyjson, []byte(vectors[1].password)); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
+
+func kdfParams(c map[string]interface{}) map[string]interface{} {
+	return c["kdfparams"].(map[string]interface{})
+}
+
+// an exported file is read by geth and imported back
+func TestExportKeyV3(t *testing.T) {
+	ki, err := Import(vectors[0].priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyjson, err := ExportKeyV3(*ki, []byte("pw"), gethks.LightScryptN, gethks.LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := gethks.DecryptKey(keyjson, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Address.Hex() != ki.Address() || hex.EncodeToString(crypto.FromECDSA(key.PrivateKey)) != ki.SK() {
+		t.Fatalf("unexpected key of %s by geth", key.Address)
+	}
+
+	back, err := ImportKeyV3(keyjson, []byte("pw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.SK() != ki.SK() {
+		t.Fatalf("unexpected key %s", back.SK())
+	}
+
+	// the keys of geth are imported
+	keyjson, err = gethks.EncryptKey(key, "geth", gethks.LightScryptN, gethks.LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err = ImportKeyV3(keyjson, []byte("geth"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.SK() != ki.SK() {
+		t.Fatalf("unexpected key %s", back.SK())
+	}
+}
+
+// files in both formats are read from the keystore
+func TestKeyStoreFormats(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := NewKeyStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy, _ := NewKey()
+	data, _ := json.Marshal(legacy)
+	keyjson, err := encryptKey(&Key{Address: legacy.Address(), SecretValue: data}, []byte("pw"), gethks.LightScryptN, gethks.LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, legacy.Address()), keyjson, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	standard, _ := NewKey()
+	keyjson, err = ExportKeyV3(*standard, []byte("pw"), gethks.LightScryptN, gethks.LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, standard.Address()), keyjson, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []*KeyInfo{legacy, standard} {
+		ki, err := ks.Get(want.Address(), []byte("pw"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ki.SK() != want.SK() {
+			t.Fatalf("unexpected key %s of %s", ki.SK(), want.Address())
+		}
+		if _, err := ks.Get(want.Address(), []byte("wrong")); err == nil {
+			t.Fatal("decrypted with a wrong password")
+		}
+	}
+
+	// a file under another name is rejected
+	if err := os.Rename(filepath.Join(dir, standard.Address()), filepath.Join(dir, legacy.Address())); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Get(legacy.Address(), []byte("pw")); err == nil {
+		t.Fatal("expected key content mismatch")
+	}
+}
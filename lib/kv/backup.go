@@ -0,0 +1,115 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/gridprotocol/computing-api/lib/logc"
+)
+
+var logger = logc.Logger("kv")
+
+// ErrLocked is returned by Open if the db is used by another process, e.g. the running daemon
+var ErrLocked = errors.New("db is used by another process")
+
+// ErrNoDB is returned by Open if there is no db at the path
+var ErrNoDB = errors.New("no db at the path")
+
+// max pending writes of restore
+const restorePending = 256
+
+// open an existing db, unlike NewDatabase it's never created
+func Open(path string) (*Database, error) {
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoDB
+		}
+		return nil, err
+	}
+
+	db, err := NewDatabase(path)
+	if err != nil {
+		if strings.Contains(err.Error(), "Cannot acquire directory lock") {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+	return db, nil
+}
+
+// write the versions after since to w in the badger streaming backup format, the db is
+// kept serving. The returned version is the since of the next incremental backup.
+func (d *Database) Backup(w io.Writer, since uint64) (uint64, error) {
+	return d.db.Backup(w, since)
+}
+
+// load a backup into the db
+func (d *Database) Restore(r io.Reader) error {
+	return d.db.Load(r, restorePending)
+}
+
+// check there is no key in the db
+func (d *Database) Empty() (bool, error) {
+	empty := true
+	err := d.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		it.Rewind()
+		empty = !it.Valid()
+		return nil
+	})
+	return empty, err
+}
+
+// size of the lsm tree and the value log in byte
+func (d *Database) Size() (int64, int64) {
+	return d.db.Size()
+}
+
+// rewrite the value log files with more than ratio of stale data, until none is left.
+// It returns the number of rewritten files.
+func (d *Database) GC(ratio float64) (int, error) {
+	n := 0
+	for {
+		err := d.db.RunValueLogGC(ratio)
+		if errors.Is(err, badger.ErrNoRewrite) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// run value log gc every interval until ctx is done
+func (d *Database) RunGC(ctx context.Context, interval time.Duration, ratio float64) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n, err := d.GC(ratio)
+		if err != nil {
+			logger.Warn("value log gc failed: ", err)
+			continue
+		}
+		if n > 0 {
+			lsm, vlog := d.Size()
+			logger.Info("value log gc rewrote ", n, " files, lsm size: ", lsm, ", vlog size: ", vlog)
+		}
+	}
+}
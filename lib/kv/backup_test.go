@@ -0,0 +1,103 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	src, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	putKeys(t, src, "a/1", "a/2", "b/1")
+	src.Delete([]byte("a/2"))
+
+	var full bytes.Buffer
+	since, err := src.Backup(&full, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// incremental backup holds the versions after the full one
+	putKeys(t, src, "c/1")
+	var inc bytes.Buffer
+	if _, err := src.Backup(&inc, since); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	if empty, _ := dst.Empty(); !empty {
+		t.Fatal("new db should be empty")
+	}
+	if err := dst.Restore(&full); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Restore(&inc); err != nil {
+		t.Fatal(err)
+	}
+
+	got := collect(t, func(fn func(key, value []byte) (bool, error)) error {
+		return dst.Iterate(nil, fn)
+	})
+	if fmt.Sprint(got) != "[a/1 b/1 c/1]" {
+		t.Fatalf("unexpected restored keys %v", got)
+	}
+
+	if _, err := src.GC(0.5); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Open(filepath.Join(dir, "none")); !errors.Is(err, ErrNoDB) {
+		t.Fatalf("expected no db, got %v", err)
+	}
+
+	db, err := NewDatabase(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := Open(dir); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected locked, got %v", err)
+	}
+}
+
+func TestHuman(t *testing.T) {
+	keys := map[string][]byte{
+		"watch/market/cursor": []byte("watch/market/cursor"),
+		"o/#42":               binary.BigEndian.AppendUint64([]byte("o/"), 42),
+		"os/0x012f":           {'o', 's', '/', 1, '/'},
+	}
+	for want, key := range keys {
+		if got := HumanKey(key); got != want {
+			t.Fatalf("expected %s, got %s", want, got)
+		}
+	}
+
+	values := map[string][]byte{
+		`{"id":1}`: []byte("{ \"id\": 1 }"),
+		"0x00ff":   {0, 0xff},
+		"<empty>":  nil,
+		"http://x": []byte("http://x"),
+	}
+	for want, value := range values {
+		if got := HumanValue(value); got != want {
+			t.Fatalf("expected %s, got %s", want, got)
+		}
+	}
+}
@@ -1,6 +1,15 @@
 package kv
 
-import "github.com/dgraph-io/badger/v2"
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+)
+
+// times of running a txn closure conflicted with another txn
+const txnRetries = 3
 
 type Database struct {
 	db *badger.DB
@@ -114,3 +123,125 @@ func (d *Database) Update(key []byte, updateFunc func(value []byte) ([]byte, err
 		return txn.Set(key, newValue)
 	})
 }
+
+// put a key expiring after ttl
+func (d *Database) PutWithTTL(key []byte, value []byte, ttl time.Duration) error {
+	return d.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry(key, value).WithTTL(ttl))
+	})
+}
+
+// iterate the keys with prefix in order, stop when fn returns false
+func (d *Database) Iterate(prefix []byte, fn func(key, value []byte) (bool, error)) error {
+	return d.scan(prefix, prefix, nil, fn)
+}
+
+// iterate the keys in [start, end) in order, end is unbounded if it's nil
+func (d *Database) IterateRange(start, end []byte, fn func(key, value []byte) (bool, error)) error {
+	return d.scan(nil, start, end, fn)
+}
+
+// at most limit entries with prefix after the key after, next is nil on the last page
+func (d *Database) Page(prefix, after []byte, limit int) ([]Entry, []byte, error) {
+	return page(d.scan, prefix, after, limit)
+}
+
+func (d *Database) scan(prefix, start, end []byte, fn func(key, value []byte) (bool, error)) error {
+	return d.db.View(func(txn *badger.Txn) error {
+		return scanTxn(txn, prefix, start, end, fn)
+	})
+}
+
+// iterate the keys with prefix in [start, end) of a txn
+func scanTxn(txn *badger.Txn, prefix, start, end []byte, fn func(key, value []byte) (bool, error)) error {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	for it.Seek(start); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+		if end != nil && bytes.Compare(item.Key(), end) >= 0 {
+			return nil
+		}
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		next, err := fn(item.KeyCopy(nil), value)
+		if err != nil {
+			return err
+		}
+		if !next {
+			return nil
+		}
+	}
+	return nil
+}
+
+// run fn in a read-write txn, it's run again if the txn conflicts with another one
+func (d *Database) Txn(fn func(txn Txn) error) error {
+	var err error
+	for i := 0; i < txnRetries; i++ {
+		err = d.db.Update(func(txn *badger.Txn) error {
+			return fn(badgerTxn{txn: txn})
+		})
+		if !errors.Is(err, badger.ErrConflict) {
+			return err
+		}
+	}
+	return err
+}
+
+type badgerTxn struct {
+	txn *badger.Txn
+}
+
+func (t badgerTxn) Get(key []byte) ([]byte, error) {
+	item, err := t.txn.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return item.ValueCopy(nil)
+}
+
+func (t badgerTxn) Has(key []byte) (bool, error) {
+	_, err := t.txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (t badgerTxn) Put(key, value []byte) error {
+	return t.txn.Set(key, value)
+}
+
+func (t badgerTxn) PutWithTTL(key, value []byte, ttl time.Duration) error {
+	return t.txn.SetEntry(badger.NewEntry(key, value).WithTTL(ttl))
+}
+
+func (t badgerTxn) Delete(key []byte) error {
+	return t.txn.Delete(key)
+}
+
+func (t badgerTxn) Iterate(prefix []byte, fn func(key, value []byte) (bool, error)) error {
+	return scanTxn(t.txn, prefix, prefix, nil, fn)
+}
+
+// put keys and delete delKeys in one txn
+func (d *Database) Batch(keys [][]byte, values [][]byte, delKeys [][]byte) error {
+	return d.db.Update(func(txn *badger.Txn) error {
+		for _, k := range delKeys {
+			if err := txn.Delete(k); err != nil {
+				return err
+			}
+		}
+		for i := 0; i < len(keys); i++ {
+			if err := txn.Set(keys[i], values[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
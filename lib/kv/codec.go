@@ -0,0 +1,75 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Codec encodes the typed values in db
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	JSON Codec = jsonCodec{}
+	Gob  Codec = gobCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// get the value of key decoded by c, ErrNotFound if it's not in db
+func GetAs[T any](r Reader, c Codec, key []byte) (T, error) {
+	var v T
+	val, err := r.Get(key)
+	if err != nil {
+		return v, err
+	}
+	if err := c.Unmarshal(val, &v); err != nil {
+		return v, fmt.Errorf("decode %q failed: %s", key, err.Error())
+	}
+	return v, nil
+}
+
+// put v encoded by c
+func PutAs[T any](w Writer, c Codec, key []byte, v T) error {
+	val, err := c.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode %q failed: %s", key, err.Error())
+	}
+	return w.Put(key, val)
+}
+
+// put v encoded by c, it expires after ttl
+func PutAsWithTTL[T any](w Writer, c Codec, key []byte, v T, ttl time.Duration) error {
+	val, err := c.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode %q failed: %s", key, err.Error())
+	}
+	return w.PutWithTTL(key, val, ttl)
+}
@@ -0,0 +1,66 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// values longer than it are cut in the readable form
+const maxReadableValue = 256
+
+// printable prefix of b
+func printable(b []byte) int {
+	for i := 0; i < len(b); {
+		r, size := utf8.DecodeRune(b[i:])
+		if r == utf8.RuneError || !unicode.IsPrint(r) {
+			return i
+		}
+		i += size
+	}
+	return len(b)
+}
+
+// readable form of a key. The keys are a text prefix followed by an optional binary part,
+// a binary part of 8 bytes is a big endian number, e.g. o/#42, others are in hex.
+func HumanKey(key []byte) string {
+	n := printable(key)
+	if n == len(key) {
+		return string(key)
+	}
+
+	head, tail := string(key[:n]), key[n:]
+	if len(tail) == 8 {
+		return head + "#" + strconv.FormatUint(binary.BigEndian.Uint64(tail), 10)
+	}
+	return head + "0x" + hex.EncodeToString(tail)
+}
+
+// readable form of a value, json is compacted, other binary values are in hex
+func HumanValue(value []byte) string {
+	var res string
+	switch {
+	case len(value) == 0:
+		return "<empty>"
+	case json.Valid(value):
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, value); err != nil {
+			res = string(value)
+		} else {
+			res = buf.String()
+		}
+	case printable(value) == len(value):
+		res = string(value)
+	default:
+		res = "0x" + hex.EncodeToString(value)
+	}
+
+	if len(res) > maxReadableValue {
+		res = res[:maxReadableValue] + "...(" + strconv.Itoa(len(value)) + " bytes)"
+	}
+	return res
+}
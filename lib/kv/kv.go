@@ -0,0 +1,107 @@
+package kv
+
+import (
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+)
+
+// ErrNotFound is returned by Get and Update of a key not in db, or expired
+var ErrNotFound = badger.ErrKeyNotFound
+
+// Entry is a key and its value read by Page
+type Entry struct {
+	Key   []byte
+	Value []byte
+}
+
+// Reader reads a key, both the store and a txn are readers
+type Reader interface {
+	Get(key []byte) ([]byte, error)
+	Has(key []byte) (bool, error)
+}
+
+// Writer writes a key, both the store and a txn are writers
+type Writer interface {
+	Put(key, value []byte) error
+	PutWithTTL(key, value []byte, ttl time.Duration) error
+	Delete(key []byte) error
+}
+
+// Txn is the view of a transaction, its writes are seen by its reads,
+// and they are committed together when the closure returns nil
+type Txn interface {
+	Reader
+	Writer
+	// iterate the keys with prefix in order, stop when fn returns false
+	Iterate(prefix []byte, fn func(key, value []byte) (bool, error)) error
+}
+
+// Store is the kv interface of the gateway, implemented by the badger database
+// and by the in-memory one for tests
+type Store interface {
+	Reader
+	Writer
+
+	MultiPut(keys [][]byte, values [][]byte) error
+	MultiDelete(keys [][]byte) error
+	// put keys and delete delKeys in one txn
+	Batch(keys [][]byte, values [][]byte, delKeys [][]byte) error
+	// replace the value of an existing key
+	Update(key []byte, updateFunc func(value []byte) ([]byte, error)) error
+
+	// iterate the keys with prefix in order, stop when fn returns false
+	Iterate(prefix []byte, fn func(key, value []byte) (bool, error)) error
+	// iterate the keys in [start, end) in order, end is unbounded if it's nil
+	IterateRange(start, end []byte, fn func(key, value []byte) (bool, error)) error
+	// at most limit entries with prefix after the key after, next is the key to read the
+	// next page after, it's nil on the last page
+	Page(prefix, after []byte, limit int) (entries []Entry, next []byte, err error)
+
+	// run fn in a transaction spanning reads and writes, the writes are dropped if fn fails
+	Txn(fn func(txn Txn) error) error
+
+	Close() error
+}
+
+var (
+	_ Store = (*Database)(nil)
+	_ Store = (*MemDatabase)(nil)
+)
+
+// seek key of the page after the key after
+func pageStart(prefix, after []byte) []byte {
+	if len(after) == 0 {
+		return prefix
+	}
+	// the smallest key greater than after
+	return append(append([]byte{}, after...), 0)
+}
+
+// read a page by scan, which iterates the keys with prefix from start
+func page(scan func(prefix, start, end []byte, fn func(key, value []byte) (bool, error)) error, prefix, after []byte, limit int) ([]Entry, []byte, error) {
+	if limit <= 0 {
+		return nil, nil, nil
+	}
+
+	var (
+		entries []Entry
+		more    bool
+	)
+	err := scan(prefix, pageStart(prefix, after), nil, func(key, value []byte) (bool, error) {
+		if len(entries) == limit {
+			more = true
+			return false, nil
+		}
+		entries = append(entries, Entry{Key: key, Value: value})
+		return true, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !more {
+		return entries, nil, nil
+	}
+	return entries, entries[len(entries)-1].Key, nil
+}
@@ -0,0 +1,236 @@
+package kv
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// run a test against the badger and the mem db
+func eachStore(t *testing.T, test func(t *testing.T, s Store)) {
+	t.Run("badger", func(t *testing.T) {
+		db, err := NewDatabase(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		test(t, db)
+	})
+	t.Run("mem", func(t *testing.T) {
+		test(t, NewMemDatabase())
+	})
+}
+
+func putKeys(t *testing.T, s Store, keys ...string) {
+	for _, k := range keys {
+		if err := s.Put([]byte(k), []byte("v"+k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func collect(t *testing.T, iter func(fn func(key, value []byte) (bool, error)) error) []string {
+	var res []string
+	err := iter(func(key, value []byte) (bool, error) {
+		if string(value) != "v"+string(key) {
+			return false, fmt.Errorf("unexpected value %s of %s", value, key)
+		}
+		res = append(res, string(key))
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestIterate(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		putKeys(t, s, "b/3", "a/1", "b/1", "b/2", "c/1", "b/10")
+
+		got := collect(t, func(fn func(key, value []byte) (bool, error)) error {
+			return s.Iterate([]byte("b/"), fn)
+		})
+		if fmt.Sprint(got) != "[b/1 b/10 b/2 b/3]" {
+			t.Fatalf("unexpected prefix keys %v", got)
+		}
+
+		got = collect(t, func(fn func(key, value []byte) (bool, error)) error {
+			return s.IterateRange([]byte("a/1"), []byte("b/2"), fn)
+		})
+		if fmt.Sprint(got) != "[a/1 b/1 b/10]" {
+			t.Fatalf("unexpected range keys %v", got)
+		}
+
+		got = collect(t, func(fn func(key, value []byte) (bool, error)) error {
+			return s.IterateRange([]byte("b/3"), nil, fn)
+		})
+		if fmt.Sprint(got) != "[b/3 c/1]" {
+			t.Fatalf("unexpected unbounded range keys %v", got)
+		}
+	})
+}
+
+func TestPage(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		putKeys(t, s, "p/1", "p/2", "p/3", "p/4", "p/5", "q/1")
+
+		var (
+			pages [][]string
+			after []byte
+		)
+		for {
+			entries, next, err := s.Page([]byte("p/"), after, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var keys []string
+			for _, e := range entries {
+				keys = append(keys, string(e.Key))
+			}
+			pages = append(pages, keys)
+			if next == nil {
+				break
+			}
+			after = next
+		}
+		if fmt.Sprint(pages) != "[[p/1 p/2] [p/3 p/4] [p/5]]" {
+			t.Fatalf("unexpected pages %v", pages)
+		}
+
+		// a full last page has no next
+		entries, next, err := s.Page([]byte("p/"), []byte("p/3"), 2)
+		if err != nil || len(entries) != 2 || next != nil {
+			t.Fatalf("unexpected last page %d %q %v", len(entries), next, err)
+		}
+	})
+}
+
+func TestTTL(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		if err := s.PutWithTTL([]byte("live"), []byte("v"), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.PutWithTTL([]byte("dead"), []byte("v"), -time.Hour); err != nil {
+			t.Fatal(err)
+		}
+
+		if has, _ := s.Has([]byte("live")); !has {
+			t.Fatal("live key should be read")
+		}
+		if _, err := s.Get([]byte("dead")); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected not found of expired key, got %v", err)
+		}
+		keys := 0
+		s.Iterate(nil, func(key, value []byte) (bool, error) {
+			keys++
+			return true, nil
+		})
+		if keys != 1 {
+			t.Fatalf("expired key should not be iterated, got %d keys", keys)
+		}
+	})
+
+	// expired by the clock
+	m := NewMemDatabase()
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	m.PutWithTTL([]byte("k"), []byte("v"), time.Minute)
+	now = now.Add(time.Minute)
+	if has, _ := m.Has([]byte("k")); has {
+		t.Fatal("key should expire after ttl")
+	}
+}
+
+func TestTxn(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		putKeys(t, s, "n/1", "n/2")
+
+		// reads see the writes of the txn
+		err := s.Txn(func(txn Txn) error {
+			if err := txn.Delete([]byte("n/1")); err != nil {
+				return err
+			}
+			if err := txn.Put([]byte("n/3"), []byte("vn/3")); err != nil {
+				return err
+			}
+			if has, _ := txn.Has([]byte("n/1")); has {
+				return errors.New("deleted key is read")
+			}
+			var keys []string
+			err := txn.Iterate([]byte("n/"), func(key, _ []byte) (bool, error) {
+				keys = append(keys, string(key))
+				return true, nil
+			})
+			if fmt.Sprint(keys) != "[n/2 n/3]" {
+				return fmt.Errorf("unexpected keys in txn %v", keys)
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// writes are dropped if the txn fails
+		fail := errors.New("fail")
+		err = s.Txn(func(txn Txn) error {
+			txn.Put([]byte("n/4"), []byte("vn/4"))
+			txn.Delete([]byte("n/2"))
+			return fail
+		})
+		if !errors.Is(err, fail) {
+			t.Fatalf("expected the error of fn, got %v", err)
+		}
+
+		got := collect(t, func(fn func(key, value []byte) (bool, error)) error {
+			return s.Iterate([]byte("n/"), fn)
+		})
+		if fmt.Sprint(got) != "[n/2 n/3]" {
+			t.Fatalf("unexpected keys %v", got)
+		}
+	})
+}
+
+type record struct {
+	Name  string
+	Count int
+}
+
+func TestCodec(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		for name, c := range map[string]Codec{"json": JSON, "gob": Gob} {
+			want := record{Name: "grid", Count: 3}
+			if err := PutAs(s, c, []byte(name), want); err != nil {
+				t.Fatal(err)
+			}
+			got, err := GetAs[record](s, c, []byte(name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Fatalf("expected %+v, got %+v", want, got)
+			}
+		}
+
+		if _, err := GetAs[record](s, JSON, []byte("none")); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected not found, got %v", err)
+		}
+
+		// in a txn
+		err := s.Txn(func(txn Txn) error {
+			r, err := GetAs[record](txn, JSON, []byte("json"))
+			if err != nil {
+				return err
+			}
+			r.Count++
+			return PutAs(txn, JSON, []byte("json"), r)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r, _ := GetAs[record](s, JSON, []byte("json")); r.Count != 4 {
+			t.Fatalf("unexpected count %d", r.Count)
+		}
+	})
+}
@@ -0,0 +1,269 @@
+package kv
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memItem struct {
+	value []byte
+	// zero if it never expires
+	expire time.Time
+}
+
+// MemDatabase is a Store in memory, it's used by tests in place of badger
+type MemDatabase struct {
+	lk    sync.RWMutex
+	items map[string]memItem
+	// clock of ttl
+	now func() time.Time
+}
+
+func NewMemDatabase() *MemDatabase {
+	return &MemDatabase{
+		items: make(map[string]memItem),
+		now:   time.Now,
+	}
+}
+
+func (m *MemDatabase) Close() error {
+	return nil
+}
+
+func (m *MemDatabase) alive(it memItem) bool {
+	return it.expire.IsZero() || m.now().Before(it.expire)
+}
+
+func (m *MemDatabase) expireAt(ttl time.Duration) time.Time {
+	return m.now().Add(ttl)
+}
+
+// value of key, the lock is held by the caller
+func (m *MemDatabase) get(key []byte) ([]byte, bool) {
+	it, ok := m.items[string(key)]
+	if !ok || !m.alive(it) {
+		return nil, false
+	}
+	return it.value, true
+}
+
+func (m *MemDatabase) Get(key []byte) ([]byte, error) {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+
+	val, ok := m.get(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte{}, val...), nil
+}
+
+func (m *MemDatabase) Has(key []byte) (bool, error) {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+
+	_, ok := m.get(key)
+	return ok, nil
+}
+
+func (m *MemDatabase) Put(key []byte, value []byte) error {
+	return m.MultiPut([][]byte{key}, [][]byte{value})
+}
+
+func (m *MemDatabase) PutWithTTL(key []byte, value []byte, ttl time.Duration) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	m.items[string(key)] = memItem{value: append([]byte{}, value...), expire: m.expireAt(ttl)}
+	return nil
+}
+
+func (m *MemDatabase) Delete(key []byte) error {
+	return m.MultiDelete([][]byte{key})
+}
+
+func (m *MemDatabase) MultiPut(keys [][]byte, values [][]byte) error {
+	return m.Batch(keys, values, nil)
+}
+
+func (m *MemDatabase) MultiDelete(keys [][]byte) error {
+	return m.Batch(nil, nil, keys)
+}
+
+// put keys and delete delKeys at once
+func (m *MemDatabase) Batch(keys [][]byte, values [][]byte, delKeys [][]byte) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	for _, k := range delKeys {
+		delete(m.items, string(k))
+	}
+	for i := 0; i < len(keys); i++ {
+		m.items[string(keys[i])] = memItem{value: append([]byte{}, values[i]...)}
+	}
+	return nil
+}
+
+func (m *MemDatabase) Update(key []byte, updateFunc func(value []byte) ([]byte, error)) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	val, ok := m.get(key)
+	if !ok {
+		return ErrNotFound
+	}
+	newValue, err := updateFunc(append([]byte{}, val...))
+	if err != nil {
+		return err
+	}
+	m.items[string(key)] = memItem{value: append([]byte{}, newValue...)}
+	return nil
+}
+
+// iterate the keys with prefix in order, stop when fn returns false
+func (m *MemDatabase) Iterate(prefix []byte, fn func(key, value []byte) (bool, error)) error {
+	return m.scan(prefix, prefix, nil, fn)
+}
+
+// iterate the keys in [start, end) in order, end is unbounded if it's nil
+func (m *MemDatabase) IterateRange(start, end []byte, fn func(key, value []byte) (bool, error)) error {
+	return m.scan(nil, start, end, fn)
+}
+
+// at most limit entries with prefix after the key after, next is nil on the last page
+func (m *MemDatabase) Page(prefix, after []byte, limit int) ([]Entry, []byte, error) {
+	return page(m.scan, prefix, after, limit)
+}
+
+// the entries are copied under the lock, fn is called without it like in badger,
+// so it may access the db
+func (m *MemDatabase) scan(prefix, start, end []byte, fn func(key, value []byte) (bool, error)) error {
+	m.lk.RLock()
+	entries := m.entries(nil, prefix, start, end)
+	m.lk.RUnlock()
+
+	for _, e := range entries {
+		next, err := fn(e.Key, e.Value)
+		if err != nil {
+			return err
+		}
+		if !next {
+			return nil
+		}
+	}
+	return nil
+}
+
+// live entries with prefix in [start, end) in order, the writes of a txn are over the items.
+// The lock is held by the caller.
+func (m *MemDatabase) entries(writes map[string]*memItem, prefix, start, end []byte) []Entry {
+	in := func(k string) bool {
+		return strings.HasPrefix(k, string(prefix)) && k >= string(start) && (end == nil || k < string(end))
+	}
+
+	var keys []string
+	for k, it := range m.items {
+		if _, ok := writes[k]; ok {
+			continue
+		}
+		if in(k) && m.alive(it) {
+			keys = append(keys, k)
+		}
+	}
+	for k, it := range writes {
+		if it != nil && in(k) && m.alive(*it) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	res := make([]Entry, 0, len(keys))
+	for _, k := range keys {
+		it, ok := writes[k]
+		if !ok {
+			v := m.items[k]
+			it = &v
+		}
+		res = append(res, Entry{Key: []byte(k), Value: append([]byte{}, it.value...)})
+	}
+	return res
+}
+
+// run fn holding the db, its writes are applied when it returns nil
+func (m *MemDatabase) Txn(fn func(txn Txn) error) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	t := &memTxn{m: m, writes: make(map[string]*memItem)}
+	if err := fn(t); err != nil {
+		return err
+	}
+
+	for k, it := range t.writes {
+		if it == nil {
+			delete(m.items, k)
+			continue
+		}
+		m.items[k] = *it
+	}
+	return nil
+}
+
+// txn of the mem db, a nil item in writes is a delete
+type memTxn struct {
+	m      *MemDatabase
+	writes map[string]*memItem
+}
+
+func (t *memTxn) get(key []byte) ([]byte, bool) {
+	if it, ok := t.writes[string(key)]; ok {
+		if it == nil || !t.m.alive(*it) {
+			return nil, false
+		}
+		return it.value, true
+	}
+	return t.m.get(key)
+}
+
+func (t *memTxn) Get(key []byte) ([]byte, error) {
+	val, ok := t.get(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte{}, val...), nil
+}
+
+func (t *memTxn) Has(key []byte) (bool, error) {
+	_, ok := t.get(key)
+	return ok, nil
+}
+
+func (t *memTxn) Put(key, value []byte) error {
+	t.writes[string(key)] = &memItem{value: append([]byte{}, value...)}
+	return nil
+}
+
+func (t *memTxn) PutWithTTL(key, value []byte, ttl time.Duration) error {
+	t.writes[string(key)] = &memItem{value: append([]byte{}, value...), expire: t.m.expireAt(ttl)}
+	return nil
+}
+
+func (t *memTxn) Delete(key []byte) error {
+	t.writes[string(key)] = nil
+	return nil
+}
+
+func (t *memTxn) Iterate(prefix []byte, fn func(key, value []byte) (bool, error)) error {
+	for _, e := range t.m.entries(t.writes, prefix, prefix, nil) {
+		next, err := fn(e.Key, e.Value)
+		if err != nil {
+			return err
+		}
+		if !next {
+			return nil
+		}
+	}
+	return nil
+}
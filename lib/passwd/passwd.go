@@ -0,0 +1,105 @@
+package passwd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+var (
+	ErrNoPassword = errors.New("no password is given by a file, an env or a terminal")
+	ErrMismatch   = errors.New("the passwords do not match")
+)
+
+// for testing
+var (
+	stdin        = int(os.Stdin.Fd())
+	isTerminal   = term.IsTerminal
+	readPassword = term.ReadPassword
+)
+
+// where to read a password, the first one given of File, Env and a prompt on the terminal is used
+type Source struct {
+	// path of a file, the password is its first line
+	File string
+	// name of an env holding the password, it's unset after reading
+	Env string
+	// shown on the terminal
+	Prompt string
+	// ask twice on the terminal, for a new password
+	Confirm bool
+}
+
+// read the password, it should be zeroed by the caller after use
+func (s Source) Read() ([]byte, error) {
+	if s.File != "" {
+		return readFile(s.File)
+	}
+
+	if s.Env != "" {
+		if v, ok := os.LookupEnv(s.Env); ok && v != "" {
+			// not inherited by the children
+			os.Unsetenv(s.Env)
+			return []byte(v), nil
+		}
+	}
+
+	if !isTerminal(stdin) {
+		return nil, ErrNoPassword
+	}
+	pw, err := prompt(s.Prompt)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Confirm {
+		return pw, nil
+	}
+
+	again, err := prompt("Repeat " + s.Prompt)
+	if err != nil {
+		Zero(pw)
+		return nil, err
+	}
+	defer Zero(again)
+	if !bytes.Equal(pw, again) {
+		Zero(pw)
+		return nil, ErrMismatch
+	}
+	return pw, nil
+}
+
+func prompt(p string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, p+": ")
+	pw, err := readPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("read password failed: %s", err.Error())
+	}
+	return pw, nil
+}
+
+func readFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read password file failed: %s", err.Error())
+	}
+	defer Zero(data)
+
+	line := data
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	line = bytes.TrimSuffix(line, []byte("\r"))
+
+	return append([]byte(nil), line...), nil
+}
+
+// overwrite b with zeros
+func Zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,80 @@
+package passwd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// answer the prompts on a fake terminal
+func fakeTerminal(t *testing.T, answers ...string) {
+	isTerminal = func(int) bool { return true }
+	readPassword = func(int) ([]byte, error) {
+		if len(answers) == 0 {
+			t.Fatal("unexpected prompt")
+		}
+		a := answers[0]
+		answers = answers[1:]
+		return []byte(a), nil
+	}
+	t.Cleanup(func() {
+		if len(answers) != 0 {
+			t.Errorf("%d prompts are not asked", len(answers))
+		}
+	})
+}
+
+func TestRead(t *testing.T) {
+	defer func(i func(int) bool, r func(int) ([]byte, error)) {
+		isTerminal, readPassword = i, r
+	}(isTerminal, readPassword)
+
+	// the first line of file
+	path := filepath.Join(t.TempDir(), "pw")
+	if err := os.WriteFile(path, []byte("secret\r\nignored\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_PASSWD", "from env")
+	pw, err := Source{File: path, Env: "TEST_PASSWD"}.Read()
+	if err != nil || string(pw) != "secret" {
+		t.Fatalf("unexpected password %q, error %v", pw, err)
+	}
+
+	// env is unset after reading
+	pw, err = Source{Env: "TEST_PASSWD"}.Read()
+	if err != nil || string(pw) != "from env" {
+		t.Fatalf("unexpected password %q, error %v", pw, err)
+	}
+	if _, ok := os.LookupEnv("TEST_PASSWD"); ok {
+		t.Fatal("env is not unset")
+	}
+
+	// no terminal
+	isTerminal = func(int) bool { return false }
+	if _, err := (Source{Env: "TEST_PASSWD"}).Read(); !errors.Is(err, ErrNoPassword) {
+		t.Fatalf("expected no password, got %v", err)
+	}
+
+	fakeTerminal(t, "typed")
+	pw, err = Source{Env: "TEST_PASSWD", Prompt: "Password"}.Read()
+	if err != nil || string(pw) != "typed" {
+		t.Fatalf("unexpected password %q, error %v", pw, err)
+	}
+
+	fakeTerminal(t, "new", "new")
+	pw, err = Source{Prompt: "New password", Confirm: true}.Read()
+	if err != nil || string(pw) != "new" {
+		t.Fatalf("unexpected password %q, error %v", pw, err)
+	}
+
+	fakeTerminal(t, "new", "typo")
+	if _, err := (Source{Prompt: "New password", Confirm: true}).Read(); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("expected mismatch, got %v", err)
+	}
+
+	Zero(pw)
+	if string(pw) != "\x00\x00\x00" {
+		t.Fatalf("password is not zeroed: %q", pw)
+	}
+}
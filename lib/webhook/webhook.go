@@ -0,0 +1,69 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// header of the hmac-sha256 of the body in hex, set if the secret is given
+	SigHeader = "X-Webhook-Sig"
+
+	retry   = 3
+	timeout = 10 * time.Second
+)
+
+var hc = &http.Client{Timeout: timeout}
+
+// post v in json to url, and retry a few times if the receiver is not ok
+func Send(url string, secret string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode webhook body failed: %s", err.Error())
+	}
+
+	for i := 0; i < retry; i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(i) * time.Second)
+		}
+
+		err = post(url, secret, body)
+		if err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+func post(url string, secret string, body []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set(SigHeader, hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook responsed status %d", res.StatusCode)
+	}
+
+	return nil
+}
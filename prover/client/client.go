@@ -5,58 +5,203 @@ import (
 	"context"
 	"encoding/hex"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
+	"math/rand"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gridprotocol/computing-api/prover/types"
 
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"golang.org/x/xerrors"
 )
 
+// bodies larger than it are not read
+const maxBody = 1 << 20
+
+type Config struct {
+	// timeout of each attempt
+	Timeout time.Duration
+	// attempts after the first one on the network errors and the 5xx or 429 statuses
+	Retries int
+	// the n-th retry waits a random time in [0, Backoff*2^n), capped by MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Timeout:    10 * time.Second,
+		Retries:    2,
+		Backoff:    200 * time.Millisecond,
+		MaxBackoff: 2 * time.Second,
+	}
+}
+
+// fill the zero fields with the default, a negative Retries means no retry
+func (c Config) withDefault() Config {
+	d := DefaultConfig()
+	if c.Timeout == 0 {
+		c.Timeout = d.Timeout
+	}
+	if c.Retries == 0 {
+		c.Retries = d.Retries
+	}
+	if c.Retries < 0 {
+		c.Retries = 0
+	}
+	if c.Backoff == 0 {
+		c.Backoff = d.Backoff
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = d.MaxBackoff
+	}
+	return c
+}
+
+// an unexpected status replied by validator
+type StatusError struct {
+	Code int
+	Msg  string
+}
+
+func (e *StatusError) Error() string {
+	if e.Msg == "" {
+		return "status [" + strconv.Itoa(e.Code) + "]"
+	}
+	return "status [" + strconv.Itoa(e.Code) + "] " + e.Msg
+}
+
+// the server errors and throttling may pass in a retry
+func (e *StatusError) temporary() bool {
+	return e.Code >= 500 || e.Code == http.StatusTooManyRequests
+}
+
 type Client struct {
 	baseUrl string
+	cfg     Config
+	hc      *http.Client
 }
 
 // client used to communicate with validator
 func NewClient(url string) *Client {
+	return NewClientWithConfig(url, DefaultConfig())
+}
+
+// client used to communicate with validator, with the timeouts and retries of cfg
+func NewClientWithConfig(url string, cfg Config) *Client {
+	cfg = cfg.withDefault()
 	return &Client{
 		baseUrl: url,
+		cfg:     cfg,
+		hc:      &http.Client{Timeout: cfg.Timeout},
 	}
 }
 
-type SettingInfo struct {
-	Last            int64
-	PrepareInterval int64
-	ProverInterval  int64
-	WaitInterval    int64
+// send a request and decode the json reply into out if it's not nil, the temporary failures are retried
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	var err error
+	for i := 0; i <= c.cfg.Retries; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return xerrors.Errorf("%w, the last error: %s", ctx.Err(), err)
+			case <-time.After(c.backoff(i)):
+			}
+		}
+
+		err = c.attempt(ctx, method, path, body, out)
+		if err == nil || !retryable(ctx, err) {
+			return err
+		}
+	}
+	return err
 }
 
-func (c *Client) GetV1SettingInfo(ctx context.Context) (SettingInfo, error) {
-	var url = c.baseUrl + "/v1/rnd"
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+// wait of the n-th retry, a full jitter of the exponential backoff
+func (c *Client) backoff(n int) time.Duration {
+	d := c.cfg.Backoff << (n - 1)
+	if d <= 0 || d > c.cfg.MaxBackoff {
+		d = c.cfg.MaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.temporary()
+	}
+	// the network errors, or a broken body
+	return true
+}
+
+func (c *Client) attempt(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseUrl+path, rd)
 	if err != nil {
-		return SettingInfo{}, err
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
 	}
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := c.hc.Do(req)
 	if err != nil {
-		return SettingInfo{}, err
+		return err
+	}
+	// drain the rest so that the connection is reused
+	defer func() {
+		io.Copy(io.Discard, io.LimitReader(res.Body, maxBody))
+		res.Body.Close()
+	}()
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxBody))
+	if err != nil {
+		return err
 	}
 
 	if res.StatusCode != http.StatusOK {
-		return SettingInfo{}, xerrors.Errorf("Failed to get rnd, status [%d]", res.StatusCode)
+		se := &StatusError{Code: res.StatusCode}
+		var msg struct {
+			Msg string `json:"msg"`
+		}
+		if json.Unmarshal(data, &msg) == nil {
+			se.Msg = msg.Msg
+		}
+		return se
 	}
-	body, err := io.ReadAll(res.Body)
-	defer res.Body.Close()
-	if err != nil {
-		return SettingInfo{}, err
+
+	if out == nil {
+		return nil
 	}
+	return json.Unmarshal(data, out)
+}
+
+// cycle settings of the validator, the intervals are in second
+type SettingInfo struct {
+	// start of a cycle in unix second, the cycles are aligned to it
+	Last            int64
+	PrepareInterval int64
+	ProverInterval  int64
+	WaitInterval    int64
+	// leading zero bits of the proof hash
+	Difficulty int
+}
 
+// get the cycle settings and difficulty from validator
+func (c *Client) GetV1SettingInfo(ctx context.Context) (SettingInfo, error) {
 	var settingRes SettingInfo
-	err = json.Unmarshal(body, &settingRes)
-	if err != nil {
-		return SettingInfo{}, err
+	if err := c.do(ctx, "GET", "/v1/info", nil, &settingRes); err != nil {
+		return SettingInfo{}, xerrors.Errorf("Failed to get setting info: %w", err)
 	}
 
 	return settingRes, nil
@@ -67,30 +212,9 @@ type rndResult struct {
 }
 
 func (c *Client) GetRND(ctx context.Context) ([32]byte, error) {
-	var url = c.baseUrl + "/v1/rnd"
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return [32]byte{}, err
-	}
-
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return [32]byte{}, err
-	}
-
-	if res.StatusCode != http.StatusOK {
-		return [32]byte{}, xerrors.Errorf("Failed to get rnd, status [%d]", res.StatusCode)
-	}
-	body, err := io.ReadAll(res.Body)
-	defer res.Body.Close()
-	if err != nil {
-		return [32]byte{}, err
-	}
-
 	var rndRes rndResult
-	err = json.Unmarshal(body, &rndRes)
-	if err != nil {
-		return [32]byte{}, err
+	if err := c.do(ctx, "GET", "/v1/rnd", nil, &rndRes); err != nil {
+		return [32]byte{}, xerrors.Errorf("Failed to get rnd: %w", err)
 	}
 
 	rndBytes, err := hex.DecodeString(rndRes.Rnd)
@@ -103,31 +227,28 @@ func (c *Client) GetRND(ctx context.Context) ([32]byte, error) {
 	return rnd, nil
 }
 
-// post proof to validator
-func (c *Client) SubmitProof(ctx context.Context, proof types.Proof) error {
-	var url = c.baseUrl + "/v1/proof"
-
+// post a signed proof to validator, a conflict means the node is proved in this cycle, by a former
+// attempt whose reply is lost, so it's accepted
+func (c *Client) SubmitProof(ctx context.Context, proof types.SignedProof) error {
 	payload := make(map[string]interface{})
 	payload["address"] = proof.Address
 	payload["id"] = proof.ID
 	payload["nonce"] = proof.Nonce
+	payload["rnd"] = hex.EncodeToString(proof.Rnd[:])
+	payload["ts"] = proof.Ts
+	payload["sig"] = hexutil.Encode(proof.Sig)
 	b, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(b))
-	if err != nil {
-		return err
+	err = c.do(ctx, "POST", "/v1/proof", b, nil)
+	var se *StatusError
+	if errors.As(err, &se) && se.Code == http.StatusConflict {
+		return nil
 	}
-
-	res, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return err
-	}
-
-	if res.StatusCode != http.StatusOK {
-		return xerrors.Errorf("Failed to submit proof, status [%d]", res.StatusCode)
+		return xerrors.Errorf("Failed to submit proof: %w", err)
 	}
 
 	return nil
@@ -135,36 +256,9 @@ func (c *Client) SubmitProof(ctx context.Context, proof types.Proof) error {
 
 // get the order count of a provider from validator
 func (c *Client) GetV1OrderCount(ctx context.Context, provider string) (int64, error) {
-	//var url = c.baseUrl + "/provider/:address/count"
-	var url = c.baseUrl + "/v1/provider/" + provider + "/count"
-
-	fmt.Println("url: ", url)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return 0, err
-	}
-
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return 0, err
-	}
-
-	if res.StatusCode != http.StatusOK {
-		return 0, xerrors.Errorf("Failed to get order count, status [%d]", res.StatusCode)
-	}
-
-	// read response body
-	body, err := io.ReadAll(res.Body)
-	defer res.Body.Close()
-	if err != nil {
-		return 0, err
-	}
-
 	var cnt int64
-	err = json.Unmarshal(body, &cnt)
-	if err != nil {
-		return 0, err
+	if err := c.do(ctx, "GET", "/v1/provider/"+provider+"/count", nil, &cnt); err != nil {
+		return 0, xerrors.Errorf("Failed to get order count: %w", err)
 	}
 
 	return cnt, nil
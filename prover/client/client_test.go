@@ -0,0 +1,168 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gridprotocol/computing-api/prover/types"
+)
+
+var fast = Config{Timeout: time.Second, Retries: 3, Backoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+func TestRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// fail twice before the reply
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("3"))
+	}))
+	defer srv.Close()
+
+	c := NewClientWithConfig(srv.URL, fast)
+	cnt, err := c.GetV1OrderCount(context.Background(), "0x01")
+	if err != nil || cnt != 3 || atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("unexpected count %d, error %v in %d calls", cnt, err, calls)
+	}
+
+	// no more than the retries
+	atomic.StoreInt32(&calls, -10)
+	_, err = c.GetV1OrderCount(context.Background(), "0x01")
+	var se *StatusError
+	if !errors.As(err, &se) || se.Code != http.StatusServiceUnavailable || atomic.LoadInt32(&calls) != -6 {
+		t.Fatalf("unexpected error %v in %d calls", err, calls+10)
+	}
+}
+
+func TestNoRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"msg":"[Fail] proof is out of the prove window"}`))
+	}))
+	defer srv.Close()
+
+	c := NewClientWithConfig(srv.URL, fast)
+	err := c.SubmitProof(context.Background(), types.SignedProof{Proof: types.Proof{NodeID: types.NodeID{Address: "0x01", ID: 1}}})
+	if err == nil || !strings.Contains(err.Error(), "out of the prove window") || calls != 1 {
+		t.Fatalf("unexpected error %v in %d calls", err, calls)
+	}
+}
+
+// a proof accepted by the former attempt, whose reply is lost
+func TestSubmitConflict(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer srv.Close()
+
+	c := NewClientWithConfig(srv.URL, fast)
+	if err := c.SubmitProof(context.Background(), types.SignedProof{Proof: types.Proof{NodeID: types.NodeID{Address: "0x01", ID: 1}}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	// each attempt times out
+	c := NewClientWithConfig(srv.URL, Config{Timeout: 50 * time.Millisecond, Retries: 1, Backoff: time.Millisecond})
+	start := time.Now()
+	if _, err := c.GetRND(context.Background()); err == nil {
+		t.Fatal("expected timeout")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("timeout takes %s", d)
+	}
+
+	// retries stop when ctx is done
+	c = NewClientWithConfig(srv.URL, Config{Timeout: time.Minute, Retries: 5, Backoff: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if _, err := c.GetRND(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("cancel takes %s", d)
+	}
+}
+
+// the bodies of all replies are closed, the requests can't go on with a single connection otherwise
+func TestBodyClosed(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1)%2 == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(strings.Repeat("x", 64<<10)))
+			return
+		}
+		w.Write([]byte(`{"Rnd":"00"}`))
+	}))
+	defer srv.Close()
+
+	c := NewClientWithConfig(srv.URL, Config{Timeout: time.Second, Retries: -1})
+	c.hc.Transport = &http.Transport{MaxConnsPerHost: 1}
+
+	for i := 0; i < 10; i++ {
+		_, err := c.GetRND(context.Background())
+		var se *StatusError
+		if i%2 == 1 && (!errors.As(err, &se) || se.Code != http.StatusNotFound) {
+			t.Fatalf("expected not found, got %v", err)
+		}
+		if i%2 == 0 && err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// a client is shared by the nodes proved concurrently
+func TestConcurrent(t *testing.T) {
+	// the first request of each node fails
+	var seen sync.Map
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := seen.LoadOrStore(r.URL.Path, true); !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("1"))
+	}))
+	defer srv.Close()
+
+	c := NewClientWithConfig(srv.URL, fast)
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(id int64) {
+			defer wg.Done()
+			if cnt, err := c.GetV1OrderCount(context.Background(), fmt.Sprintf("0x%02x", id)); err != nil || cnt != 1 {
+				t.Errorf("unexpected count %d, error %v", cnt, err)
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+}
@@ -0,0 +1,152 @@
+package prover
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// a counter of events
+type Counter struct {
+	v int64
+}
+
+func (c *Counter) Inc() {
+	atomic.AddInt64(&c.v, 1)
+}
+
+func (c *Counter) Value() int64 {
+	return atomic.LoadInt64(&c.v)
+}
+
+// a histogram of the observed values in buckets of upper bounds
+type Histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	// counts[i] is the count of values <= bounds[i] and > bounds[i-1], the last one is of the values above all
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func NewHistogram(bounds ...float64) *Histogram {
+	bounds = append([]float64(nil), bounds...)
+	sort.Float64s(bounds)
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// the buckets are cumulative like prometheus, the count of values <= Bounds[i] is Counts[i]
+type HistogramSnapshot struct {
+	Bounds []float64
+	Counts []uint64
+	Sum    float64
+	Count  uint64
+}
+
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := HistogramSnapshot{
+		Bounds: append([]float64(nil), h.bounds...),
+		Counts: make([]uint64, len(h.bounds)),
+		Sum:    h.sum,
+		Count:  h.count,
+	}
+	var acc uint64
+	for i := range h.bounds {
+		acc += h.counts[i]
+		s.Counts[i] = acc
+	}
+	return s
+}
+
+// metrics of the prover in this run
+type Metrics struct {
+	// cycles with any node proved
+	Cycles Counter
+	// proofs accepted and failed, and nodes skipped without orders
+	Success Counter
+	Fail    Counter
+	Skip    Counter
+	// alerts raised on consecutive failed cycles
+	Alerts Counter
+
+	// seconds to find a nonce and to submit it
+	Compute *Histogram
+	Submit  *Histogram
+}
+
+func newMetrics() *Metrics {
+	return &Metrics{
+		Compute: NewHistogram(0.1, 0.5, 1, 2, 5, 10, 20, 60),
+		Submit:  NewHistogram(0.01, 0.05, 0.1, 0.5, 1, 2, 5),
+	}
+}
+
+// write the metrics in the prometheus text format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	printf := func(format string, a ...interface{}) error {
+		c, err := fmt.Fprintf(w, format, a...)
+		n += int64(c)
+		return err
+	}
+
+	counters := []struct {
+		name string
+		help string
+		c    *Counter
+	}{
+		{"grid_prover_cycles_total", "cycles with any node proved", &m.Cycles},
+		{"grid_prover_proofs_success_total", "proofs accepted by the validator", &m.Success},
+		{"grid_prover_proofs_fail_total", "proofs failed", &m.Fail},
+		{"grid_prover_nodes_skipped_total", "nodes skipped without active orders", &m.Skip},
+		{"grid_prover_alerts_total", "alerts raised on consecutive failed cycles", &m.Alerts},
+	}
+	for _, c := range counters {
+		if err := printf("# HELP %s %s\n# TYPE %s counter\n%s %d\n", c.name, c.help, c.name, c.name, c.c.Value()); err != nil {
+			return n, err
+		}
+	}
+
+	histograms := []struct {
+		name string
+		help string
+		h    *Histogram
+	}{
+		{"grid_prover_compute_seconds", "time to find a nonce", m.Compute},
+		{"grid_prover_submit_seconds", "latency to submit a proof", m.Submit},
+	}
+	for _, h := range histograms {
+		s := h.h.Snapshot()
+		if err := printf("# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name); err != nil {
+			return n, err
+		}
+		for i, b := range s.Bounds {
+			if err := printf("%s_bucket{le=\"%g\"} %d\n", h.name, b, s.Counts[i]); err != nil {
+				return n, err
+			}
+		}
+		if err := printf("%s_bucket{le=\"+Inf\"} %d\n%s_sum %g\n%s_count %d\n", h.name, s.Count, h.name, s.Sum, h.name, s.Count); err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,299 @@
+package prover
+
+import (
+	"encoding/binary"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gridprotocol/computing-api/lib/kv"
+)
+
+// result of a node in a cycle, kept in db
+type CycleRecord struct {
+	Node int64 `json:"node"`
+	// start of the cycle in unix second
+	Cycle int64  `json:"cycle"`
+	Rnd   string `json:"rnd,omitempty"`
+	Nonce int64  `json:"nonce"`
+	// milliseconds to find the nonce and to submit it
+	Compute int64  `json:"compute"`
+	Submit  int64  `json:"submit"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	Time    int64  `json:"time"`
+}
+
+// health of the prover in this run
+type Status struct {
+	Address string `json:"address"`
+	// start of the last cycle all the nodes with orders are proved
+	LastSuccess int64 `json:"lastSuccess"`
+	// consecutive cycles proved and failed, one of them is 0
+	Streak     int64  `json:"streak"`
+	FailStreak int64  `json:"failStreak"`
+	LastError  string `json:"lastError,omitempty"`
+	// proofs of the next cycle are accepted in [NextWindowStart, NextWindowEnd] in unix second
+	NextWindowStart int64 `json:"nextWindowStart"`
+	NextWindowEnd   int64 `json:"nextWindowEnd"`
+	Difficulty      int   `json:"difficulty"`
+	// the failed cycles reached the alert threshold
+	Alerting bool                `json:"alerting"`
+	Nodes    map[int64]NodeStats `json:"nodes"`
+}
+
+// raised when the consecutive failed cycles reach the threshold, and resolved at the next proved one
+type Alert struct {
+	Kind     string `json:"kind"`
+	Address  string `json:"address"`
+	Resolved bool   `json:"resolved"`
+	// consecutive failed cycles and the start of the last one
+	Failed int64  `json:"failed"`
+	Cycle  int64  `json:"cycle"`
+	Error  string `json:"error,omitempty"`
+	Time   int64  `json:"time"`
+}
+
+const (
+	alertKind = "prover"
+	// alerts waiting for delivery, more are dropped
+	alertQueue = 64
+	// Stop waits for the delivery of the queued alerts at most
+	alertDrain = 5 * time.Second
+)
+
+// keep the records of the cycles in db for keep
+func (p *GRIDProver) SetDB(db kv.Store, keep time.Duration) {
+	p.db = db
+	if keep > 0 {
+		p.keep = keep
+	}
+}
+
+// raise an alert by fn after the consecutive failed cycles, disabled if after is not positive.
+// The alerts are delivered to fn one by one in the order raised.
+func (p *GRIDProver) SetAlert(after int, fn func(Alert)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.alertAfter = after
+	p.onAlert = fn
+	if fn != nil && p.alerts == nil {
+		p.alerts = make(chan Alert, alertQueue)
+		p.alertsDone = make(chan struct{})
+		go p.deliverAlerts()
+	}
+}
+
+func (p *GRIDProver) Metrics() *Metrics {
+	return p.metrics
+}
+
+func (p *GRIDProver) Status() Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := p.status
+	s.Nodes = make(map[int64]NodeStats, len(p.stats))
+	for id, ns := range p.stats {
+		s.Nodes[id] = *ns
+	}
+	return s
+}
+
+// the prove window of the cycle waited
+func (p *GRIDProver) setNext(start int64) {
+	prepare := int64(p.prepareInterval.Seconds())
+	prove := int64(p.proverInterval.Seconds())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.NextWindowStart = start + prepare
+	p.status.NextWindowEnd = start + prepare + prove
+	p.status.Difficulty = p.diffcult
+}
+
+// track the result of the cycle, the cycles without any node to prove are not counted
+func (p *GRIDProver) finishCycle(start int64, err error) {
+	if err == errSkip {
+		return
+	}
+	p.metrics.Cycles.Inc()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := &p.status
+	if err == nil {
+		if s.Alerting {
+			s.Alerting = false
+			p.alert(Alert{Resolved: true, Failed: s.FailStreak, Cycle: start})
+		}
+		s.LastSuccess = start
+		s.Streak++
+		s.FailStreak = 0
+		return
+	}
+
+	s.Streak = 0
+	s.FailStreak++
+	s.LastError = err.Error()
+	if p.alertAfter > 0 && s.FailStreak == int64(p.alertAfter) {
+		s.Alerting = true
+		p.metrics.Alerts.Inc()
+		p.alert(Alert{Failed: s.FailStreak, Cycle: start, Error: s.LastError})
+	}
+}
+
+// queue an alert for delivery in background. The lock is held by the caller.
+func (p *GRIDProver) alert(a Alert) {
+	a.Kind = alertKind
+	a.Address = p.address
+	a.Time = p.clock.Now().Unix()
+
+	if a.Resolved {
+		logger.Infof("prover alert resolved at cycle %d", a.Cycle)
+	} else {
+		logger.Errorf("prover alert: %d consecutive cycles failed, the last is %d: %s", a.Failed, a.Cycle, a.Error)
+	}
+
+	if p.alerts == nil {
+		return
+	}
+	select {
+	case p.alerts <- a:
+	default:
+		logger.Warnf("prover alert queue is full, the alert of cycle %d is dropped", a.Cycle)
+	}
+}
+
+// deliver the queued alerts in order until Stop, the ones queued before Stop are delivered
+// and Stop waits for them for alertDrain at most
+func (p *GRIDProver) deliverAlerts() {
+	defer close(p.alertsDone)
+
+	deliver := func(a Alert) {
+		p.mu.Lock()
+		fn := p.onAlert
+		p.mu.Unlock()
+		if fn != nil {
+			fn(a)
+		}
+	}
+
+	for {
+		select {
+		case a := <-p.alerts:
+			deliver(a)
+		case <-p.done:
+			for {
+				select {
+				case a := <-p.alerts:
+					deliver(a)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func cyclePrefix(node int64) []byte {
+	return []byte("prover/cycle/" + strconv.FormatInt(node, 10) + "/")
+}
+
+func cycleKey(node, cycle int64) []byte {
+	return binary.BigEndian.AppendUint64(cyclePrefix(node), uint64(cycle))
+}
+
+// keep the record in db if it's set
+func (p *GRIDProver) keepRecord(r CycleRecord) {
+	if p.db == nil {
+		return
+	}
+	if err := kv.PutAsWithTTL(p.db, kv.JSON, cycleKey(r.Node, r.Cycle), r, p.keep); err != nil {
+		logger.Warn("keep record of cycle failed: ", err)
+	}
+}
+
+// at most limit records of a node in the cycles after the cycle after, in order of cycle,
+// next is the cycle to read the next page after, it's 0 on the last page
+func (p *GRIDProver) Records(node int64, after int64, limit int) ([]CycleRecord, int64, error) {
+	if p.db == nil {
+		return nil, 0, nil
+	}
+
+	var start []byte
+	if after > 0 {
+		start = cycleKey(node, after)
+	}
+	entries, next, err := p.db.Page(cyclePrefix(node), start, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res := make([]CycleRecord, 0, len(entries))
+	for _, e := range entries {
+		var r CycleRecord
+		if err := kv.JSON.Unmarshal(e.Value, &r); err != nil {
+			return nil, 0, err
+		}
+		res = append(res, r)
+	}
+
+	if next == nil {
+		return res, 0, nil
+	}
+	return res, int64(binary.BigEndian.Uint64(next[len(next)-8:])), nil
+}
+
+// register the status, metrics and records of the prover
+func (p *GRIDProver) RegisterRoutes(r gin.IRouter) {
+	g := r.Group("/prover")
+	g.GET("/status", p.handlerStatus)
+	g.GET("/metrics", p.handlerMetrics)
+	g.GET("/node/:id/records", p.handlerRecords)
+}
+
+// status of the prover, it's unavailable when alerting for the health checks
+func (p *GRIDProver) handlerStatus(c *gin.Context) {
+	s := p.Status()
+	if s.Alerting {
+		c.JSON(http.StatusServiceUnavailable, s)
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+// metrics in the prometheus text format
+func (p *GRIDProver) handlerMetrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4")
+	c.Status(http.StatusOK)
+	p.metrics.WriteTo(c.Writer)
+}
+
+// records of a node, ?after=cycle&limit=n
+func (p *GRIDProver) handlerRecords(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] invalid node id"})
+		return
+	}
+	after, err := strconv.ParseInt(c.DefaultQuery("after", "0"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] invalid after"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] limit should be in [1, 1000]"})
+		return
+	}
+
+	records, next, err := p.Records(id, after, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"msg": "[Fail] read records failed: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"records": records, "next": next})
+}
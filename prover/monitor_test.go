@@ -0,0 +1,256 @@
+package prover
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	"github.com/gridprotocol/computing-api/keystore/signer"
+	"github.com/gridprotocol/computing-api/lib/kv"
+	"github.com/gridprotocol/computing-api/prover/validator"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram(1, 0.1, 10)
+	for _, v := range []float64{0.05, 0.1, 0.5, 3, 30} {
+		h.Observe(v)
+	}
+
+	s := h.Snapshot()
+	if s.Count != 5 || s.Sum != 33.65 {
+		t.Fatalf("unexpected count %d and sum %g", s.Count, s.Sum)
+	}
+	// cumulative in the order of bounds
+	want := []uint64{2, 3, 4}
+	for i := range want {
+		if s.Bounds[i] != []float64{0.1, 1, 10}[i] || s.Counts[i] != want[i] {
+			t.Fatalf("unexpected buckets %v %v", s.Bounds, s.Counts)
+		}
+	}
+
+	m := newMetrics()
+	m.Success.Inc()
+	m.Submit.Observe(0.02)
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"grid_prover_proofs_success_total 1\n",
+		"grid_prover_submit_seconds_bucket{le=\"0.05\"} 1\n",
+		"grid_prover_submit_seconds_bucket{le=\"+Inf\"} 1\n",
+		"grid_prover_submit_seconds_count 1\n",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Fatalf("%q is not in metrics:\n%s", line, buf.String())
+		}
+	}
+}
+
+// the cycles are recorded, and alerts are raised and resolved with the validator down and up
+func TestMonitor(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+
+	v := validator.New(validator.Config{
+		PrepareInterval: 2 * time.Second,
+		ProveInterval:   3 * time.Second,
+		WaitInterval:    5 * time.Second,
+		Difficulty:      8,
+		Now:             clock.Now,
+	})
+	// rnd is unavailable when it's down
+	var down atomic.Bool
+	h := v.Handler()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() && r.URL.Path == "/v1/rnd" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	key, _ := crypto.GenerateKey()
+	p, err := NewGRIDProver("local", srv.URL, signer.NewKeySigner(key), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.clock = clock
+	p.SetDB(kv.NewMemDatabase(), 0)
+	alerts := make(chan Alert, 4)
+	p.SetAlert(2, func(a Alert) { alerts <- a })
+	v.SetOrderCount(p.Address(), 1)
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	p.RegisterRoutes(r)
+	status := func() (int, Status) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/prover/status", nil))
+		var s Status
+		if err := json.Unmarshal(w.Body.Bytes(), &s); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, s
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Start(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	stepUntil := func(ok func(Status) bool) Status {
+		for i := 0; i < 100; i++ {
+			clock.next(t)
+			if s := p.Status(); ok(s) {
+				return s
+			}
+		}
+		t.Fatalf("unexpected status %+v", p.Status())
+		return Status{}
+	}
+
+	s := stepUntil(func(s Status) bool { return s.Streak == 1 })
+	if s.LastSuccess != 1000 || s.Nodes[1].Success != 1 || s.Difficulty != 8 {
+		t.Fatalf("unexpected status %+v", s)
+	}
+	if code, s := status(); code != http.StatusOK || s.NextWindowStart != 1012 || s.NextWindowEnd != 1015 {
+		t.Fatalf("unexpected status %d %+v", code, s)
+	}
+
+	down.Store(true)
+	s = stepUntil(func(s Status) bool { return s.Alerting })
+	if s.FailStreak != 2 || s.Streak != 0 || s.LastSuccess != 1000 || !strings.Contains(s.LastError, "rnd") {
+		t.Fatalf("unexpected status %+v", s)
+	}
+	if code, _ := status(); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected unavailable when alerting, got %d", code)
+	}
+	select {
+	case a := <-alerts:
+		if a.Resolved || a.Failed != 2 || a.Cycle != 1020 || a.Address != p.Address() {
+			t.Fatalf("unexpected alert %+v", a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("alert is not raised")
+	}
+
+	down.Store(false)
+	s = stepUntil(func(s Status) bool { return s.Streak == 1 })
+	if s.Alerting || s.LastSuccess != 1030 {
+		t.Fatalf("unexpected status %+v", s)
+	}
+	select {
+	case a := <-alerts:
+		if !a.Resolved || a.Cycle != 1030 {
+			t.Fatalf("unexpected alert %+v", a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("alert is not resolved")
+	}
+
+	// all cycles are kept in order
+	records, next, err := p.Records(1, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != 1010 || len(records) != 2 || !records[0].Success || records[0].Rnd == "" || records[1].Success {
+		t.Fatalf("unexpected records %+v, next %d", records, next)
+	}
+	records, next, err = p.Records(1, next, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != 0 || len(records) != 2 || records[0].Cycle != 1020 || !records[1].Success || records[1].Cycle != 1030 {
+		t.Fatalf("unexpected records %+v, next %d", records, next)
+	}
+
+	m := p.Metrics()
+	if m.Cycles.Value() != 4 || m.Success.Value() != 2 || m.Fail.Value() != 2 || m.Alerts.Value() != 1 || m.Compute.Snapshot().Count != 2 {
+		t.Fatalf("unexpected metrics cycles %d success %d fail %d alerts %d", m.Cycles.Value(), m.Success.Value(), m.Fail.Value(), m.Alerts.Value())
+	}
+}
+
+// the alerts are delivered in the order raised, even with a slow receiver
+func TestAlertOrder(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	p, err := NewGRIDProver("local", "http://localhost:0", signer.NewKeySigner(key), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.clock = &fakeClock{now: time.Unix(1000, 0)}
+	defer p.Stop()
+
+	alerts := make(chan Alert, 8)
+	p.SetAlert(1, func(a Alert) {
+		if !a.Resolved {
+			time.Sleep(10 * time.Millisecond)
+		}
+		alerts <- a
+	})
+
+	fail := errors.New("validator is down")
+	for i, err := range []error{fail, nil, fail, nil} {
+		p.finishCycle(int64(i), err)
+	}
+
+	for i := 0; i < 4; i++ {
+		select {
+		case a := <-alerts:
+			if a.Cycle != int64(i) || a.Resolved != (i%2 == 1) {
+				t.Fatalf("unexpected alert %d: %+v", i, a)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("alert is not delivered")
+		}
+	}
+}
+
+func TestAlertStop(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	p, err := NewGRIDProver("local", "http://localhost:0", signer.NewKeySigner(key), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.clock = &fakeClock{now: time.Unix(1000, 0)}
+
+	var (
+		mu        sync.Mutex
+		delivered []int64
+	)
+	p.SetAlert(1, func(a Alert) {
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		delivered = append(delivered, a.Cycle)
+		mu.Unlock()
+	})
+
+	fail := errors.New("validator is down")
+	for i, err := range []error{fail, nil, fail} {
+		p.finishCycle(int64(i), err)
+	}
+
+	// the queued alerts are delivered when Stop returns
+	p.Stop()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(delivered) != 3 || delivered[0] != 0 || delivered[2] != 2 {
+		t.Fatalf("unexpected alerts delivered before stop returns: %v", delivered)
+	}
+}
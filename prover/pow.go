@@ -1,3 +1,5 @@
+//go:build !purego
+
 package prover
 
 /*
@@ -7,17 +9,34 @@ int generatePOW(char *rand, int len, int diffcult, long long *index);
 import "C"
 
 import (
+	"context"
+	"sync"
 	"unsafe"
 
+	"github.com/gridprotocol/computing-api/prover/pow"
 	"github.com/gridprotocol/computing-api/prover/types"
 
 	"golang.org/x/xerrors"
 )
 
-// generate a proof with POW
-func GeneratePOW(nodeID types.NodeID, rand []byte, diffcult int) (int64, error) {
-	var res int64
-	var prefixBuf = append(rand, nodeID.ToBytes()...)
+// libpow takes all the gpus, the proofs of nodes are searched one by one
+var powLock sync.Mutex
+
+// generate a proof with POW on the gpus by libpow, the search can't be cancelled once started.
+// Build with tag purego or without cgo for the search in go.
+func GeneratePOW(ctx context.Context, nodeID types.NodeID, rand []byte, diffcult int) (int64, error) {
+	if err := pow.CheckDifficulty(diffcult); err != nil {
+		return 0, err
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	var res int64 = -1
+	var prefixBuf = pow.Prefix(nodeID, rand)
+
+	powLock.Lock()
+	defer powLock.Unlock()
 
 	c_prefix := (*C.char)(unsafe.Pointer(&prefixBuf[0]))
 	c_index := (*C.longlong)(unsafe.Pointer(&res))
@@ -25,5 +44,10 @@ func GeneratePOW(nodeID types.NodeID, rand []byte, diffcult int) (int64, error)
 	if C.generatePOW(c_prefix, C.int(len(prefixBuf)), C.int(diffcult), c_index) != 0 {
 		return 0, xerrors.New("Unexpected Error")
 	}
+
+	// libpow searches a bounded range, the index is kept if none is found
+	if res < 0 || !pow.Verify(nodeID, rand, diffcult, res) {
+		return 0, pow.ErrNoProof
+	}
 	return res, nil
 }
@@ -0,0 +1,118 @@
+package pow
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"sync"
+
+	"github.com/gridprotocol/computing-api/prover/types"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrNoProof is returned if no nonce meets the difficulty
+var ErrNoProof = xerrors.New("no nonce meets the difficulty")
+
+// nonces tried between the checks of ctx
+const checkEvery = 1 << 12
+
+// the puzzle is sha256(rnd || nodeID.ToBytes() || nonce) with difficulty leading zero bits,
+// the nonce is in 8 bytes little endian
+func Prefix(nodeID types.NodeID, rnd []byte) []byte {
+	prefix := make([]byte, 0, len(rnd)+40)
+	prefix = append(prefix, rnd...)
+	return append(prefix, nodeID.ToBytes()...)
+}
+
+func CheckDifficulty(difficulty int) error {
+	if difficulty < 0 || difficulty > 256 {
+		return fmt.Errorf("difficulty %d is out of [0, 256]", difficulty)
+	}
+	return nil
+}
+
+// check hash has difficulty leading zero bits
+func meetsDifficulty(hash [32]byte, difficulty int) bool {
+	n := difficulty / 8
+	for i := 0; i < n; i++ {
+		if hash[i] != 0 {
+			return false
+		}
+	}
+	if rem := difficulty % 8; rem > 0 {
+		return bits.LeadingZeros8(hash[n]) >= rem
+	}
+	return true
+}
+
+// check the nonce of a proof solves the puzzle of rnd
+func Verify(nodeID types.NodeID, rnd []byte, difficulty int, nonce int64) bool {
+	if CheckDifficulty(difficulty) != nil || nonce < 0 {
+		return false
+	}
+
+	buf := binary.LittleEndian.AppendUint64(Prefix(nodeID, rnd), uint64(nonce))
+	return meetsDifficulty(sha256.Sum256(buf), difficulty)
+}
+
+// search the nonce of the puzzle with prefix in workers goroutines, the worker i tries
+// the nonces i, i+workers, ... The nonce found first is returned, the others stop then.
+// It returns the error of ctx if it's done before.
+func Search(ctx context.Context, prefix []byte, difficulty int, workers int) (int64, error) {
+	if err := CheckDifficulty(difficulty); err != nil {
+		return 0, err
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		once  sync.Once
+		found int64 = -1
+		wg    sync.WaitGroup
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(start int64) {
+			defer wg.Done()
+
+			// the prefix is shared, each worker changes the nonce of its own buffer
+			buf := binary.LittleEndian.AppendUint64(append([]byte{}, prefix...), 0)
+			nb := buf[len(prefix):]
+
+			// the nonce overflows to negative at the end of the space
+			step := int64(workers)
+			for i, nonce := 0, start; nonce >= 0; i, nonce = i+1, nonce+step {
+				if i%checkEvery == 0 && ctx.Err() != nil {
+					return
+				}
+
+				binary.LittleEndian.PutUint64(nb, uint64(nonce))
+				if meetsDifficulty(sha256.Sum256(buf), difficulty) {
+					once.Do(func() {
+						found = nonce
+						cancel()
+					})
+					return
+				}
+			}
+		}(int64(w))
+	}
+	wg.Wait()
+
+	if found >= 0 {
+		return found, nil
+	}
+	if err := ctx.Err(); err != nil {
+		// cancelled by the caller, not by a found nonce
+		return 0, err
+	}
+	return 0, ErrNoProof
+}
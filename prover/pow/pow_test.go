@@ -0,0 +1,91 @@
+package pow
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gridprotocol/computing-api/prover/types"
+)
+
+// the nonces found by the search are accepted by the verifier
+func TestSearchVerified(t *testing.T) {
+	prop := func(rnd [32]byte, addr common.Address, id uint32, d uint8, workers uint8) bool {
+		nodeID := types.NodeID{Address: addr.Hex(), ID: int64(id)}
+		difficulty := int(d % 14)
+
+		nonce, err := Search(context.Background(), Prefix(nodeID, rnd[:]), difficulty, int(workers%8)+1)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+
+		// the puzzle hashed again by hand
+		buf := append(append(append([]byte{}, rnd[:]...), nodeID.ToBytes()...), make([]byte, 8)...)
+		binary.LittleEndian.PutUint64(buf[len(buf)-8:], uint64(nonce))
+		hash := sha256.Sum256(buf)
+		target := new(big.Int).Lsh(big.NewInt(1), uint(256-difficulty))
+
+		return Verify(nodeID, rnd[:], difficulty, nonce) && new(big.Int).SetBytes(hash[:]).Cmp(target) < 0
+	}
+	if err := quick.Check(prop, &quick.Config{MaxCount: 50}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// the difficulty check is the comparison with the target 2^(256-difficulty)
+func TestMeetsDifficulty(t *testing.T) {
+	prop := func(hash [32]byte, zeros uint8, d uint16) bool {
+		// zero the leading bits to make the hashes near the target
+		for i := 0; i < int(zeros%64); i++ {
+			hash[i/8] &^= 0x80 >> (i % 8)
+		}
+		difficulty := int(d % 257)
+
+		target := new(big.Int).Lsh(big.NewInt(1), uint(256-difficulty))
+		want := new(big.Int).SetBytes(hash[:]).Cmp(target) < 0
+
+		return meetsDifficulty(hash, difficulty) == want
+	}
+	if err := quick.Check(prop, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyInvalid(t *testing.T) {
+	nodeID := types.NodeID{Address: common.Address{1}.Hex(), ID: 1}
+	if Verify(nodeID, nil, 0, -1) {
+		t.Fatal("negative nonce should be rejected")
+	}
+	if Verify(nodeID, nil, 257, 0) {
+		t.Fatal("difficulty over 256 should be rejected")
+	}
+	if !Verify(nodeID, nil, 0, 0) {
+		t.Fatal("any nonce meets difficulty 0")
+	}
+}
+
+func TestSearchCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	// never met in the time
+	_, err := Search(ctx, []byte("prefix"), 256, 4)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("search is not stopped in time: %s", time.Since(start))
+	}
+
+	if _, err := Search(context.Background(), nil, 300, 1); err == nil {
+		t.Fatal("expected error of invalid difficulty")
+	}
+}
@@ -0,0 +1,16 @@
+//go:build purego || !cgo
+
+package prover
+
+import (
+	"context"
+	"runtime"
+
+	"github.com/gridprotocol/computing-api/prover/pow"
+	"github.com/gridprotocol/computing-api/prover/types"
+)
+
+// generate a proof with POW on all cpus, the search stops when ctx is done
+func GeneratePOW(ctx context.Context, nodeID types.NodeID, rand []byte, diffcult int) (int64, error) {
+	return pow.Search(ctx, pow.Prefix(nodeID, rand), diffcult, runtime.NumCPU())
+}
@@ -1,6 +1,7 @@
 package prover
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
@@ -24,7 +25,7 @@ func TestPOW(t *testing.T) {
 		challenge[index] = byte(rand.Int())
 	}
 
-	res, err := GeneratePOW(nodeID, challenge, 8)
+	res, err := GeneratePOW(context.Background(), nodeID, challenge, 8)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -50,7 +51,7 @@ func TestRate(t *testing.T) {
 		for index := range challenge {
 			challenge[index] = byte(rand.Int())
 		}
-		res, err := GeneratePOW(nodeID, challenge, 8)
+		res, err := GeneratePOW(context.Background(), nodeID, challenge, 8)
 		if err != nil {
 			t.Fatal(err)
 		}
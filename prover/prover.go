@@ -2,21 +2,92 @@ package prover
 
 import (
 	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/gridprotocol/computing-api/keystore/signer"
+	"github.com/gridprotocol/computing-api/lib/kv"
 	"github.com/gridprotocol/computing-api/prover/client"
 	"github.com/gridprotocol/computing-api/prover/logs"
+	"github.com/gridprotocol/computing-api/prover/pow"
 	"github.com/gridprotocol/computing-api/prover/types"
 
-	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/xerrors"
 )
 
 var logger = logs.Logger("grid prover")
 
-type GRIDProver struct {
-	nodeID types.NodeID
+// time source of the prover, a fake one drives the cycles in tests
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// a timer made by Clock, like time.Timer
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// proof results of a node in this run
+type NodeStats struct {
+	Success int64 `json:"success"`
+	Fail    int64 `json:"fail"`
+	// cycles skipped without active orders
+	Skip int64 `json:"skip"`
+	// start of the last cycle with an accepted proof
+	LastSuccess int64  `json:"lastSuccess"`
+	LastError   string `json:"lastError,omitempty"`
+}
 
+type GRIDProver struct {
+	// provider of the nodes, its signer signs the proofs
+	address string
+	signer  signer.Signer
+	// ids of the nodes, they are read from nodes in each cycle if it's set
+	ids   []int64
+	nodes func(ctx context.Context) ([]int64, error)
+	// active orders of each node, the order count of provider in validator is used if it's nil
+	orders func(ctx context.Context) (map[int64]int64, error)
+
+	mu     sync.Mutex
+	stats  map[int64]*NodeStats
+	status Status
+
+	// records of the cycles are kept in db for keep, none is kept if it's nil
+	db      kv.Store
+	keep    time.Duration
+	metrics *Metrics
+	// alert after consecutive failed cycles, disabled if it's not positive
+	alertAfter int
+	onAlert    func(Alert)
+	// alerts delivered to onAlert in order by a worker, closed when the worker returns
+	alerts     chan Alert
+	alertsDone chan struct{}
+
+	// the cycles are aligned to it, the start of a cycle of validator
 	last            int64
 	prepareInterval time.Duration
 	proverInterval  time.Duration
@@ -24,33 +95,44 @@ type GRIDProver struct {
 
 	diffcult int
 
-	done  chan struct{}
-	doned bool
+	// start of the last cycle proved
+	proved int64
+	// the settings are fetched from validator again after refreshAt
+	refreshInterval time.Duration
+	refreshAt       time.Time
+	clock           Clock
+
+	// closed by Stop, and by Start when it returns
+	done     chan struct{}
+	stopOnce sync.Once
+	started  atomic.Bool
+	stopped  chan struct{}
 
 	client.Client
 }
 
-func NewGRIDProver(chain string, validatorUrl string, sk string, id int64) (*GRIDProver, error) {
-	// sk is required
-	if sk == "" {
-		return nil, fmt.Errorf("sk is required for new Prover")
-	}
-	// change string to ecdsa
-	privateKey, err := crypto.HexToECDSA(sk)
-	if err != nil {
-		return nil, err
+// make a prover of the nodes of provider, the nodes can be read from the registry by SetNodeSource instead
+func NewGRIDProver(chain string, validatorUrl string, sg signer.Signer, ids ...int64) (*GRIDProver, error) {
+	// signer is required
+	if sg == nil {
+		return nil, fmt.Errorf("signer is required for new Prover")
 	}
 
-	// get time information from validator
+	// the defaults until the settings of validator are fetched
 	prepareInterval := 10 * time.Second
 	proveInterval := 10 * time.Second
 	waitInterval := 2*time.Minute - prepareInterval - proveInterval
 
 	return &GRIDProver{
-		nodeID: types.NodeID{
-			Address: crypto.PubkeyToAddress(privateKey.PublicKey).Hex(),
-			ID:      id,
-		},
+		address: sg.Address().Hex(),
+		signer:  sg,
+		ids:     ids,
+		stats:   make(map[int64]*NodeStats),
+		status:  Status{Address: sg.Address().Hex()},
+
+		keep:       7 * 24 * time.Hour,
+		metrics:    newMetrics(),
+		alertAfter: 3,
 
 		last:            0,
 		prepareInterval: prepareInterval,
@@ -59,114 +141,381 @@ func NewGRIDProver(chain string, validatorUrl string, sk string, id int64) (*GRI
 
 		diffcult: 10,
 
-		done:  make(chan struct{}),
-		doned: false,
+		refreshInterval: time.Minute,
+		clock:           realClock{},
+
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
 
 		// new gridClient to communicate with validator
 		Client: *client.NewClient(validatorUrl),
 	}, nil
 }
 
+// run the cycles until ctx is done or Stop is called, it's called once
 func (p *GRIDProver) Start(ctx context.Context) {
-	for {
-		// 1 sec for each loop
-		time.Sleep(1 * time.Second)
+	p.started.Store(true)
+	defer close(p.stopped)
 
-		wait, nextTime := p.CalculateWatingTime()
+	// the proofs in progress are cancelled by Stop
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
 		select {
-		case <-ctx.Done():
-			p.doned = true
-			return
 		case <-p.done:
-			p.doned = true
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		p.refreshSettings(ctx)
+
+		wait, start := p.CalculateWatingTime()
+		p.setNext(start)
+		if !p.sleep(ctx, wait) {
 			return
-		case <-time.After(wait):
 		}
 
-		logger.Info("provider: ", p.nodeID.Address)
-		cnt, err := p.Client.GetV1OrderCount(ctx, p.nodeID.Address)
-		if err != nil {
-			logger.Error(err.Error())
-			continue
+		err := p.proveCycle(ctx, start)
+		if ctx.Err() != nil {
+			return
 		}
+		p.finishCycle(start, err)
 
-		logger.Info("order count for provider: ", cnt)
+		p.proved = start
+		_, next := p.CalculateWatingTime()
+		p.setNext(next)
+	}
+}
 
-		if cnt <= 0 {
-			fmt.Println("no order for this provider, skip proof generation")
-			continue
-		}
+// read the ids of nodes in each cycle, e.g. the nodes of provider in the registry
+func (p *GRIDProver) SetNodeSource(nodes func(ctx context.Context) ([]int64, error)) {
+	p.nodes = nodes
+}
 
-		// get rnd from Validator/Contract
-		rnd, err := p.GetRND(ctx)
-		if err != nil {
-			logger.Error(err.Error())
-			continue
+// read the active orders of each node in each cycle, e.g. from the market logs followed by the gateway,
+// the nodes without orders are skipped
+func (p *GRIDProver) SetOrderSource(orders func(ctx context.Context) (map[int64]int64, error)) {
+	p.orders = orders
+}
+
+// provider of the nodes
+func (p *GRIDProver) Address() string {
+	return p.address
+}
+
+// proof results of the nodes in this run
+func (p *GRIDProver) Stats() map[int64]NodeStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	res := make(map[int64]NodeStats, len(p.stats))
+	for id, s := range p.stats {
+		res[id] = *s
+	}
+	return res
+}
+
+func (p *GRIDProver) nodeIDs(ctx context.Context) ([]int64, error) {
+	if p.nodes == nil {
+		return p.ids, nil
+	}
+	return p.nodes(ctx)
+}
+
+// prove the nodes with active orders concurrently in the window of the cycle,
+// errSkip is returned if none has orders
+func (p *GRIDProver) proveCycle(ctx context.Context, start int64) error {
+	ids, err := p.nodeIDs(ctx)
+	if err != nil {
+		logger.Error("get nodes of provider failed: ", err)
+		return xerrors.Errorf("get nodes of provider failed: %w", err)
+	}
+
+	counts, err := p.orderCounts(ctx, ids)
+	if err != nil {
+		logger.Error("get order count failed: ", err)
+		err = xerrors.Errorf("get order count failed: %w", err)
+		for _, id := range ids {
+			p.record(CycleRecord{Node: id, Cycle: start}, err)
 		}
+		return err
+	}
 
-		// generate proof
-		res, err := p.GenerateProof(ctx, rnd)
-		if err != nil {
-			logger.Error(err.Error())
+	active := make([]types.NodeID, 0, len(ids))
+	for _, id := range ids {
+		if counts[id] <= 0 {
+			logger.Infof("no order for node %d, skip proof generation", id)
+			p.record(CycleRecord{Node: id, Cycle: start}, errSkip)
 			continue
 		}
+		active = append(active, types.NodeID{Address: p.address, ID: id})
+	}
+	if len(active) == 0 {
+		return errSkip
+	}
 
-		// submit proof to validator
-		success, err := p.ProveToValidator(ctx, res)
-		if err != nil {
-			logger.Error(err.Error())
-			// continue
-		}
+	// proofs are useless after the window
+	end := start + int64((p.prepareInterval + p.proverInterval).Seconds())
+	wctx, cancel := context.WithTimeout(ctx, time.Duration(end+1-p.clock.Now().Unix())*time.Second)
+	defer cancel()
 
-		if success {
-			logger.Infof("Proof of Work Generation Successfully result[%d]", res)
-		} else {
-			logger.Info("Proof of Work Generation Falied")
+	// the rnd of a cycle is the same for all nodes
+	rnd, err := p.GetRND(wctx)
+	if err != nil {
+		logger.Error(err.Error())
+		err = xerrors.Errorf("get rnd failed: %w", err)
+		for _, n := range active {
+			p.record(CycleRecord{Node: n.ID, Cycle: start}, err)
 		}
+		return err
+	}
 
-		p.last = nextTime
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, n := range active {
+		wg.Add(1)
+		go func(n types.NodeID) {
+			defer wg.Done()
+			if err := p.proveNode(wctx, n, rnd, start); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}(n)
 	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
 }
 
+// active orders of the nodes, each node has the order count of provider without the order source
+func (p *GRIDProver) orderCounts(ctx context.Context, ids []int64) (map[int64]int64, error) {
+	if p.orders != nil {
+		return p.orders(ctx)
+	}
+
+	cnt, err := p.GetV1OrderCount(ctx, p.address)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[int64]int64, len(ids))
+	for _, id := range ids {
+		counts[id] = cnt
+	}
+	return counts, nil
+}
+
+// generate and submit the proof of a node
+func (p *GRIDProver) proveNode(ctx context.Context, n types.NodeID, rnd [32]byte, start int64) error {
+	r := CycleRecord{Node: n.ID, Cycle: start, Rnd: hex.EncodeToString(rnd[:])}
+
+	t := time.Now()
+	res, err := p.GenerateProof(ctx, n, rnd)
+	r.Compute = time.Since(t).Milliseconds()
+	p.metrics.Compute.Observe(time.Since(t).Seconds())
+
+	if err == nil {
+		r.Nonce = res
+
+		t = time.Now()
+		_, err = p.ProveToValidator(ctx, n, rnd, res)
+		r.Submit = time.Since(t).Milliseconds()
+		p.metrics.Submit.Observe(time.Since(t).Seconds())
+	}
+	p.record(r, err)
+
+	if err != nil {
+		logger.Errorf("Proof of Work of node %d Falied: %s", n.ID, err)
+		return err
+	}
+	logger.Infof("Proof of Work of node %d Generation Successfully result[%d]", n.ID, res)
+	return nil
+}
+
+// a node without active orders in the cycle
+var errSkip = xerrors.New("no active order")
+
+// track the result of a node in the cycle, the proofs are kept in db.
+// The ones cancelled by Stop are not results.
+func (p *GRIDProver) record(r CycleRecord, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	r.Success = err == nil
+	if err != nil {
+		r.Error = err.Error()
+	}
+	r.Time = p.clock.Now().Unix()
+
+	p.mu.Lock()
+	s, ok := p.stats[r.Node]
+	if !ok {
+		s = new(NodeStats)
+		p.stats[r.Node] = s
+	}
+
+	switch err {
+	case nil:
+		s.Success++
+		s.LastSuccess = r.Cycle
+		p.metrics.Success.Inc()
+	case errSkip:
+		s.Skip++
+		p.metrics.Skip.Inc()
+	default:
+		s.Fail++
+		s.LastError = r.Error
+		p.metrics.Fail.Inc()
+	}
+	p.mu.Unlock()
+
+	if err != errSkip {
+		p.keepRecord(r)
+	}
+}
+
+// wait for d, false if ctx is done before it
+func (p *GRIDProver) sleep(ctx context.Context, d time.Duration) bool {
+	t := p.clock.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C():
+		return true
+	}
+}
+
+// stop the cycles and cancel the proofs in progress, it returns after Start returns
+// and the alerts queued are delivered
 func (p *GRIDProver) Stop() {
-	close(p.done)
+	p.stopOnce.Do(func() {
+		close(p.done)
+	})
+
+	if p.started.Load() {
+		<-p.stopped
+	}
 
-	for !p.doned {
-		time.Sleep(200 * time.Millisecond)
+	p.mu.Lock()
+	alertsDone := p.alertsDone
+	p.mu.Unlock()
+	if alertsDone != nil {
+		select {
+		case <-alertsDone:
+		case <-time.After(alertDrain):
+			logger.Warn("prover alerts are not delivered in ", alertDrain)
+		}
 	}
 }
 
+// wait until the prove window of the next cycle not proved, and the start of that cycle
 func (p *GRIDProver) CalculateWatingTime() (time.Duration, int64) {
 	challengeCycleSeconds := int64((p.prepareInterval + p.proverInterval + p.waitInterval).Seconds())
-	now := time.Now().Unix()
-	duration := now - p.last
-	over := duration % challengeCycleSeconds
+	prepare := int64(p.prepareInterval.Seconds())
+	prove := int64(p.proverInterval.Seconds())
+
+	now := p.clock.Now().Unix()
+	over := (now - p.last) % challengeCycleSeconds
+	if over < 0 {
+		over += challengeCycleSeconds
+	}
+	start := now - over
 
-	var waitingSeconds int64 = 0
-	if over < int64(p.prepareInterval.Seconds()) {
-		waitingSeconds = int64(p.prepareInterval.Seconds()) - over
-		p.last = now - over
-	} else if over > int64((p.prepareInterval + p.proverInterval).Seconds()) {
-		waitingSeconds = challengeCycleSeconds + int64(p.prepareInterval.Seconds()) - over
-		p.last = now - over + challengeCycleSeconds
+	// proved in this cycle or its window is passed
+	if start <= p.proved || over > prepare+prove {
+		start += challengeCycleSeconds
 	}
 
-	next := p.last + challengeCycleSeconds
+	waitingSeconds := start + prepare - now
+	if waitingSeconds < 0 {
+		waitingSeconds = 0
+	}
 
-	return time.Duration(waitingSeconds) * time.Second, next
+	return time.Duration(waitingSeconds) * time.Second, start
 }
 
-// generate a proof with a random value
-func (p *GRIDProver) GenerateProof(ctx context.Context, rnd [32]byte) (int64, error) {
-	return GeneratePOW(p.nodeID, rnd[:], p.diffcult)
+// fetch the cycle settings and difficulty from validator if they are due to refresh,
+// the current ones are kept if it fails
+func (p *GRIDProver) refreshSettings(ctx context.Context) {
+	now := p.clock.Now()
+	if now.Before(p.refreshAt) {
+		return
+	}
+	p.refreshAt = now.Add(p.refreshInterval)
+
+	info, err := p.GetV1SettingInfo(ctx)
+	if err != nil {
+		logger.Warn("get settings from validator failed, keep the current ones: ", err)
+		return
+	}
+	if err := p.applySettings(info); err != nil {
+		logger.Warn("invalid settings from validator, keep the current ones: ", err)
+	}
 }
 
-// submit proof to validator
-func (p *GRIDProver) ProveToValidator(ctx context.Context, result int64) (bool, error) {
-	err := p.SubmitProof(ctx, types.Proof{
-		NodeID: p.nodeID,
-		Nonce:  result,
-	})
+// align the cycles to the ones of validator
+func (p *GRIDProver) applySettings(info client.SettingInfo) error {
+	if info.PrepareInterval <= 0 || info.ProverInterval <= 0 || info.WaitInterval < 0 {
+		return fmt.Errorf("invalid intervals %d/%d/%d", info.PrepareInterval, info.ProverInterval, info.WaitInterval)
+	}
+	// difficulty is not set by the old validators
+	diffcult := p.diffcult
+	if info.Difficulty != 0 {
+		if err := pow.CheckDifficulty(info.Difficulty); err != nil {
+			return err
+		}
+		diffcult = info.Difficulty
+	}
+
+	prepare := time.Duration(info.PrepareInterval) * time.Second
+	prove := time.Duration(info.ProverInterval) * time.Second
+	wait := time.Duration(info.WaitInterval) * time.Second
+	if info.Last != p.last || prepare != p.prepareInterval || prove != p.proverInterval || wait != p.waitInterval || diffcult != p.diffcult {
+		logger.Infof("settings of validator: last %d, intervals %s/%s/%s, difficulty %d", info.Last, prepare, prove, wait, diffcult)
+	}
+
+	p.last = info.Last
+	p.prepareInterval = prepare
+	p.proverInterval = prove
+	p.waitInterval = wait
+	p.diffcult = diffcult
+
+	return nil
+}
+
+// generate a proof of a node with a random value
+func (p *GRIDProver) GenerateProof(ctx context.Context, n types.NodeID, rnd [32]byte) (int64, error) {
+	return GeneratePOW(ctx, n, rnd[:], p.diffcult)
+}
+
+// submit proof of a node in the cycle of rnd to validator, signed by the provider signer
+func (p *GRIDProver) ProveToValidator(ctx context.Context, n types.NodeID, rnd [32]byte, result int64) (bool, error) {
+	proof := types.SignedProof{
+		Proof: types.Proof{
+			NodeID: n,
+			Nonce:  result,
+		},
+		Rnd: rnd,
+		Ts:  p.clock.Now().Unix(),
+	}
+	sig, err := p.signer.SignText(proof.SignBytes(proof.Rnd, proof.Ts))
+	if err != nil {
+		return false, err
+	}
+	proof.Sig = sig
+
+	err = p.SubmitProof(ctx, proof)
 	if err != nil {
 		return false, err
 	}
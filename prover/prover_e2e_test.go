@@ -0,0 +1,79 @@
+package prover_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gridprotocol/computing-api/keystore/signer"
+	"github.com/gridprotocol/computing-api/prover"
+	"github.com/gridprotocol/computing-api/prover/types"
+	"github.com/gridprotocol/computing-api/prover/validator"
+)
+
+// the prover generates and submits the proofs accepted by the validator
+func TestProverE2E(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the prover runs in real cycles")
+	}
+
+	key, _ := crypto.GenerateKey()
+	provider := crypto.PubkeyToAddress(key.PublicKey).Hex()
+
+	// cycles of 4s, proofs are accepted in the 2s after the first second,
+	// the prover fetches them from the validator
+	v := validator.New(validator.Config{
+		PrepareInterval: time.Second,
+		ProveInterval:   2 * time.Second,
+		WaitInterval:    time.Second,
+		Difficulty:      10,
+	})
+	srv := httptest.NewServer(v.Handler())
+	defer srv.Close()
+
+	p, err := prover.NewGRIDProver("local", srv.URL, signer.NewKeySigner(key), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Start(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	node := types.NodeID{Address: provider, ID: 1}
+
+	// no proof without orders
+	time.Sleep(5 * time.Second)
+	if h := v.History(node); len(h.Records) != 0 {
+		t.Fatalf("proof is submitted without orders: %+v", h)
+	}
+
+	v.SetOrderCount(provider, 1)
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		h := v.History(node)
+		if h.Success >= 2 {
+			if h.Fail != 0 {
+				t.Fatalf("unexpected failed proofs: %+v", h)
+			}
+			// one proof a cycle
+			if h.Records[0].Cycle == h.Records[1].Cycle {
+				t.Fatalf("proved twice in a cycle: %+v", h)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("proofs are not accepted in time: %+v", h)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
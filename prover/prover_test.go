@@ -0,0 +1,423 @@
+package prover
+
+import (
+	"context"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gridprotocol/computing-api/keystore/signer"
+	"github.com/gridprotocol/computing-api/prover/types"
+	"github.com/gridprotocol/computing-api/prover/validator"
+)
+
+// a clock only moving when the test fires a timer
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	c  *fakeClock
+	at time.Time
+	ch chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTimer{c: c, at: c.now.Add(d), ch: make(chan time.Time, 1)}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+
+	for i, ot := range t.c.timers {
+		if ot == t {
+			t.c.timers = append(t.c.timers[:i], t.c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// pending timers
+func (c *fakeClock) pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// wait for a pending timer, move to it and fire it
+func (c *fakeClock) next(t *testing.T) {
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		c.mu.Lock()
+		if len(c.timers) > 0 {
+			sort.Slice(c.timers, func(i, j int) bool { return c.timers[i].at.Before(c.timers[j].at) })
+			ft := c.timers[0]
+			c.timers = c.timers[1:]
+			if ft.at.After(c.now) {
+				c.now = ft.at
+			}
+			ft.ch <- c.now
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+
+		if time.Now().After(deadline) {
+			t.Fatal("prover is not waiting on the clock")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCalculateWatingTime(t *testing.T) {
+	cases := []struct {
+		name   string
+		last   int64
+		proved int64
+		now    int64
+		wait   time.Duration
+		start  int64
+	}{
+		{"before window", 1003, 0, 1001, 4 * time.Second, 1003},
+		{"in prepare", 1003, 0, 1004, time.Second, 1003},
+		{"in window", 1003, 0, 1006, 0, 1003},
+		{"end of window", 1003, 0, 1008, 0, 1003},
+		{"window passed", 1003, 0, 1009, 6 * time.Second, 1013},
+		{"proved", 1003, 1003, 1006, 9 * time.Second, 1013},
+		{"epoch aligned", 0, 0, 1001, time.Second, 1000},
+	}
+
+	for _, c := range cases {
+		clock := &fakeClock{now: time.Unix(c.now, 0)}
+		p := &GRIDProver{
+			last:            c.last,
+			prepareInterval: 2 * time.Second,
+			proverInterval:  3 * time.Second,
+			waitInterval:    5 * time.Second,
+			proved:          c.proved,
+			clock:           clock,
+		}
+		wait, start := p.CalculateWatingTime()
+		if wait != c.wait || start != c.start {
+			t.Errorf("%s: expected %s to %d, got %s to %d", c.name, c.wait, c.start, wait, start)
+		}
+	}
+}
+
+// the prover follows the settings of validator and the changes of them in run
+func TestFollowSettings(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+
+	// difficulty is higher than the default of prover, proofs fail if it's not fetched
+	v := validator.New(validator.Config{
+		Last:            1003,
+		PrepareInterval: 2 * time.Second,
+		ProveInterval:   3 * time.Second,
+		WaitInterval:    5 * time.Second,
+		Difficulty:      12,
+		Now:             clock.Now,
+	})
+	srv := httptest.NewServer(v.Handler())
+	defer srv.Close()
+
+	key, _ := crypto.GenerateKey()
+	p, err := NewGRIDProver("local", srv.URL, signer.NewKeySigner(key), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.clock = clock
+	p.refreshInterval = 30 * time.Second
+
+	node := types.NodeID{Address: p.address, ID: 1}
+	v.SetOrderCount(node.Address, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Start(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// step the prover until a proof is accepted, a proof is submitted before the next timer
+	proveUntil := func(ok func(validator.Record) bool) validator.History {
+		for i := 0; i < 100; i++ {
+			clock.next(t)
+			h := v.History(node)
+			if n := len(h.Records); n > 0 && h.Records[n-1].Success && ok(h.Records[n-1]) {
+				return h
+			}
+		}
+		t.Fatalf("no proof accepted: %+v", v.History(node))
+		return validator.History{}
+	}
+
+	h := proveUntil(func(validator.Record) bool { return true })
+	if h.Fail != 0 || h.Records[0].Cycle != 1003 {
+		t.Fatalf("unexpected history %+v", h)
+	}
+
+	// new cycles of 11s aligned to 1107 and a higher difficulty in run
+	v.SetConfig(validator.Config{
+		Last:            1107,
+		PrepareInterval: 3 * time.Second,
+		ProveInterval:   2 * time.Second,
+		WaitInterval:    6 * time.Second,
+		Difficulty:      13,
+	})
+
+	// accepted in a cycle aligned to the new last, with the new difficulty
+	h = proveUntil(func(r validator.Record) bool { return (r.Cycle-1107)%11 == 0 })
+
+	// every cycle is proved after it
+	fail := h.Fail
+	proveUntil(func(r validator.Record) bool { return r.Cycle > h.Records[len(h.Records)-1].Cycle })
+	if h := v.History(node); h.Fail != fail {
+		t.Fatalf("proofs failed in the new settings: %+v", h)
+	}
+}
+
+// without the order source, the nodes are proved in the same cycle if the provider has orders in validator
+func TestProveNodes(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+
+	v := validator.New(validator.Config{
+		PrepareInterval: 2 * time.Second,
+		ProveInterval:   3 * time.Second,
+		WaitInterval:    5 * time.Second,
+		Difficulty:      12,
+		Now:             clock.Now,
+	})
+	srv := httptest.NewServer(v.Handler())
+	defer srv.Close()
+
+	key, _ := crypto.GenerateKey()
+	p, err := NewGRIDProver("local", srv.URL, signer.NewKeySigner(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.clock = clock
+
+	// no order in the first cycle, node 4 is registered later
+	var mu sync.Mutex
+	ids := []int64{1, 2, 3}
+	p.SetNodeSource(func(context.Context) ([]int64, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int64(nil), ids...), nil
+	})
+	v.SetOrderCount(p.Address(), 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Start(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// the stats are tracked before the next timer
+	waitStats := func(ok func(map[int64]NodeStats) bool) map[int64]NodeStats {
+		for i := 0; i < 100; i++ {
+			clock.next(t)
+			if s := p.Stats(); ok(s) {
+				return s
+			}
+		}
+		t.Fatalf("unexpected stats %+v", p.Stats())
+		return nil
+	}
+
+	s := waitStats(func(s map[int64]NodeStats) bool { return s[1].Skip > 0 })
+	for _, id := range []int64{1, 2, 3} {
+		if s[id].Skip != 1 || s[id].Success != 0 || s[id].Fail != 0 {
+			t.Fatalf("node %d is not skipped without orders: %+v", id, s[id])
+		}
+		if h := v.History(types.NodeID{Address: p.Address(), ID: id}); len(h.Records) != 0 {
+			t.Fatalf("proof of node %d without order is submitted: %+v", id, h)
+		}
+	}
+
+	v.SetOrderCount(p.Address(), 1)
+
+	s = waitStats(func(s map[int64]NodeStats) bool { return s[1].Success > 0 })
+	for _, id := range []int64{1, 2, 3} {
+		if s[id].LastSuccess != s[1].LastSuccess || s[id].Success != 1 {
+			t.Fatalf("nodes are not proved in a cycle: %+v", s)
+		}
+		h := v.History(types.NodeID{Address: p.Address(), ID: id})
+		if h.Success != 1 || h.Fail != 0 || h.Records[0].Cycle != s[1].LastSuccess {
+			t.Fatalf("unexpected history of node %d: %+v", id, h)
+		}
+	}
+
+	mu.Lock()
+	ids = append(ids, 4)
+	mu.Unlock()
+
+	s = waitStats(func(s map[int64]NodeStats) bool { return s[4].Success > 0 })
+	if s[4].LastSuccess != s[1].LastSuccess || s[1].Fail != 0 || s[4].Fail != 0 {
+		t.Fatalf("new node is not proved with others: %+v", s)
+	}
+}
+
+// the nodes with orders are proved in the same cycle, the others are skipped
+func TestProveNodeOrders(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+
+	v := validator.New(validator.Config{
+		PrepareInterval: 2 * time.Second,
+		ProveInterval:   3 * time.Second,
+		WaitInterval:    5 * time.Second,
+		Difficulty:      12,
+		Now:             clock.Now,
+	})
+	srv := httptest.NewServer(v.Handler())
+	defer srv.Close()
+
+	key, _ := crypto.GenerateKey()
+	p, err := NewGRIDProver("local", srv.URL, signer.NewKeySigner(key), 1, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.clock = clock
+
+	// node 2 has no order, the count of provider in validator is not used
+	p.SetOrderSource(func(context.Context) (map[int64]int64, error) {
+		return map[int64]int64{1: 1, 3: 2}, nil
+	})
+	v.SetOrderCount(p.Address(), 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Start(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	var s map[int64]NodeStats
+	for i := 0; i < 100; i++ {
+		clock.next(t)
+		if s = p.Stats(); s[1].Success > 0 {
+			break
+		}
+	}
+	if s[1].Success != 1 || s[3].Success != 1 || s[3].LastSuccess != s[1].LastSuccess {
+		t.Fatalf("nodes with orders are not proved in a cycle: %+v", s)
+	}
+	if s[2].Success != 0 || s[2].Fail != 0 || s[2].Skip != 1 {
+		t.Fatalf("node without order is not skipped: %+v", s[2])
+	}
+	for _, id := range []int64{1, 3} {
+		h := v.History(types.NodeID{Address: p.Address(), ID: id})
+		if h.Success != 1 || h.Fail != 0 || h.Records[0].Cycle != s[1].LastSuccess {
+			t.Fatalf("unexpected history of node %d: %+v", id, h)
+		}
+	}
+	if h := v.History(types.NodeID{Address: p.Address(), ID: 2}); len(h.Records) != 0 {
+		t.Fatalf("proof of node without order is submitted: %+v", h)
+	}
+}
+
+// Stop returns after Start, both while waiting a cycle and proving
+func TestStop(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+
+	// a proof can't be found in the test
+	v := validator.New(validator.Config{
+		PrepareInterval: 2 * time.Second,
+		ProveInterval:   3 * time.Second,
+		WaitInterval:    5 * time.Second,
+		Difficulty:      64,
+		Now:             clock.Now,
+	})
+	srv := httptest.NewServer(v.Handler())
+	defer srv.Close()
+
+	key, _ := crypto.GenerateKey()
+	newProver := func() (*GRIDProver, chan struct{}) {
+		p, err := NewGRIDProver("local", srv.URL, signer.NewKeySigner(key), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.clock = clock
+
+		done := make(chan struct{})
+		go func() {
+			p.Start(context.Background())
+			close(done)
+		}()
+		return p, done
+	}
+	stop := func(p *GRIDProver, done chan struct{}) {
+		stopped := make(chan struct{})
+		go func() {
+			p.Stop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			t.Fatal("stop is not returned")
+		}
+		select {
+		case <-done:
+		default:
+			t.Fatal("stop is returned before start")
+		}
+		// more than once
+		p.Stop()
+	}
+
+	// waiting the window
+	p, done := newProver()
+	for clock.pending() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	stop(p, done)
+	if n := clock.pending(); n != 0 {
+		t.Fatalf("%d timers are not stopped", n)
+	}
+
+	// searching a proof
+	v.SetOrderCount(p.Address(), 1)
+	p, done = newProver()
+	clock.next(t)
+	time.Sleep(100 * time.Millisecond)
+	stop(p, done)
+	if s := p.Status(); s.FailStreak != 0 || s.Nodes[1].Fail != 0 {
+		t.Fatalf("cancelled proof is counted as a failure: %+v", s)
+	}
+}
@@ -3,6 +3,7 @@ package types
 import (
 	"encoding/binary"
 
+	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/common"
 )
 
@@ -31,6 +32,29 @@ func (p *Proof) ToBytes() []byte {
 	return append(buf, nonceBuf...)
 }
 
+// message signed by the provider to submit the proof in the cycle of rnd at ts in unix second
+func (p *Proof) SignBytes(rnd [32]byte, ts int64) []byte {
+	var tsBuf = make([]byte, 8)
+	binary.LittleEndian.PutUint64(tsBuf, uint64(ts))
+	buf := append(p.ToBytes(), rnd[:]...)
+
+	return append(buf, tsBuf...)
+}
+
+// hash of the signed message as an ethereum personal message, the signer must be the address of node
+func (p *Proof) SignHash(rnd [32]byte, ts int64) []byte {
+	return accounts.TextHash(p.SignBytes(rnd, ts))
+}
+
+// a proof signed by the provider
+type SignedProof struct {
+	Proof
+	Rnd [32]byte
+	Ts  int64
+	// 65 bytes [R || S || V] signature on SignHash
+	Sig []byte
+}
+
 type Result struct {
 	NodeID
 	Success bool
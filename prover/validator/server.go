@@ -0,0 +1,124 @@
+package validator
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/gin-gonic/gin"
+	"github.com/gridprotocol/computing-api/prover/types"
+)
+
+// body of a signed proof submission, rnd in hex and sig in 0x hex
+type proofRequest struct {
+	Address string `json:"address" binding:"required"`
+	ID      int64  `json:"id"`
+	Nonce   int64  `json:"nonce"`
+	Rnd     string `json:"rnd" binding:"required"`
+	Ts      int64  `json:"ts" binding:"required"`
+	Sig     string `json:"sig" binding:"required"`
+}
+
+// the validator http api used by the prover client
+func (v *Validator) Handler() http.Handler {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(gin.Recovery())
+
+	g := r.Group("/v1")
+	g.GET("/info", v.handlerInfo)
+	g.GET("/rnd", v.handlerRnd)
+	g.POST("/proof", v.handlerProof)
+	g.GET("/provider/:address/count", v.handlerOrderCount)
+	g.GET("/provider/:address/node/:id/history", v.handlerHistory)
+
+	return r
+}
+
+// serve the validator api on addr
+func (v *Validator) NewServer(addr string) *http.Server {
+	return &http.Server{
+		Addr:    addr,
+		Handler: v.Handler(),
+	}
+}
+
+// cycle settings and difficulty
+func (v *Validator) handlerInfo(c *gin.Context) {
+	c.JSON(http.StatusOK, v.Settings())
+}
+
+// rnd of the current cycle
+func (v *Validator) handlerRnd(c *gin.Context) {
+	rnd, start := v.Rnd()
+	c.JSON(http.StatusOK, gin.H{"Rnd": hex.EncodeToString(rnd[:]), "Cycle": start})
+}
+
+// verify a proof
+func (v *Validator) handlerProof(c *gin.Context) {
+	var req proofRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] invalid proof: " + err.Error()})
+		return
+	}
+
+	p := types.SignedProof{
+		Proof: types.Proof{NodeID: types.NodeID{Address: req.Address, ID: req.ID}, Nonce: req.Nonce},
+		Ts:    req.Ts,
+	}
+	rnd, err := hex.DecodeString(req.Rnd)
+	if err != nil || len(rnd) != len(p.Rnd) {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] invalid rnd"})
+		return
+	}
+	copy(p.Rnd[:], rnd)
+	if p.Sig, err = hexutil.Decode(req.Sig); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] invalid signature"})
+		return
+	}
+
+	if err := v.Verify(p); err != nil {
+		logger.Info("proof of node ", req.Address, "/", req.ID, " rejected: ", err)
+
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, ErrProved):
+			status = http.StatusConflict
+		case errors.Is(err, ErrInvalidSig), errors.Is(err, ErrExpired):
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, gin.H{"msg": "[Fail] " + err.Error()})
+		return
+	}
+
+	logger.Info("proof of node ", req.Address, "/", req.ID, " accepted")
+	c.JSON(http.StatusOK, gin.H{"msg": "[ACK] proof accepted"})
+}
+
+// order count of a provider
+func (v *Validator) handlerOrderCount(c *gin.Context) {
+	c.JSON(http.StatusOK, v.OrderCount(c.Param("address")))
+}
+
+// proof results of a node
+func (v *Validator) handlerHistory(c *gin.Context) {
+	n, ok := nodeParam(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, v.History(n))
+}
+
+// node in the path, a bad request is replied if the id is invalid
+func nodeParam(c *gin.Context) (types.NodeID, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] invalid node id"})
+		return types.NodeID{}, false
+	}
+
+	return types.NodeID{Address: c.Param("address"), ID: id}, true
+}
@@ -0,0 +1,347 @@
+package validator
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gridprotocol/computing-api/prover/client"
+	"github.com/gridprotocol/computing-api/prover/logs"
+	"github.com/gridprotocol/computing-api/prover/pow"
+	"github.com/gridprotocol/computing-api/prover/types"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var logger = logs.Logger("grid validator")
+
+var (
+	ErrOutOfWindow = errors.New("proof is out of the prove window")
+	ErrProved      = errors.New("node is proved in this cycle")
+	ErrInvalidPOW  = errors.New("nonce doesn't meet the difficulty")
+	ErrWrongRnd    = errors.New("proof isn't of the rnd of this cycle")
+	ErrInvalidSig  = errors.New("signer isn't the provider of node")
+	ErrExpired     = errors.New("signature is expired")
+	ErrReplay      = errors.New("signature is used")
+)
+
+type Config struct {
+	// start of a cycle in unix second, the cycles are aligned to the unix epoch if it's 0 like the prover
+	Last int64
+	// a cycle is the prepare, the prove and the wait interval in order,
+	// proofs are accepted in the prove interval
+	PrepareInterval time.Duration
+	ProveInterval   time.Duration
+	WaitInterval    time.Duration
+	// leading zero bits of the proof hash
+	Difficulty int
+	// order count of the providers not set by SetOrderCount
+	DefaultOrders int64
+	// results kept for each node
+	KeepHistory int
+	// proofs signed more than it before or after now are rejected
+	MaxSkew time.Duration
+	// clock, time.Now if it's nil
+	Now func() time.Time
+}
+
+func DefaultConfig() Config {
+	return Config{
+		PrepareInterval: 10 * time.Second,
+		ProveInterval:   10 * time.Second,
+		WaitInterval:    100 * time.Second,
+		Difficulty:      10,
+		KeepHistory:     128,
+		MaxSkew:         30 * time.Second,
+	}
+}
+
+// fill the zero fields with the default
+func (c Config) withDefault() Config {
+	d := DefaultConfig()
+	if c.PrepareInterval == 0 {
+		c.PrepareInterval = d.PrepareInterval
+	}
+	if c.ProveInterval == 0 {
+		c.ProveInterval = d.ProveInterval
+	}
+	if c.WaitInterval == 0 {
+		c.WaitInterval = d.WaitInterval
+	}
+	if c.Difficulty == 0 {
+		c.Difficulty = d.Difficulty
+	}
+	if c.KeepHistory == 0 {
+		c.KeepHistory = d.KeepHistory
+	}
+	if c.MaxSkew == 0 {
+		c.MaxSkew = d.MaxSkew
+	}
+	if c.Now == nil {
+		c.Now = time.Now
+	}
+	return c
+}
+
+// result of a proof
+type Record struct {
+	// start of the cycle in unix second
+	Cycle   int64  `json:"cycle"`
+	Nonce   int64  `json:"nonce"`
+	Success bool   `json:"success"`
+	Reason  string `json:"reason,omitempty"`
+	Time    int64  `json:"time"`
+}
+
+// proof results of a node, the latest records are kept
+type History struct {
+	Success int64    `json:"success"`
+	Fail    int64    `json:"fail"`
+	Records []Record `json:"records"`
+}
+
+// Validator is an in-process stand-in of the grid validator. It issues a random challenge
+// per cycle, verifies the proofs of nodes against the difficulty and serves the order counts
+// of providers, for the tests of the prover and a local validator in development.
+type Validator struct {
+	mu  sync.Mutex
+	cfg Config
+
+	// start of cycle -> rnd
+	rnds map[int64][32]byte
+	// provider -> order count
+	orders map[string]int64
+	// node -> results
+	history map[string]*History
+	// hash of signed messages -> signed time, for rejecting replays
+	used map[string]int64
+}
+
+func New(cfg Config) *Validator {
+	return &Validator{
+		cfg:     cfg.withDefault(),
+		rnds:    make(map[int64][32]byte),
+		orders:  make(map[string]int64),
+		history: make(map[string]*History),
+		used:    make(map[string]int64),
+	}
+}
+
+// addresses in any case are the same provider
+func providerKey(addr string) string {
+	return strings.ToLower(addr)
+}
+
+func nodeKey(n types.NodeID) string {
+	return providerKey(n.Address) + "/" + strconv.FormatInt(n.ID, 10)
+}
+
+func (v *Validator) Config() Config {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.cfg
+}
+
+// change the cycle settings and difficulty while serving, they are read by the provers at refresh
+func (v *Validator) SetConfig(cfg Config) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if cfg.Now == nil {
+		cfg.Now = v.cfg.Now
+	}
+	v.cfg = cfg.withDefault()
+	logger.Info("validator settings changed: ", v.settings())
+}
+
+// cycle settings and difficulty served to the provers
+func (v *Validator) Settings() client.SettingInfo {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.settings()
+}
+
+func (v *Validator) settings() client.SettingInfo {
+	return client.SettingInfo{
+		Last:            v.cfg.Last,
+		PrepareInterval: int64(v.cfg.PrepareInterval.Seconds()),
+		ProverInterval:  int64(v.cfg.ProveInterval.Seconds()),
+		WaitInterval:    int64(v.cfg.WaitInterval.Seconds()),
+		Difficulty:      v.cfg.Difficulty,
+	}
+}
+
+// start of the cycle at t and the seconds into it. The lock is held by the caller.
+func (v *Validator) cycleAt(t time.Time) (int64, int64) {
+	cycle := int64((v.cfg.PrepareInterval + v.cfg.ProveInterval + v.cfg.WaitInterval).Seconds())
+	over := (t.Unix() - v.cfg.Last) % cycle
+	if over < 0 {
+		over += cycle
+	}
+	return t.Unix() - over, over
+}
+
+// rnd of the current cycle and its start
+func (v *Validator) Rnd() ([32]byte, int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	start, _ := v.cycleAt(v.cfg.Now())
+	return v.rndOf(start), start
+}
+
+// rnd of the cycle starting at start, it's made at the first read. The lock is held by the caller.
+func (v *Validator) rndOf(start int64) [32]byte {
+	if rnd, ok := v.rnds[start]; ok {
+		return rnd
+	}
+
+	var rnd [32]byte
+	if _, err := rand.Read(rnd[:]); err != nil {
+		panic(fmt.Sprintf("read random failed: %s", err))
+	}
+	v.rnds[start] = rnd
+
+	// the proofs are of the current cycle, older rnds are never read
+	for s := range v.rnds {
+		if s < start {
+			delete(v.rnds, s)
+		}
+	}
+
+	logger.Debug("new rnd of cycle ", start)
+	return rnd
+}
+
+// verify the proof of a node in the prove window of the current cycle, the result is recorded.
+// The proofs not signed by the provider in time, or replayed, are rejected without a record.
+func (v *Validator) Verify(p types.SignedProof) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := v.cfg.Now()
+	start, over := v.cycleAt(now)
+	prepare := int64(v.cfg.PrepareInterval.Seconds())
+	prove := int64(v.cfg.ProveInterval.Seconds())
+
+	if d := now.Sub(time.Unix(p.Ts, 0)); d > v.cfg.MaxSkew || d < -v.cfg.MaxSkew {
+		return ErrExpired
+	}
+	hash := p.SignHash(p.Rnd, p.Ts)
+	if !signedBy(hash, p.Sig, p.Address) {
+		return ErrInvalidSig
+	}
+
+	h, ok := v.history[nodeKey(p.NodeID)]
+	if !ok {
+		h = new(History)
+		v.history[nodeKey(p.NodeID)] = h
+	}
+	if n := len(h.Records); n > 0 && h.Records[n-1].Cycle == start && h.Records[n-1].Success {
+		return ErrProved
+	}
+
+	if err := v.use(hex.EncodeToString(hash), p.Ts, now); err != nil {
+		return err
+	}
+
+	rnd := v.rndOf(start)
+
+	var err error
+	switch {
+	case over < prepare || over > prepare+prove:
+		err = ErrOutOfWindow
+	case p.Rnd != rnd:
+		err = ErrWrongRnd
+	case !pow.Verify(p.NodeID, rnd[:], v.cfg.Difficulty, p.Nonce):
+		err = ErrInvalidPOW
+	}
+
+	r := Record{Cycle: start, Nonce: p.Nonce, Success: err == nil, Time: now.Unix()}
+	if err != nil {
+		r.Reason = err.Error()
+		h.Fail++
+	} else {
+		h.Success++
+	}
+	h.Records = append(h.Records, r)
+	if len(h.Records) > v.cfg.KeepHistory {
+		h.Records = h.Records[len(h.Records)-v.cfg.KeepHistory:]
+	}
+
+	return err
+}
+
+// check the signature on hash is of the address
+func signedBy(hash, sig []byte, address string) bool {
+	if len(sig) != crypto.SignatureLength || !common.IsHexAddress(address) {
+		return false
+	}
+	// the wallets sign with v in 27 or 28
+	sig = append([]byte(nil), sig...)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+
+	pub, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return false
+	}
+	return crypto.PubkeyToAddress(*pub) == common.HexToAddress(address)
+}
+
+// record a signed message, reject it if used. The lock is held by the caller.
+func (v *Validator) use(msgHash string, signed int64, now time.Time) error {
+	// the expired ones are rejected before
+	for k, ts := range v.used {
+		if d := now.Sub(time.Unix(ts, 0)); d > v.cfg.MaxSkew {
+			delete(v.used, k)
+		}
+	}
+
+	if _, ok := v.used[msgHash]; ok {
+		return ErrReplay
+	}
+	v.used[msgHash] = signed
+
+	return nil
+}
+
+// proof results of a node
+func (v *Validator) History(n types.NodeID) History {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	h, ok := v.history[nodeKey(n)]
+	if !ok {
+		return History{}
+	}
+	res := *h
+	res.Records = append([]Record(nil), h.Records...)
+	return res
+}
+
+// set the order count of a provider
+func (v *Validator) SetOrderCount(provider string, n int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.orders[providerKey(provider)] = n
+}
+
+// order count of a provider
+func (v *Validator) OrderCount(provider string) int64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	n, ok := v.orders[providerKey(provider)]
+	if !ok {
+		return v.cfg.DefaultOrders
+	}
+	return n
+}
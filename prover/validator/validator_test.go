@@ -0,0 +1,271 @@
+package validator
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gridprotocol/computing-api/prover/client"
+	"github.com/gridprotocol/computing-api/prover/pow"
+	"github.com/gridprotocol/computing-api/prover/types"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	node   = types.NodeID{Address: crypto.PubkeyToAddress(key.PublicKey).Hex(), ID: 1}
+)
+
+// validator of 10s cycles, 2s prepare, 3s prove and 5s wait, on a clock set by the test
+func newValidator(now *time.Time) *Validator {
+	return New(Config{
+		PrepareInterval: 2 * time.Second,
+		ProveInterval:   3 * time.Second,
+		WaitInterval:    5 * time.Second,
+		Difficulty:      8,
+		Now:             func() time.Time { return *now },
+	})
+}
+
+func solve(t *testing.T, v *Validator, n types.NodeID) int64 {
+	rnd, _ := v.Rnd()
+	nonce, err := pow.Search(context.Background(), pow.Prefix(n, rnd[:]), v.Config().Difficulty, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nonce
+}
+
+// sign the proof of the current rnd at now
+func sign(v *Validator, p types.Proof) types.SignedProof {
+	rnd, _ := v.Rnd()
+	return signAt(v, p, rnd, v.Config().Now().Unix(), key)
+}
+
+func signAt(v *Validator, p types.Proof, rnd [32]byte, ts int64, sk *ecdsa.PrivateKey) types.SignedProof {
+	sp := types.SignedProof{Proof: p, Rnd: rnd, Ts: ts}
+	sp.Sig, _ = crypto.Sign(sp.SignHash(rnd, ts), sk)
+	return sp
+}
+
+func TestCycle(t *testing.T) {
+	now := time.Unix(1000, 0)
+	v := newValidator(&now)
+
+	rnd, start := v.Rnd()
+	if start != 1000 {
+		t.Fatalf("unexpected cycle start %d", start)
+	}
+
+	// the same rnd in a cycle
+	now = now.Add(9 * time.Second)
+	if r, _ := v.Rnd(); r != rnd {
+		t.Fatal("rnd changed in a cycle")
+	}
+
+	// a new one in the next
+	now = now.Add(time.Second)
+	r, s := v.Rnd()
+	if r == rnd || s != 1010 {
+		t.Fatalf("expected a new rnd of cycle 1010, got cycle %d", s)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1000, 0)
+	v := newValidator(&now)
+	v.Rnd()
+
+	// too early
+	nonce := solve(t, v, node)
+	if err := v.Verify(sign(v, types.Proof{NodeID: node, Nonce: nonce})); !errors.Is(err, ErrOutOfWindow) {
+		t.Fatalf("expected out of window, got %v", err)
+	}
+
+	// a wrong nonce in the window
+	now = now.Add(3 * time.Second)
+	bad := nonce + 1
+	for pow.Verify(node, func() []byte { r, _ := v.Rnd(); return r[:] }(), 8, bad) {
+		bad++
+	}
+	if err := v.Verify(sign(v, types.Proof{NodeID: node, Nonce: bad})); !errors.Is(err, ErrInvalidPOW) {
+		t.Fatalf("expected invalid pow, got %v", err)
+	}
+
+	if err := v.Verify(sign(v, types.Proof{NodeID: node, Nonce: nonce})); err != nil {
+		t.Fatal(err)
+	}
+	// once a cycle
+	if err := v.Verify(sign(v, types.Proof{NodeID: node, Nonce: nonce})); !errors.Is(err, ErrProved) {
+		t.Fatalf("expected proved, got %v", err)
+	}
+
+	// the nonce of the last cycle is late
+	now = now.Add(10 * time.Second)
+	if err := v.Verify(sign(v, types.Proof{NodeID: node, Nonce: nonce})); err == nil {
+		t.Fatal("nonce of the last cycle should be rejected")
+	}
+
+	h := v.History(types.NodeID{Address: "0x" + strings.ToUpper(node.Address[2:]), ID: 1})
+	if h.Success != 1 || h.Fail != 3 || len(h.Records) != 4 {
+		t.Fatalf("unexpected history %+v", h)
+	}
+	if h.Records[2].Cycle != 1000 || !h.Records[2].Success {
+		t.Fatalf("unexpected record %+v", h.Records[2])
+	}
+}
+
+func TestServer(t *testing.T) {
+	now := time.Unix(1003, 0)
+	v := newValidator(&now)
+	srv := httptest.NewServer(v.Handler())
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := client.NewClient(srv.URL)
+
+	v.SetOrderCount(node.Address, 2)
+	if cnt, err := c.GetV1OrderCount(ctx, node.Address); err != nil || cnt != 2 {
+		t.Fatalf("unexpected order count %d %v", cnt, err)
+	}
+	if cnt, err := c.GetV1OrderCount(ctx, "0x0000000000000000000000000000000000000001"); err != nil || cnt != 0 {
+		t.Fatalf("unexpected order count %d %v", cnt, err)
+	}
+
+	rnd, err := c.GetRND(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := v.Rnd(); r != rnd {
+		t.Fatalf("unexpected rnd %s", hex.EncodeToString(rnd[:]))
+	}
+
+	nonce := solve(t, v, node)
+	sp := sign(v, types.Proof{NodeID: node, Nonce: nonce})
+	if err := c.SubmitProof(ctx, sp); err != nil {
+		t.Fatal(err)
+	}
+
+	// submitted twice
+	body, _ := json.Marshal(map[string]interface{}{
+		"address": node.Address, "id": node.ID, "nonce": nonce,
+		"rnd": hex.EncodeToString(sp.Rnd[:]), "ts": sp.Ts, "sig": hexutil.Encode(sp.Sig),
+	})
+	res, err := http.Post(srv.URL+"/v1/proof", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusConflict {
+		t.Fatalf("expected conflict, got %d", res.StatusCode)
+	}
+
+	res, err = http.Get(fmt.Sprintf("%s/v1/provider/%s/node/%d/history", srv.URL, node.Address, node.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var h History
+	if err := json.NewDecoder(res.Body).Decode(&h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Success != 1 || len(h.Records) != 1 || h.Records[0].Nonce != nonce {
+		t.Fatalf("unexpected history %+v", h)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	now := time.Unix(1003, 0)
+	v := newValidator(&now)
+	srv := httptest.NewServer(v.Handler())
+	defer srv.Close()
+
+	c := client.NewClient(srv.URL)
+	info, err := c.GetV1SettingInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info != (client.SettingInfo{PrepareInterval: 2, ProverInterval: 3, WaitInterval: 5, Difficulty: 8}) {
+		t.Fatalf("unexpected settings %+v", info)
+	}
+
+	// the clock is kept and cycles are aligned to the new last
+	v.SetConfig(Config{Last: 1005, PrepareInterval: time.Second, ProveInterval: time.Second, WaitInterval: time.Second, Difficulty: 9})
+	info, err = c.GetV1SettingInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Last != 1005 || info.Difficulty != 9 || info.ProverInterval != 1 {
+		t.Fatalf("unexpected settings %+v", info)
+	}
+	if _, start := v.Rnd(); start != 1002 {
+		t.Fatalf("unexpected cycle start %d", start)
+	}
+}
+
+func TestSignature(t *testing.T) {
+	now := time.Unix(1003, 0)
+	v := newValidator(&now)
+	nonce := solve(t, v, node)
+	rnd, _ := v.Rnd()
+	p := types.Proof{NodeID: node, Nonce: nonce}
+
+	// not signed by the provider
+	other, _ := crypto.GenerateKey()
+	if err := v.Verify(signAt(v, p, rnd, now.Unix(), other)); !errors.Is(err, ErrInvalidSig) {
+		t.Fatalf("expected invalid signature, got %v", err)
+	}
+	sp := sign(v, p)
+	sp.Nonce++
+	if err := v.Verify(sp); !errors.Is(err, ErrInvalidSig) {
+		t.Fatalf("expected invalid signature of a changed proof, got %v", err)
+	}
+
+	// signed long ago or in the future
+	for _, ts := range []int64{now.Unix() - 31, now.Unix() + 31} {
+		if err := v.Verify(signAt(v, p, rnd, ts, key)); !errors.Is(err, ErrExpired) {
+			t.Fatalf("expected expired, got %v", err)
+		}
+	}
+
+	// the rejected ones above are not of the node
+	if h := v.History(node); len(h.Records) != 0 {
+		t.Fatalf("unexpected history %+v", h)
+	}
+
+	// a proof of another rnd
+	if err := v.Verify(signAt(v, p, [32]byte{1}, now.Unix(), key)); !errors.Is(err, ErrWrongRnd) {
+		t.Fatalf("expected wrong rnd, got %v", err)
+	}
+
+	// a failed proof replayed
+	bad := types.Proof{NodeID: node, Nonce: nonce + 1}
+	for pow.Verify(node, rnd[:], 8, bad.Nonce) {
+		bad.Nonce++
+	}
+	sp = sign(v, bad)
+	if err := v.Verify(sp); !errors.Is(err, ErrInvalidPOW) {
+		t.Fatalf("expected invalid pow, got %v", err)
+	}
+	if err := v.Verify(sp); !errors.Is(err, ErrReplay) {
+		t.Fatalf("expected replay, got %v", err)
+	}
+
+	if err := v.Verify(sign(v, p)); err != nil {
+		t.Fatal(err)
+	}
+	if h := v.History(node); h.Success != 1 || h.Fail != 2 {
+		t.Fatalf("unexpected history %+v", h)
+	}
+}
@@ -0,0 +1,383 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/grid/contracts/go/credit"
+	"github.com/grid/contracts/go/market"
+	"github.com/gridprotocol/computing-api/computing/gateway/chainerr"
+	"github.com/gridprotocol/computing-api/computing/gateway/txmgr"
+	"github.com/gridprotocol/computing-api/keystore"
+)
+
+// market methods used by the user, implemented by the market binding
+type marketContract interface {
+	GetOrder(opts *bind.CallOpts, id uint64) (market.IMarketOrder, error)
+	CreateOrder(opts *bind.TransactOpts, provider common.Address, nodeId uint64, probation uint64, duration uint64) (*types.Transaction, error)
+	Activate(opts *bind.TransactOpts, id uint64) (*types.Transaction, error)
+	UserCancel(opts *bind.TransactOpts, id uint64) (*types.Transaction, error)
+	UserSettle(opts *bind.TransactOpts, id uint64) (*types.Transaction, error)
+	Deposit(opts *bind.TransactOpts, amount *big.Int) (*types.Transaction, error)
+	ParseCreateOrder(log types.Log) (*market.MarketCreateOrder, error)
+}
+
+// credit token methods used by the user, implemented by the credit binding
+type creditContract interface {
+	Approve(opts *bind.TransactOpts, spender common.Address, value *big.Int) (*types.Transaction, error)
+	Allowance(opts *bind.CallOpts, owner common.Address, spender common.Address) (*big.Int, error)
+	BalanceOf(opts *bind.CallOpts, account common.Address) (*big.Int, error)
+}
+
+// set the secret key of the user for sending transactions
+func (cp *ChainProcessor) SetKey(sk string) error {
+	if _, err := crypto.HexToECDSA(sk); err != nil {
+		return fmt.Errorf("invalid secret key: %s", err.Error())
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.sk = sk
+	return nil
+}
+
+// set the margin percent of the gas limit over the estimated gas, 0 for the default of txmgr
+func (cp *ChainProcessor) SetGasMargin(percent uint64) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.gasMargin = percent
+}
+
+// load the secret key of a wallet from the keystore
+func (cp *ChainProcessor) UseWallet(repoPath string, wallet string, pw []byte) error {
+	ks, err := keystore.NewKeyStore(repoPath)
+	if err != nil {
+		return err
+	}
+
+	ki, err := ks.Get(wallet, pw)
+	if err != nil {
+		return fmt.Errorf("get key info from wallet failed: %s", err.Error())
+	}
+
+	return cp.SetKey(ki.SK())
+}
+
+// address of the user
+func (cp *ChainProcessor) Address() (common.Address, error) {
+	cp.mu.Lock()
+	sk := cp.sk
+	cp.mu.Unlock()
+
+	if sk == "" {
+		return common.Address{}, fmt.Errorf("no key is set for sending transactions")
+	}
+
+	privateKey, err := crypto.HexToECDSA(sk)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	return crypto.PubkeyToAddress(privateKey.PublicKey), nil
+}
+
+// create an order for a node, fund the market with enough credit for it and activate it, return the order id
+func (cp *ChainProcessor) CreateLease(provider string, nodeID uint64, prob uint64, dur uint64) (uint64, error) {
+	ctx := context.Background()
+
+	// calc the order fee with the node price
+	fee, err := cp.Fee(ctx, provider, nodeID, dur)
+	if err != nil {
+		return 0, err
+	}
+	logger.Debug("order fee:", fee)
+
+	if _, err := cp.Fund(ctx, fee); err != nil {
+		return 0, err
+	}
+
+	id, _, err := cp.CreateOrder(ctx, common.HexToAddress(provider), nodeID, prob, dur)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := cp.Activate(ctx, id); err != nil {
+		return id, err
+	}
+
+	return id, nil
+}
+
+// get an order
+func (cp *ChainProcessor) ShowLease(id uint64) (*market.IMarketOrder, error) {
+	return cp.GetOrder(context.Background(), id)
+}
+
+// cancel an order
+func (cp *ChainProcessor) StopLease(id uint64) error {
+	_, err := cp.Cancel(context.Background(), id)
+	return err
+}
+
+// calc the fee of an order with the node price in the provider list
+func (cp *ChainProcessor) Fee(ctx context.Context, provider string, nodeID uint64, dur uint64) (*big.Int, error) {
+	p, ok := cp.CurrentList.Get(common.HexToAddress(provider).Hex())
+	if !ok {
+		// provider may be registered after last refresh
+		if err := cp.CurrentList.Refresh(ctx, cp); err != nil {
+			return nil, err
+		}
+		p, ok = cp.CurrentList.Get(common.HexToAddress(provider).Hex())
+		if !ok {
+			return nil, fmt.Errorf("provider not found in registry: %s", provider)
+		}
+	}
+
+	for _, n := range p.Nodes {
+		if n.ID == nodeID {
+			return new(big.Int).Mul(n.PriceSec(), new(big.Int).SetUint64(dur)), nil
+		}
+	}
+
+	return nil, fmt.Errorf("node %d not found for provider %s", nodeID, provider)
+}
+
+// approve the market to spend the credit of user if allowance is not enough,
+// and deposit the amount into the market, return the receipt of the deposit
+func (cp *ChainProcessor) Fund(ctx context.Context, amount *big.Int) (*types.Receipt, error) {
+	user, err := cp.Address()
+	if err != nil {
+		return nil, err
+	}
+
+	creditIns, err := cp.getCredit()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &bind.CallOpts{Context: ctx}
+
+	balance, err := creditIns.BalanceOf(opts, user)
+	if err != nil {
+		return nil, fmt.Errorf("get credit balance failed: %s", err.Error())
+	}
+	if balance.Cmp(amount) < 0 {
+		return nil, fmt.Errorf("insufficient credit, balance: %s, need: %s", balance, amount)
+	}
+
+	allowance, err := creditIns.Allowance(opts, user, cp.contracts.Market)
+	if err != nil {
+		return nil, fmt.Errorf("get credit allowance failed: %s", err.Error())
+	}
+	if allowance.Cmp(amount) >= 0 {
+		logger.Debug("allowance is enough:", allowance)
+	} else {
+		logger.Debug("user approve credit for market")
+		_, err := cp.transact(ctx, "approve", func(auth *bind.TransactOpts) (*types.Transaction, error) {
+			return creditIns.Approve(auth, cp.contracts.Market, amount)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	marketIns, err := cp.getMarket()
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("user deposit credit into market")
+	return cp.transact(ctx, "deposit", func(auth *bind.TransactOpts) (*types.Transaction, error) {
+		return marketIns.Deposit(auth, amount)
+	})
+}
+
+// create an order, return the order id parsed from the receipt
+func (cp *ChainProcessor) CreateOrder(ctx context.Context, provider common.Address, nodeID uint64, prob uint64, dur uint64) (uint64, *types.Receipt, error) {
+	marketIns, err := cp.getMarket()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	logger.Debug("user create an order")
+	receipt, err := cp.transact(ctx, "create order", func(auth *bind.TransactOpts) (*types.Transaction, error) {
+		return marketIns.CreateOrder(auth, provider, nodeID, prob, dur)
+	})
+	if err != nil {
+		return 0, receipt, err
+	}
+
+	// find the order id in the event
+	for _, l := range receipt.Logs {
+		if l == nil || l.Address != cp.contracts.Market {
+			continue
+		}
+		ev, err := marketIns.ParseCreateOrder(*l)
+		if err != nil {
+			continue
+		}
+		logger.Debug("order created:", ev.Id)
+		return ev.Id, receipt, nil
+	}
+
+	return 0, receipt, fmt.Errorf("no create order event found in tx %s", receipt.TxHash)
+}
+
+// activate an order
+func (cp *ChainProcessor) Activate(ctx context.Context, id uint64) (*types.Receipt, error) {
+	marketIns, err := cp.getMarket()
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("user activate an order")
+	return cp.transact(ctx, "activate", func(auth *bind.TransactOpts) (*types.Transaction, error) {
+		return marketIns.Activate(auth, id)
+	})
+}
+
+// cancel an order
+func (cp *ChainProcessor) Cancel(ctx context.Context, id uint64) (*types.Receipt, error) {
+	marketIns, err := cp.getMarket()
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("user cancel an order")
+	return cp.transact(ctx, "cancel", func(auth *bind.TransactOpts) (*types.Transaction, error) {
+		return marketIns.UserCancel(auth, id)
+	})
+}
+
+// user settle an order
+func (cp *ChainProcessor) Settle(ctx context.Context, id uint64) (*types.Receipt, error) {
+	marketIns, err := cp.getMarket()
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("user settle an order")
+	return cp.transact(ctx, "settle", func(auth *bind.TransactOpts) (*types.Transaction, error) {
+		return marketIns.UserSettle(auth, id)
+	})
+}
+
+// get an order
+func (cp *ChainProcessor) GetOrder(ctx context.Context, id uint64) (*market.IMarketOrder, error) {
+	marketIns, err := cp.getMarket()
+	if err != nil {
+		return nil, err
+	}
+
+	orderInfo, err := marketIns.GetOrder(&bind.CallOpts{Context: ctx}, id)
+	if err != nil {
+		return nil, fmt.Errorf("getorder failed: %w", chainerr.Decode(err))
+	}
+
+	return &orderInfo, nil
+}
+
+// sign and send a transaction with estimated gas, and wait for its receipt
+func (cp *ChainProcessor) transact(ctx context.Context, name string, send func(*bind.TransactOpts) (*types.Transaction, error)) (*types.Receipt, error) {
+	auth, err := cp.makeAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// dry run to estimate gas and fill the nonce and fee
+	auth.NoSend = true
+	tx, err := send(auth)
+	if err != nil {
+		return nil, fmt.Errorf("estimate gas for %s failed: %w", name, chainerr.Decode(err))
+	}
+
+	cp.mu.Lock()
+	margin := cp.gasMargin
+	cp.mu.Unlock()
+
+	auth.NoSend = false
+	auth.GasLimit = txmgr.GasLimit(tx.Gas(), margin)
+	tx, err = send(auth)
+	if err != nil {
+		return nil, fmt.Errorf("send %s tx failed: %w", name, chainerr.Decode(err))
+	}
+
+	logger.Debug("waiting for tx to be ok:", tx.Hash())
+	receipt, err := bind.WaitMined(ctx, cp.getBackend(), tx)
+	if err != nil {
+		return nil, fmt.Errorf("wait %s tx failed: %s", name, err.Error())
+	}
+	logger.Debugf("%s gas used: %d", name, receipt.GasUsed)
+
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return receipt, fmt.Errorf("%s tx %s reverted", name, tx.Hash())
+	}
+
+	return receipt, nil
+}
+
+// make auth for sending transaction with the user key
+func (cp *ChainProcessor) makeAuth(ctx context.Context) (*bind.TransactOpts, error) {
+	cp.mu.Lock()
+	sk := cp.sk
+	cp.mu.Unlock()
+
+	if sk == "" {
+		return nil, fmt.Errorf("no key is set for sending transactions")
+	}
+
+	privateKey, err := crypto.HexToECDSA(sk)
+	if err != nil {
+		return nil, err
+	}
+
+	chainID, err := cp.getBackend().ChainID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get chain id failed: %s", err.Error())
+	}
+
+	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, chainID)
+	if err != nil {
+		return nil, err
+	}
+	auth.Context = ctx
+
+	return auth, nil
+}
+
+// get market contract instance
+func (cp *ChainProcessor) getMarket() (marketContract, error) {
+	backend := cp.getBackend()
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.market == nil {
+		marketIns, err := market.NewMarket(cp.contracts.Market, backend)
+		if err != nil {
+			return nil, fmt.Errorf("new contract instance failed: %s", err.Error())
+		}
+		cp.market = marketIns
+	}
+	return cp.market, nil
+}
+
+// get credit contract instance
+func (cp *ChainProcessor) getCredit() (creditContract, error) {
+	backend := cp.getBackend()
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.credit == nil {
+		creditIns, err := credit.NewCredit(cp.contracts.Credit, backend)
+		if err != nil {
+			return nil, fmt.Errorf("new contract instance failed: %s", err.Error())
+		}
+		cp.credit = creditIns
+	}
+	return cp.credit, nil
+}
@@ -0,0 +1,321 @@
+package chain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/grid/contracts/go/market"
+	"github.com/gridprotocol/computing-api/computing/gateway/chainerr"
+	"github.com/gridprotocol/computing-api/keystore"
+	"github.com/gridprotocol/computing-api/user/backend/provider"
+)
+
+const (
+	// runtime: log the calldata, init: return the runtime
+	logCode = "600b600c600039600b6000f3" + "366000600037366000a000"
+	// runtime: revert
+	revertCode = "6005600c60003960056000f3" + "60006000fd"
+)
+
+// fake market sends every call to a contract logging the calldata,
+// and keeps the order state in memory once the tx is sent.
+type fakeMarket struct {
+	backend bind.ContractBackend
+	logAddr common.Address
+	revAddr common.Address
+
+	mu     sync.Mutex
+	nextID uint64
+	orders map[uint64]*market.IMarketOrder
+	// order id created by a tx
+	created map[common.Hash]uint64
+	// credit deposited by the user
+	deposit *big.Int
+}
+
+func (fm *fakeMarket) send(opts *bind.TransactOpts, to common.Address, method string, id uint64) (*types.Transaction, error) {
+	data := append([]byte(method), make([]byte, 8)...)
+	binary.BigEndian.PutUint64(data[len(method):], id)
+	return bind.NewBoundContract(to, abi.ABI{}, fm.backend, fm.backend, fm.backend).RawTransact(opts, data)
+}
+
+// get the order in given status, or revert
+func (fm *fakeMarket) target(id uint64, status uint8) common.Address {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	o, ok := fm.orders[id]
+	if !ok || o.Status != status {
+		return fm.revAddr
+	}
+	return fm.logAddr
+}
+
+func (fm *fakeMarket) setStatus(opts *bind.TransactOpts, id uint64, status uint8) {
+	if opts.NoSend {
+		return
+	}
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	fm.orders[id].Status = status
+}
+
+func (fm *fakeMarket) GetOrder(opts *bind.CallOpts, id uint64) (market.IMarketOrder, error) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	o, ok := fm.orders[id]
+	if !ok {
+		return market.IMarketOrder{}, nil
+	}
+	return *o, nil
+}
+
+func (fm *fakeMarket) CreateOrder(opts *bind.TransactOpts, p common.Address, nodeId uint64, prob uint64, dur uint64) (*types.Transaction, error) {
+	tx, err := fm.send(opts, fm.logAddr, "createOrder", nodeId)
+	if err != nil || opts.NoSend {
+		return tx, err
+	}
+
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	fm.nextID++
+	fm.orders[fm.nextID] = &market.IMarketOrder{
+		User:      opts.From,
+		Provider:  p,
+		NodeId:    nodeId,
+		Status:    1,
+		Probation: new(big.Int).SetUint64(prob),
+		Duration:  new(big.Int).SetUint64(dur),
+	}
+	fm.created[tx.Hash()] = fm.nextID
+	return tx, nil
+}
+
+func (fm *fakeMarket) Activate(opts *bind.TransactOpts, id uint64) (*types.Transaction, error) {
+	tx, err := fm.send(opts, fm.target(id, 1), "activate", id)
+	if err == nil {
+		fm.setStatus(opts, id, 2)
+	}
+	return tx, err
+}
+
+func (fm *fakeMarket) UserCancel(opts *bind.TransactOpts, id uint64) (*types.Transaction, error) {
+	tx, err := fm.send(opts, fm.target(id, 2), "userCancel", id)
+	if err == nil {
+		fm.setStatus(opts, id, 3)
+	}
+	return tx, err
+}
+
+func (fm *fakeMarket) UserSettle(opts *bind.TransactOpts, id uint64) (*types.Transaction, error) {
+	return fm.send(opts, fm.target(id, 2), "userSettle", id)
+}
+
+func (fm *fakeMarket) Deposit(opts *bind.TransactOpts, amount *big.Int) (*types.Transaction, error) {
+	tx, err := fm.send(opts, fm.logAddr, "deposit", amount.Uint64())
+	if err == nil && !opts.NoSend {
+		fm.mu.Lock()
+		fm.deposit = new(big.Int).Add(fm.deposit, amount)
+		fm.mu.Unlock()
+	}
+	return tx, err
+}
+
+func (fm *fakeMarket) ParseCreateOrder(l types.Log) (*market.MarketCreateOrder, error) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	id, ok := fm.created[l.TxHash]
+	if !ok {
+		return nil, fmt.Errorf("not a create order event")
+	}
+	return &market.MarketCreateOrder{Id: id, Raw: l}, nil
+}
+
+type fakeCredit struct {
+	fm *fakeMarket
+
+	mu        sync.Mutex
+	balance   *big.Int
+	allowance *big.Int
+}
+
+func (fc *fakeCredit) Approve(opts *bind.TransactOpts, spender common.Address, value *big.Int) (*types.Transaction, error) {
+	tx, err := fc.fm.send(opts, fc.fm.logAddr, "approve", value.Uint64())
+	if err == nil && !opts.NoSend {
+		fc.mu.Lock()
+		fc.allowance = value
+		fc.mu.Unlock()
+	}
+	return tx, err
+}
+
+func (fc *fakeCredit) Allowance(opts *bind.CallOpts, owner common.Address, spender common.Address) (*big.Int, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.allowance, nil
+}
+
+func (fc *fakeCredit) BalanceOf(opts *bind.CallOpts, account common.Address) (*big.Int, error) {
+	return fc.balance, nil
+}
+
+// deploy raw code on the simulated chain
+func deploy(t *testing.T, sim *simulated.Backend, key *ecdsa.PrivateKey, code string) common.Address {
+	auth, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(1337))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, _, _, err := bind.DeployContract(auth, abi.ABI{}, common.FromHex(code), sim.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.Commit()
+	return addr
+}
+
+func TestLeaseLifecycle(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	user := crypto.PubkeyToAddress(key.PublicKey)
+	sim := simulated.NewBackend(types.GenesisAlloc{
+		user: {Balance: new(big.Int).Mul(big.NewInt(1e18), big.NewInt(100))},
+	})
+	defer sim.Close()
+
+	fm := &fakeMarket{
+		backend: sim.Client(),
+		logAddr: deploy(t, sim, key, logCode),
+		revAddr: deploy(t, sim, key, revertCode),
+		orders:  make(map[uint64]*market.IMarketOrder),
+		created: make(map[common.Hash]uint64),
+		deposit: new(big.Int),
+	}
+	fc := &fakeCredit{fm: fm, balance: big.NewInt(1e9), allowance: big.NewInt(0)}
+
+	// mine blocks in background
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+				sim.Commit()
+			}
+		}
+	}()
+
+	pro := "0x1111111111111111111111111111111111111111"
+	cp := NewChainProcessor("", Contracts{Market: fm.logAddr})
+	cp.SetBackend(sim.Client())
+	cp.market = fm
+	cp.credit = fc
+	cp.CurrentList.Set([]provider.Provider{{
+		Address: common.HexToAddress(pro).Hex(),
+		Nodes: []provider.Node{{
+			ID:  1,
+			Cpu: provider.Resource{Num: 1, PriceSec: big.NewInt(10)},
+		}},
+	}})
+
+	// no key
+	if _, err := cp.CreateLease(pro, 1, 60, 3600); err == nil {
+		t.Fatal("expected error without key")
+	}
+	if err := cp.SetKey(common.Bytes2Hex(crypto.FromECDSA(key))); err != nil {
+		t.Fatal(err)
+	}
+
+	// unknown node
+	if _, err := cp.CreateLease(pro, 2, 60, 3600); err == nil {
+		t.Fatal("expected error for unknown node")
+	}
+
+	id, err := cp.CreateLease(pro, 1, 60, 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fc.allowance.Cmp(big.NewInt(36000)) != 0 {
+		t.Fatalf("expected allowance 36000, got %s", fc.allowance)
+	}
+	if fm.deposit.Cmp(big.NewInt(36000)) != 0 {
+		t.Fatalf("expected deposit 36000, got %s", fm.deposit)
+	}
+
+	order, err := cp.ShowLease(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != 2 || order.User != user {
+		t.Fatalf("unexpected order: %+v", order)
+	}
+
+	receipt, err := cp.Settle(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful || receipt.GasUsed == 0 {
+		t.Fatalf("unexpected receipt: %+v", receipt)
+	}
+
+	if err := cp.StopLease(id); err != nil {
+		t.Fatal(err)
+	}
+	order, _ = cp.ShowLease(id)
+	if order.Status != 3 {
+		t.Fatalf("expected cancelled order, got status %d", order.Status)
+	}
+
+	// cancel again is reverted in gas estimation
+	if err := cp.StopLease(id); !errors.Is(err, chainerr.ErrReverted) {
+		t.Fatalf("expected reverted for cancelling a cancelled order, got %v", err)
+	}
+
+	// insufficient credit
+	fc.balance = big.NewInt(1)
+	if _, err := cp.CreateLease(pro, 1, 60, 3600); err == nil {
+		t.Fatal("expected insufficient credit error")
+	}
+}
+
+func TestUseWallet(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := keystore.NewKeyStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ki, err := keystore.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put(ki.Address(), []byte("test"), *ki); err != nil {
+		t.Fatal(err)
+	}
+
+	cp := NewChainProcessor("", Contracts{})
+	if err := cp.UseWallet(dir, ki.Address(), []byte("wrong")); err == nil {
+		t.Fatal("expected error with wrong password")
+	}
+	if err := cp.UseWallet(dir, ki.Address(), []byte("test")); err != nil {
+		t.Fatal(err)
+	}
+	addr, err := cp.Address()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.Hex() != ki.Address() {
+		t.Fatalf("expected address %s, got %s", ki.Address(), addr.Hex())
+	}
+}
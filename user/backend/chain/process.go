@@ -1,29 +1,101 @@
 package chain
 
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/grid/contracts/eth"
+	"github.com/gridprotocol/computing-api/lib/logc"
+	"github.com/gridprotocol/computing-api/user/backend/provider"
+)
+
+var logger = logc.Logger("chain")
+
+// chain access used by the processor, both ethclient and simulated backend implement it
+type Backend interface {
+	bind.ContractBackend
+	bind.DeployBackend
+	ChainID(ctx context.Context) (*big.Int, error)
+}
+
+// addresses of the contracts used by the processor
+type Contracts struct {
+	Market   common.Address
+	Credit   common.Address
+	Registry common.Address
+}
+
 type ChainProcessor struct {
+	// chain endpoint
+	endpoint  string
+	contracts Contracts
+	// timeout for probing the gateway of each provider
+	probeTO time.Duration
+
+	mu      sync.Mutex
+	backend Backend
+	market  marketContract
+	credit  creditContract
+	// user's secret key for sending transactions
+	sk string
+	// gas limit is the estimated gas with this margin percent
+	gasMargin uint64
+
 	// cache list (periodly updating)
-	CurrentList []string
+	CurrentList *provider.List
 }
 
-func NewChainProcessor() *ChainProcessor {
+func NewChainProcessor(endpoint string, contracts Contracts) *ChainProcessor {
 	return &ChainProcessor{
-		CurrentList: nil,
+		endpoint:    endpoint,
+		contracts:   contracts,
+		probeTO:     5 * time.Second,
+		CurrentList: provider.NewList(),
 	}
 }
 
-func (cp *ChainProcessor) FetchList() error {
-	cp.CurrentList = []string{"localhost:12345"}
-	return nil
+// set the timeout for probing gateways, 0 to skip probing
+func (cp *ChainProcessor) SetProbeTimeout(to time.Duration) {
+	cp.probeTO = to
+}
+
+// use a connected backend instead of dialing the endpoint, such as a simulated chain
+func (cp *ChainProcessor) SetBackend(b Backend) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.backend = b
+	cp.market = nil
+	cp.credit = nil
 }
 
-func (cp *ChainProcessor) CreateLease() error {
-	return nil
+// get the backend, connect to the endpoint at first use
+func (cp *ChainProcessor) getBackend() Backend {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.backend == nil {
+		// connect to an eth node with ep
+		backend, chainID := eth.ConnETH(cp.endpoint)
+		logger.Debug("chain id:", chainID)
+		cp.backend = backend
+	}
+	return cp.backend
+}
+
+// read all providers from the registry contract into the cache list
+func (cp *ChainProcessor) FetchList() error {
+	return cp.CurrentList.Refresh(context.Background(), cp)
 }
 
-func (cp *ChainProcessor) ShowLease() error {
-	return nil
+// refresh the cache list every interval in background until ctx is done
+func (cp *ChainProcessor) StartRefresh(ctx context.Context, interval time.Duration) {
+	go cp.CurrentList.Run(ctx, cp, interval)
 }
 
-func (cp *ChainProcessor) StopLease() error {
-	return nil
+// query the nodes in cache, sorted by price
+func (cp *ChainProcessor) Query(f provider.Filter) []provider.Entry {
+	return cp.CurrentList.Query(f)
 }
@@ -0,0 +1,80 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/grid/contracts/go/registry"
+	"github.com/gridprotocol/computing-api/user/backend/provider"
+)
+
+// read all providers and their nodes from the registry contract
+func (cp *ChainProcessor) FetchProviders(ctx context.Context) ([]provider.Provider, error) {
+	// get contract instance
+	regIns, err := registry.NewRegistry(cp.contracts.Registry, cp.getBackend())
+	if err != nil {
+		return nil, fmt.Errorf("new contract instance failed: %s", err.Error())
+	}
+
+	opts := &bind.CallOpts{Context: ctx}
+
+	// all provider addresses
+	addrs, err := regIns.GetAllProviders(opts)
+	if err != nil {
+		return nil, fmt.Errorf("get all providers failed: %s", err.Error())
+	}
+	logger.Debug("provider count:", len(addrs))
+
+	providers := make([]provider.Provider, 0, len(addrs))
+	for _, addr := range addrs {
+		info, err := regIns.GetProvider(opts, addr)
+		if err != nil {
+			return nil, fmt.Errorf("get provider %s failed: %s", addr, err.Error())
+		}
+
+		// node id starts from 1
+		cnt, err := regIns.GetNodeCount(opts, addr)
+		if err != nil {
+			return nil, fmt.Errorf("get node count of %s failed: %s", addr, err.Error())
+		}
+
+		nodes := make([]provider.Node, 0, cnt)
+		for id := uint64(1); id <= cnt; id++ {
+			n, err := regIns.GetNode(opts, addr, id)
+			if err != nil {
+				return nil, fmt.Errorf("get node %d of %s failed: %s", id, addr, err.Error())
+			}
+
+			nodes = append(nodes, provider.Node{
+				ID:   id,
+				Cpu:  provider.Resource{Num: n.Cpu.Num, PriceSec: n.Cpu.PriceSec},
+				Gpu:  provider.Resource{Num: n.Gpu.Num, PriceSec: n.Gpu.PriceSec},
+				Mem:  provider.Resource{Num: n.Mem.Num, PriceSec: n.Mem.PriceSec},
+				Disk: provider.Resource{Num: n.Disk.Num, PriceSec: n.Disk.PriceSec},
+			})
+		}
+
+		providers = append(providers, provider.Provider{
+			Address:  addr.Hex(),
+			Endpoint: fmt.Sprintf("http://%s:%v", info.Ip, info.Port),
+			Nodes:    nodes,
+		})
+	}
+
+	// probe all gateways concurrently
+	if cp.probeTO > 0 {
+		var wg sync.WaitGroup
+		for i := range providers {
+			wg.Add(1)
+			go func(p *provider.Provider) {
+				defer wg.Done()
+				provider.Probe(ctx, p, cp.probeTO)
+			}(&providers[i])
+		}
+		wg.Wait()
+	}
+
+	return providers, nil
+}
@@ -0,0 +1,534 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/gridprotocol/computing-api/computing/model"
+	"github.com/gridprotocol/computing-api/lib/auth"
+	"github.com/gridprotocol/computing-api/lib/utils"
+)
+
+const (
+	// name prefix of the cookie made by the gateway
+	cookiePrefix = "cpuser_"
+)
+
+// Client wraps the http api of a computing gateway for a single user
+type Client struct {
+	baseUrl string
+	hc      *http.Client
+
+	mu      sync.RWMutex
+	session *Session
+}
+
+// client used to communicate with a gateway
+func NewClient(url string) *Client {
+	return &Client{
+		baseUrl: strings.TrimRight(url, "/"),
+		hc:      &http.Client{Timeout: time.Minute},
+	}
+}
+
+// get the gateway url of this client
+func (c *Client) URL() string {
+	return c.baseUrl
+}
+
+// replace the http client used for requests, such as a client with tls or proxy
+func (c *Client) SetHTTPClient(hc *http.Client) {
+	c.hc = hc
+}
+
+// set the timeout for each request
+func (c *Client) SetTimeout(to time.Duration) {
+	c.hc.Timeout = to
+}
+
+// get current session, nil if not signed in
+func (c *Client) Session() *Session {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.session
+}
+
+// set a session kept by the caller, such as a session restored from platform's db
+func (c *Client) SetSession(s *Session) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.session = s
+}
+
+// sign the current timestamp with sk and sign in the gateway
+func (c *Client) SignIn(ctx context.Context, sk string) (*Session, error) {
+	ts := utils.Uint64ToString(uint64(time.Now().Unix()))
+
+	// sign with the hash of the eth enclosed ts
+	hash := auth.Hash([]byte(auth.EncloseEth(ts)))
+	sig, err := auth.Sign(hash, sk)
+	if err != nil {
+		return nil, err
+	}
+	sigStr := "0x" + hex.EncodeToString(sig)
+
+	// recover the user address from signature
+	user := "0x" + hex.EncodeToString(auth.SigToAddress(hash, sig))
+
+	return c.SignInWithSig(ctx, user, ts, sigStr)
+}
+
+// sign in the gateway with a signature made by user's wallet
+func (c *Client) SignInWithSig(ctx context.Context, user, ts, sig string) (*Session, error) {
+	q := url.Values{}
+	q.Set("user", user)
+	q.Set("ts", ts)
+	q.Set("sig", sig)
+
+	res, err := c.get(ctx, "/greet/cookie", q, false)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if err := checkResponse(res); err != nil {
+		return nil, err
+	}
+
+	// find the cookie set by the gateway
+	for _, ck := range res.Cookies() {
+		if !strings.HasPrefix(ck.Name, cookiePrefix) {
+			continue
+		}
+
+		s, err := newSession(ck)
+		if err != nil {
+			return nil, err
+		}
+		c.SetSession(s)
+
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("no cookie found in the response of gateway")
+}
+
+// get the model list supported by the gateway
+func (c *Client) ModelList(ctx context.Context) ([]Model, error) {
+	res, err := c.get(ctx, "/greet/modellist", nil, false)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var result struct {
+		Models []Model `json:"models"`
+	}
+	if err := decodeResponse(res, &result); err != nil {
+		return nil, err
+	}
+
+	return result.Models, nil
+}
+
+// deploy a model in the list of gateway for an order
+func (c *Client) DeployByID(ctx context.Context, oid uint64, id uint64) (*Ack, error) {
+	q := url.Values{}
+	q.Set("oid", utils.Uint64ToString(oid))
+	q.Set("id", utils.Uint64ToString(id))
+
+	return c.ack(ctx, "/greet/deployid", q)
+}
+
+// deploy the app described by a remote yaml for an order
+func (c *Client) DeployByURL(ctx context.Context, oid uint64, yamlUrl string) (*Ack, error) {
+	q := url.Values{}
+	q.Set("oid", utils.Uint64ToString(oid))
+	q.Set("url", yamlUrl)
+
+	return c.ack(ctx, "/greet/deployurl", q)
+}
+
+// show the deployment status of an order
+func (c *Client) Show(ctx context.Context, oid uint64) (*Deployment, error) {
+	q := url.Values{}
+	q.Set("oid", utils.Uint64ToString(oid))
+
+	res, err := c.get(ctx, "/greet/show", q, true)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var d Deployment
+	if err := decodeResponse(res, &d); err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+// clean the app deployed for an order
+func (c *Client) Clean(ctx context.Context, oid uint64) (*Ack, error) {
+	q := url.Values{}
+	q.Set("oid", utils.Uint64ToString(oid))
+
+	return c.ack(ctx, "/greet/clean", q)
+}
+
+// get the unsigned tx for extending an order, dur is in second
+func (c *Client) BuildExtend(ctx context.Context, oid uint64, user string, dur uint64) (*model.UnsignedTx, error) {
+	q := url.Values{}
+	q.Set("oid", utils.Uint64ToString(oid))
+	q.Set("user", user)
+	q.Set("dur", utils.Uint64ToString(dur))
+
+	res, err := c.get(ctx, "/greet/extend", q, false)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var ut model.UnsignedTx
+	if err := decodeResponse(res, &ut); err != nil {
+		return nil, err
+	}
+
+	return &ut, nil
+}
+
+// send the extend tx signed by the user to the gateway
+func (c *Client) SendExtend(ctx context.Context, oid uint64, signedTx []byte) (*TxAck, error) {
+	q := url.Values{}
+	q.Set("oid", utils.Uint64ToString(oid))
+
+	res, err := c.post(ctx, "/greet/extend", q, model.SignedTx{Tx: hexutil.Encode(signedTx)})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var a TxAck
+	if err := decodeResponse(res, &a); err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// get the status of a tx sent by the gateway
+func (c *Client) GetTx(ctx context.Context, hash string) (*TxInfo, error) {
+	res, err := c.get(ctx, "/tx/"+hash, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var ti TxInfo
+	if err := decodeResponse(res, &ti); err != nil {
+		return nil, err
+	}
+
+	return &ti, nil
+}
+
+// poll the status of a tx until it is finished or ctx is done
+func (c *Client) WaitTx(ctx context.Context, hash string, interval time.Duration) (*TxInfo, error) {
+	for {
+		ti, err := c.GetTx(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		if ti.Final() {
+			return ti, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ti, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// bounds of the extend tx built by the gateway, the tx beyond them is never signed
+type ExtendConfig struct {
+	// market contract of the chain, the tx must call it. It's required.
+	Market common.Address
+	// max gas limit of the tx
+	MaxGas uint64
+	// max gas price of the tx in wei, the fee cap of a dynamic fee tx
+	MaxGasPrice *big.Int
+}
+
+func DefaultExtendConfig(market common.Address) ExtendConfig {
+	return ExtendConfig{
+		Market:      market,
+		MaxGas:      300000,
+		MaxGasPrice: big.NewInt(500 * params.GWei),
+	}
+}
+
+// fill the zero fields with the default
+func (c ExtendConfig) withDefault() ExtendConfig {
+	d := DefaultExtendConfig(c.Market)
+	if c.MaxGas == 0 {
+		c.MaxGas = d.MaxGas
+	}
+	if c.MaxGasPrice == nil {
+		c.MaxGasPrice = d.MaxGasPrice
+	}
+	return c
+}
+
+// extend the duration of an order, dur is in second.
+// the tx is signed locally with sk, the key is never sent to the gateway.
+func (c *Client) Extend(ctx context.Context, oid uint64, sk string, dur uint64, cfg ExtendConfig) (*TxAck, error) {
+	key, err := crypto.HexToECDSA(sk)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key: %s", err.Error())
+	}
+	user := crypto.PubkeyToAddress(key.PublicKey)
+
+	ut, err := c.BuildExtend(ctx, oid, user.Hex(), dur)
+	if err != nil {
+		return nil, err
+	}
+
+	signed, err := SignExtend(ut, key, oid, dur, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.SendExtend(ctx, oid, signed)
+}
+
+// check the unsigned tx calls extend on the market with the given order and duration within the gas bounds,
+// and sign it with key
+func SignExtend(ut *model.UnsignedTx, key *ecdsa.PrivateKey, oid uint64, dur uint64, cfg ExtendConfig) ([]byte, error) {
+	cfg = cfg.withDefault()
+	if cfg.Market == (common.Address{}) {
+		return nil, fmt.Errorf("the market address is required to sign the extend tx")
+	}
+
+	raw, err := hexutil.Decode(ut.Tx)
+	if err != nil {
+		return nil, fmt.Errorf("invalid unsigned tx: %s", err.Error())
+	}
+
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("decode unsigned tx failed: %s", err.Error())
+	}
+
+	// never sign a call other than the expected one
+	if tx.To() == nil || *tx.To() != cfg.Market {
+		return nil, fmt.Errorf("the unsigned tx is not calling the market %s", cfg.Market)
+	}
+	if !bytes.Equal(tx.Data(), ExtendCallData(oid, dur)) {
+		return nil, fmt.Errorf("the unsigned tx is not extending order %d with duration %d", oid, dur)
+	}
+	if tx.Value().Sign() != 0 {
+		return nil, fmt.Errorf("the unsigned tx should not carry value")
+	}
+	if tx.Gas() > cfg.MaxGas {
+		return nil, fmt.Errorf("gas limit %d of the unsigned tx exceeds %d", tx.Gas(), cfg.MaxGas)
+	}
+	if tx.GasFeeCap().Cmp(cfg.MaxGasPrice) > 0 {
+		return nil, fmt.Errorf("gas price %s of the unsigned tx exceeds %s", tx.GasFeeCap(), cfg.MaxGasPrice)
+	}
+
+	chainID, ok := new(big.Int).SetString(ut.ChainID, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid chain id: %s", ut.ChainID)
+	}
+
+	signedTx, err := types.SignTx(tx, types.LatestSignerForChainID(chainID), key)
+	if err != nil {
+		return nil, fmt.Errorf("sign tx failed: %s", err.Error())
+	}
+
+	return signedTx.MarshalBinary()
+}
+
+// abi encoded call of extend(uint64,uint64) on the market contract
+func ExtendCallData(oid uint64, dur uint64) []byte {
+	data := make([]byte, 0, 4+64)
+	data = append(data, crypto.Keccak256([]byte("extend(uint64,uint64)"))[:4]...)
+	data = append(data, common.LeftPadBytes(new(big.Int).SetUint64(oid).Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(new(big.Int).SetUint64(dur).Bytes(), 32)...)
+	return data
+}
+
+// send a request to the app deployed for an order through the gateway.
+// the path of req is ignored, the gateway only forwards the root path.
+func (c *Client) Compute(ctx context.Context, oid uint64, req *http.Request) (*http.Response, error) {
+	s, err := c.validSession()
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(c.baseUrl + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	// keep the query of the original request, and append the order id
+	q := req.URL.Query()
+	q.Set("id", utils.Uint64ToString(oid))
+	u.RawQuery = q.Encode()
+
+	r := req.Clone(ctx)
+	r.URL = u
+	r.Host = u.Host
+	r.RequestURI = ""
+	r.AddCookie(s.Cookie)
+
+	return c.hc.Do(r)
+}
+
+// send a request and decode the ack message
+func (c *Client) ack(ctx context.Context, path string, q url.Values) (*Ack, error) {
+	res, err := c.get(ctx, path, q, true)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var a Ack
+	if err := decodeResponse(res, &a); err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// send a post request with a json body to the gateway
+func (c *Client) post(ctx context.Context, path string, q url.Values, body any) (*http.Response, error) {
+	u := c.baseUrl + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.hc.Do(req)
+}
+
+// send a get request to the gateway, with the session cookie if withCookie is set
+func (c *Client) get(ctx context.Context, path string, q url.Values, withCookie bool) (*http.Response, error) {
+	u := c.baseUrl + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if withCookie {
+		s, err := c.validSession()
+		if err != nil {
+			return nil, err
+		}
+		req.AddCookie(s.Cookie)
+	}
+
+	return c.hc.Do(req)
+}
+
+// get the session and check its expire
+func (c *Client) validSession() (*Session, error) {
+	s := c.Session()
+	if s == nil {
+		return nil, ErrNoSession
+	}
+	if s.Expired() {
+		return nil, ErrSessionExpired
+	}
+	return s, nil
+}
+
+// make a session from the cookie, the value of cookie is: expire_sig
+func newSession(ck *http.Cookie) (*Session, error) {
+	parts := strings.SplitN(ck.Value, "_", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("the cookie's value format is invalid")
+	}
+
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expire time in cookie: %s", err.Error())
+	}
+
+	return &Session{
+		User:    ck.Name[len(cookiePrefix):],
+		Cookie:  &http.Cookie{Name: ck.Name, Value: ck.Value},
+		Expires: time.Unix(ts, 0),
+	}, nil
+}
+
+// turn a non-200 response into an api error
+func checkResponse(res *http.Response) error {
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return &APIError{StatusCode: res.StatusCode, Message: err.Error()}
+	}
+
+	var fr failResult
+	if err := json.Unmarshal(body, &fr); err != nil {
+		return &APIError{StatusCode: res.StatusCode, Message: string(body)}
+	}
+
+	msg := fr.Msg
+	if msg == "" {
+		msg = fr.Err
+	}
+
+	return &APIError{StatusCode: res.StatusCode, Code: fr.Code, Message: msg}
+}
+
+// check the response and decode the body into v
+func decodeResponse(res *http.Response, v any) error {
+	if err := checkResponse(res); err != nil {
+		return err
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,217 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	sk   = "e4aeceb313e4ea9f4ea5e756cf930b55ce5b14dc102955c75460b9f7e37db259"
+	addr = "0x0d2897e7e3ad18df4a0571a7bacb3ffe417d3b06"
+)
+
+func TestClientProcess(t *testing.T) {
+	fg := NewFakeGateway()
+	defer fg.Close()
+	fg.SetOrder(1, FakeOrder{User: addr, Status: 2, Duration: 3600})
+	fg.SetModels([]Model{{Name: "llama", GPU: "1"}})
+
+	ctx := context.Background()
+	c := NewClient(fg.URL)
+
+	// no session
+	if _, err := c.Show(ctx, 1); err != ErrNoSession {
+		t.Fatalf("expected no session error, got: %v", err)
+	}
+
+	s, err := c.SignIn(ctx, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.User != addr {
+		t.Fatalf("expected user %s, got %s", addr, s.User)
+	}
+
+	models, err := c.ModelList(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(models) != 1 || models[0].Name != "llama" {
+		t.Fatalf("unexpected model list: %v", models)
+	}
+
+	// show before deploy
+	_, err = c.Show(ctx, 1)
+	if !IsStatus(err, http.StatusBadRequest) {
+		t.Fatalf("expected bad request, got: %v", err)
+	}
+
+	if _, err := c.DeployByID(ctx, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := c.Show(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name == "" || !d.Available {
+		t.Fatalf("unexpected deployment: %+v", d)
+	}
+
+	// compute through the gateway
+	req, err := http.NewRequest("POST", "http://example/", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.Compute(ctx, 1, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "POST hello" {
+		t.Fatalf("unexpected compute response: %s", body)
+	}
+
+	ack, err := c.Extend(ctx, 1, sk, 100, DefaultExtendConfig(FakeMarket))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ack.Hash == "" {
+		t.Fatal("expected tx hash in ack")
+	}
+	o, _ := fg.Order(1)
+	if o.Duration != 3700 {
+		t.Fatalf("expected duration 3700, got %d", o.Duration)
+	}
+
+	ti, err := c.WaitTx(ctx, ack.Hash, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ti.Status != "mined" || ti.Name != "extend" || !strings.EqualFold(ti.Hash, ack.Hash) {
+		t.Fatalf("unexpected tx info: %+v", ti)
+	}
+	if _, err := c.GetTx(ctx, "0x"+strings.Repeat("00", 32)); !IsStatus(err, http.StatusNotFound) {
+		t.Fatalf("expected not found for unknown tx, got %v", err)
+	}
+
+	if _, err := c.Clean(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	o, _ = fg.Order(1)
+	if o.AppName != "" {
+		t.Fatal("app should be cleaned")
+	}
+
+	// unknown order
+	_, err = c.DeployByID(ctx, 9, 2)
+	if !IsStatus(err, http.StatusBadRequest) {
+		t.Fatalf("expected bad request, got: %v", err)
+	}
+
+	// order of another user
+	fg.SetOrder(2, FakeOrder{User: "0x0000000000000000000000000000000000000002", Status: 2, Duration: 3600})
+	if _, err := c.DeployByID(ctx, 2, 2); !IsStatus(err, http.StatusForbidden) {
+		t.Fatalf("expected forbidden, got: %v", err)
+	}
+	if _, err := c.DeployByURL(ctx, 2, "http://example/app.yaml"); !IsStatus(err, http.StatusForbidden) {
+		t.Fatalf("expected forbidden, got: %v", err)
+	}
+}
+
+func TestClientBadSignature(t *testing.T) {
+	fg := NewFakeGateway()
+	defer fg.Close()
+
+	c := NewClient(fg.URL)
+	_, err := c.SignInWithSig(context.Background(), addr, "1700000000", "0x1234")
+	if !IsStatus(err, http.StatusBadRequest) {
+		t.Fatalf("expected bad request, got: %v", err)
+	}
+	if c.Session() != nil {
+		t.Fatal("session should not be set")
+	}
+}
+
+func TestExtendSignedByOther(t *testing.T) {
+	fg := NewFakeGateway()
+	defer fg.Close()
+	fg.SetOrder(1, FakeOrder{User: addr, Status: 2, Duration: 3600})
+
+	ctx := context.Background()
+	c := NewClient(fg.URL)
+
+	// only the user of the order gets the tx
+	other, _ := crypto.GenerateKey()
+	if _, err := c.Extend(ctx, 1, hex.EncodeToString(crypto.FromECDSA(other)), 100, DefaultExtendConfig(FakeMarket)); !IsStatus(err, http.StatusForbidden) || !IsCode(err, "NOT_ORDER_USER") {
+		t.Fatalf("expected not order user, got: %v", err)
+	}
+
+	// the tx signed by another key is rejected
+	ut, err := c.BuildExtend(ctx, 1, addr, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultExtendConfig(FakeMarket)
+	signed, err := SignExtend(ut, other, 1, 100, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SendExtend(ctx, 1, signed); !IsStatus(err, http.StatusInternalServerError) {
+		t.Fatalf("expected renew failure, got: %v", err)
+	}
+
+	// never sign a tx for other order or duration
+	key, _ := crypto.HexToECDSA(sk)
+	if _, err := SignExtend(ut, key, 2, 100, cfg); err == nil {
+		t.Fatal("expected error signing a tx for other order")
+	}
+	if _, err := SignExtend(ut, key, 1, 1000, cfg); err == nil {
+		t.Fatal("expected error signing a tx for other duration")
+	}
+
+	// never sign a tx to other contract or beyond the gas bounds
+	if _, err := SignExtend(ut, key, 1, 100, DefaultExtendConfig(common.HexToAddress("0x01"))); err == nil {
+		t.Fatal("expected error signing a tx to other contract")
+	}
+	if _, err := SignExtend(ut, key, 1, 100, ExtendConfig{}); err == nil {
+		t.Fatal("expected error signing without the market")
+	}
+	if _, err := SignExtend(ut, key, 1, 100, ExtendConfig{Market: FakeMarket, MaxGas: 1000}); err == nil {
+		t.Fatal("expected error signing a tx beyond the gas limit")
+	}
+	if _, err := SignExtend(ut, key, 1, 100, ExtendConfig{Market: FakeMarket, MaxGasPrice: big.NewInt(0)}); err == nil {
+		t.Fatal("expected error signing a tx beyond the gas price")
+	}
+
+	// the signed tx is for order 1 only
+	signed, _ = SignExtend(ut, key, 1, 100, cfg)
+	fg.SetOrder(2, FakeOrder{User: addr, Status: 2})
+	if _, err := c.SendExtend(ctx, 2, signed); !IsStatus(err, http.StatusInternalServerError) {
+		t.Fatalf("expected renew failure, got: %v", err)
+	}
+	if _, err := c.SendExtend(ctx, 1, signed); err != nil {
+		t.Fatal(err)
+	}
+
+	// inactive order
+	fg.SetOrder(3, FakeOrder{User: addr, Status: 1})
+	if _, err := c.Extend(ctx, 3, sk, 100, DefaultExtendConfig(FakeMarket)); !IsStatus(err, http.StatusConflict) || !IsCode(err, "ORDER_NOT_ACTIVE") {
+		t.Fatalf("expected order not active, got: %v", err)
+	}
+
+	o, _ := fg.Order(1)
+	if o.Duration != 3700 {
+		t.Fatalf("expected duration 3700, got %d", o.Duration)
+	}
+}
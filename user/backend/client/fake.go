@@ -0,0 +1,497 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gin-gonic/gin"
+
+	"github.com/gridprotocol/computing-api/computing/model"
+	"github.com/gridprotocol/computing-api/lib/auth"
+	"github.com/gridprotocol/computing-api/lib/utils"
+)
+
+var (
+	// market address and chain id in the txs built by the fake gateway
+	FakeMarket  = common.HexToAddress("0x000000000000000000000000000000000000fa4e")
+	FakeChainID = big.NewInt(1337)
+)
+
+// order kept in the fake gateway, status is the same as the market contract:
+// 0 not exist, 1 unactive, 2 active, 3 cancelled, 4 completed
+type FakeOrder struct {
+	User     string
+	Status   uint8
+	AppName  string
+	Duration uint64
+}
+
+// FakeGateway is an in-process gateway for tests, it serves the same routes
+// as the computing gateway with orders kept in memory instead of contract.
+type FakeGateway struct {
+	*httptest.Server
+
+	// handle the compute requests forwarded by the fake gateway, echo the request if nil
+	Backend http.Handler
+
+	mu      sync.RWMutex
+	signKey []byte
+	expire  time.Duration
+	orders  map[uint64]*FakeOrder
+	models  []Model
+	// txs sent, they are mined at once
+	txs map[string]*TxInfo
+}
+
+// start a fake gateway, close it after use
+func NewFakeGateway() *FakeGateway {
+	fg := &FakeGateway{
+		signKey: []byte("fake-gateway"),
+		expire:  time.Hour,
+		orders:  make(map[uint64]*FakeOrder),
+		txs:     make(map[string]*TxInfo),
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.GET("/greet/cookie", fg.handlerCookie)
+	r.GET("/greet/deployurl", fg.handlerDeployUrl)
+	r.GET("/greet/deployid", fg.handlerDeployID)
+	r.GET("/greet/extend", fg.handlerExtend)
+	r.POST("/greet/extend", fg.handlerExtendSend)
+	r.GET("/tx/:hash", fg.handlerTx)
+	r.GET("/greet/clean", fg.handlerClean)
+	r.GET("/greet/show", fg.handlerShow)
+	r.GET("/greet/modellist", fg.handlerModelList)
+	r.Any("/", fg.handlerCompute)
+
+	fg.Server = httptest.NewServer(r)
+
+	return fg
+}
+
+// add or replace an order
+func (fg *FakeGateway) SetOrder(id uint64, o FakeOrder) {
+	fg.mu.Lock()
+	defer fg.mu.Unlock()
+	fg.orders[id] = &o
+}
+
+// get a copy of an order
+func (fg *FakeGateway) Order(id uint64) (FakeOrder, bool) {
+	fg.mu.RLock()
+	defer fg.mu.RUnlock()
+	o, ok := fg.orders[id]
+	if !ok {
+		return FakeOrder{}, false
+	}
+	return *o, true
+}
+
+// set the model list responsed by the fake gateway
+func (fg *FakeGateway) SetModels(models []Model) {
+	fg.mu.Lock()
+	defer fg.mu.Unlock()
+	fg.models = models
+}
+
+// set the expire of the cookies made afterwards
+func (fg *FakeGateway) SetCookieExpire(expire time.Duration) {
+	fg.mu.Lock()
+	defer fg.mu.Unlock()
+	fg.expire = expire
+}
+
+func (fg *FakeGateway) handlerCookie(c *gin.Context) {
+	user := c.Query("user")
+	ts := c.Query("ts")
+	sig := c.Query("sig")
+
+	if len(ts) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] missing timestamp in request"})
+		return
+	}
+	if len(sig) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] missing signature in request"})
+		return
+	}
+	if !verifySig(user, ts, sig) {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] Failed to verify your signature"})
+		return
+	}
+
+	fg.mu.RLock()
+	expire := time.Now().Add(fg.expire)
+	fg.mu.RUnlock()
+
+	ets := strconv.FormatInt(expire.Unix(), 10)
+	token, _ := auth.SignToken(user+ets, fg.signKey)
+	cookie := &http.Cookie{
+		Name:  cookiePrefix + user,
+		Value: ets + "_" + token,
+	}
+	c.SetCookie(cookie.Name, cookie.Value, 0, "", "", false, false)
+
+	c.JSON(http.StatusOK, gin.H{
+		"msg":    "[ACK] user authorized",
+		"cookie": cookie.String(),
+	})
+}
+
+func (fg *FakeGateway) handlerDeployUrl(c *gin.Context) {
+	user, ok := fg.checkCookie(c)
+	if !ok {
+		return
+	}
+
+	if len(c.Query("url")) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] missing yaml url in request"})
+		return
+	}
+	if _, ok := fg.deployOrder(c, user); !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"msg": "[ACK] deploy from url ok"})
+}
+
+func (fg *FakeGateway) handlerDeployID(c *gin.Context) {
+	yamlID := c.Query("id")
+	if len(yamlID) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] missing yaml id in request"})
+		return
+	}
+
+	user, ok := fg.checkCookie(c)
+	if !ok {
+		return
+	}
+
+	o, ok := fg.deployOrder(c, user)
+	if !ok {
+		return
+	}
+
+	fg.mu.Lock()
+	o.AppName = fmt.Sprintf("app-%s-%s", yamlID, strings.ToLower(user))
+	fg.mu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{"msg": "[ACK] deploy ok"})
+}
+
+func (fg *FakeGateway) handlerClean(c *gin.Context) {
+	oid, _ := utils.StringToUint64(c.Query("oid"))
+
+	if _, ok := fg.checkCookie(c); !ok {
+		return
+	}
+
+	o, ok := fg.getOrder(c, oid)
+	if !ok {
+		return
+	}
+
+	fg.mu.Lock()
+	o.AppName = ""
+	fg.mu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{"msg": "[ACK] clean ok"})
+}
+
+func (fg *FakeGateway) handlerShow(c *gin.Context) {
+	oid, _ := utils.StringToUint64(c.Query("oid"))
+
+	if _, ok := fg.checkCookie(c); !ok {
+		return
+	}
+
+	o, ok := fg.getOrder(c, oid)
+	if !ok {
+		return
+	}
+
+	fg.mu.RLock()
+	name := o.AppName
+	fg.mu.RUnlock()
+
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] no app deployed for this order"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deployment": name, "available": true, "progressing": true})
+}
+
+func (fg *FakeGateway) handlerExtend(c *gin.Context) {
+	oid, _ := utils.StringToUint64(c.Query("oid"))
+
+	o, ok := fg.getOrder(c, oid)
+	if !ok {
+		return
+	}
+
+	user := c.Query("user")
+	dur, err := utils.StringToUint64(c.Query("dur"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] invalid duration: " + c.Query("dur")})
+		return
+	}
+
+	fg.mu.RLock()
+	defer fg.mu.RUnlock()
+	if o.Status != 2 {
+		c.JSON(http.StatusConflict, gin.H{"msg": "[Error] only activated order can be renewed", "code": "ORDER_NOT_ACTIVE"})
+		return
+	}
+	if !strings.EqualFold(o.User, user) {
+		c.JSON(http.StatusForbidden, gin.H{"msg": "[Fail] only the user of the order can renew it", "code": "NOT_ORDER_USER"})
+		return
+	}
+
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce:    0,
+		GasPrice: big.NewInt(1),
+		Gas:      100000,
+		To:       &FakeMarket,
+		Data:     ExtendCallData(oid, dur),
+	})
+	raw, _ := tx.MarshalBinary()
+
+	c.JSON(http.StatusOK, model.UnsignedTx{
+		Msg:      "[ACK] sign the tx and post it to /greet/extend",
+		Tx:       hexutil.Encode(raw),
+		ChainID:  FakeChainID.String(),
+		From:     common.HexToAddress(user).Hex(),
+		To:       FakeMarket.Hex(),
+		Gas:      tx.Gas(),
+		GasPrice: tx.GasPrice().String(),
+		Data:     hexutil.Encode(tx.Data()),
+	})
+}
+
+func (fg *FakeGateway) handlerExtendSend(c *gin.Context) {
+	oid, _ := utils.StringToUint64(c.Query("oid"))
+
+	o, ok := fg.getOrder(c, oid)
+	if !ok {
+		return
+	}
+
+	var req model.SignedTx
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] invalid request body: " + err.Error()})
+		return
+	}
+
+	fail := func(err string) {
+		c.JSON(http.StatusInternalServerError, gin.H{"msg": "[Fail] Failed to renew: " + err})
+	}
+
+	raw, err := hexutil.Decode(req.Tx)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		fail(err.Error())
+		return
+	}
+
+	// same checks as the gateway: market address, chain, method and order id, signer
+	data := tx.Data()
+	if tx.To() == nil || *tx.To() != FakeMarket || !tx.Protected() || tx.ChainId().Cmp(FakeChainID) != 0 ||
+		len(data) != 68 || !bytes.Equal(data[:36], ExtendCallData(oid, 0)[:36]) {
+		fail("not an extend tx of this order")
+		return
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(FakeChainID), tx)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	fg.mu.Lock()
+	defer fg.mu.Unlock()
+	if o.Status != 2 {
+		c.JSON(http.StatusConflict, gin.H{"msg": "[Error] only activated order can be renewed", "code": "ORDER_NOT_ACTIVE"})
+		return
+	}
+	if !strings.EqualFold(o.User, sender.Hex()) {
+		fail(fmt.Sprintf("tx signer %s is not the user of order %d", sender, oid))
+		return
+	}
+	o.Duration += new(big.Int).SetBytes(data[36:]).Uint64()
+
+	hash := tx.Hash().Hex()
+	fg.txs[strings.ToLower(hash)] = &TxInfo{
+		ID:      hash,
+		Name:    "extend",
+		From:    sender.Hex(),
+		Nonce:   tx.Nonce(),
+		Hashes:  []string{hash},
+		Status:  "mined",
+		Hash:    hash,
+		Block:   1,
+		GasUsed: tx.Gas(),
+	}
+
+	c.JSON(http.StatusOK, gin.H{"msg": "[ACK] renew tx sent, query it with /tx/" + hash, "hash": hash})
+}
+
+func (fg *FakeGateway) handlerTx(c *gin.Context) {
+	fg.mu.RLock()
+	defer fg.mu.RUnlock()
+
+	ti, ok := fg.txs[strings.ToLower(c.Param("hash"))]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"msg": "[Fail] tx is not sent by the gateway: " + c.Param("hash")})
+		return
+	}
+
+	res := *ti
+	res.Msg = "[ACK] tx is " + ti.Status
+	c.JSON(http.StatusOK, res)
+}
+
+func (fg *FakeGateway) handlerModelList(c *gin.Context) {
+	fg.mu.RLock()
+	defer fg.mu.RUnlock()
+
+	models := fg.models
+	if models == nil {
+		models = []Model{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"models": models})
+}
+
+func (fg *FakeGateway) handlerCompute(c *gin.Context) {
+	oid, _ := utils.StringToUint64(c.Query("id"))
+
+	if _, ok := fg.checkCookie(c); !ok {
+		return
+	}
+
+	o, ok := fg.getOrder(c, oid)
+	if !ok {
+		return
+	}
+
+	fg.mu.RLock()
+	status, name := o.Status, o.AppName
+	fg.mu.RUnlock()
+
+	if status != 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] order not active"})
+		return
+	}
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] have not deployed before"})
+		return
+	}
+
+	if fg.Backend != nil {
+		fg.Backend.ServeHTTP(c.Writer, c.Request)
+		return
+	}
+
+	// echo the method and body by default
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(c.Request.Body)
+	c.String(http.StatusOK, "%s %s", c.Request.Method, buf.String())
+}
+
+// find a valid cookie, response an error if not found
+func (fg *FakeGateway) checkCookie(c *gin.Context) (string, bool) {
+	for _, ck := range c.Request.Cookies() {
+		if !strings.HasPrefix(ck.Name, cookiePrefix) {
+			continue
+		}
+		user := ck.Name[len(cookiePrefix):]
+
+		parts := strings.SplitN(ck.Value, "_", 2)
+		if len(parts) != 2 {
+			break
+		}
+		ts, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			break
+		}
+		if auth.VerifyToken(user+parts[0], parts[1], fg.signKey) != nil {
+			break
+		}
+		if !time.Now().Before(time.Unix(ts, 0)) {
+			break
+		}
+
+		return user, true
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{"err": "[Fail] invalid cookie: no valid cookie found"})
+	return "", false
+}
+
+// get an order, response an error if not found
+func (fg *FakeGateway) getOrder(c *gin.Context, id uint64) (*FakeOrder, bool) {
+	fg.mu.RLock()
+	defer fg.mu.RUnlock()
+
+	o, ok := fg.orders[id]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] get order info from contract failed: order not exist"})
+		return nil, false
+	}
+	return o, true
+}
+
+// the order in query to deploy for, only its user can deploy for it
+func (fg *FakeGateway) deployOrder(c *gin.Context, user string) (*FakeOrder, bool) {
+	oid, err := utils.StringToUint64(c.Query("oid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "[Fail] missing or invalid order id in request"})
+		return nil, false
+	}
+
+	o, ok := fg.getOrder(c, oid)
+	if !ok {
+		return nil, false
+	}
+
+	fg.mu.RLock()
+	defer fg.mu.RUnlock()
+	if !strings.EqualFold(o.User, user) {
+		c.JSON(http.StatusForbidden, gin.H{"msg": "[Fail] only the user of the order can deploy for it", "code": "NOT_ORDER_USER"})
+		return nil, false
+	}
+	return o, true
+}
+
+// check the eth signature of ts, 'cheat' is always passed like the gateway
+func verifySig(user, ts, sig string) bool {
+	if ts == "cheat" {
+		return true
+	}
+
+	sigByte, err := auth.HexDecode(sig)
+	if err != nil {
+		return false
+	}
+	addrByte, err := auth.HexDecode(user)
+	if err != nil {
+		return false
+	}
+
+	hash := auth.Hash([]byte(auth.EncloseEth(ts)))
+	return bytes.Equal(addrByte, auth.SigToAddress(hash, sigByte))
+}
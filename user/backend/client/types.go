@@ -0,0 +1,120 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	// no cookie got from the gateway yet
+	ErrNoSession = errors.New("no session for the gateway, sign in first")
+	// the cookie got from the gateway is expired
+	ErrSessionExpired = errors.New("the session is expired, sign in again")
+)
+
+// error responsed by the gateway, with the http status and the message in body.
+// code is set for a chain failure, e.g. ORDER_NOT_ACTIVE, INSUFFICIENT_BALANCE.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("gateway responsed [%d] %s: %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("gateway responsed [%d]: %s", e.StatusCode, e.Message)
+}
+
+// check if an error is an api error with the given http status
+func IsStatus(err error, status int) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == status
+	}
+	return false
+}
+
+// check if an error is an api error with the given code
+func IsCode(err error, code string) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == code
+	}
+	return false
+}
+
+// session of a user on a gateway, made from the cookie
+type Session struct {
+	User    string
+	Cookie  *http.Cookie
+	Expires time.Time
+}
+
+// check if the session is expired
+func (s *Session) Expired() bool {
+	return !time.Now().Before(s.Expires)
+}
+
+// acknowledge message of the gateway
+type Ack struct {
+	Msg string `json:"msg"`
+}
+
+// acknowledge of the gateway for a sent tx
+type TxAck struct {
+	Msg  string `json:"msg"`
+	Hash string `json:"hash"`
+}
+
+// status of a tx sent by the gateway, status is pending, mined, failed or dropped.
+// id is the hash of the first submission, hash is the mined one of its replacements.
+type TxInfo struct {
+	Msg     string         `json:"msg"`
+	ID      string         `json:"id"`
+	Name    string         `json:"name"`
+	From    string         `json:"from"`
+	Nonce   uint64         `json:"nonce"`
+	Hashes  []string       `json:"hashes"`
+	Status  string         `json:"status"`
+	Hash    string         `json:"hash"`
+	Block   uint64         `json:"block"`
+	GasUsed uint64         `json:"gasUsed"`
+	Receipt *types.Receipt `json:"receipt"`
+	Reason  string         `json:"reason"`
+	Code    string         `json:"code"`
+	Err     string         `json:"err"`
+}
+
+// check if the tx is mined, reverted or dropped
+func (ti *TxInfo) Final() bool {
+	return ti.Status != "pending"
+}
+
+// status of an app deployed for an order
+type Deployment struct {
+	Name        string `json:"deployment"`
+	Available   bool   `json:"available"`
+	Progressing bool   `json:"progressing"`
+}
+
+// model supported by the gateway
+type Model struct {
+	Name string `json:"name"`
+	Desc string `json:"desc"`
+	GPU  string `json:"gpu"`
+	MEM  string `json:"mem"`
+	DISK string `json:"disk"`
+}
+
+// the failure body of the gateway, message is in 'msg' or 'err'
+type failResult struct {
+	Msg  string `json:"msg"`
+	Err  string `json:"err"`
+	Code string `json:"code"`
+}
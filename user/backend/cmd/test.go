@@ -6,27 +6,45 @@ import (
 	"log"
 	"net/http"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/grid/contracts/eth"
+	"github.com/grid/contracts/eth/contracts"
 	"github.com/gridprotocol/computing-api/user/backend/chain"
 	"github.com/gridprotocol/computing-api/user/backend/computing"
+	"github.com/gridprotocol/computing-api/user/backend/provider"
 )
 
+// grpc address of the gateway for test
+const grpcUrl = "localhost:12345"
+
 // test computing interface: greet and process
 func quickTest() {
+	// loading contracts on local chain
+	l := contracts.Local{}
+	l.Load()
+
 	comP := computing.NewComputingProcessor()
-	chainP := chain.NewChainProcessor()
+	chainP := chain.NewChainProcessor(eth.Ganache, chain.Contracts{
+		Market:   common.HexToAddress(l.Market),
+		Credit:   common.HexToAddress(l.Credit),
+		Registry: common.HexToAddress(l.Registry),
+	})
 
 	// chain test
 	err := chainP.FetchList()
 	if err != nil {
 		log.Fatal(err)
 	}
-	if len(chainP.CurrentList) == 0 {
+	nodes := chainP.Query(provider.Filter{})
+	if len(nodes) == 0 {
 		log.Fatal("no available node")
 	}
-	url := chainP.CurrentList[0]
+	for _, n := range nodes {
+		log.Printf("[Node] provider: %s, id: %d, endpoint: %s, online: %v, price: %s\n", n.Provider, n.ID, n.Endpoint, n.Online, n.PriceSec())
+	}
 
 	// grpc test
-	err = comP.NewClient(url)
+	err = comP.NewClient(grpcUrl)
 	if err != nil {
 		log.Fatal(err)
 	}
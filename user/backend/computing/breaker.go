@@ -0,0 +1,123 @@
+package computing
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// calls are rejected while the breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open for this gateway")
+
+type breakerState int
+
+const (
+	// calls are allowed
+	stateClosed breakerState = iota
+	// calls are rejected until the cooldown is over
+	stateOpen
+	// one trial call is allowed after the cooldown
+	stateHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case stateClosed:
+		return "closed"
+	case stateOpen:
+		return "open"
+	case stateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// breaker opens after threshold consecutive failures, and allows a trial call after cooldown
+type breaker struct {
+	mu        sync.Mutex
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+	threshold int
+	cooldown  time.Duration
+	// trial call in flight when half open
+	trial bool
+
+	now func() time.Time
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// check if a call is allowed
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case stateOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = stateHalfOpen
+		b.trial = true
+		return nil
+	case stateHalfOpen:
+		// only one trial call at a time
+		if b.trial {
+			return ErrCircuitOpen
+		}
+		b.trial = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// record the result of an allowed call
+func (b *breaker) done(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if success {
+		b.state = stateClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == stateHalfOpen || b.failures >= b.threshold {
+		b.state = stateOpen
+		b.openedAt = b.now()
+	}
+}
+
+// record a failure found out of the calls, it's counted only when the breaker is closed,
+// so the cooldown of an open one and the trial of a half open one are kept
+func (b *breaker) trip() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != stateClosed {
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.state = stateOpen
+		b.openedAt = b.now()
+	}
+}
+
+func (b *breaker) current() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
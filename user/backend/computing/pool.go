@@ -0,0 +1,391 @@
+package computing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gridprotocol/computing-api/computing/proto"
+	"github.com/gridprotocol/computing-api/lib/logc"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+var logger = logc.Logger("computing")
+
+var ErrPoolClosed = errors.New("client pool is closed")
+
+// a pooled connection to the gateway of a provider
+type poolEntry struct {
+	target string
+	conn   *grpc.ClientConn
+	client proto.ComputeServiceClient
+	br     *breaker
+
+	// guarded by pool mu
+	lastUsed time.Time
+	// calls in flight, never evicted while using
+	inUse int
+}
+
+// Pool keeps one lazily dialed connection for each gateway endpoint, closes the idle ones
+// and watches their health, calls to an endpoint failing repeatedly are rejected by its breaker.
+type Pool struct {
+	// timeout for connecting to a gateway
+	dialTO    time.Duration
+	greetTO   time.Duration
+	processTO time.Duration
+	// idle connections are closed after it
+	idleTO time.Duration
+	// interval of health checking and eviction
+	checkInterval time.Duration
+	// breaker settings for each endpoint
+	failThreshold int
+	cooldown      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*poolEntry
+	closed  bool
+
+	stop chan struct{}
+	done chan struct{}
+	// for testing
+	now func() time.Time
+}
+
+func NewPool() *Pool {
+	p := &Pool{
+		dialTO:        10 * time.Second,
+		greetTO:       time.Minute,
+		processTO:     time.Minute,
+		idleTO:        10 * time.Minute,
+		checkInterval: 30 * time.Second,
+		failThreshold: 5,
+		cooldown:      30 * time.Second,
+		entries:       make(map[string]*poolEntry),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+		now:           time.Now,
+	}
+	go p.run()
+	return p
+}
+
+// set the timeout of connecting, greet and process calls
+func (p *Pool) SetTimeout(dial, greet, process time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dialTO = dial
+	p.greetTO = greet
+	p.processTO = process
+}
+
+// set the idle time before a connection is closed
+func (p *Pool) SetIdleTimeout(to time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.idleTO = to
+}
+
+// set the failures to open the breaker of an endpoint, and the cooldown before a trial call,
+// it applies to the endpoints dialed later
+func (p *Pool) SetBreaker(threshold int, cooldown time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failThreshold = threshold
+	p.cooldown = cooldown
+}
+
+// get a ready client for the gateway at target, dial it at first use
+func (p *Pool) Get(ctx context.Context, target string) (*VirtualClient, error) {
+	e, err := p.entry(target)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := e.br.allow(); err != nil {
+		return nil, fmt.Errorf("get client of %s failed: %w", target, err)
+	}
+
+	p.mu.Lock()
+	dialTO := p.dialTO
+	p.mu.Unlock()
+
+	// wait the connection to be ready
+	dctx, cancel := context.WithTimeout(ctx, dialTO)
+	defer cancel()
+	if err := waitReady(dctx, e.conn); err != nil {
+		e.br.done(false)
+		return nil, fmt.Errorf("connect to %s failed: %s", target, err.Error())
+	}
+	e.br.done(true)
+
+	return &VirtualClient{pool: p, target: target}, nil
+}
+
+// get or create the entry of target
+func (p *Pool) entry(target string) (*poolEntry, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.entryLocked(target)
+}
+
+// get or create the entry of target with the pool mu held
+func (p *Pool) entryLocked(target string) (*poolEntry, error) {
+	if p.closed {
+		return nil, ErrPoolClosed
+	}
+
+	e, ok := p.entries[target]
+	if ok && e.conn.GetState() != connectivity.Shutdown {
+		e.lastUsed = p.now()
+		return e, nil
+	}
+
+	// not connected until first call
+	conn, err := grpc.Dial(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("dial %s failed: %s", target, err.Error())
+	}
+
+	br := newBreaker(p.failThreshold, p.cooldown)
+	if ok {
+		// keep the breaker state of the endpoint
+		br = e.br
+	}
+
+	e = &poolEntry{
+		target:   target,
+		conn:     conn,
+		client:   proto.NewComputeServiceClient(conn),
+		br:       br,
+		lastUsed: p.now(),
+	}
+	p.entries[target] = e
+	logger.Debug("new connection to gateway: ", target)
+
+	return e, nil
+}
+
+// wait until the connection is ready or ctx is done
+func waitReady(ctx context.Context, conn *grpc.ClientConn) error {
+	for {
+		s := conn.GetState()
+		switch s {
+		case connectivity.Ready:
+			return nil
+		case connectivity.Idle:
+			conn.Connect()
+		case connectivity.Shutdown:
+			return fmt.Errorf("connection is closed")
+		}
+		if !conn.WaitForStateChange(ctx, s) {
+			return fmt.Errorf("connection is %s: %s", s, ctx.Err())
+		}
+	}
+}
+
+// the endpoints in pool
+func (p *Pool) Targets() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	res := make([]string, 0, len(p.entries))
+	for t := range p.entries {
+		res = append(res, t)
+	}
+	return res
+}
+
+// remove the connection of target
+func (p *Pool) Remove(target string) error {
+	p.mu.Lock()
+	e, ok := p.entries[target]
+	delete(p.entries, target)
+	p.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return e.conn.Close()
+}
+
+// stop the background checking and close all connections
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	entries := p.entries
+	p.entries = make(map[string]*poolEntry)
+	p.mu.Unlock()
+
+	close(p.stop)
+	<-p.done
+
+	var err error
+	for _, e := range entries {
+		if cerr := e.conn.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// check health and evict idle connections periodly
+func (p *Pool) run() {
+	defer close(p.done)
+
+	for {
+		p.mu.Lock()
+		interval := p.checkInterval
+		p.mu.Unlock()
+
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(interval):
+			p.check()
+		}
+	}
+}
+
+// close the idle connections, and reconnect the failed ones in background
+func (p *Pool) check() {
+	p.mu.Lock()
+	now := p.now()
+	var idle []*poolEntry
+	for t, e := range p.entries {
+		if e.inUse == 0 && now.Sub(e.lastUsed) > p.idleTO {
+			delete(p.entries, t)
+			idle = append(idle, e)
+			continue
+		}
+
+		switch e.conn.GetState() {
+		case connectivity.TransientFailure:
+			// counted as a failure, so the breaker opens for a dead gateway
+			logger.Debug("gateway is unhealthy: ", t)
+			e.br.trip()
+		case connectivity.Shutdown:
+			delete(p.entries, t)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, e := range idle {
+		logger.Debug("close idle connection: ", e.target)
+		e.conn.Close()
+	}
+}
+
+// get the entry of target and mark it in use for a call, it's dialed again if it was
+// evicted or closed since the client was got
+func (p *Pool) acquire(target string) (*poolEntry, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e, err := p.entryLocked(target)
+	if err != nil {
+		return nil, err
+	}
+	e.inUse++
+	return e, nil
+}
+
+func (p *Pool) release(e *poolEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e.inUse--
+	e.lastUsed = p.now()
+}
+
+func (p *Pool) timeouts() (time.Duration, time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.greetTO, p.processTO
+}
+
+// VirtualClient is a client of one gateway sharing the pooled connection,
+// the connection is looked up in pool at each call
+type VirtualClient struct {
+	pool   *Pool
+	target string
+}
+
+// the endpoint of the gateway
+func (vc *VirtualClient) Target() string {
+	return vc.target
+}
+
+func (vc *VirtualClient) Greet(msgType int32, input string, opts map[string]string) (string, error) {
+	greetTO, _ := vc.pool.timeouts()
+	ctx, cancel := context.WithTimeout(context.Background(), greetTO)
+	defer cancel()
+
+	var res *proto.GreetFromServer
+	err := vc.call(func(client proto.ComputeServiceClient) error {
+		var err error
+		res, err = client.Greet(ctx, &proto.GreetFromClient{Input: input, MsgType: msgType, Opts: opts})
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return res.GetResult(), nil
+}
+
+func (vc *VirtualClient) Process(address string, apikey string, httpReq []byte) ([]byte, error) {
+	_, processTO := vc.pool.timeouts()
+	ctx, cancel := context.WithTimeout(context.Background(), processTO)
+	defer cancel()
+
+	var res *proto.Response
+	err := vc.call(func(client proto.ComputeServiceClient) error {
+		var err error
+		res, err = client.Process(ctx, &proto.Request{ApiKey: apikey, Address: address, Request: httpReq})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.GetResponse(), nil
+}
+
+// run a call through the breaker of the endpoint
+func (vc *VirtualClient) call(f func(proto.ComputeServiceClient) error) error {
+	e, err := vc.pool.acquire(vc.target)
+	if err != nil {
+		return err
+	}
+	defer vc.pool.release(e)
+
+	if err := e.br.allow(); err != nil {
+		return fmt.Errorf("call %s failed: %w", vc.target, err)
+	}
+
+	err = f(e.client)
+	e.br.done(!isGatewayFailure(err))
+	return err
+}
+
+// errors of the gateway itself, not caused by the request
+func isGatewayFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.ResourceExhausted:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,262 @@
+package computing
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gridprotocol/computing-api/computing/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeServer struct {
+	proto.UnimplementedComputeServiceServer
+}
+
+func (fs *fakeServer) Greet(ctx context.Context, req *proto.GreetFromClient) (*proto.GreetFromServer, error) {
+	switch req.GetInput() {
+	case "slow":
+		<-ctx.Done()
+		return nil, ctx.Err()
+	case "bad":
+		return nil, status.Error(codes.InvalidArgument, "bad input")
+	}
+	return &proto.GreetFromServer{Result: "hello " + req.GetInput()}, nil
+}
+
+func (fs *fakeServer) Process(ctx context.Context, req *proto.Request) (*proto.Response, error) {
+	return &proto.Response{Response: req.GetRequest()}, nil
+}
+
+func startServer(t *testing.T) (string, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	proto.RegisterComputeServiceServer(s, &fakeServer{})
+	go s.Serve(lis)
+	return lis.Addr().String(), s.Stop
+}
+
+func TestPoolGet(t *testing.T) {
+	addr, stop := startServer(t)
+	defer stop()
+
+	p := NewPool()
+	defer p.Close()
+
+	vc, err := p.Get(context.Background(), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := vc.Greet(0, "grid", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "hello grid" {
+		t.Fatalf("unexpected greet result: %s", res)
+	}
+	body, err := vc.Process("0x1", "", []byte("req"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "req" {
+		t.Fatalf("unexpected process result: %s", body)
+	}
+
+	// connection is shared
+	vc2, err := p.Get(context.Background(), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vc2.Target() != vc.Target() || len(p.Targets()) != 1 {
+		t.Fatal("expected one pooled connection")
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Get(context.Background(), addr); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("expected pool closed error, got %v", err)
+	}
+}
+
+func TestPoolIdle(t *testing.T) {
+	addr, stop := startServer(t)
+	defer stop()
+
+	now := time.Now()
+	p := NewPool()
+	defer p.Close()
+	p.now = func() time.Time { return now }
+	p.SetIdleTimeout(time.Minute)
+
+	held, err := p.Get(context.Background(), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(30 * time.Second)
+	p.check()
+	if len(p.Targets()) != 1 {
+		t.Fatal("connection should not be evicted before idle timeout")
+	}
+
+	now = now.Add(2 * time.Minute)
+	p.check()
+	if len(p.Targets()) != 0 {
+		t.Fatal("idle connection should be evicted")
+	}
+
+	// a held client dials again at next call
+	if _, err := held.Greet(0, "held", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Targets()) != 1 {
+		t.Fatal("expected the connection dialed again")
+	}
+	now = now.Add(2 * time.Minute)
+	p.check()
+
+	// dial again at next use
+	vc, err := p.Get(context.Background(), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vc.Greet(0, "again", nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolBreaker(t *testing.T) {
+	addr, stop := startServer(t)
+	defer stop()
+
+	p := NewPool()
+	defer p.Close()
+	p.SetTimeout(time.Second, 50*time.Millisecond, time.Second)
+	p.SetBreaker(2, time.Hour)
+
+	vc, err := p.Get(context.Background(), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// errors caused by the request don't count
+	for i := 0; i < 3; i++ {
+		if _, err := vc.Greet(0, "bad", nil); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("expected invalid argument, got %v", err)
+		}
+	}
+
+	// deadline of each call
+	for i := 0; i < 2; i++ {
+		if _, err := vc.Greet(0, "slow", nil); status.Code(err) != codes.DeadlineExceeded {
+			t.Fatalf("expected deadline exceeded, got %v", err)
+		}
+	}
+
+	if _, err := vc.Greet(0, "grid", nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected circuit open, got %v", err)
+	}
+	if _, err := p.Get(context.Background(), addr); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected circuit open, got %v", err)
+	}
+}
+
+func TestPoolUnreachable(t *testing.T) {
+	// nothing listens on it
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	p := NewPool()
+	defer p.Close()
+	p.SetTimeout(200*time.Millisecond, time.Second, time.Second)
+	p.SetBreaker(1, time.Hour)
+
+	if _, err := p.Get(context.Background(), addr); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected connect error, got %v", err)
+	}
+	if _, err := p.Get(context.Background(), addr); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected circuit open, got %v", err)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := newBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	b.done(false)
+	if b.current() != stateClosed {
+		t.Fatal("breaker should be closed under threshold")
+	}
+	b.done(false)
+	if b.allow() != ErrCircuitOpen {
+		t.Fatal("breaker should be open")
+	}
+
+	// one trial after cooldown
+	now = now.Add(2 * time.Minute)
+	if err := b.allow(); err != nil {
+		t.Fatal(err)
+	}
+	if b.allow() != ErrCircuitOpen {
+		t.Fatal("only one trial call is allowed when half open")
+	}
+
+	// trial failed
+	b.done(false)
+	if b.current() != stateOpen {
+		t.Fatal("failed trial should open the breaker")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if err := b.allow(); err != nil {
+		t.Fatal(err)
+	}
+	b.done(true)
+	if b.current() != stateClosed {
+		t.Fatal("succeeded trial should close the breaker")
+	}
+}
+
+func TestBreakerTrip(t *testing.T) {
+	now := time.Now()
+	b := newBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	b.trip()
+	b.trip()
+	if b.current() != stateOpen {
+		t.Fatal("breaker should be open by the failed checks")
+	}
+
+	// failed checks while open don't extend the cooldown
+	now = now.Add(40 * time.Second)
+	b.trip()
+	now = now.Add(40 * time.Second)
+	if err := b.allow(); err != nil {
+		t.Fatalf("cooldown should be over, got %v", err)
+	}
+
+	// nor end the trial in flight
+	b.trip()
+	if b.current() != stateHalfOpen || b.allow() != ErrCircuitOpen {
+		t.Fatal("only one trial call is allowed when half open")
+	}
+	b.done(true)
+	if b.current() != stateClosed {
+		t.Fatal("succeeded trial should close the breaker")
+	}
+}
@@ -21,6 +21,8 @@ var (
 	// rpc server address
 	addr     = flag.String("addr", "localhost:12345", "remote address of the server")
 	contract = "0xd46e8dd67c5d32be8058bb8eb970870f07244567"
+	// order of the user, the contract address stands for the user here
+	order = flag.String("oid", "1", "id of the order to be authorized for")
 	// account  = "0x683642c22feDE752415D4793832Ab75EFdF6223c"
 	//entrance = "baidu.com"
 )
@@ -54,7 +56,7 @@ func main() {
 
 		// 2. check payee and apply for authority
 		fmt.Println("Greet 1")
-		res2, err := c.Greet(ctx, &proto.GreetFromClient{Input: contract, MsgType: 1})
+		res2, err := c.Greet(ctx, &proto.GreetFromClient{Input: contract, Opts: map[string]string{"address": contract, "oid": *order}, MsgType: 1})
 		if err != nil {
 			log.Fatalf("fail to greet: %v", err)
 		}
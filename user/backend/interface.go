@@ -1,5 +1,7 @@
 package backend
 
+import "github.com/grid/contracts/go/market"
+
 type UserBackendAPI interface {
 	BackendToChainAPI
 }
@@ -7,15 +9,21 @@ type UserBackendAPI interface {
 // Platform / User client
 type BackendToChainAPI interface {
 	FetchList() error
-	CreateLease() error
-	ShowLease() error
-	StopLease() error
+	// create an order for a node and activate it, return the order id
+	CreateLease(provider string, nodeID uint64, prob uint64, dur uint64) (uint64, error)
+	ShowLease(id uint64) (*market.IMarketOrder, error)
+	StopLease(id uint64) error
 }
 
 // User client (platform should not do the forwarding)
 type BackendToComputingAPI interface {
 	NewClient(targetURL string) error
 	CloseClient() error
+	ComputingClient
+}
+
+// calls to the gateway of a provider, implemented by the pooled virtual client
+type ComputingClient interface {
 	Greet(msgType int32, input string, opts map[string]string) (string, error)
 	Process(address string, apikey string, httpReq []byte) ([]byte, error)
 }
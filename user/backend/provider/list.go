@@ -0,0 +1,142 @@
+package provider
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gridprotocol/computing-api/lib/logc"
+)
+
+var logger = logc.Logger("provider")
+
+// Fetcher reads all providers and their nodes, such as from the registry contract
+type Fetcher interface {
+	FetchProviders(ctx context.Context) ([]Provider, error)
+}
+
+// filter for querying nodes, zero value means no limit
+type Filter struct {
+	MinCpu  uint64
+	MinGpu  uint64
+	MinMem  uint64
+	MinDisk uint64
+	// skip the nodes whose provider is offline
+	OnlineOnly bool
+}
+
+// check if a node meets the filter
+func (f Filter) match(p *Provider, n *Node) bool {
+	if f.OnlineOnly && !p.Online {
+		return false
+	}
+	return n.Cpu.Num >= f.MinCpu &&
+		n.Gpu.Num >= f.MinGpu &&
+		n.Mem.Num >= f.MinMem &&
+		n.Disk.Num >= f.MinDisk
+}
+
+// List caches the providers, and is refreshed periodly
+type List struct {
+	mu        sync.RWMutex
+	providers []Provider
+	updated   time.Time
+}
+
+func NewList() *List {
+	return &List{}
+}
+
+// replace all providers in cache
+func (l *List) Set(providers []Provider) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.providers = providers
+	l.updated = time.Now()
+}
+
+// get all providers in cache
+func (l *List) Providers() []Provider {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	res := make([]Provider, len(l.providers))
+	copy(res, l.providers)
+	return res
+}
+
+// get a provider by address
+func (l *List) Get(addr string) (Provider, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, p := range l.providers {
+		if p.Address == addr {
+			return p, true
+		}
+	}
+	return Provider{}, false
+}
+
+// the last time the cache is refreshed
+func (l *List) Updated() time.Time {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.updated
+}
+
+// get the nodes meet the filter, sorted by price per second from low to high
+func (l *List) Query(f Filter) []Entry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	res := make([]Entry, 0)
+	for i := range l.providers {
+		p := &l.providers[i]
+		for j := range p.Nodes {
+			n := &p.Nodes[j]
+			if !f.match(p, n) {
+				continue
+			}
+			res = append(res, Entry{
+				Provider: p.Address,
+				Endpoint: p.Endpoint,
+				Online:   p.Online,
+				Node:     *n,
+			})
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].PriceSec().Cmp(res[j].PriceSec()) < 0
+	})
+
+	return res
+}
+
+// fetch once and update the cache
+func (l *List) Refresh(ctx context.Context, f Fetcher) error {
+	providers, err := f.FetchProviders(ctx)
+	if err != nil {
+		return err
+	}
+	l.Set(providers)
+	return nil
+}
+
+// refresh the cache every interval until ctx is done, the old cache is kept on failure
+func (l *List) Run(ctx context.Context, f Fetcher, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := l.Refresh(ctx, f); err != nil {
+			logger.Error("refresh provider list failed: ", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
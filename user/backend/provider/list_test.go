@@ -0,0 +1,118 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gridprotocol/computing-api/user/backend/client"
+)
+
+type fakeFetcher struct {
+	calls     atomic.Int64
+	providers []Provider
+	fail      bool
+}
+
+func (ff *fakeFetcher) FetchProviders(ctx context.Context) ([]Provider, error) {
+	ff.calls.Add(1)
+	if ff.fail {
+		return nil, fmt.Errorf("fetch failed")
+	}
+	return ff.providers, nil
+}
+
+func node(id, gpu, mem uint64, gpuPrice int64) Node {
+	return Node{
+		ID:   id,
+		Cpu:  Resource{Num: 4, PriceSec: big.NewInt(1)},
+		Gpu:  Resource{Num: gpu, PriceSec: big.NewInt(gpuPrice)},
+		Mem:  Resource{Num: mem, PriceSec: big.NewInt(1)},
+		Disk: Resource{Num: 10, PriceSec: big.NewInt(1)},
+	}
+}
+
+func TestQuery(t *testing.T) {
+	l := NewList()
+	l.Set([]Provider{
+		{Address: "0x1", Online: true, Nodes: []Node{node(1, 1, 16, 100), node(2, 2, 32, 50)}},
+		{Address: "0x2", Online: false, Nodes: []Node{node(1, 4, 64, 10)}},
+	})
+
+	// price: cpu + gpu + mem*num + disk*num
+	if p := node(1, 1, 16, 100).PriceSec(); p.Int64() != 1+100+16+10 {
+		t.Fatalf("unexpected price: %s", p)
+	}
+
+	all := l.Query(Filter{})
+	if len(all) != 3 {
+		t.Fatalf("expected 3 nodes, got %d", len(all))
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i-1].PriceSec().Cmp(all[i].PriceSec()) > 0 {
+			t.Fatal("nodes are not sorted by price")
+		}
+	}
+
+	res := l.Query(Filter{MinGpu: 2, MinMem: 32})
+	if len(res) != 2 || res[0].Provider != "0x2" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	res = l.Query(Filter{MinGpu: 2, OnlineOnly: true})
+	if len(res) != 1 || res[0].Provider != "0x1" || res[0].ID != 2 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+}
+
+func TestRun(t *testing.T) {
+	ff := &fakeFetcher{providers: []Provider{{Address: "0x1"}}}
+	l := NewList()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		l.Run(ctx, ff, 10*time.Millisecond)
+		close(done)
+	}()
+
+	time.Sleep(55 * time.Millisecond)
+	cancel()
+	<-done
+
+	if ff.calls.Load() < 3 {
+		t.Fatalf("expected periodic refresh, got %d calls", ff.calls.Load())
+	}
+	if _, ok := l.Get("0x1"); !ok {
+		t.Fatal("provider should be cached")
+	}
+
+	// keep the old cache on failure
+	ff.fail = true
+	if err := l.Refresh(context.Background(), ff); err == nil {
+		t.Fatal("expected refresh error")
+	}
+	if len(l.Providers()) != 1 {
+		t.Fatal("old cache should be kept")
+	}
+}
+
+func TestProbe(t *testing.T) {
+	fg := client.NewFakeGateway()
+	defer fg.Close()
+
+	p := &Provider{Endpoint: fg.URL}
+	Probe(context.Background(), p, time.Second)
+	if !p.Online {
+		t.Fatal("provider should be online")
+	}
+
+	fg.Close()
+	Probe(context.Background(), p, time.Second)
+	if p.Online {
+		t.Fatal("provider should be offline")
+	}
+}
@@ -0,0 +1,73 @@
+package provider
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/gridprotocol/computing-api/user/backend/client"
+)
+
+// resource of a node, price is in wei per second for each unit
+type Resource struct {
+	Num      uint64
+	PriceSec *big.Int
+}
+
+// a node registered by a provider
+type Node struct {
+	ID   uint64
+	Cpu  Resource
+	Gpu  Resource
+	Mem  Resource
+	Disk Resource
+}
+
+// the total price per second of the node, the same as the gateway calculating an order fee
+func (n Node) PriceSec() *big.Int {
+	vmem := new(big.Int).Mul(new(big.Int).SetUint64(n.Mem.Num), price(n.Mem))
+	vdisk := new(big.Int).Mul(new(big.Int).SetUint64(n.Disk.Num), price(n.Disk))
+
+	total := new(big.Int).Add(price(n.Cpu), price(n.Gpu))
+	total.Add(total, vmem)
+	total.Add(total, vdisk)
+
+	return total
+}
+
+// a provider registered in the registry contract
+type Provider struct {
+	Address  string
+	Endpoint string // http endpoint of the gateway
+	Nodes    []Node
+	Online   bool
+}
+
+// a node with its provider, used for showing the market
+type Entry struct {
+	Provider string
+	Endpoint string
+	Online   bool
+	Node
+}
+
+// probe the gateway of a provider and set its online status
+func Probe(ctx context.Context, p *Provider, timeout time.Duration) {
+	if p.Endpoint == "" {
+		p.Online = false
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err := client.NewClient(p.Endpoint).ModelList(ctx)
+	p.Online = err == nil
+}
+
+func price(r Resource) *big.Int {
+	if r.PriceSec == nil {
+		return new(big.Int)
+	}
+	return r.PriceSec
+}
@@ -1,18 +1,40 @@
 package service
 
-import "github.com/gridprotocol/computing-api/user/backend"
+import (
+	"context"
+
+	"github.com/gridprotocol/computing-api/user/backend"
+	"github.com/gridprotocol/computing-api/user/backend/computing"
+)
 
 type CoreService struct {
 	backend.BackendToChainAPI
-	// ? cache pool?
-	pool []backend.BackendToComputingAPI
+	// pooled connections to the gateways, keyed by endpoint
+	pool *computing.Pool
 }
 
 func NewCoreService(chain backend.BackendToChainAPI) *CoreService {
 	return &CoreService{
 		BackendToChainAPI: chain,
-		pool:              make([]backend.BackendToComputingAPI, 0),
+		pool:              computing.NewPool(),
+	}
+}
+
+// get a ready client for the gateway of a provider, addr is the grpc endpoint of it
+func (cs *CoreService) GetVirtualClient(addr string) (backend.ComputingClient, error) {
+	vc, err := cs.pool.Get(context.Background(), addr)
+	if err != nil {
+		return nil, err
 	}
+	return vc, nil
 }
 
-func (cs *CoreService) GetVirtualClient(addr string) {}
+// the pool for setting timeouts and breakers
+func (cs *CoreService) Pool() *computing.Pool {
+	return cs.pool
+}
+
+// close all connections to the gateways
+func (cs *CoreService) Close() error {
+	return cs.pool.Close()
+}